@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const altHeading = "#### Another way to look at it"
+
+const altInstruction = "\n\nRight after EVERY concept's main explanation, add a subsection headed exactly \"" + altHeading +
+	"\" that explains the same concept a second, genuinely different way: another analogy, another angle or representation, " +
+	"or a worked example where the main explanation is abstract. Don't reuse the main explanation's wording or examples."
+
+var altHeadingRe = regexp.MustCompile(`(?im)^[ \t]*(?:#{2,6}[ \t]*|\*\*)[ \t]*another way to look at it\b[^\n]*$`)
+
+// isAltHeading reports whether a heading opens an alternate explanation.
+func isAltHeading(text string) bool {
+	return altHeadingRe.MatchString(text)
+}
+
+// findAlt locates the alternate explanation of a concept section; start is
+// -1 when it has none.
+func findAlt(section string) (start, end int) {
+	loc := altHeadingRe.FindStringIndex(section)
+	if loc == nil {
+		return -1, -1
+	}
+	end = len(section)
+	if next := anyHeadingRe.FindStringIndex(section[loc[1]:]); next != nil {
+		end = loc[1] + next[0]
+	}
+	return loc[0], end
+}
+
+// ensureAltExplanations makes sure every concept of j has an alternate
+// explanation. With --alt-model all of them come from that model, otherwise
+// the ones the answer skipped are asked for again. It returns the updated
+// content and, aligned with j.items, which concepts have one.
+func ensureAltExplanations(j chunk, content string) (string, []bool) {
+	preamble, sections := splitSections(content, chunkNumbers(j.items))
+	if len(sections) == 0 {
+		return content, nil
+	}
+
+	model := j.model
+	if cfg.AltModel != "" {
+		model = cfg.AltModel
+	}
+	var missing []conceptSection
+	for _, s := range sections {
+		if start, _ := findAlt(s.Text); start < 0 {
+			missing = append(missing, s)
+		}
+	}
+	var added map[string]string
+	if len(missing) > 0 {
+		if cfg.AltModel == "" {
+			nums := make([]string, len(missing))
+			for i, s := range missing {
+				nums[i] = s.Number
+			}
+			retryf("   Chunk %d skipped the alternate explanation for concept(s) %s, asking again...\n", j.id+1, strings.Join(nums, ", "))
+		}
+		var err error
+		if added, err = requestAltExplanations(missing, model); err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating alternate explanations for chunk %d: %v\n", j.id+1, err)
+		}
+	}
+
+	has := make([]bool, len(j.items))
+	var parts []string
+	if preamble != "" {
+		parts = append(parts, preamble)
+	}
+	for _, s := range sections {
+		text := s.Text
+		if alt := added[s.Number]; alt != "" {
+			text = insertAlt(text, altHeading+"\n\n"+alt)
+		}
+		if start, _ := findAlt(text); start >= 0 {
+			for k, it := range j.items {
+				if conceptNumber(it) == s.Number {
+					has[k] = true
+				}
+			}
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, "\n\n"), has
+}
+
+// insertAlt puts an alternate explanation after the main one: before the
+// misconceptions subsection when there is one, else at the end.
+func insertAlt(section, block string) string {
+	if start, _, _ := findMisconceptions(section); start >= 0 {
+		return strings.TrimSpace(section[:start]) + "\n\n" + block + "\n\n" + section[start:]
+	}
+	return strings.TrimSpace(section) + "\n\n" + block
+}
+
+// requestAltExplanations asks for a second explanation of each section,
+// keyed by concept number. The model sees the first one so it can avoid it.
+func requestAltExplanations(sections []conceptSection, model string) (map[string]string, error) {
+	texts := make([]string, len(sections))
+	for i, s := range sections {
+		texts[i] = s.Text
+	}
+	prompt := fmt.Sprintf(
+		"Here are explanations of concepts from a study guide:\n\n%s\n\n"+
+			"For EACH concept, write a second explanation that makes it click a different way: another analogy, another angle or representation, "+
+			"or a worked example where the explanation above is abstract. Don't reuse its wording or examples.\n\n"+
+			"Start each concept with a line \"=== CONCEPT <number> ===\" followed by the new explanation, without a heading. Do not add any other text.",
+		strings.Join(texts, "\n\n"),
+	)
+	resp, err := callAIWith(callOptions{Model: model, Temperature: defaultTemperature, Purpose: "alt-explanations"}, prompt, cfg.SystemPrompt)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]string{}
+	for num, body := range parseConceptBlocks(resp) {
+		if body = strings.TrimSpace(altHeadingRe.ReplaceAllString(body, "")); body != "" {
+			out[num] = body
+		}
+	}
+	return out, nil
+}
+
+// chooseExplanation keeps the explanations --explanation asks exports for:
+// both, only the main one, or the alternate one in place of the main one
+// where a concept has one.
+func chooseExplanation(md, which string) string {
+	if which == "both" || which == "" {
+		return md
+	}
+	_, concepts := guideConcepts(parseMarkdown(md))
+	for i := len(concepts) - 1; i >= 0; i-- {
+		n, err := strconv.Atoi(conceptNumber(concepts[i].Title))
+		if err != nil {
+			continue
+		}
+		start, end, ok := guideSection(md, n)
+		if !ok {
+			continue
+		}
+		sec := md[start:end]
+		as, ae := findAlt(sec)
+		if as < 0 {
+			continue
+		}
+		rest := "\n\n" + strings.TrimLeft(sec[ae:], "\n")
+		if which == "main" {
+			sec = strings.TrimSpace(sec[:as]) + rest
+		} else {
+			alt := altHeadingRe.ReplaceAllString(sec[as:ae], "")
+			sec = sectionLead(sec[:as]) + "\n\n" + strings.TrimSpace(alt) + rest
+		}
+		md = md[:start] + sec + md[end:]
+	}
+	return md
+}
+
+// sectionLead is a section's heading and the label lines under it.
+func sectionLead(section string) string {
+	lines := strings.Split(section, "\n")
+	n := 1
+	for n < len(lines) && (strings.TrimSpace(lines[n]) == "" || labelLineRe.MatchString(strings.TrimSpace(lines[n]))) {
+		n++
+	}
+	return strings.TrimSpace(strings.Join(lines[:n], "\n"))
+}
+
+// readGuide reads a guide for an exporter, with the explanations
+// --explanation picks.
+func readGuide(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(chooseExplanation(string(b), cfg.Explanation)), nil
+}
+
+func checkExplanation() error {
+	switch cfg.Explanation {
+	case "both", "main", "alt":
+		return nil
+	}
+	return fmt.Errorf("invalid --explanation %q (expected both, main or alt)", cfg.Explanation)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// analogyInstruction asks for an optional analogy per concept from the
+// --analogy-domain, labelled so styleAnalogies can find it.
+func analogyInstruction(domain string) string {
+	return fmt.Sprintf("\n\nANALOGIES: The reader knows %[1]s well. For a concept where it genuinely helps understanding, "+
+		"add after its explanation one short paragraph that starts exactly with \"**Analogy (%[1]s):**\" and maps the concept onto %[1]s. "+
+		"The technical explanation stays primary and complete without it. Skip the analogy for any concept where it would be forced "+
+		"or misleading; most concepts having none is fine.", domain)
+}
+
+var analogyLabelRe = regexp.MustCompile(`(?i)^(?:>[ \t]*)*\*\*analogy\b`)
+
+// styleAnalogies sets each labelled analogy paragraph of content off as a
+// blockquote. It returns the updated content and, aligned with j.items,
+// which concepts have an analogy.
+func styleAnalogies(j chunk, content string) (string, []bool) {
+	_, sections := splitSections(content, chunkNumbers(j.items))
+	if len(sections) == 0 {
+		return content, nil
+	}
+	has := map[string]bool{}
+	texts := map[string]string{}
+	for _, s := range sections {
+		lines := strings.Split(s.Text, "\n")
+		inFence, inAnalogy := false, false
+		for i, l := range lines {
+			t := strings.TrimSpace(l)
+			switch {
+			case strings.HasPrefix(t, "```"):
+				inFence, inAnalogy = !inFence, false
+			case inFence:
+			case t == "":
+				inAnalogy = false
+			case analogyLabelRe.MatchString(t):
+				inAnalogy, has[s.Number] = true, true
+				fallthrough
+			case inAnalogy:
+				if !strings.HasPrefix(t, ">") {
+					lines[i] = "> " + t
+				}
+			}
+		}
+		texts[s.Number] = strings.Join(lines, "\n")
+	}
+	found := make([]bool, len(j.items))
+	for k, it := range j.items {
+		found[k] = has[conceptNumber(it)]
+	}
+	return replaceSections(content, j.items, texts), found
+}
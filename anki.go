@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+)
+
+// ankiInstruction keeps answers apart: each one is the back of a card that
+// is reviewed alone and in random order.
+const ankiInstruction = "\n\nFLASHCARDS: Each concept's answer becomes the back of its own flashcard, reviewed on its own and in random order. " +
+	"Keep every answer self-contained: never refer to other concepts or sections (no \"as mentioned above\" or \"see concept 3\"), " +
+	"and start each answer with its own numbered heading."
+
+// writeAnkiHeader writes the file headers Anki's importer reads, so the
+// separator and the HTML fields need no import settings.
+func writeAnkiHeader(w io.Writer) {
+	fmt.Fprint(w, "#separator:tab\n#html:true\n#columns:Front\tBack\n")
+}
+
+// ankiField escapes text for a tab-separated HTML field.
+func ankiField(s string) string {
+	s = html.EscapeString(strings.TrimSpace(s))
+	s = strings.ReplaceAll(s, "\t", "    ")
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "<br>")
+}
+
+// writeAnkiCards writes one card per concept of j: the concept without its
+// number on the front, its section without the heading on the back. A
+// concept with no answer, whose section can't be found, is empty or is
+// marked MISSING, gets no card rather than one with a blank back.
+func writeAnkiCards(w io.Writer, j chunk, content string) {
+	_, sections := splitSections(content, chunkNumbers(j.items))
+	backs := make(map[string]string, len(sections))
+	for _, s := range sections {
+		_, body, _ := strings.Cut(s.Text, "\n")
+		backs[s.Number] = body
+	}
+	var skipped []string
+	for _, it := range j.items {
+		back := strings.TrimSpace(backs[conceptNumber(it)])
+		if back == "" || back == missingPlaceholder {
+			skipped = append(skipped, conceptNumber(it))
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\n", ankiField(conceptPrefixRe.ReplaceAllString(it, "")), ankiField(back))
+	}
+	if skipped != nil {
+		fmt.Fprintf(os.Stderr, "Warning: no answer for concept(s) %s; they have no card.\n", strings.Join(skipped, ", "))
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteAnkiCards(t *testing.T) {
+	j := chunk{items: []string{"1. Channels", "2. Select", "3. Mutexes", "4. Atomics"}}
+	content := "## 1. Channels\n\nChannels connect\tgoroutines.\n\nUse `<-ch`.\n\n" +
+		"## 2. Select\n\n\n\n" +
+		missingSection("3. Mutexes")
+	var buf bytes.Buffer
+	stderr := captureStderr(t, func() { writeAnkiCards(&buf, j, content) })
+	if want := "Channels\tChannels connect    goroutines.<br><br>Use `&lt;-ch`.\n"; buf.String() != want {
+		t.Errorf("cards:\n%q\nwant\n%q", buf.String(), want)
+	}
+	// The empty, MISSING and absent answers get no card.
+	if !strings.Contains(stderr, "concept(s) 2, 3, 4; they have no card") {
+		t.Errorf("stderr:\n%s", stderr)
+	}
+}
+
+func TestWriteAnkiCardsFailedChunk(t *testing.T) {
+	j := chunk{items: []string{"5. Goroutines", "6. WaitGroups"}}
+	var buf bytes.Buffer
+	captureStderr(t, func() { writeAnkiCards(&buf, j, missingSections(j.items)) })
+	if buf.Len() != 0 {
+		t.Errorf("a failed chunk wrote cards:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"github.com/yuriiter/aiguide/pkg/guide"
+)
+
+// answerRequest is one line of "aiguide answer --ndjson" input.
+type answerRequest struct {
+	ID       string `json:"id"`
+	Question string `json:"question"`
+}
+
+// answerResult is one line of its output. Exactly one of AnswerMarkdown and
+// Error is set.
+type answerResult struct {
+	ID             string `json:"id"`
+	Question       string `json:"question"`
+	AnswerMarkdown string `json:"answer_markdown,omitempty"`
+	Error          string `json:"error,omitempty"`
+	Tokens         int    `json:"tokens"`
+}
+
+// answerJob is a request, or the error a malformed input line produced.
+type answerJob struct {
+	line int
+	req  answerRequest
+	err  error
+}
+
+// answerNDJSON answers the questions read from in, one JSON object per
+// line, and writes each result to out as soon as it is ready. Input is read
+// as it arrives; at most 2*cfg.Threads questions are read ahead of the
+// answers, so a fast producer can't pile up work.
+func answerNDJSON(in io.Reader, out io.Writer) {
+	jobs := make(chan answerJob, cfg.Threads)
+	var outMu sync.Mutex
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	// Encode writes each line in one unbuffered write, so every result
+	// reaches the reader as soon as it is done.
+	emit := func(r answerResult) {
+		outMu.Lock()
+		defer outMu.Unlock()
+		if err := enc.Encode(r); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing result: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if j.err != nil {
+					emit(answerResult{ID: j.req.ID, Question: j.req.Question, Error: fmt.Sprintf("line %d: %v", j.line, j.err)})
+					continue
+				}
+				emit(answerQuestion(j.req))
+			}
+		}()
+	}
+
+	r := bufio.NewReader(in)
+	for n := 1; ; n++ {
+		line, err := r.ReadString('\n')
+		if strings.TrimSpace(line) != "" {
+			jobs <- parseAnswerLine(n, line)
+		}
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			}
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func parseAnswerLine(n int, line string) answerJob {
+	j := answerJob{line: n}
+	if err := json.Unmarshal([]byte(line), &j.req); err != nil {
+		j.err = fmt.Errorf("invalid JSON: %v", err)
+		return j
+	}
+	if strings.TrimSpace(j.req.Question) == "" {
+		j.err = errors.New(`missing "question"`)
+	}
+	return j
+}
+
+func answerQuestion(req answerRequest) answerResult {
+	prompt := fmt.Sprintf(
+		"Here is a question:\n%s\n\n"+
+			"Provide a detailed explanation based on the system prompt instructions.",
+		req.Question,
+	)
+	content, u, err := gen.AnswerChunk(runCtx, guide.Chunk{Prompt: prompt, System: cfg.SystemPrompt, Model: cfg.Model, Label: "The question"})
+	err = interrupted(err)
+
+	res := answerResult{ID: req.ID, Question: req.Question, Tokens: u.TotalTokens}
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.AnswerMarkdown = content
+	}
+	return res
+}
+
+func newAnswerCmd() *cobra.Command {
+	var ndjson bool
+	cmd := &cobra.Command{
+		Use:   "answer --ndjson",
+		Short: "Answer questions from stdin, one JSON object per line, for pipelines",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if !ndjson {
+				fmt.Fprintln(os.Stderr, "Error: answer needs --ndjson (the only supported format).")
+				os.Exit(1)
+			}
+			if cfg.Threads < 1 {
+				fmt.Fprintln(os.Stderr, "Error: --threads must be at least 1.")
+				os.Exit(1)
+			}
+			if cfg.SystemPromptPath == "-" {
+				fmt.Fprintln(os.Stderr, "Error: answer reads questions from stdin, so --system-prompt cannot be -.")
+				os.Exit(1)
+			}
+			if err := loadEnv(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			cfg.SystemPrompt = modes["guide"].systemPrompt
+			if cfg.SystemPromptPath != "" {
+				prompt, err := loadSystemPrompt(cfg.SystemPromptPath)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				cfg.SystemPrompt = prompt
+			}
+			info, err := additionalInstructions(cfg.Info)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			cfg.SystemPrompt += info
+			answerNDJSON(os.Stdin, os.Stdout)
+			usage.writeSummary(os.Stderr, cfg.Model)
+		},
+	}
+	cmd.Flags().BoolVar(&ndjson, "ndjson", false, "Read {\"id\", \"question\"} objects and write one result object per line")
+	cmd.Flags().StringVarP(&cfg.Provider, "provider", "p", "", "Named provider profile from the config file")
+	cmd.Flags().StringVarP(&cfg.Model, "model", "m", "", "Model to use (overrides OPENAI_MODEL)")
+	cmd.Flags().IntVarP(&cfg.Threads, "threads", "t", 1, "Number of questions answered concurrently")
+	cmd.Flags().StringVarP(&cfg.SystemPromptPath, "system-prompt", "s", "", "Custom system prompt: a file path, an http(s) URL or - for stdin")
+	cmd.Flags().StringArrayVarP(&cfg.Info, "info", "i", nil, "Additional instructions or context to append to system prompt, or @file to read them from a file (repeatable)")
+	return cmd
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// JudgeChoice records which candidate won a concept. Winner is the 1-based
+// candidate index; Scores are in candidate order (0 for failed candidates).
+type JudgeChoice struct {
+	Concept string    `json:"concept"`
+	Winner  int       `json:"winner"`
+	Scores  []float64 `json:"scores,omitempty"`
+}
+
+func candidateTemperature(k int) float64 {
+	t := defaultTemperature + 0.15*float64(k)
+	if t > 1.2 {
+		t = 1.2
+	}
+	return t
+}
+
+// bestOfChunk generates cfg.BestOf candidates for a chunk in parallel, asks a
+// judge to score each concept's answers and assembles the chunk from the
+// per-concept winners.
+func bestOfChunk(j chunk, prompt string) (string, []JudgeChoice, error) {
+	n := cfg.BestOf
+	candidates := make([]string, n)
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for k := 0; k < n; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			seed := k + 1
+			opts := callOptions{Model: j.model, Temperature: candidateTemperature(k), Seed: &seed, Purpose: "candidate"}
+			content, err := callAIWith(opts, prompt, cfg.SystemPrompt)
+			candidates[k] = cleanChunkContent(content)
+			if fixed, err := renumberSections(j, candidates[k]); err == nil {
+				candidates[k] = fixed
+			}
+			errs[k] = err
+		}(k)
+	}
+	wg.Wait()
+
+	var ok []int
+	for k := range candidates {
+		if errs[k] == nil && candidates[k] != "" {
+			ok = append(ok, k)
+		}
+	}
+	switch len(ok) {
+	case 0:
+		return "", nil, errs[0]
+	case 1:
+		return candidates[ok[0]], nil, nil
+	}
+
+	numbers := chunkNumbers(j.items)
+	split := make([]map[string]string, n)
+	for _, k := range ok {
+		_, sections := splitSections(candidates[k], numbers)
+		split[k] = make(map[string]string, len(sections))
+		for _, s := range sections {
+			split[k][s.Number] = s.Text
+		}
+	}
+
+	scores, err := judgeCandidates(j, numbers, ok, split)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: judge failed for chunk %d, keeping first candidate: %v\n", j.id+1, err)
+		return candidates[ok[0]], nil, nil
+	}
+
+	var parts []string
+	choices := make([]JudgeChoice, 0, len(numbers))
+	for _, num := range numbers {
+		winner := -1
+		for _, k := range ok {
+			if split[k][num] == "" {
+				continue
+			}
+			// Strictly greater keeps the first candidate on ties.
+			if winner < 0 || scores[num][k] > scores[num][winner] {
+				winner = k
+			}
+		}
+		if winner < 0 {
+			continue
+		}
+		parts = append(parts, split[winner][num])
+		choices = append(choices, JudgeChoice{Concept: num, Winner: winner + 1, Scores: scores[num]})
+	}
+
+	if len(parts) == 0 {
+		return candidates[ok[0]], nil, nil
+	}
+	return strings.Join(parts, "\n\n"), choices, nil
+}
+
+// judgeCandidates returns, per concept number, a score for every candidate
+// slot. Concepts or candidates the judge leaves out score 0.
+func judgeCandidates(j chunk, numbers []string, ok []int, split []map[string]string) (map[string][]float64, error) {
+	var b strings.Builder
+	for i, num := range numbers {
+		fmt.Fprintf(&b, "=== CONCEPT %s: %s ===\n\n", num, j.items[i])
+		for slot, k := range ok {
+			text := split[k][num]
+			if text == "" {
+				text = "(no answer)"
+			}
+			fmt.Fprintf(&b, "--- Candidate %d ---\n%s\n\n", slot+1, text)
+		}
+	}
+	fmt.Fprintf(&b, "Score every candidate for every concept from 1 to 10. "+
+		"Respond ONLY with a JSON object mapping each concept number to an array of %d scores in candidate order, "+
+		"e.g. {\"%s\": [7, 9]}.", len(ok), numbers[0])
+
+	sys := "You are a strict reviewer of study-guide answers. Judge accuracy, clarity and completeness, " +
+		"and how well each answer follows these authoring instructions:\n\n" + cfg.SystemPrompt
+
+	resp, err := callAIWith(callOptions{Model: cfg.Model, Temperature: 0, Purpose: "judge"}, b.String(), sys)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := strings.Index(resp, "{"), strings.LastIndex(resp, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("judge response is not JSON")
+	}
+	var raw map[string][]float64
+	if err := json.Unmarshal([]byte(resp[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("parsing judge response: %w", err)
+	}
+
+	scores := make(map[string][]float64, len(numbers))
+	for _, num := range numbers {
+		row := make([]float64, len(split))
+		for slot, k := range ok {
+			if slot < len(raw[num]) {
+				row[k] = raw[num][slot]
+			}
+		}
+		scores[num] = row
+	}
+	return scores, nil
+}
+
+// writeBestOfSummary reports how many tokens best-of generation cost compared
+// with a single pass, judged calls included.
+func writeBestOfSummary(w io.Writer) {
+	candidate := usage.purposeTokens("candidate")
+	judge := usage.purposeTokens("judge")
+	if candidate == 0 {
+		return
+	}
+	single := float64(candidate) / float64(cfg.BestOf)
+	fmt.Fprintf(w, "-> Best-of-%d: %d candidate + %d judge tokens, ≈ %.1fx the answer tokens of a single pass\n",
+		cfg.BestOf, candidate, judge, float64(candidate+judge)/single)
+}
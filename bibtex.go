@@ -0,0 +1,438 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	bibYearRe        = regexp.MustCompile(`\b(1[5-9]\d{2}|20\d{2})[a-z]?\b`)
+	bibDOIRe         = regexp.MustCompile(`(?i)(?:\bdoi:\s*)?\b(10\.\d{4,9}/[^\s"<>]+)`)
+	bibRFCRe         = regexp.MustCompile(`(?i)\bRFC\s*(\d{1,5})\b`)
+	bibQuotedRe      = regexp.MustCompile(`["“]([^"”]{3,})["”]`)
+	bibItalicRe      = regexp.MustCompile(`(?:\*([^*]{3,})\*|_([^_]{3,})_)`)
+	bibAPATitleRe    = regexp.MustCompile(`\(\s*(?:1[5-9]\d{2}|20\d{2})[a-z]?\s*\)\.?\s*((?:[Vv]ol\.|[^.])+)`)
+	bibAuthorRe      = regexp.MustCompile(`([A-Z][\p{L}'’-]+),\s+((?:[A-Z]\.\s?)+)`)
+	bibBulletRe      = regexp.MustCompile(`^\s*[-*]\s+(.+)$`)
+	bibKeyWordRe     = regexp.MustCompile(`[a-z0-9]+`)
+	bibNamesRe       = regexp.MustCompile(`^\p{Lu}[\p{L}'’.-]*(?:\s+\p{Lu}[\p{L}'’.-]*)*(?:\s+(?:&|and|et al\.?)\s*(?:\p{Lu}[\p{L}'’.-]*(?:\s+\p{Lu}[\p{L}'’.-]*)*)?)?$`)
+	bibPagesRe       = regexp.MustCompile(`\b(?:pp?\.\s*)?(\d+)\s*[–-]{1,2}\s*(\d+)\b`)
+	bibVolumeRe      = regexp.MustCompile(`(?i)(?:\bvol(?:ume)?\.?\s*|\s)(\d+)\s*(?:,\s*no\.\s*(\d+)|\((\d+)\))`)
+	bibEmptyParensRe = regexp.MustCompile(`\(\s*\)`)
+	bibJournalRe     = regexp.MustCompile(`(?i)\b(?:journal|transactions|communications of|review|letters|magazine)\b`)
+	bibProcRe        = regexp.MustCompile(`(?i)\b(?:proceedings|conference|symposium|workshop)\b`)
+	bibBookRe        = regexp.MustCompile(`(?i)\b(?:press|publishing|publishers|books|edition|ed\.|addison-wesley|o'reilly|wiley|springer|prentice hall|mit press|manning|no starch)\b`)
+)
+
+var bibStopWords = map[string]bool{"a": true, "an": true, "the": true, "on": true, "of": true, "in": true, "and": true, "to": true, "for": true}
+
+// bibEntry is one reference. Fields are kept in BibTeX order for output.
+type bibEntry struct {
+	Type   string
+	Key    string
+	Fields [][2]string
+	refs   []string // the reference texts merged into the entry
+}
+
+func (e *bibEntry) get(name string) string {
+	for _, f := range e.Fields {
+		if f[0] == name {
+			return f[1]
+		}
+	}
+	return ""
+}
+
+func (e *bibEntry) set(name, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	for i, f := range e.Fields {
+		if f[0] == name {
+			e.Fields[i][1] = value
+			return
+		}
+	}
+	e.Fields = append(e.Fields, [2]string{name, value})
+}
+
+func (e *bibEntry) unset(name string) {
+	e.Fields = slices.DeleteFunc(e.Fields, func(f [2]string) bool { return f[0] == name })
+}
+
+// guideReferences collects the reference texts of a guide: footnote and
+// citation definitions anywhere, and the entries of References, Sources and
+// Further reading lists.
+func guideReferences(md string) []string {
+	var refs []string
+	inFence, inRefs := false, false
+	for _, line := range strings.Split(md, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+		if inFence {
+			continue
+		}
+		if referencesHeadRe.MatchString(trimmed) {
+			inRefs = true
+			continue
+		}
+		if m := citationDefRe.FindStringSubmatch(line); m != nil {
+			refs = append(refs, m[3])
+			continue
+		}
+		if !inRefs {
+			continue
+		}
+		if m := citationListRe.FindStringSubmatch(line); m != nil {
+			refs = append(refs, m[3])
+		} else if m := bibBulletRe.FindStringSubmatch(line); m != nil {
+			refs = append(refs, m[1])
+		} else if trimmed != "" {
+			inRefs = false
+		}
+	}
+	return refs
+}
+
+// parseReference turns the free-form reference a model wrote into a BibTeX
+// entry, inferring the type from what it mentions. Entries that lack the
+// fields their type needs become @misc with a note.
+func parseReference(text string) *bibEntry {
+	e := &bibEntry{}
+	rest := text
+	if m := httpLinkRe.FindStringSubmatch(rest); m != nil {
+		e.set("title", m[1])
+		e.set("url", trimLinkPunct(m[2]))
+		rest = strings.Replace(rest, m[0], " ", 1)
+	} else if u := bareLinkRe.FindString(rest); u != "" {
+		e.set("url", trimLinkPunct(u))
+		rest = strings.Replace(rest, u, " ", 1)
+	}
+	if m := bibDOIRe.FindStringSubmatch(rest); m != nil {
+		e.set("doi", strings.TrimRight(m[1], ".,;"))
+		rest = strings.Replace(rest, m[0], " ", 1)
+	}
+	year := ""
+	if m := bibYearRe.FindStringSubmatch(rest); m != nil {
+		year = m[1]
+	}
+
+	// Title: quoted, then italic, then APA's "(Year). Title.", then whatever
+	// follows an RFC number.
+	titleStart := -1
+	if e.get("title") == "" {
+		if loc := bibQuotedRe.FindStringSubmatchIndex(rest); loc != nil {
+			e.set("title", rest[loc[2]:loc[3]])
+			titleStart = loc[0]
+		} else if loc := bibItalicRe.FindStringSubmatchIndex(rest); loc != nil {
+			if loc[2] >= 0 {
+				e.set("title", rest[loc[2]:loc[3]])
+			} else {
+				e.set("title", rest[loc[4]:loc[5]])
+			}
+			titleStart = loc[0]
+		} else if loc := bibAPATitleRe.FindStringSubmatchIndex(rest); loc != nil {
+			e.set("title", rest[loc[2]:loc[3]])
+			titleStart = loc[0]
+		}
+	}
+	rfc := bibRFCRe.FindStringSubmatch(rest)
+	if e.get("title") == "" && rfc != nil {
+		after := strings.TrimLeft(rest[strings.Index(rest, rfc[0])+len(rfc[0]):], " :—–-,")
+		e.set("title", strings.Trim(bibEmptyParensRe.ReplaceAllString(bibYearRe.ReplaceAllString(after, ""), ""), " ."))
+	}
+	if e.get("title") == "" {
+		// "Author & Author, Title, Publisher, Year" names its parts by
+		// position only.
+		if parts := strings.Split(rest, ", "); len(parts) >= 3 && bibNamesRe.MatchString(parts[0]) {
+			e.set("title", parts[1])
+			titleStart = len(parts[0])
+		}
+	}
+	if e.get("title") == "" {
+		// Bare text: the first segment is the best guess at a title.
+		first := strings.FieldsFunc(rest, func(r rune) bool { return r == '.' || r == '—' || r == '(' })
+		if len(first) > 0 {
+			e.set("title", first[0])
+		}
+	}
+	if t := strings.Trim(e.get("title"), " .,:;—–-*_\"“”"); t != "" {
+		e.set("title", t)
+	} else {
+		// What was taken for a title was only punctuation.
+		e.unset("title")
+	}
+
+	// Authors come before the title or the year.
+	head := rest
+	if titleStart >= 0 {
+		head = rest[:titleStart]
+	} else if i := strings.Index(rest, "("+year); year != "" && i >= 0 {
+		head = rest[:i]
+	}
+	if pairs := bibAuthorRe.FindAllStringSubmatch(head, -1); pairs != nil {
+		var names []string
+		for _, p := range pairs {
+			names = append(names, p[1]+", "+strings.TrimSpace(p[2]))
+		}
+		e.set("author", strings.Join(names, " and "))
+	} else if titleStart > 0 {
+		if a := strings.Trim(head, " .,:;—–-"); a != "" && len(strings.Fields(a)) <= 12 {
+			e.set("author", strings.NewReplacer(" & ", " and ", ", and ", " and ").Replace(a))
+		}
+	}
+	e.set("year", year)
+
+	venue := rest
+	if t := e.get("title"); t != "" {
+		if i := strings.Index(venue, t); i >= 0 {
+			venue = venue[i+len(t):]
+		}
+	}
+	venue = bibEmptyParensRe.ReplaceAllString(bibYearRe.ReplaceAllString(venue, ""), "")
+	if m := bibPagesRe.FindStringSubmatch(venue); m != nil {
+		e.set("pages", m[1]+"--"+m[2])
+		venue = strings.Replace(venue, m[0], "", 1)
+	}
+	if m := bibVolumeRe.FindStringSubmatch(venue); m != nil {
+		e.set("volume", m[1])
+		e.set("number", m[2]+m[3])
+		venue = strings.Replace(venue, m[0], "", 1)
+	}
+	venue = strings.Join(strings.Fields(strings.Trim(venue, " .,:;()—–-*_\"“”")), " ")
+
+	switch {
+	case rfc != nil:
+		e.Type = "techreport"
+		e.set("institution", "IETF")
+		e.set("type", "RFC")
+		e.set("number", rfc[1])
+	case bibProcRe.MatchString(venue):
+		e.Type = "inproceedings"
+		e.set("booktitle", venue)
+	case bibJournalRe.MatchString(venue):
+		e.Type = "article"
+		e.set("journal", venue)
+	case bibBookRe.MatchString(venue):
+		e.Type = "book"
+		e.set("publisher", venue)
+	default:
+		e.Type = "misc"
+		if u := e.get("url"); u != "" {
+			e.set("howpublished", `\url{`+u+`}`)
+		}
+	}
+
+	required := map[string][]string{
+		"article":       {"author", "title", "journal", "year"},
+		"book":          {"author", "title", "publisher", "year"},
+		"inproceedings": {"author", "title", "booktitle", "year"},
+		"techreport":    {"title", "institution", "year"},
+		"misc":          {"title"},
+	}[e.Type]
+	var missing []string
+	for _, f := range required {
+		if e.get(f) == "" {
+			missing = append(missing, f)
+		}
+	}
+	if e.Type == "misc" && e.get("url") == "" && (e.get("author") == "" || e.get("year") == "") {
+		missing = append(missing, "author, year or url")
+	}
+	if len(missing) > 0 {
+		e.Type = "misc"
+		e.set("note", "aiguide: incomplete reference, check it (missing "+strings.Join(missing, ", ")+"). Original: "+strings.TrimSpace(text))
+	}
+	return e
+}
+
+// bibBaseKey derives a citation key from the first author's last name, the
+// year and the first significant title word, e.g. "pike2012go".
+func bibBaseKey(e *bibEntry) string {
+	if rfc := e.get("number"); e.get("type") == "RFC" && rfc != "" {
+		return "rfc" + rfc
+	}
+	// Without an author, two title words make the key, e.g. "effectivego".
+	name, titleWords := "", 2
+	if a := e.get("author"); a != "" {
+		first, _, _ := strings.Cut(a, " and ")
+		last, _, hasComma := strings.Cut(first, ",")
+		if !hasComma {
+			if f := strings.Fields(first); len(f) > 0 {
+				last = f[len(f)-1]
+			}
+		}
+		if w := bibKeyWordRe.FindAllString(asciiFold(strings.ToLower(last)), -1); len(w) > 0 {
+			name, titleWords = strings.Join(w, ""), 1
+		}
+	}
+	var words []string
+	for _, w := range bibKeyWordRe.FindAllString(asciiFold(strings.ToLower(e.get("title"))), -1) {
+		if !bibStopWords[w] && len(words) < titleWords {
+			words = append(words, w)
+		}
+	}
+	if name == "" {
+		key := strings.Join(words, "") + e.get("year")
+		if key == "" {
+			key = "anon"
+		}
+		return key
+	}
+	year := e.get("year")
+	if year == "" {
+		year = "nd"
+	}
+	return name + year + strings.Join(words, "")
+}
+
+// asciiFold drops the accents of common Latin letters so keys stay ASCII.
+func asciiFold(s string) string {
+	return strings.NewReplacer(
+		"á", "a", "à", "a", "ä", "a", "â", "a", "ã", "a", "å", "a",
+		"é", "e", "è", "e", "ë", "e", "ê", "e",
+		"í", "i", "ì", "i", "ï", "i", "î", "i",
+		"ó", "o", "ò", "o", "ö", "o", "ô", "o", "õ", "o", "ø", "o",
+		"ú", "u", "ù", "u", "ü", "u", "û", "u",
+		"ñ", "n", "ç", "c", "ß", "ss", "ł", "l", "š", "s", "ž", "z", "č", "c",
+	).Replace(s)
+}
+
+// bibDedupKeys identify the same work written differently: entries that
+// share any of them are one work, so a citation with a DOI matches one of
+// the same title without.
+func bibDedupKeys(e *bibEntry) []string {
+	if e.get("type") == "RFC" {
+		return []string{"rfc" + e.get("number")}
+	}
+	var keys []string
+	if doi := e.get("doi"); doi != "" {
+		keys = append(keys, "doi:"+strings.ToLower(doi))
+	}
+	if t := strings.Join(bibKeyWordRe.FindAllString(asciiFold(strings.ToLower(e.get("title"))), -1), ""); t != "" {
+		keys = append(keys, "title:"+t)
+	}
+	if u := e.get("url"); u != "" || len(keys) == 0 {
+		keys = append(keys, "url:"+strings.TrimSuffix(strings.ToLower(u), "/"))
+	}
+	return keys
+}
+
+// buildBibliography parses, merges and keys the references. Duplicates keep
+// the first entry and fill its gaps from the later ones; a complete later
+// entry replaces an incomplete @misc, and one of a specific type a plain
+// @misc.
+func buildBibliography(refs []string) []*bibEntry {
+	var entries []*bibEntry
+	byDedup := map[string]*bibEntry{}
+	for _, r := range refs {
+		e := parseReference(r)
+		keys := bibDedupKeys(e)
+		var prev *bibEntry
+		for _, k := range keys {
+			if prev = byDedup[k]; prev != nil {
+				break
+			}
+		}
+		if prev == nil {
+			e.refs = []string{r}
+			for _, k := range keys {
+				byDedup[k] = e
+			}
+			entries = append(entries, e)
+			continue
+		}
+		for _, k := range keys {
+			if byDedup[k] == nil {
+				byDedup[k] = prev
+			}
+		}
+		prev.refs = append(prev.refs, r)
+		if e.get("note") == "" && (prev.get("note") != "" || prev.Type == "misc" && e.Type != "misc") {
+			old := *prev
+			prev.Type, prev.Fields = e.Type, e.Fields
+			e = &old
+		}
+		for _, f := range e.Fields {
+			if f[0] != "note" && prev.get(f[0]) == "" {
+				prev.set(f[0], f[1])
+			}
+		}
+	}
+
+	used := map[string]bool{}
+	for _, e := range entries {
+		base := bibBaseKey(e)
+		key := base
+		for suffix := 'b'; used[key]; suffix++ {
+			key = base + string(suffix)
+		}
+		used[key] = true
+		e.Key = key
+	}
+	return entries
+}
+
+var bibEscaper = strings.NewReplacer(`&`, `\&`, `%`, `\%`, `$`, `\$`, `#`, `\#`, `_`, `\_`, `{`, `\{`, `}`, `\}`)
+
+func formatBibliography(entries []*bibEntry) string {
+	var b strings.Builder
+	for i, e := range entries {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "@%s{%s,\n", e.Type, e.Key)
+		for _, f := range e.Fields {
+			value := f[1]
+			switch f[0] {
+			case "url", "doi", "howpublished":
+			case "title":
+				value = "{" + bibEscaper.Replace(value) + "}" // keep the capitalization
+			default:
+				value = bibEscaper.Replace(value)
+			}
+			fmt.Fprintf(&b, "  %-12s = {%s},\n", f[0], value)
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+func bibtexPath(guidePath string) string {
+	return strings.TrimSuffix(guidePath, ".md") + ".bib"
+}
+
+// exportBibTeX writes the guide's references as a BibTeX file next to it.
+func exportBibTeX(guidePath string) error {
+	md, err := readGuide(guidePath)
+	if err != nil {
+		return err
+	}
+	entries := buildBibliography(guideReferences(string(md)))
+	if len(entries) == 0 {
+		fmt.Println("-> No references found; nothing to export")
+		return nil
+	}
+	path := bibtexPath(guidePath)
+	if err := os.WriteFile(path, []byte(formatBibliography(entries)), 0o644); err != nil {
+		return err
+	}
+	incomplete := 0
+	for _, e := range entries {
+		if e.get("note") != "" {
+			incomplete++
+		}
+	}
+	fmt.Printf("-> Wrote %d reference(s) to %s", len(entries), path)
+	if incomplete > 0 {
+		fmt.Printf(" (%d incomplete, marked @misc with a note)", incomplete)
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		text   string
+		typ    string
+		key    string
+		fields map[string]string
+	}{
+		{
+			text: `Pike, R., & Kernighan, B. W. (1984). *The UNIX Programming Environment*. Prentice Hall.`,
+			typ:  "book", key: "pike1984unix",
+			fields: map[string]string{"author": "Pike, R. and Kernighan, B. W.", "title": "The UNIX Programming Environment", "publisher": "Prentice Hall", "year": "1984"},
+		},
+		{
+			text: `Donovan & Kernighan, The Go Programming Language, Addison-Wesley, 2015`,
+			typ:  "book", key: "donovan2015go",
+			fields: map[string]string{"author": "Donovan and Kernighan", "title": "The Go Programming Language"},
+		},
+		{
+			text: `RFC 9293: Transmission Control Protocol (TCP) (2022)`,
+			typ:  "techreport", key: "rfc9293",
+			fields: map[string]string{"title": "Transmission Control Protocol (TCP)", "number": "9293", "institution": "IETF", "year": "2022"},
+		},
+		{
+			text: `Lamport, L. (1978). "Time, Clocks, and the Ordering of Events in a Distributed System". Communications of the ACM, 21(7), 558–565.`,
+			typ:  "article", key: "lamport1978time",
+			fields: map[string]string{"journal": "Communications of the ACM", "volume": "21", "number": "7", "pages": "558--565"},
+		},
+		{
+			text: `Dijkstra, E. W. (1968). "Go To Statement Considered Harmful". Communications of the ACM 11(3), pp. 147-148.`,
+			typ:  "article", key: "dijkstra1968go",
+			fields: map[string]string{"pages": "147--148", "volume": "11", "number": "3"},
+		},
+		{
+			// Accents are folded out of the key and kept in the fields.
+			text: `Gödel, K. (1931). "Über formal unentscheidbare Sätze der Principia Mathematica"`,
+			typ:  "misc", key: "godel1931uber",
+			fields: map[string]string{"author": "Gödel, K.", "title": "Über formal unentscheidbare Sätze der Principia Mathematica"},
+		},
+		{
+			text: `Pike, R. (2012). "Go at Google". SPLASH 2012 conference proceedings.`,
+			typ:  "inproceedings", key: "pike2012go",
+			fields: map[string]string{"booktitle": "SPLASH conference proceedings"},
+		},
+		{
+			// Without an author, two title words make the key.
+			text: `"Effective Go". https://go.dev/doc/effective_go`,
+			typ:  "misc", key: "effectivego",
+			fields: map[string]string{"url": "https://go.dev/doc/effective_go", "howpublished": `\url{https://go.dev/doc/effective_go}`},
+		},
+		{
+			text: `[The Go Memory Model](https://go.dev/ref/mem).`,
+			typ:  "misc", key: "gomemory",
+			fields: map[string]string{"title": "The Go Memory Model", "url": "https://go.dev/ref/mem"},
+		},
+		{
+			text: `Some blog post`,
+			typ:  "misc", key: "someblog",
+			fields: map[string]string{"note": "aiguide: incomplete reference, check it (missing author, year or url). Original: Some blog post"},
+		},
+		{
+			// Punctuation is no title.
+			text: `Lamport (1978), doi: 10.1145/359545.359563.`,
+			typ:  "misc", key: "lamport1978",
+			fields: map[string]string{"title": "", "doi": "10.1145/359545.359563", "author": "Lamport"},
+		},
+		{
+			text: `   `,
+			typ:  "misc", key: "anon",
+		},
+	}
+	for _, tt := range tests {
+		e := parseReference(tt.text)
+		if e.Type != tt.typ {
+			t.Errorf("%q: type %q, want %q (fields %v)", tt.text, e.Type, tt.typ, e.Fields)
+		}
+		if key := bibBaseKey(e); key != tt.key {
+			t.Errorf("%q: key %q, want %q", tt.text, key, tt.key)
+		}
+		for name, want := range tt.fields {
+			if got := e.get(name); got != want {
+				t.Errorf("%q: %s = %q, want %q", tt.text, name, got, want)
+			}
+		}
+	}
+}
+
+func TestBuildBibliographyDedup(t *testing.T) {
+	refs := []string{
+		`Lamport, L. (1978). "Time, Clocks, and the Ordering of Events in a Distributed System".`,
+		`Pike, R. (2012). "Go at Google". SPLASH 2012 conference proceedings.`,
+		// The same paper: other case, a DOI and a journal.
+		`Lamport, L. (1978). "Time, clocks, and the ordering of events in a distributed system." Communications of the ACM 21(7): 558-565. doi:10.1145/359545.359563`,
+		// Matched on the DOI alone.
+		`Lamport (1978), doi: 10.1145/359545.359563.`,
+		`Pike, R. (2012). "Go Concurrency Patterns". Google I/O.`,
+		`RFC 9293: Transmission Control Protocol (TCP) (2022)`,
+		`rfc 9293`,
+		`"Effective Go". https://go.dev/doc/effective_go`,
+		`[Effective Go](https://go.dev/doc/effective_go/)`,
+		`Pike, R. (2012). "Go, Concurrency and You". Gophercon.`,
+	}
+	entries := buildBibliography(refs)
+	var keys []string
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	want := []string{"lamport1978time", "pike2012go", "pike2012gob", "rfc9293", "effectivego", "pike2012goc"}
+	if strings.Join(keys, " ") != strings.Join(want, " ") {
+		t.Fatalf("keys %v, want %v", keys, want)
+	}
+
+	lamport := entries[0]
+	// The article replaced the @misc, whose fields fill its gaps.
+	if lamport.Type != "article" || lamport.get("note") != "" || lamport.get("doi") != "10.1145/359545.359563" || lamport.get("journal") != "Communications of the ACM" {
+		t.Errorf("merged entry: %s %v", lamport.Type, lamport.Fields)
+	}
+	if len(lamport.refs) != 3 {
+		t.Errorf("merged entry has %d reference texts, want 3", len(lamport.refs))
+	}
+	if rfc := entries[3]; rfc.Type != "techreport" || rfc.get("year") != "2022" || rfc.get("note") != "" || len(rfc.refs) != 2 {
+		t.Errorf("RFC entry: %s %v", rfc.Type, rfc.Fields)
+	}
+}
+
+func TestFormatBibliography(t *testing.T) {
+	e := parseReference(`Kernighan, B. W. (1999). "The Practice of Programming: 50% Less Bugs & More_Fun". Addison-Wesley. https://example.com/a_b#c`)
+	e.Key = "kernighan1999practice"
+	got := formatBibliography([]*bibEntry{e})
+	for _, want := range []string{
+		"@book{kernighan1999practice,\n",
+		`  title        = {{The Practice of Programming: 50\% Less Bugs \& More\_Fun}},`,
+		`  url          = {https://example.com/a_b#c},`,
+		`  publisher    = {Addison-Wesley},`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// bloomLevels are the levels of the revised Bloom's taxonomy, lowest first.
+var bloomLevels = []string{"remember", "understand", "apply", "analyze", "evaluate", "create"}
+
+const bloomRebalanceRounds = 3
+
+var bloomRewriteRe = regexp.MustCompile(`^\s*(\d+)[.):]\s*(.+)$`)
+
+// bloomEnabled reports whether any flag needs Bloom levels.
+func bloomEnabled() bool {
+	return cfg.Bloom || cfg.BloomMaxRemember > 0 || cfg.ShowBloom
+}
+
+// normalizeBloom maps the model's wording ("Analysing", "Remembering",
+// "APPLY") onto a level, or "" when it isn't one.
+func normalizeBloom(s string) string {
+	s = strings.ToLower(strings.Trim(strings.TrimSpace(s), "\"'*`."))
+	stems := map[string]string{
+		"remem": "remember", "recall": "remember", "underst": "understand", "compreh": "understand",
+		"appl": "apply", "analy": "analyze", "evalu": "evaluate", "creat": "create", "synth": "create",
+	}
+	for stem, level := range stems {
+		if strings.HasPrefix(s, stem) {
+			return level
+		}
+	}
+	return ""
+}
+
+// classifyBloom labels every concept with a Bloom level. The result is
+// aligned with concepts; labels the model leaves out or garbles stay empty
+// and are reported.
+func classifyBloom(concepts []string, model string) ([]string, error) {
+	prompt := fmt.Sprintf(
+		"Classify each of the following study-guide concepts of the subject '%s' by the cognitive level a learner "+
+			"needs to master it, using Bloom's revised taxonomy (%s).\n\n%s\n\n"+
+			"Respond ONLY with a JSON object mapping each concept number to its level, e.g. {\"%s\": \"apply\"}.",
+		cfg.Subject, strings.Join(bloomLevels, ", "), strings.Join(concepts, "\n"), conceptNumber(concepts[0]),
+	)
+
+	resp, err := callAIWith(callOptions{Model: model, Temperature: 0, Purpose: "bloom"}, prompt,
+		"You are an instructional designer who classifies learning objectives tersely.")
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := strings.Index(resp, "{"), strings.LastIndex(resp, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("Bloom classification is not JSON")
+	}
+	var raw map[string]string
+	if err := json.Unmarshal([]byte(resp[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("parsing Bloom classification: %w", err)
+	}
+	byNumber := make(map[string]string, len(raw))
+	for num, level := range raw {
+		byNumber[strings.TrimRight(strings.TrimSpace(num), ".)")] = normalizeBloom(level)
+	}
+
+	levels := make([]string, len(concepts))
+	var missing []string
+	for i, c := range concepts {
+		levels[i] = byNumber[conceptNumber(c)]
+		if levels[i] == "" {
+			missing = append(missing, conceptNumber(c))
+		}
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: no valid Bloom level for concept(s) %s\n", strings.Join(missing, ", "))
+	}
+	return levels, nil
+}
+
+// rebalanceBloom rewrites recall-only concepts as higher-order questions on
+// the same topic until at most cfg.BloomMaxRemember of them sit at
+// "remember", or bloomRebalanceRounds is used up. Concepts keep their
+// numbers and positions.
+func rebalanceBloom(concepts, levels []string, model string) ([]string, []string, error) {
+	for round := 1; ; round++ {
+		var recall []int
+		for i, l := range levels {
+			if l == "remember" {
+				recall = append(recall, i)
+			}
+		}
+		allowed := int(cfg.BloomMaxRemember * float64(len(concepts)))
+		excess := len(recall) - allowed
+		if excess <= 0 {
+			return concepts, levels, nil
+		}
+		if round > bloomRebalanceRounds {
+			break
+		}
+
+		// Rewrite the later recall concepts; the first ones usually lay the
+		// groundwork the rest builds on.
+		targets := recall[len(recall)-excess:]
+		statusf("-> Rebalancing Bloom levels: rewriting %d recall-only concepts (round %d)...\n", len(targets), round)
+
+		lines := make([]string, len(targets))
+		for k, i := range targets {
+			lines[k] = concepts[i]
+		}
+		prompt := fmt.Sprintf(
+			"These concepts from a study guide on '%s' only test recall:\n\n%s\n\n"+
+				"Rewrite each one as a higher-order question or task about the same topic that requires the learner "+
+				"to apply, analyze, evaluate or create. Output ONLY one line per concept in the form "+
+				"\"<number>. <rewritten concept>\", keeping the numbers above.",
+			cfg.Subject, strings.Join(lines, "\n"),
+		)
+		resp, err := callAIWith(callOptions{Model: cfg.Model, Temperature: defaultTemperature, Purpose: "bloom"}, prompt,
+			"You are an instructional designer who writes challenging study questions.")
+		if err != nil {
+			return concepts, levels, err
+		}
+
+		byNumber := make(map[string]int, len(targets))
+		for _, i := range targets {
+			byNumber[conceptNumber(concepts[i])] = i
+		}
+		var rewritten []int
+		scanner := bufio.NewScanner(strings.NewReader(resp))
+		for scanner.Scan() {
+			m := bloomRewriteRe.FindStringSubmatch(scanner.Text())
+			if m == nil {
+				continue
+			}
+			if i, ok := byNumber[m[1]]; ok {
+				concepts[i] = m[1] + ". " + strings.TrimSpace(m[2])
+				rewritten = append(rewritten, i)
+				delete(byNumber, m[1])
+			}
+		}
+		if len(rewritten) == 0 {
+			break
+		}
+
+		relabeled, err := classifyBloom(pick(concepts, rewritten), model)
+		if err != nil {
+			return concepts, levels, err
+		}
+		for k, i := range rewritten {
+			levels[i] = relabeled[k]
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Warning: more than %.0f%% of concepts still test recall after %d rebalancing rounds\n",
+		cfg.BloomMaxRemember*100, bloomRebalanceRounds)
+	return concepts, levels, nil
+}
+
+// writeBloomSummary prints how the guide's concepts spread across levels.
+func writeBloomSummary(w io.Writer, levels []string) {
+	if len(levels) == 0 {
+		return
+	}
+	counts := map[string]int{}
+	for _, l := range levels {
+		if l == "" {
+			l = "unclassified"
+		}
+		counts[l]++
+	}
+
+	fmt.Fprintln(w, "-> Bloom coverage:")
+	for _, l := range append(bloomLevels, "unclassified") {
+		n := counts[l]
+		if n == 0 && l == "unclassified" {
+			continue
+		}
+		pct := float64(n) * 100 / float64(len(levels))
+		fmt.Fprintf(w, "   %-12s %-20s %3d (%.0f%%)\n", l, strings.Repeat("█", int(pct/5+0.5)), n, pct)
+	}
+}
+
+func bloomBadge(level string) string {
+	if level == "" {
+		return ""
+	}
+	return "*Bloom:* " + level
+}
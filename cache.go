@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// The cache keeps what aiguide can reuse between runs under cacheDir(), one
+// file per entry in <kind>/<ab>/<hash>. index.json lists every entry with
+// its size and when it was last used, plus the hit counts of recent runs, so
+// stats and eviction never walk the entries. Changes to the index are made
+// under index.lock; entries are written atomically and anything that finds
+// an entry gone treats it as a miss, so a clean can run next to other runs.
+
+// cacheEntry is an index record, keyed by the entry's path under cacheDir().
+type cacheEntry struct {
+	Kind    string    `json:"kind"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+	Used    time.Time `json:"used"`
+}
+
+// cacheRun counts one process's lookups, for the hit rate.
+type cacheRun struct {
+	Started time.Time `json:"started"`
+	PID     int       `json:"pid"`
+	Hits    int       `json:"hits"`
+	Misses  int       `json:"misses"`
+}
+
+type cacheIndex struct {
+	Entries map[string]*cacheEntry `json:"entries"`
+	Runs    []cacheRun             `json:"runs,omitempty"`
+}
+
+// cacheRecentRuns is how many runs the hit rate is computed over.
+const cacheRecentRuns = 20
+
+// fileLockStale is when a lock left behind by a crashed process is broken.
+const fileLockStale = 30 * time.Second
+
+var cacheStarted = time.Now()
+
+// cacheDir is $AIGUIDE_CACHE_DIR, else aiguide under the user cache
+// directory ($XDG_CACHE_HOME or ~/.cache on Linux).
+func cacheDir() string {
+	if d := os.Getenv("AIGUIDE_CACHE_DIR"); d != "" {
+		return d
+	}
+	if d, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(d, "aiguide")
+	}
+	return expandHome("~/.cache/aiguide")
+}
+
+func cacheEntryPath(kind, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	h := hex.EncodeToString(sum[:])
+	return filepath.Join(kind, h[:2], h)
+}
+
+// lockCache takes index.lock and returns its release.
+func lockCache(dir string) (func(), error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return lockFile(filepath.Join(dir, "index.lock"))
+}
+
+// lockFile takes a lock shared by aiguide processes: a file created
+// exclusively at path, broken once it is older than fileLockStale. It returns
+// the release.
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(2 * fileLockStale)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > fileLockStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is held by another aiguide process", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func loadCacheIndex(dir string) (*cacheIndex, error) {
+	idx := &cacheIndex{Entries: map[string]*cacheEntry{}}
+	b, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, idx); err != nil {
+		return nil, fmt.Errorf("reading the cache index: %w", err)
+	}
+	if idx.Entries == nil {
+		idx.Entries = map[string]*cacheEntry{}
+	}
+	return idx, nil
+}
+
+func (idx *cacheIndex) save(dir string) error {
+	b, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, "index.json"), append(b, '\n'), 0o644)
+}
+
+// updateCacheIndex runs fn on the index under the lock and saves it.
+func updateCacheIndex(dir string, fn func(*cacheIndex)) error {
+	unlock, err := lockCache(dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	idx, err := loadCacheIndex(dir)
+	if err != nil {
+		return err
+	}
+	fn(idx)
+	return idx.save(dir)
+}
+
+// countLookup adds a hit or a miss to this process's run.
+func (idx *cacheIndex) countLookup(hit bool) {
+	pid := os.Getpid()
+	i := len(idx.Runs) - 1
+	for ; i >= 0; i-- {
+		if r := idx.Runs[i]; r.PID == pid && r.Started.Equal(cacheStarted) {
+			break
+		}
+	}
+	if i < 0 {
+		idx.Runs = append(idx.Runs, cacheRun{Started: cacheStarted, PID: pid})
+		if len(idx.Runs) > cacheRecentRuns {
+			idx.Runs = idx.Runs[len(idx.Runs)-cacheRecentRuns:]
+		}
+		i = len(idx.Runs) - 1
+	}
+	if hit {
+		idx.Runs[i].Hits++
+	} else {
+		idx.Runs[i].Misses++
+	}
+}
+
+// cacheGet returns the cached value of kind and key. Cache errors are
+// reported as misses: the cache only ever saves work.
+func cacheGet(kind, key string) ([]byte, bool) {
+	dir := cacheDir()
+	rel := cacheEntryPath(kind, key)
+	b, err := os.ReadFile(filepath.Join(dir, rel))
+	hit := err == nil
+	if err := updateCacheIndex(dir, func(idx *cacheIndex) {
+		idx.countLookup(hit)
+		if e := idx.Entries[rel]; e != nil && hit {
+			e.Used = time.Now().UTC()
+		} else if !hit {
+			delete(idx.Entries, rel)
+		}
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not update the cache index: %v\n", err)
+	}
+	return b, hit
+}
+
+// cachePut stores value under kind and key.
+func cachePut(kind, key string, value []byte) error {
+	dir := cacheDir()
+	rel := cacheEntryPath(kind, key)
+	path := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, value, 0o644); err != nil {
+		return err
+	}
+	return updateCacheIndex(dir, func(idx *cacheIndex) {
+		now := time.Now().UTC()
+		idx.Entries[rel] = &cacheEntry{Kind: kind, Size: int64(len(value)), Created: now, Used: now}
+	})
+}
+
+// sizeUnits are the suffixes --max-size takes, longest first.
+var sizeUnits = []struct {
+	suffix string
+	bytes  float64
+}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+// parseSize reads sizes such as 2GB, 500MB or 1.5G.
+func parseSize(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	for _, u := range sizeUnits {
+		for _, suffix := range []string{u.suffix, strings.TrimSuffix(u.suffix, "B")} {
+			if suffix == "" {
+				continue
+			}
+			if n, ok := strings.CutSuffix(t, suffix); ok {
+				v, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+				if err != nil || v < 0 {
+					return 0, fmt.Errorf("expected a number before %q", suffix)
+				}
+				return int64(v * u.bytes), nil
+			}
+		}
+	}
+	v, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("expected a size such as 500MB or 2GB")
+	}
+	return v, nil
+}
+
+func formatSize(n int64) string {
+	for _, u := range sizeUnits[:len(sizeUnits)-1] {
+		if float64(n) >= u.bytes {
+			return fmt.Sprintf("%.1f %s", float64(n)/u.bytes, u.suffix)
+		}
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// cleanCache removes entries unused for longer than olderThan (when set),
+// then the least recently used ones until the rest fit in maxSize (when
+// set). It returns how many entries and bytes it removed.
+func cleanCache(dir string, olderThan time.Duration, maxSize int64) (removed int, freed int64, err error) {
+	err = updateCacheIndex(dir, func(idx *cacheIndex) {
+		keys := make([]string, 0, len(idx.Entries))
+		var total int64
+		for k, e := range idx.Entries {
+			keys = append(keys, k)
+			total += e.Size
+		}
+		sort.Slice(keys, func(i, j int) bool { return idx.Entries[keys[i]].Used.Before(idx.Entries[keys[j]].Used) })
+
+		cutoff := time.Now().Add(-olderThan)
+		for _, k := range keys {
+			e := idx.Entries[k]
+			expired := olderThan > 0 && e.Used.Before(cutoff)
+			if !expired && (maxSize <= 0 || total <= maxSize) {
+				break
+			}
+			if err := os.Remove(filepath.Join(dir, k)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintf(os.Stderr, "Warning: could not remove %s: %v\n", k, err)
+				continue
+			}
+			delete(idx.Entries, k)
+			total -= e.Size
+			removed++
+			freed += e.Size
+		}
+	})
+	return removed, freed, err
+}
+
+func printCacheStats(dir string) error {
+	idx, err := loadCacheIndex(dir)
+	if err != nil {
+		return err
+	}
+	var size int64
+	var oldest time.Time
+	kinds := map[string]int{}
+	for _, e := range idx.Entries {
+		size += e.Size
+		kinds[e.Kind]++
+		if oldest.IsZero() || e.Created.Before(oldest) {
+			oldest = e.Created
+		}
+	}
+
+	fmt.Printf("Cache:        %s\n", dir)
+	entries := strconv.Itoa(len(idx.Entries))
+	if len(kinds) > 0 {
+		var parts []string
+		for k, n := range kinds {
+			parts = append(parts, fmt.Sprintf("%s %d", k, n))
+		}
+		sort.Strings(parts)
+		entries += " (" + strings.Join(parts, ", ") + ")"
+	}
+	fmt.Printf("Entries:      %s\n", entries)
+	fmt.Printf("Size on disk: %s\n", formatSize(size))
+
+	var hits, misses int
+	for _, r := range idx.Runs {
+		hits += r.Hits
+		misses += r.Misses
+	}
+	if hits+misses > 0 {
+		fmt.Printf("Hit rate:     %.0f%% over the last %d run(s) (%d hits, %d misses)\n", 100*float64(hits)/float64(hits+misses), len(idx.Runs), hits, misses)
+	} else {
+		fmt.Println("Hit rate:     no lookups yet")
+	}
+	if !oldest.IsZero() {
+		fmt.Printf("Oldest entry: %s (%d days ago)\n", oldest.Local().Format("2006-01-02"), int(time.Since(oldest).Hours()/24))
+	}
+	return nil
+}
+
+// clearCache removes every entry and the index. The lock is kept while it
+// runs, so other processes wait rather than write into a half-removed cache.
+func clearCache(dir string) error {
+	unlock, err := lockCache(dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	items, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, it := range items {
+		if it.Name() == "index.lock" {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, it.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect and prune aiguide's on-disk cache",
+	}
+
+	stats := &cobra.Command{
+		Use:   "stats",
+		Short: "Show the cache's entries, size, recent hit rate and oldest entry",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := printCacheStats(cacheDir()); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	var olderThan, maxSize string
+	clean := &cobra.Command{
+		Use:   "clean",
+		Short: "Remove entries unused for a while, or the least recently used ones beyond a size",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if olderThan == "" && maxSize == "" {
+				fmt.Fprintln(os.Stderr, "Error: cache clean needs --older-than or --max-size.")
+				os.Exit(1)
+			}
+			var age time.Duration
+			var size int64
+			var err error
+			if olderThan != "" {
+				if age, err = parseAge(olderThan); err != nil || age <= 0 {
+					fmt.Fprintf(os.Stderr, "Error: invalid --older-than %q (expected e.g. 30d, 6w or 720h)\n", olderThan)
+					os.Exit(1)
+				}
+			}
+			if maxSize != "" {
+				if size, err = parseSize(maxSize); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: invalid --max-size %q: %v\n", maxSize, err)
+					os.Exit(1)
+				}
+			}
+			removed, freed, err := cleanCache(cacheDir(), age, size)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Removed %d entries (%s).\n", removed, formatSize(freed))
+		},
+	}
+	clean.Flags().StringVar(&olderThan, "older-than", "", "Remove entries not used for this long, e.g. 30d, 6w or 720h")
+	clean.Flags().StringVar(&maxSize, "max-size", "", "Remove the least recently used entries until the cache fits, e.g. 2GB")
+
+	var yes bool
+	clearAll := &cobra.Command{
+		Use:   "clear",
+		Short: "Remove the whole cache",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			dir := cacheDir()
+			if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+				fmt.Println("The cache is empty.")
+				return
+			}
+			if !yes {
+				idx, err := loadCacheIndex(dir)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				var size int64
+				for _, e := range idx.Entries {
+					size += e.Size
+				}
+				fmt.Printf("Remove all %d cache entries (%s) in %s? [y/N] ", len(idx.Entries), formatSize(size), dir)
+				answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+					fmt.Println("Nothing removed.")
+					return
+				}
+			}
+			if err := clearCache(dir); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println("Cache cleared.")
+		},
+	}
+	clearAll.Flags().BoolVarP(&yes, "yes", "y", false, "Don't ask for confirmation")
+
+	cmd.AddCommand(stats, clean, clearAll)
+	return cmd
+}
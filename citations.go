@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// citationMarkerRe matches the markers models use: [3], [^3], [^note],
+	// [1, 2], [1-3], [source 3] and <sup>3</sup>.
+	citationMarkerRe = regexp.MustCompile(`\[\^([\w-]+)\]|\[(\d+(?:\s*[,;–-]\s*\d+)*)\]|(?i:\[(?:source|ref|citation)s?:?\s*(\d+)\])|<sup>\[?(\d+)\]?</sup>`)
+	// citationDefRe matches a definition line anywhere: "[3]: ...", "[^3]: ..."
+	// or "[3] ..." at the start of a line.
+	citationDefRe = regexp.MustCompile(`^\s*(?:\[\^([\w-]+)\]:|\[(\d+)\]:?)\s+(.+)$`)
+	// citationListRe matches an entry of a references list: "1. ...", "(1) ...",
+	// "- [1] ..." and the forms above.
+	citationListRe     = regexp.MustCompile(`^\s*(?:[-*]\s+)?(?:\[\^?([\w-]+)\]:?|\(?(\d+)[.)])\s+(.+)$`)
+	referencesHeadRe   = regexp.MustCompile(`(?i)^\s*(?:#{1,6}\s*|\*\*)?(?:references|sources|citations|bibliography|works cited|further reading)\s*:?\s*(?:\*\*)?\s*:?\s*$`)
+	citationRangeSepRe = regexp.MustCompile(`\s*[,;]\s*`)
+)
+
+// footnotes converts citation markers to markdown footnotes with labels
+// numbered across the whole guide. It is nil unless --citation-style
+// footnote is set.
+type footnotes struct {
+	placement string
+	next      int
+	byText    map[string]int // document placement: one label per source
+	defs      []string       // document placement: definitions so far
+}
+
+func newFootnotes() *footnotes {
+	if cfg.CitationStyle != "footnote" {
+		return nil
+	}
+	return &footnotes{placement: cfg.FootnotePlacement, byText: map[string]int{}}
+}
+
+// convert rewrites the citations of chunk j, section by section, since
+// models number their sources per concept.
+func (f *footnotes) convert(j chunk, content string) string {
+	preamble, sections := splitSections(content, chunkNumbers(j.items))
+	if len(sections) == 0 {
+		return f.convertSection(content)
+	}
+	var parts []string
+	if preamble != "" {
+		parts = append(parts, f.convertSection(preamble))
+	}
+	for _, s := range sections {
+		parts = append(parts, f.convertSection(s.Text))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+type citationDef struct {
+	key, text string
+	used      bool
+}
+
+func (f *footnotes) convertSection(text string) string {
+	prose, refHeading, defs := extractCitationDefs(text)
+	if len(defs) == 0 && !citationMarkerRe.MatchString(prose) {
+		return text
+	}
+	byKey := map[string]*citationDef{}
+	for _, d := range defs {
+		byKey[d.key] = d
+	}
+
+	labels := map[string]int{}
+	var order []string
+	label := func(key string) (int, bool) {
+		d, ok := byKey[key]
+		if !ok {
+			return 0, false // no definition: drop the marker rather than dangle
+		}
+		if n, ok := labels[key]; ok {
+			return n, true
+		}
+		var n int
+		if f.placement == "document" {
+			if n, ok = f.byText[d.text]; !ok {
+				f.next++
+				n = f.next
+				f.byText[d.text] = n
+				f.defs = append(f.defs, fmt.Sprintf("[^%d]: %s", n, d.text))
+			}
+		} else {
+			f.next++
+			n = f.next
+		}
+		d.used = true
+		labels[key] = n
+		order = append(order, key)
+		return n, true
+	}
+
+	prose = forEachProse(prose, func(s string) string {
+		var b strings.Builder
+		last := 0
+		for _, loc := range citationMarkerRe.FindAllStringSubmatchIndex(s, -1) {
+			// [1](url) is a link and [1][x] a reference link, not a citation.
+			if loc[1] < len(s) && (s[loc[1]] == '(' || s[loc[1]] == '[') {
+				continue
+			}
+			var keys []string
+			for g := 2; g < len(loc); g += 2 {
+				if loc[g] >= 0 {
+					keys = citationKeys(s[loc[g]:loc[g+1]])
+					break
+				}
+			}
+			b.WriteString(strings.TrimRight(s[last:loc[0]], " "))
+			for _, k := range keys {
+				if n, ok := label(k); ok {
+					fmt.Fprintf(&b, "[^%d]", n)
+				}
+			}
+			last = loc[1]
+		}
+		b.WriteString(s[last:])
+		return b.String()
+	})
+
+	var tail []string
+	if f.placement != "document" && len(order) > 0 {
+		var sb strings.Builder
+		for _, k := range order {
+			fmt.Fprintf(&sb, "[^%d]: %s\n", labels[k], byKey[k].text)
+		}
+		tail = append(tail, strings.TrimSpace(sb.String()))
+	}
+	// Sources the text never cited stay visible as a plain list, so the
+	// conversion loses nothing and leaves no unreferenced footnote.
+	var unused []string
+	for _, d := range defs {
+		if !d.used {
+			unused = append(unused, "- "+d.text)
+		}
+	}
+	if len(unused) > 0 {
+		if refHeading == "" {
+			refHeading = "**Sources:**"
+		}
+		tail = append([]string{refHeading + "\n\n" + strings.Join(unused, "\n")}, tail...)
+	}
+
+	prose = strings.TrimSpace(prose)
+	if len(tail) > 0 {
+		prose += "\n\n" + strings.Join(tail, "\n\n")
+	}
+	return prose
+}
+
+// citationKeys expands a marker's content: "1, 2" and "1-3" cite several
+// sources.
+func citationKeys(s string) []string {
+	var keys []string
+	for _, part := range citationRangeSepRe.Split(strings.TrimSpace(s), -1) {
+		lo, hi, isRange := strings.Cut(strings.ReplaceAll(part, "–", "-"), "-")
+		a, errA := strconv.Atoi(strings.TrimSpace(lo))
+		b, errB := strconv.Atoi(strings.TrimSpace(hi))
+		if isRange && errA == nil && errB == nil && a <= b && b-a < 20 {
+			for n := a; n <= b; n++ {
+				keys = append(keys, strconv.Itoa(n))
+			}
+			continue
+		}
+		keys = append(keys, strings.TrimSpace(part))
+	}
+	return keys
+}
+
+// extractCitationDefs removes the source definitions, and the references
+// heading they sit under, from text. Code blocks are left alone.
+func extractCitationDefs(text string) (prose, heading string, defs []*citationDef) {
+	var kept []string
+	seen := map[string]bool{}
+	inFence, inRefs := false, false
+	add := func(key, body string) {
+		if !seen[key] {
+			seen[key] = true
+			defs = append(defs, &citationDef{key: key, text: strings.TrimSpace(body)})
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+		if inFence {
+			kept = append(kept, line)
+			continue
+		}
+		if referencesHeadRe.MatchString(trimmed) {
+			inRefs, heading = true, trimmed
+			continue
+		}
+		if inRefs {
+			if m := citationListRe.FindStringSubmatch(line); m != nil {
+				add(m[1]+m[2], m[3])
+				continue
+			}
+			if trimmed == "" {
+				continue
+			}
+			inRefs = false
+		}
+		if m := citationDefRe.FindStringSubmatch(line); m != nil {
+			add(m[1]+m[2], m[3])
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n"), heading, defs
+}
+
+// writeEnd writes the collected definitions with --footnote-placement
+// document.
+func (f *footnotes) writeEnd(w io.Writer) {
+	if f.placement != "document" || len(f.defs) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s\n", strings.Join(f.defs, "\n"))
+}
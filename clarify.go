@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// maxClarifyingQuestions is how many questions --clarify asks at most.
+const maxClarifyingQuestions = 3
+
+// Clarification is one question --clarify asked about the subject and the
+// user's answer; an empty answer leaves the choice to the model.
+type Clarification struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// clarifications shape both the concept list and the answers; they are
+// recorded in the sidecar.
+var clarifications []Clarification
+
+// loadClarifyAnswers reads --clarify-answers: one answer per line, in the
+// order the questions are asked. Blank lines are kept as "no preference".
+func loadClarifyAnswers(path string) ([]string, error) {
+	b, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("reading --clarify-answers: %w", err)
+	}
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return lines, nil
+}
+
+// stdinIsTerminal reports whether the user can be asked questions.
+func stdinIsTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// clarifyingQuestions asks the model whether the subject is too broad or
+// ambiguous to write a focused guide about, and if so what it would ask.
+func clarifyingQuestions() ([]string, error) {
+	prompt := fmt.Sprintf(
+		"A learner asked for a study guide about: '%s'.\n\n"+
+			"Decide whether this subject is ambiguous or too broad to write a focused guide about. If it is, "+
+			"write up to %d short clarifying questions that would change what the guide covers, "+
+			"such as its scope, the learner's level, or whether it is for an exam or for practical work. "+
+			"If the subject is already specific, ask nothing.\n\n"+
+			"Respond ONLY with a JSON object, e.g. {\"ambiguous\": true, \"questions\": [\"...\"]}.",
+		cfg.Subject, maxClarifyingQuestions) + languageInstruction()
+
+	resp, err := callAIWith(callOptions{Model: auxModel(), Temperature: 0, Purpose: "clarify"}, prompt,
+		"You are a tutor who scopes a learner's request before teaching.")
+	if err != nil {
+		return nil, err
+	}
+	start, end := strings.Index(resp, "{"), strings.LastIndex(resp, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("the clarifying questions are not JSON")
+	}
+	var out struct {
+		Ambiguous bool     `json:"ambiguous"`
+		Questions []string `json:"questions"`
+	}
+	if err := json.Unmarshal([]byte(resp[start:end+1]), &out); err != nil {
+		return nil, fmt.Errorf("parsing the clarifying questions: %w", err)
+	}
+	if !out.Ambiguous {
+		return nil, nil
+	}
+	var questions []string
+	for _, q := range out.Questions {
+		if q = strings.TrimSpace(q); q != "" && len(questions) < maxClarifyingQuestions {
+			questions = append(questions, q)
+		}
+	}
+	return questions, nil
+}
+
+// clarifySubject runs the --clarify exchange: the model's questions are
+// answered from answers (--clarify-answers) when given, else at the
+// terminal. Without either it warns and the guide is generated as usual.
+func clarifySubject(answers []string) error {
+	if answers == nil && !stdinIsTerminal() {
+		fmt.Fprintln(os.Stderr, "Warning: --clarify needs a terminal to ask its questions, or a --clarify-answers file; generating without it.")
+		return nil
+	}
+	statusf("-> Checking whether %q needs clarifying...\n", cfg.Subject)
+	questions, err := clarifyingQuestions()
+	if err != nil {
+		return err
+	}
+	if len(questions) == 0 {
+		statusf("-> The subject is specific enough, no questions to ask\n")
+		return nil
+	}
+
+	if answers != nil {
+		if len(answers) < len(questions) {
+			fmt.Fprintf(os.Stderr, "Warning: --clarify-answers has %d answer(s) for %d question(s); the rest are left to the model.\n", len(answers), len(questions))
+		}
+		for i, q := range questions {
+			c := Clarification{Question: q}
+			if i < len(answers) {
+				c.Answer = answers[i]
+			}
+			statusf("   %d. %s\n      %s\n", i+1, q, c.Answer)
+			clarifications = append(clarifications, c)
+		}
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, "A few questions to focus the guide (press Enter to leave one to the model):")
+	in := bufio.NewReader(os.Stdin)
+	for i, q := range questions {
+		fmt.Fprintf(os.Stderr, "  %d. %s\n  > ", i+1, q)
+		line, err := in.ReadString('\n')
+		clarifications = append(clarifications, Clarification{Question: q, Answer: strings.TrimSpace(line)})
+		if err != nil {
+			// Ctrl-D: the remaining questions are left to the model.
+			fmt.Fprintln(os.Stderr)
+			for _, rest := range questions[i+1:] {
+				clarifications = append(clarifications, Clarification{Question: rest})
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// clarificationContext is what the clarifications add to the list prompt
+// and the system prompt.
+func clarificationContext() string {
+	var b strings.Builder
+	for _, c := range clarifications {
+		if c.Answer != "" {
+			fmt.Fprintf(&b, "- %s\n  %s\n", c.Question, c.Answer)
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "\n\nThe learner clarified what they want from this guide. Scope all content to these answers:\n" + b.String()
+}
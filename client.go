@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/yuriiter/aiguide/pkg/guide"
+)
+
+// gen makes every API call of the run. loadEnv builds it from the provider
+// settings.
+var gen *guide.Generator
+
+// refusalError means the model declined to answer.
+type refusalError = guide.RefusalError
+
+// apiError is a non-200 response of the provider.
+type apiError = guide.APIError
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "…"
+}
+
+// callOptions controls a single completion request. Purpose tags the call in
+// the usage summary.
+type callOptions struct {
+	Model       string
+	Temperature float64
+	Seed        *int
+	Purpose     string
+	WebSearch   bool
+	// Stream, when set, asks for the answer as server-sent events and
+	// receives its text as it arrives.
+	Stream func(delta string)
+}
+
+func (o callOptions) call(userPrompt, sysPrompt string) guide.Call {
+	t := o.Temperature
+	return guide.Call{Model: o.Model, System: sysPrompt, User: userPrompt, Temperature: &t, Seed: o.Seed,
+		WebSearch: o.WebSearch, Purpose: o.Purpose, Stream: o.Stream}
+}
+
+func callAI(userPrompt, sysPrompt string) (string, error) {
+	return callAIWith(callOptions{Model: cfg.Model, Temperature: defaultTemperature}, userPrompt, sysPrompt)
+}
+
+func callAIWith(opts callOptions, userPrompt, sysPrompt string) (string, error) {
+	content, _, err := callAIUsage(opts, userPrompt, sysPrompt)
+	return content, err
+}
+
+// callAIUsage is callAIWith that also returns the tokens the call used,
+// retries included.
+func callAIUsage(opts callOptions, userPrompt, sysPrompt string) (string, Usage, error) {
+	content, u, err := gen.Complete(runCtx, opts.call(userPrompt, sysPrompt))
+	return content, u, interrupted(err)
+}
+
+// interrupted marks the error of a call Ctrl-C cut short.
+func interrupted(err error) error {
+	if err != nil && runCtx.Err() != nil && !errors.Is(err, ErrInterrupted) {
+		return fmt.Errorf("%w: %w", ErrInterrupted, err)
+	}
+	return err
+}
+
+// newGenerator builds gen for the resolved provider settings in cfg.
+func newGenerator(backend, chatTemplate, baseURL string) (*guide.Generator, error) {
+	t := defaultTemperature
+	return guide.New(guide.Config{
+		BaseURL:         baseURL,
+		APIKey:          cfg.Token,
+		Model:           cfg.Model,
+		Temperature:     &t,
+		Backend:         backend,
+		ChatTemplate:    chatTemplate,
+		Headers:         cfg.Headers,
+		MaxTokens:       cfg.MaxTokens,
+		SystemRole:      cfg.SystemRole,
+		NoTemperature:   cfg.Quirks[quirkNoTemperature],
+		NoSeed:          cfg.Quirks[quirkNoSeed],
+		Retries:         &cfg.Retries,
+		RetryMaxWait:    cfg.RetryMaxWait,
+		RequestIDPrefix: "run" + runID + "/",
+		Limiter:         budgetLimiter{},
+		Observer:        runObserver{},
+	})
+}
+
+// budgetLimiter fails calls once --max-cost or --max-total-tokens is spent.
+type budgetLimiter struct{}
+
+func (budgetLimiter) Wait(context.Context) error { return checkBudget() }
+
+// runObserver reports the calls of the run: progress events, metrics, the
+// usage summary and the --verbose and retry lines.
+type runObserver struct{}
+
+func (runObserver) Request(r guide.RequestInfo) {
+	e := progressEvent{Event: "request", RequestID: r.ID, UpstreamRequestID: r.Upstream, HTTPStatus: r.Status}
+	if r.Err != nil {
+		e.Error = r.Err.Error()
+	}
+	emitEvent(e)
+}
+
+func (runObserver) Attempt(c guide.Call, took time.Duration, u *Usage, err error) {
+	metrics.apiRequest(c.Model, requestStatus(err), took)
+	if cfg.Verbose {
+		verbosef("   %s request to %s: %s, %s\n", requestPurpose(c.Purpose), c.Model, took.Round(time.Millisecond), requestStatus(err))
+	}
+	if u != nil {
+		usage.add(c.Model, c.Purpose, *u)
+	}
+}
+
+func (runObserver) Retry(c guide.Call, n, of int, wait time.Duration, err error) {
+	var refusal *refusalError
+	if errors.As(err, &refusal) {
+		retryf("   %s was refused, retrying with a softened prompt...\n", c.Label)
+		return
+	}
+	retryf("   %s, retrying in %s (%d/%d)...\n", guide.RetryReason(err), wait.Round(100*time.Millisecond), n, of)
+	metrics.retry(c.Model)
+	if errors.Is(err, ErrRateLimited) {
+		metrics.rateLimitWait(wait)
+	}
+}
+
+func (runObserver) Notice(msg string) {
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+}
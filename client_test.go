@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// retryServer fails the first requests with the given statuses and then
+// answers, reporting 5 prompt and 6 completion tokens for every request.
+func retryServer(t *testing.T, fail ...int) *atomic.Int32 {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := int(calls.Add(1)); n <= len(fail) {
+			http.Error(w, `{"error":{"message":"try again"}}`, fail[n-1])
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": "answer"}}},
+			"usage":   map[string]int{"prompt_tokens": 5, "completion_tokens": 6, "total_tokens": 11},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	prev := gen
+	t.Cleanup(func() { gen = prev })
+	var err error
+	if gen, err = newGenerator("", "", srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	return &calls
+}
+
+func TestCallAIUsageRetries(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.Model, cfg.Retries, cfg.RetryMaxWait, cfg.Quiet = "retry-model", 3, 10*time.Millisecond, false
+	calls := retryServer(t, http.StatusTooManyRequests, http.StatusBadGateway)
+
+	var content string
+	var u Usage
+	var err error
+	stderr := captureStderr(t, func() {
+		content, u, err = callAIUsage(callOptions{Model: cfg.Model, Purpose: "missing"}, "prompt", "system")
+	})
+	if err != nil || content != "answer" || calls.Load() != 3 {
+		t.Fatalf("callAIUsage = %q, %v after %d requests", content, err, calls.Load())
+	}
+	if u.PromptTokens != 5 || u.CompletionTokens != 6 {
+		t.Errorf("usage = %+v", u)
+	}
+	for _, want := range []string{"the provider answered 429", "(1/3)", "the provider answered 502", "(2/3)"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("retry lines lack %q:\n%s", want, stderr)
+		}
+	}
+}
+
+func TestCallAIUsageGivesUp(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.Model, cfg.Retries, cfg.RetryMaxWait, cfg.Quiet = "retry-model", 2, 10*time.Millisecond, true
+
+	calls := retryServer(t, 503, 503, 503)
+	_, _, err := callAIUsage(callOptions{Model: cfg.Model}, "prompt", "system")
+	var ae *apiError
+	if !errors.As(err, &ae) || ae.StatusCode != 503 || calls.Load() != 3 {
+		t.Errorf("after the retries: %v, %d requests; want the 503 after 3", err, calls.Load())
+	}
+
+	// An error a retry can't fix is returned at once.
+	calls = retryServer(t, http.StatusUnauthorized)
+	_, _, err = callAIUsage(callOptions{Model: cfg.Model}, "prompt", "system")
+	if !errors.Is(err, ErrAuth) || calls.Load() != 1 {
+		t.Errorf("401: %v, %d requests; want ErrAuth after 1", err, calls.Load())
+	}
+}
+
+func TestMissingSections(t *testing.T) {
+	items := []string{"4. Channels", "5. Select"}
+	got := missingSections(items)
+	want := "## 4. Channels\n\n" + missingPlaceholder + "\n\n## 5. Select\n\n" + missingPlaceholder
+	if got != want {
+		t.Errorf("missingSections = %q, want %q", got, want)
+	}
+	// The sections are found again by their numbers, as redo looks for them.
+	if _, sections := splitSections(got, chunkNumbers(items)); len(sections) != 2 {
+		t.Errorf("%d sections found, want 2", len(sections))
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// codeVerifyTimeout bounds the compile of a single block.
+const codeVerifyTimeout = 30 * time.Second
+
+var codeFenceRe = regexp.MustCompile("(?ms)^([ \\t]*)```[ \\t]*([\\w+#-]+)[^\\n]*\\n(.*?)\\n[ \\t]*```[ \\t]*$")
+
+// CodeCheck is the outcome of verifying one fenced code block.
+type CodeCheck struct {
+	Concept string `json:"concept,omitempty"`
+	Lang    string `json:"lang"`
+	Status  string `json:"status"` // ok, fixed, failed or skipped
+	Error   string `json:"error,omitempty"`
+}
+
+// codeVerifier compiles one block without running it. A nil error means the
+// block compiled; errSkipBlock means it can't be checked in isolation.
+type codeVerifier struct {
+	tool  string // binary that must be on PATH
+	check func(ctx context.Context, src string) error
+}
+
+var codeVerifiers = map[string]codeVerifier{
+	"go": {tool: "go", check: checkGoBlock},
+}
+
+var codeLangAliases = map[string]string{"golang": "go"}
+
+var errSkipBlock = errors.New("skipped")
+
+var goPositionRe = regexp.MustCompile(`^block\.go:\d+(?::\d+)?: `)
+
+// checkVerifyCode reports a missing toolchain before any API calls are made.
+func checkVerifyCode() error {
+	for lang, v := range codeVerifiers {
+		if _, err := exec.LookPath(v.tool); err != nil {
+			return fmt.Errorf("--verify-code needs %s on PATH to check %s blocks", v.tool, lang)
+		}
+	}
+	return nil
+}
+
+// verifyCode compiles every fenced block in content that has a verifier.
+// Failing blocks are repaired once with --fix-code and otherwise annotated
+// with an HTML comment right above the fence.
+func verifyCode(j chunk, content string) (string, []CodeCheck) {
+	preamble, sections := splitSections(content, chunkNumbers(j.items))
+	if len(sections) == 0 {
+		sections = []conceptSection{{Text: content}}
+		preamble = ""
+	}
+
+	var checks []CodeCheck
+	var parts []string
+	if preamble != "" {
+		text, c := verifySection(j, "", preamble)
+		parts, checks = append(parts, text), append(checks, c...)
+	}
+	for _, s := range sections {
+		text, c := verifySection(j, s.Number, s.Text)
+		parts, checks = append(parts, text), append(checks, c...)
+	}
+	return strings.Join(parts, "\n\n"), checks
+}
+
+func verifySection(j chunk, concept, text string) (string, []CodeCheck) {
+	var checks []CodeCheck
+	var b strings.Builder
+	last := 0
+	for _, m := range codeFenceRe.FindAllStringSubmatchIndex(text, -1) {
+		lang := strings.ToLower(text[m[4]:m[5]])
+		if alias, ok := codeLangAliases[lang]; ok {
+			lang = alias
+		}
+		v, ok := codeVerifiers[lang]
+		if !ok {
+			continue
+		}
+		indent, src := text[m[2]:m[3]], text[m[6]:m[7]]
+
+		check := CodeCheck{Concept: concept, Lang: lang, Status: "ok"}
+		err := runVerifier(v, src)
+		if err != nil && !errors.Is(err, errSkipBlock) && cfg.FixCode {
+			if fixed, ferr := fixCodeBlock(j, lang, src, err); ferr == nil {
+				if runVerifier(v, fixed) == nil {
+					b.WriteString(text[last:m[0]])
+					fmt.Fprintf(&b, "%s```%s\n%s\n%s```", indent, text[m[4]:m[5]], fixed, indent)
+					last = m[1]
+					check.Status = "fixed"
+					checks = append(checks, check)
+					continue
+				}
+			} else {
+				fmt.Fprintf(os.Stderr, "Error repairing a %s block in chunk %d: %v\n", lang, j.id+1, ferr)
+			}
+		}
+		switch {
+		case errors.Is(err, errSkipBlock):
+			check.Status, check.Error = "skipped", strings.TrimPrefix(err.Error(), errSkipBlock.Error()+": ")
+		case err != nil:
+			check.Status, check.Error = "failed", err.Error()
+			b.WriteString(text[last:m[0]])
+			fmt.Fprintf(&b, "%s<!-- aiguide: this %s block does not compile: %s -->\n", indent, lang,
+				strings.ReplaceAll(firstLine(check.Error), "--", "- -"))
+			last = m[0]
+		}
+		checks = append(checks, check)
+	}
+	b.WriteString(text[last:])
+	return b.String(), checks
+}
+
+func runVerifier(v codeVerifier, src string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), codeVerifyTimeout)
+	defer cancel()
+	err := v.check(ctx, src)
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: compile timed out after %s", errSkipBlock, codeVerifyTimeout)
+	}
+	return err
+}
+
+func fixCodeBlock(j chunk, lang, src string, compileErr error) (string, error) {
+	prompt := fmt.Sprintf(
+		"This %s code block from a study guide does not compile:\n\n```%s\n%s\n```\n\nCompiler output:\n\n%s\n\n"+
+			"Fix it with the smallest change that keeps what it demonstrates. Respond ONLY with the corrected code in one fenced block.",
+		lang, lang, src, compileErr,
+	)
+	resp, err := callAIWith(callOptions{Model: j.model, Temperature: 0, Purpose: "fix-code"}, prompt,
+		"You are a careful engineer who fixes compile errors without changing intent.")
+	if err != nil {
+		return "", err
+	}
+	if m := codeFenceRe.FindStringSubmatch(strings.TrimSpace(resp)); m != nil {
+		return m[3], nil
+	}
+	return cleanChunkContent(resp), nil
+}
+
+// checkGoBlock builds a block with the go toolchain. Fragments get a package
+// clause, a main function around loose statements and imports for the
+// standard packages they use. Builds run offline in a temp module, so no
+// code is fetched or executed.
+func checkGoBlock(ctx context.Context, src string) error {
+	file, fragment, err := goHarness(src)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "aiguide-verify-")
+	if err != nil {
+		return fmt.Errorf("%w: %v", errSkipBlock, err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module verify\n\ngo 1.21\n"), 0o644); err != nil {
+		return fmt.Errorf("%w: %v", errSkipBlock, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "block.go"), []byte(file), 0o644); err != nil {
+		return fmt.Errorf("%w: %v", errSkipBlock, err)
+	}
+
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", os.DevNull, ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOTOOLCHAIN=local", "CGO_ENABLED=0", "GOWORK=off")
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+
+	var errs []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		// Fragments often declare things only to show them; the compiler's
+		// unused checks would flag nearly every one of them.
+		if fragment && (strings.Contains(line, "declared and not used") || strings.Contains(line, "imported and not used")) {
+			continue
+		}
+		line = strings.TrimPrefix(line, "./")
+		if fragment {
+			// Positions point into the harness, not the block as shown.
+			line = goPositionRe.ReplaceAllString(line, "")
+		}
+		errs = append(errs, line)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errs, "\n"))
+}
+
+// goHarness turns a block into a compilable file. fragment reports whether
+// anything had to be added.
+func goHarness(src string) (file string, fragment bool, err error) {
+	fset := token.NewFileSet()
+	f, perr := parser.ParseFile(fset, "block.go", src, parser.ImportsOnly)
+	if perr == nil && f.Name != nil {
+		if imp := externalImport(f); imp != "" {
+			return "", false, fmt.Errorf("%w: imports %s", errSkipBlock, imp)
+		}
+		return src, false, nil
+	}
+
+	candidates := []string{"package main\n\n" + src, "package main\n\nfunc main() {\n" + src + "\n}\n"}
+	for i, c := range candidates {
+		f, err := parser.ParseFile(fset, "block.go", c, parser.ParseComments)
+		if err != nil {
+			continue
+		}
+		if imp := externalImport(f); imp != "" {
+			return "", true, fmt.Errorf("%w: imports %s", errSkipBlock, imp)
+		}
+		if i == 0 && !hasMain(f) {
+			c += "\nfunc main() {}\n"
+		}
+		return addStdImports(f, c), true, nil
+	}
+	// Neither shape parses: report the error against the block as written.
+	_, err = parser.ParseFile(fset, "block.go", "package main\n\nfunc main() {\n"+src+"\n}\n", 0)
+	return "", true, err
+}
+
+func externalImport(f *ast.File) string {
+	for _, imp := range f.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		if first, _, _ := strings.Cut(path, "/"); strings.Contains(first, ".") {
+			return path
+		}
+	}
+	return ""
+}
+
+func hasMain(f *ast.File) bool {
+	for _, d := range f.Decls {
+		if fn, ok := d.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "main" {
+			return true
+		}
+	}
+	return false
+}
+
+// goStdPackages maps the selector names fragments use most to their import
+// paths, goimports-style.
+var goStdPackages = map[string]string{
+	"atomic": "sync/atomic", "bufio": "bufio", "bytes": "bytes", "context": "context", "errors": "errors",
+	"filepath": "path/filepath", "fmt": "fmt", "http": "net/http", "io": "io", "json": "encoding/json",
+	"log": "log", "math": "math", "os": "os", "rand": "math/rand", "reflect": "reflect", "regexp": "regexp",
+	"runtime": "runtime", "slices": "slices", "sort": "sort", "strconv": "strconv", "strings": "strings",
+	"sync": "sync", "time": "time", "unicode": "unicode", "utf8": "unicode/utf8", "maps": "maps",
+}
+
+// addStdImports adds an import for every standard package the file refers
+// to but doesn't import.
+func addStdImports(f *ast.File, src string) string {
+	imported := map[string]bool{}
+	for _, imp := range f.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		imported[name] = true
+	}
+	declared := map[string]bool{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ValueSpec:
+			for _, id := range n.Names {
+				declared[id.Name] = true
+			}
+		case *ast.AssignStmt:
+			if n.Tok == token.DEFINE {
+				for _, e := range n.Lhs {
+					if id, ok := e.(*ast.Ident); ok {
+						declared[id.Name] = true
+					}
+				}
+			}
+		}
+		return true
+	})
+
+	need := map[string]bool{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && !imported[id.Name] && !declared[id.Name] {
+				if path, ok := goStdPackages[id.Name]; ok {
+					need[path] = true
+				}
+			}
+		}
+		return true
+	})
+	if len(need) == 0 {
+		return src
+	}
+	paths := make([]string, 0, len(need))
+	for p := range need {
+		paths = append(paths, strconv.Quote(p))
+	}
+	sort.Strings(paths)
+	return strings.Replace(src, "package main\n", "package main\n\nimport (\n\t"+strings.Join(paths, "\n\t")+"\n)\n", 1)
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// writeCodeSummary lists the verified blocks and every one still failing.
+func writeCodeSummary(w io.Writer, sections []SectionMeta) {
+	counts := map[string]int{}
+	var failed []CodeCheck
+	total := 0
+	for _, sec := range sections {
+		for _, c := range sec.CodeChecks {
+			counts[c.Status]++
+			total++
+			if c.Status == "failed" {
+				failed = append(failed, c)
+			}
+		}
+	}
+	if total == 0 {
+		return
+	}
+	fmt.Fprintf(w, "-> Code verification: %d blocks, %d ok, %d fixed, %d failed, %d skipped\n",
+		total, counts["ok"], counts["fixed"], counts["failed"], counts["skipped"])
+	for _, c := range failed {
+		where := "preamble"
+		if c.Concept != "" {
+			where = "concept " + c.Concept
+		}
+		fmt.Fprintf(w, "   %s (%s): %s\n", where, c.Lang, firstLine(c.Error))
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//go:embed conceptmap.html
+var conceptmapHTML string
+
+// conceptMap is the data behind the HTML concept map, also written on its
+// own as <guide>.conceptmap.json.
+type conceptMap struct {
+	Schema        string           `json:"$schema"`
+	SchemaVersion int              `json:"schema_version"`
+	Title         string           `json:"title"`
+	Guide         string           `json:"guide"`
+	Nodes         []conceptMapNode `json:"nodes"`
+	Edges         []conceptMapEdge `json:"edges"`
+}
+
+type conceptMapNode struct {
+	ID         int      `json:"id"` // the concept's 1-based position
+	Title      string   `json:"title"`
+	Anchor     string   `json:"anchor"`
+	Part       string   `json:"part,omitempty"`
+	Cluster    string   `json:"cluster,omitempty"`
+	Summary    string   `json:"summary,omitempty"`
+	Difficulty int      `json:"difficulty,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+// conceptMapEdge links two concepts. Kind is "link" for a section linking
+// to another one, "prerequisite" from a concept to one that builds on it,
+// and "overlap" for sections --dedup-content found repeating each other.
+type conceptMapEdge struct {
+	Source int    `json:"source"`
+	Target int    `json:"target"`
+	Kind   string `json:"kind"`
+}
+
+func buildConceptMap(guidePath string, blocks []mdBlock, sc *Sidecar) *conceptMap {
+	title, concepts := guideConcepts(blocks)
+	m := &conceptMap{Schema: schemaURL("conceptmap"), SchemaVersion: schemaVersion, Title: title, Guide: filepath.Base(guidePath), Nodes: []conceptMapNode{}, Edges: []conceptMapEdge{}}
+
+	byAnchor := map[string]int{}
+	for _, c := range concepts {
+		byAnchor[c.Anchor] = c.Item
+		m.Nodes = append(m.Nodes, conceptMapNode{ID: c.Item, Title: c.Title, Anchor: c.Anchor, Part: c.Part, Cluster: c.Part, Summary: c.Summary})
+	}
+	if sc != nil {
+		for _, sec := range sc.Sections {
+			for k, item := range sec.Items {
+				if item < 1 || item > len(m.Nodes) {
+					continue
+				}
+				n := &m.Nodes[item-1]
+				if sec.Difficulty != nil && k < len(sec.Difficulty) {
+					n.Difficulty = sec.Difficulty[k]
+				}
+				if sec.Tags != nil && k < len(sec.Tags) {
+					n.Tags = sec.Tags[k]
+				}
+				if k < len(sec.Prerequisites) {
+					for _, p := range sec.Prerequisites[k] {
+						if p >= 1 && p <= len(m.Nodes) && p != item {
+							m.Edges = append(m.Edges, conceptMapEdge{Source: p, Target: item, Kind: "prerequisite"})
+						}
+					}
+				}
+			}
+			for _, d := range sec.Duplicates {
+				m.Edges = append(m.Edges, conceptMapEdge{Source: d.Item, Target: d.Of, Kind: "overlap"})
+			}
+		}
+	}
+	// Without parts, concepts cluster by their first tag.
+	for i := range m.Nodes {
+		if n := &m.Nodes[i]; n.Cluster == "" && len(n.Tags) > 0 {
+			n.Cluster = n.Tags[0]
+		}
+	}
+
+	seen := map[[2]int]bool{}
+	for _, c := range concepts {
+		for _, a := range c.Links {
+			if t, ok := byAnchor[a]; ok && !seen[[2]int{c.Item, t}] {
+				seen[[2]int{c.Item, t}] = true
+				m.Edges = append(m.Edges, conceptMapEdge{Source: c.Item, Target: t, Kind: "link"})
+			}
+		}
+	}
+	return m
+}
+
+// exportConceptMap writes <guide>.conceptmap.html, a self-contained page
+// with a force-directed graph of the concepts, and the JSON behind it.
+func exportConceptMap(guidePath string) error {
+	src, err := readGuide(guidePath)
+	if err != nil {
+		return err
+	}
+	sc, err := readSidecar(sidecarPath(guidePath))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring unreadable sidecar: %v\n", err)
+	}
+	m := buildConceptMap(guidePath, parseMarkdown(string(src)), sc)
+	if len(m.Nodes) == 0 {
+		return fmt.Errorf("no concept sections found in %s", guidePath)
+	}
+	if m.Title == "" {
+		m.Title = strings.TrimSuffix(filepath.Base(guidePath), ".md")
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	stem := strings.TrimSuffix(guidePath, ".md")
+	if err := os.WriteFile(stem+".conceptmap.json", append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	// json.Marshal escapes <, > and &, so the data can't close the script tag.
+	compact, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	lang, dir := guideLanguage(sc), "ltr"
+	if languages[lang].rtl {
+		dir = "rtl"
+	}
+	page := strings.NewReplacer("{{LANG}}", lang, "{{DIR}}", dir, "{{TITLE}}", html.EscapeString(m.Title), "{{DATA}}", string(compact)).Replace(conceptmapHTML)
+	if err := os.WriteFile(stem+".conceptmap.html", []byte(page), 0o644); err != nil {
+		return err
+	}
+	statusf("-> Wrote %s.conceptmap.html and %s.conceptmap.json (%d concepts, %d connections)\n", stem, stem, len(m.Nodes), len(m.Edges))
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readConceptLines reads --concepts-file or --concepts-extra: one concept
+// per line, "-" for stdin. Blank lines and # comments are skipped.
+func readConceptLines(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(expandHome(path))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%s has no concepts", conceptSource(path))
+	}
+	return lines, nil
+}
+
+func conceptSource(path string) string {
+	if path == "-" {
+		return "stdin"
+	}
+	return path
+}
+
+// numberConcepts numbers the lines 1, 2, 3... in order, the numbering the
+// headings and Table of Contents anchors use. It reports whether a line
+// already carried another number.
+func numberConcepts(lines []string) ([]string, bool) {
+	out := renumberConcepts(lines)
+	changed := false
+	for i, l := range lines {
+		if p := strings.TrimSpace(conceptPrefixRe.FindString(l)); p != "" && unicodeIsDigit(p[0]) && strings.TrimRight(p, ".)") != strconv.Itoa(i+1) {
+			changed = true
+		}
+	}
+	return out, changed
+}
+
+// mergeConcepts appends the extra concepts that aren't in the list yet,
+// compared case-insensitively, and returns the list with how many were
+// added.
+func mergeConcepts(concepts, extra []string) ([]string, int) {
+	seen := make(map[string]bool, len(concepts)+len(extra))
+	for _, c := range concepts {
+		seen[conceptKey(c)] = true
+	}
+	added := 0
+	for _, c := range extra {
+		if k := conceptKey(c); !seen[k] {
+			seen[k] = true
+			concepts = append(concepts, c)
+			added++
+		}
+	}
+	return concepts, added
+}
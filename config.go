@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileConfig is the optional JSON config file. It lives at
+// $XDG_CONFIG_HOME/aiguide/config.json unless --config or AIGUIDE_CONFIG
+// points elsewhere.
+type FileConfig struct {
+	Providers map[string]ProviderProfile `json:"providers,omitempty"`
+	Hooks     RunHooks                   `json:"hooks,omitempty"`
+	History   HistoryConfig              `json:"history,omitempty"`
+	Profiles  map[string]FlagProfile     `json:"profiles,omitempty"`
+}
+
+// RunHooks are the default --pre-hook and --post-hook commands.
+type RunHooks struct {
+	Pre  string `json:"pre,omitempty"`
+	Post string `json:"post,omitempty"`
+}
+
+var configPath string
+
+func defaultConfigPath() string {
+	if p := os.Getenv("AIGUIDE_CONFIG"); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "aiguide", "config.json")
+}
+
+// loadFileConfig reads the config file. A missing default file is not an
+// error; a missing file that was asked for explicitly is.
+func loadFileConfig() (*FileConfig, error) {
+	path := configPath
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath()
+	}
+
+	fc := &FileConfig{}
+	if path == "" {
+		return fc, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return fc, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, fc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return fc, nil
+}
+
+// expandHome replaces a leading "~/" with the user's home directory.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
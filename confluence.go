@@ -0,0 +1,528 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	confluenceMaxRetries = 5
+	confluenceURLEnvVar  = "CONFLUENCE_URL"
+	confluenceSpaceEnv   = "CONFLUENCE_SPACE"
+	confluenceParentEnv  = "CONFLUENCE_PARENT_PAGE"
+)
+
+// confluenceLanguages maps fence languages onto names the code macro knows.
+// Anything else is rendered without syntax highlighting.
+var confluenceLanguages = map[string]string{
+	"bash": "bash", "sh": "bash", "shell": "bash", "zsh": "bash", "powershell": "powershell",
+	"c": "cpp", "cpp": "cpp", "c++": "cpp", "csharp": "c#", "cs": "c#", "c#": "c#",
+	"css": "css", "diff": "diff", "erlang": "erl", "go": "go", "golang": "go", "groovy": "groovy",
+	"html": "html", "xml": "xml", "java": "java", "javascript": "js", "js": "js", "typescript": "js", "ts": "js",
+	"json": "js", "kotlin": "kotlin", "perl": "perl", "php": "php", "python": "py", "py": "py",
+	"ruby": "ruby", "rust": "rust", "scala": "scala", "sql": "sql", "swift": "swift",
+	"yaml": "yml", "yml": "yml", "text": "text", "txt": "text",
+}
+
+var conceptTitleRe = regexp.MustCompile(`^\d+\.\s`)
+
+// confluencePage is one page to create or update; with --confluence-child-pages
+// every concept gets its own page under the guide.
+type confluencePage struct {
+	Title string
+	Body  string
+}
+
+type confluenceConverter struct {
+	warnings   map[string]int
+	childPages bool
+	pageOf     map[string]string // anchor -> child page title
+}
+
+func (c *confluenceConverter) warn(msg string) {
+	c.warnings[msg]++
+}
+
+func cdata(s string) string {
+	return "<![CDATA[" + strings.ReplaceAll(s, "]]>", "]]]]><![CDATA[>") + "]]>"
+}
+
+func (c *confluenceConverter) inline(text string) string {
+	var b strings.Builder
+	for _, s := range parseInline(text) {
+		var part string
+		switch {
+		case s.Code:
+			part = "<code>" + html.EscapeString(s.Text) + "</code>"
+		case strings.HasPrefix(s.Link, "#"):
+			anchor := strings.TrimPrefix(s.Link, "#")
+			if page, ok := c.pageOf[anchor]; ok {
+				part = fmt.Sprintf(`<ac:link><ri:page ri:content-title="%s" /><ac:plain-text-link-body>%s</ac:plain-text-link-body></ac:link>`,
+					html.EscapeString(page), cdata(s.Text))
+			} else {
+				part = fmt.Sprintf(`<ac:link ac:anchor="%s"><ac:plain-text-link-body>%s</ac:plain-text-link-body></ac:link>`,
+					html.EscapeString(anchor), cdata(s.Text))
+			}
+		case s.Link != "":
+			part = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(s.Link), html.EscapeString(s.Text))
+		default:
+			part = html.EscapeString(s.Text)
+		}
+		if s.Italic {
+			part = "<em>" + part + "</em>"
+		}
+		if s.Bold {
+			part = "<strong>" + part + "</strong>"
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+func anchorMacro(name string) string {
+	return `<ac:structured-macro ac:name="anchor"><ac:parameter ac:name="">` + html.EscapeString(name) + `</ac:parameter></ac:structured-macro>`
+}
+
+type listFrame struct {
+	tag   string
+	depth int
+}
+
+// convert renders parsed markdown as Confluence storage-format XHTML. The
+// guide's H1 becomes the page title. Headings carry anchor macros named like
+// the markdown anchors, so Table of Contents links keep working.
+func (c *confluenceConverter) convert(blocks []mdBlock) (string, []confluencePage) {
+	var title string
+	for _, b := range blocks {
+		if b.Kind == "heading" && b.Level == 1 {
+			title = plainInline(b.Text)
+			break
+		}
+	}
+
+	c.pageOf = map[string]string{}
+	if c.childPages {
+		for _, b := range blocks {
+			if b.Kind == "heading" && b.Level == 2 && conceptTitleRe.MatchString(b.Text) {
+				c.pageOf[mdAnchor(b.Text)] = childPageTitle(title, b.Text)
+			}
+		}
+	}
+
+	pages := []confluencePage{{Title: title}}
+	var body strings.Builder
+	var lists []listFrame
+	inTOC, seenTitle, inAlt, inDetails := false, false, false, false
+
+	closeLists := func(depth int) {
+		for len(lists) > 0 && lists[len(lists)-1].depth > depth {
+			fmt.Fprintf(&body, "</li></%s>", lists[len(lists)-1].tag)
+			lists = lists[:len(lists)-1]
+		}
+	}
+	// An alternate explanation folds into an expand macro, up to the next
+	// heading or rule.
+	closeAlt := func() {
+		if inAlt {
+			closeLists(-1)
+			body.WriteString("</ac:rich-text-body></ac:structured-macro>")
+			inAlt = false
+		}
+	}
+	// A details block, like a hidden Socratic answer, folds into an expand
+	// macro titled with its summary.
+	closeDetails := func() {
+		if inDetails {
+			closeLists(-1)
+			body.WriteString("</ac:rich-text-body></ac:structured-macro>")
+			inDetails = false
+		}
+	}
+	flushPage := func() {
+		closeAlt()
+		closeDetails()
+		closeLists(-1)
+		pages[len(pages)-1].Body = body.String()
+		body.Reset()
+	}
+
+	for _, b := range blocks {
+		isItem := b.Kind == "bullet" || b.Kind == "numbered"
+		if inTOC && c.childPages && isItem {
+			continue
+		}
+		if !isItem {
+			inTOC = false
+			closeLists(-1)
+		}
+
+		if b.Kind == "heading" || b.Kind == "rule" {
+			closeAlt()
+		}
+
+		switch b.Kind {
+		case "heading":
+			if b.Level == 1 && !seenTitle {
+				seenTitle = true
+				continue
+			}
+			if isAltHeading(b.Text) {
+				fmt.Fprintf(&body, `<ac:structured-macro ac:name="expand"><ac:parameter ac:name="title">%s</ac:parameter><ac:rich-text-body>`, html.EscapeString(plainInline(b.Text)))
+				inAlt = true
+				continue
+			}
+			if isTOCHeading(b.Text) {
+				inTOC = true
+				if c.childPages {
+					body.WriteString(`<ac:structured-macro ac:name="children" />`)
+					continue
+				}
+			}
+			anchor := mdAnchor(b.Text)
+			if page, ok := c.pageOf[anchor]; ok {
+				flushPage()
+				pages = append(pages, confluencePage{Title: page})
+				body.WriteString(anchorMacro(anchor))
+				continue
+			}
+			fmt.Fprintf(&body, "<h%d>%s%s</h%d>", b.Level, anchorMacro(anchor), c.inline(b.Text), b.Level)
+		case "paragraph":
+			fmt.Fprintf(&body, "<p>%s</p>", c.inline(b.Text))
+		case "bullet", "numbered":
+			tag := "ul"
+			if b.Kind == "numbered" {
+				tag = "ol"
+			}
+			closeLists(b.Level)
+			top := len(lists) - 1
+			switch {
+			case top >= 0 && lists[top].depth == b.Level && lists[top].tag == tag:
+				body.WriteString("</li><li>")
+			case top >= 0 && lists[top].depth == b.Level:
+				fmt.Fprintf(&body, "</li></%s><%s><li>", lists[top].tag, tag)
+				lists[top].tag = tag
+			default:
+				fmt.Fprintf(&body, "<%s><li>", tag)
+				lists = append(lists, listFrame{tag: tag, depth: b.Level})
+			}
+			body.WriteString(c.inline(b.Text))
+		case "code":
+			body.WriteString(`<ac:structured-macro ac:name="code">`)
+			if lang, ok := confluenceLanguages[b.Lang]; ok {
+				fmt.Fprintf(&body, `<ac:parameter ac:name="language">%s</ac:parameter>`, lang)
+			} else if b.Lang != "" {
+				c.warn(fmt.Sprintf("code language %q shown without highlighting", b.Lang))
+			}
+			fmt.Fprintf(&body, "<ac:plain-text-body>%s</ac:plain-text-body></ac:structured-macro>", cdata(b.Text))
+		case "quote":
+			lines := strings.Split(b.Text, "\n")
+			for i, l := range lines {
+				lines[i] = c.inline(l)
+			}
+			fmt.Fprintf(&body, "<blockquote><p>%s</p></blockquote>", strings.Join(lines, "<br />"))
+		case "rule":
+			body.WriteString("<hr />")
+		case "table":
+			body.WriteString("<table><tbody>")
+			for i, row := range b.Rows {
+				cell := "td"
+				if i == 0 {
+					cell = "th"
+				}
+				body.WriteString("<tr>")
+				for _, v := range row {
+					fmt.Fprintf(&body, "<%s>%s</%s>", cell, c.inline(v), cell)
+				}
+				body.WriteString("</tr>")
+			}
+			body.WriteString("</tbody></table>")
+		case "html":
+			if strings.HasPrefix(strings.TrimSpace(b.Text), "<!--") {
+				c.warn("HTML comment dropped")
+				continue
+			}
+			switch tag, summary := detailsTag(b.Text); tag {
+			case "open":
+				continue
+			case "summary":
+				closeDetails()
+				fmt.Fprintf(&body, `<ac:structured-macro ac:name="expand"><ac:parameter ac:name="title">%s</ac:parameter><ac:rich-text-body>`, html.EscapeString(summary))
+				inDetails = true
+				continue
+			case "close":
+				closeDetails()
+				continue
+			}
+			c.warn("raw HTML kept as plain text")
+			fmt.Fprintf(&body, "<p>%s</p>", html.EscapeString(b.Text))
+		}
+	}
+	flushPage()
+	return title, pages
+}
+
+// childPageTitle keeps concept pages unique within the space, since
+// Confluence titles must be.
+func childPageTitle(guideTitle, heading string) string {
+	return plainInline(heading) + " — " + guideTitle
+}
+
+type confluenceClient struct {
+	base string
+	auth string
+	http *http.Client
+}
+
+func newConfluenceClient(base string) *confluenceClient {
+	auth := "Bearer " + os.Getenv("CONFLUENCE_TOKEN")
+	if user := os.Getenv("CONFLUENCE_USER"); user != "" {
+		auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+os.Getenv("CONFLUENCE_TOKEN")))
+	}
+	return &confluenceClient{
+		base: strings.TrimSuffix(base, "/"),
+		auth: auth,
+		http: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type confluenceStatusError struct {
+	Status     string
+	StatusCode int
+	Body       string
+}
+
+func (e *confluenceStatusError) Error() string {
+	return fmt.Sprintf("Confluence API error: %s - %s", e.Status, truncate(e.Body, 300))
+}
+
+func (c *confluenceClient) do(method, path string, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, c.base+path, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", c.auth)
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return err
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500) && attempt < confluenceMaxRetries {
+			wait := time.Duration(1<<attempt) * time.Second
+			if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				wait = time.Duration(secs) * time.Second
+			}
+			time.Sleep(wait)
+			continue
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return &confluenceStatusError{Status: resp.Status, StatusCode: resp.StatusCode, Body: string(respBody)}
+		}
+		if out == nil {
+			return nil
+		}
+		return json.Unmarshal(respBody, out)
+	}
+}
+
+type confluenceLabel struct {
+	Prefix string `json:"prefix"`
+	Name   string `json:"name"`
+}
+
+type confluenceContent struct {
+	ID      string `json:"id"`
+	Version struct {
+		Number int `json:"number"`
+	} `json:"version"`
+	Metadata struct {
+		Labels struct {
+			Results []confluenceLabel `json:"results"`
+		} `json:"labels"`
+	} `json:"metadata"`
+	Links struct {
+		Base  string `json:"base"`
+		WebUI string `json:"webui"`
+	} `json:"_links"`
+}
+
+func (c *confluenceClient) find(space, title string) (*confluenceContent, error) {
+	q := url.Values{
+		"spaceKey": {space},
+		"title":    {title},
+		"type":     {"page"},
+		"expand":   {"version,metadata.labels"},
+	}
+	var res struct {
+		Results []confluenceContent `json:"results"`
+		Links   struct {
+			Base string `json:"base"`
+		} `json:"_links"`
+	}
+	if err := c.do("GET", "/rest/api/content?"+q.Encode(), nil, &res); err != nil {
+		return nil, err
+	}
+	if len(res.Results) == 0 {
+		return nil, nil
+	}
+	page := res.Results[0]
+	if page.Links.Base == "" {
+		page.Links.Base = res.Links.Base
+	}
+	return &page, nil
+}
+
+// upsert creates the page, or replaces the body of an existing page with the
+// same title. Updates bump the version by one and retry once on a version
+// conflict; labels are re-applied afterwards so they survive the update.
+func (c *confluenceClient) upsert(space, parentID string, page confluencePage) (*confluenceContent, error) {
+	storage := map[string]any{"storage": map[string]any{"value": page.Body, "representation": "storage"}}
+
+	for attempt := 0; ; attempt++ {
+		existing, err := c.find(space, page.Title)
+		if err != nil {
+			return nil, err
+		}
+
+		var saved confluenceContent
+		if existing == nil {
+			req := map[string]any{
+				"type":  "page",
+				"title": page.Title,
+				"space": map[string]any{"key": space},
+				"body":  storage,
+			}
+			if parentID != "" {
+				req["ancestors"] = []map[string]any{{"id": parentID}}
+			}
+			if err := c.do("POST", "/rest/api/content", req, &saved); err != nil {
+				return nil, err
+			}
+			return &saved, nil
+		}
+
+		err = c.do("PUT", "/rest/api/content/"+existing.ID, map[string]any{
+			"id":      existing.ID,
+			"type":    "page",
+			"title":   page.Title,
+			"space":   map[string]any{"key": space},
+			"body":    storage,
+			"version": map[string]any{"number": existing.Version.Number + 1, "message": "Updated by aiguide"},
+		}, &saved)
+		var se *confluenceStatusError
+		if errors.As(err, &se) && se.StatusCode == http.StatusConflict && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if labels := existing.Metadata.Labels.Results; len(labels) > 0 {
+			if err := c.do("POST", "/rest/api/content/"+existing.ID+"/label", labels, nil); err != nil {
+				return nil, fmt.Errorf("page updated but restoring labels failed: %w", err)
+			}
+		}
+		if saved.Links.Base == "" {
+			saved.Links.Base = existing.Links.Base
+		}
+		return &saved, nil
+	}
+}
+
+func checkConfluence() error {
+	if cfg.ConfluenceURL == "" {
+		cfg.ConfluenceURL = os.Getenv(confluenceURLEnvVar)
+	}
+	if cfg.ConfluenceSpace == "" {
+		cfg.ConfluenceSpace = os.Getenv(confluenceSpaceEnv)
+	}
+	if cfg.ConfluenceParent == "" {
+		cfg.ConfluenceParent = os.Getenv(confluenceParentEnv)
+	}
+	if cfg.ConfluenceURL == "" {
+		return fmt.Errorf("Confluence export requires --confluence-url (or %s)", confluenceURLEnvVar)
+	}
+	if cfg.ConfluenceSpace == "" {
+		return fmt.Errorf("Confluence export requires --confluence-space (or %s)", confluenceSpaceEnv)
+	}
+	if os.Getenv("CONFLUENCE_TOKEN") == "" {
+		return fmt.Errorf("Confluence export requires the CONFLUENCE_TOKEN environment variable")
+	}
+	return nil
+}
+
+func exportConfluence(guidePath string) error {
+	if err := checkConfluence(); err != nil {
+		return err
+	}
+
+	src, err := readGuide(guidePath)
+	if err != nil {
+		return err
+	}
+
+	conv := &confluenceConverter{warnings: map[string]int{}, childPages: cfg.ConfluenceChildPages}
+	title, pages := conv.convert(parseMarkdown(string(src)))
+	if title == "" {
+		pages[0].Title = strings.TrimSuffix(guidePath, ".md")
+	}
+
+	client := newConfluenceClient(cfg.ConfluenceURL)
+	root, err := client.upsert(cfg.ConfluenceSpace, cfg.ConfluenceParent, pages[0])
+	if err != nil {
+		return err
+	}
+	for i, p := range pages[1:] {
+		if _, err := client.upsert(cfg.ConfluenceSpace, root.ID, p); err != nil {
+			return fmt.Errorf("child page %d of %d (%s): %w", i+1, len(pages)-1, p.Title, err)
+		}
+	}
+
+	base := root.Links.Base
+	if base == "" {
+		base = client.base
+	}
+	statusf("-> Confluence page: %s%s\n", base, root.Links.WebUI)
+	if len(pages) > 1 {
+		statusf("-> %d child pages\n", len(pages)-1)
+	}
+	if len(conv.warnings) > 0 {
+		msgs := make([]string, 0, len(conv.warnings))
+		for m := range conv.warnings {
+			msgs = append(msgs, m)
+		}
+		sort.Strings(msgs)
+		fmt.Fprintln(os.Stderr, "-> Confluence conversion warnings:")
+		for _, m := range msgs {
+			fmt.Fprintf(os.Stderr, "   %s (%dx)\n", m, conv.warnings[m])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// golden compares got with the golden file path, or rewrites it with
+// -update.
+func golden(t *testing.T, path, got string) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from the output:\n got: %s\nwant: %s", path, got, want)
+	}
+}
+
+func TestConfluenceGolden(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/confluence/*.md")
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("no inputs: %v", err)
+	}
+	for _, in := range inputs {
+		t.Run(filepath.Base(in), func(t *testing.T) {
+			src, err := os.ReadFile(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conv := &confluenceConverter{warnings: map[string]int{}}
+			title, pages := conv.convert(parseMarkdown(string(src)))
+			if len(pages) != 1 || pages[0].Title != title {
+				t.Fatalf("got %d pages titled %q, want one titled %q", len(pages), pages[0].Title, title)
+			}
+			golden(t, strings.TrimSuffix(in, ".md")+".xhtml", title+"\n"+strings.ReplaceAll(pages[0].Body, "><", ">\n<")+"\n")
+		})
+	}
+}
+
+func TestConfluenceChildPages(t *testing.T) {
+	src, err := os.ReadFile("testdata/confluence/inline_code.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv := &confluenceConverter{warnings: map[string]int{}, childPages: true}
+	title, pages := conv.convert(parseMarkdown(string(src)))
+	if len(pages) != 2 {
+		t.Fatalf("got %d pages, want the guide and one concept page", len(pages))
+	}
+	if want := "3. Slices & Maps — " + title; pages[1].Title != want {
+		t.Errorf("child page title = %q, want %q", pages[1].Title, want)
+	}
+	if !strings.Contains(pages[0].Body, `<ac:structured-macro ac:name="children" />`) || strings.Contains(pages[0].Body, "<li>") {
+		t.Errorf("the guide page should list its children instead of the ToC: %s", pages[0].Body)
+	}
+}
+
+func TestConfluenceWarnings(t *testing.T) {
+	src, err := os.ReadFile("testdata/confluence/inline_code.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv := &confluenceConverter{warnings: map[string]int{}}
+	conv.convert(parseMarkdown(string(src)))
+	if conv.warnings[`code language "brainfuck" shown without highlighting`] != 1 || len(conv.warnings) != 1 {
+		t.Errorf("warnings = %v, want one for the unknown code language", conv.warnings)
+	}
+}
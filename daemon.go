@@ -0,0 +1,784 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// A job is the argv of an ordinary run, "<subject> [flags]", which the
+// daemon runs as a child aiguide process. Flags are parsed and validated by
+// the same root command as on the CLI, first with --dry-run when the job is
+// submitted and again when it runs.
+
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobPartial   = "partial"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// keepFinishedJobs is how many finished jobs the queue remembers.
+const keepFinishedJobs = 200
+
+type daemonJob struct {
+	ID        int        `json:"id"`
+	Args      []string   `json:"args"`
+	User      string     `json:"user,omitempty"`
+	Status    string     `json:"status"`
+	Output    string     `json:"output,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Cost      *float64   `json:"cost_usd,omitempty"`
+	Submitted time.Time  `json:"submitted"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+}
+
+func (j daemonJob) finished() bool {
+	return j.Status != jobQueued && j.Status != jobRunning
+}
+
+// daemonRequest is one request over the socket; the daemon answers with one
+// daemonResponse line, and a second one when a job finishes for Wait. The
+// submitter is taken from the socket, not the request.
+type daemonRequest struct {
+	Op   string   `json:"op"` // submit, queue or cancel
+	Args []string `json:"args,omitempty"`
+	ID   int      `json:"id,omitempty"`
+	Wait bool     `json:"wait,omitempty"`
+}
+
+type daemonResponse struct {
+	Error string      `json:"error,omitempty"`
+	Job   *daemonJob  `json:"job,omitempty"`
+	Ahead int         `json:"ahead,omitempty"` // queued jobs before Job
+	Jobs  []daemonJob `json:"jobs,omitempty"`
+}
+
+// daemonAllowedFlags are the flags a submitted job may set: the ones that
+// shape the guide written to the daemon's --output-dir. The others would
+// run commands or read files as the daemon's user (hooks, --system-prompt,
+// --concepts-file, --version-of, --resume), send the guide or the
+// daemon's credentials elsewhere (--webhook, --git-push, --gist), dodge the
+// budget (--price-in) or break the daemon's handling of the child.
+var daemonAllowedFlags = []string{
+	"provider", "profile", "number", "chunk", "stream", "threads", "info", "mode", "filename-template",
+	"no-provenance", "provenance-style", "model", "cheap-model", "route-by-difficulty", "route-threshold",
+	"show-difficulty", "prerequisites", "order", "seed", "max-difficulty", "practice", "solutions",
+	"bloom", "bloom-max-remember", "show-bloom", "misconceptions", "pitfalls", "mnemonics",
+	"verify-code", "fix-code", "check-links", "broken-links", "link-timeout", "dedup-content",
+	"dedup-threshold", "readability", "readability-target", "readability-fix", "tables", "study-time",
+	"reading-speed", "difficulty-multipliers", "exercise-minutes", "study-plan", "citation-style",
+	"footnote-placement", "plan-start", "weekends-off", "sessions-per-week", "session-minutes",
+	"session-time", "outline-only", "error-format", "max-cost", "max-total-tokens", "lang",
+	"alt-explanations", "alt-model", "no-answers", "no-history", "target-length", "words-per-page",
+	"analogy-domain", "timeline", "consistent-terms", "glossary", "retries", "retry-max-wait", "format",
+	"no-verify", "quiet", "verbose", "system-role", "best-of", "tags", "tag-set", "only-tags", "skip-tags",
+	"group-by", "depth", "sub-count", "export", "no-sidecar",
+}
+
+// daemonRejectedExports publish with the daemon's credentials.
+var daemonRejectedExports = []string{"notion", "confluence"}
+
+// jobFlags are the flags a job sets, by long name, with their values in
+// the order given.
+type jobFlags map[string][]string
+
+// recordedValue stands in for a root flag's value: it keeps what the job
+// sets instead of changing the daemon's own config.
+type recordedValue struct {
+	name, typ string
+	flags     jobFlags
+}
+
+func (v *recordedValue) Set(s string) error {
+	v.flags[v.name] = append(v.flags[v.name], s)
+	return nil
+}
+
+func (v *recordedValue) String() string { return "" }
+func (v *recordedValue) Type() string   { return v.typ }
+
+// parseJobArgs parses a job's argv with the names, shorthands and value
+// rules of the root command's flags, so every spelling pflag accepts
+// ("--name=value", "-n5", "-qv") is checked against daemonAllowedFlags. The
+// values themselves are validated by the dry run.
+func parseJobArgs(root *pflag.FlagSet, args []string) (jobFlags, []string, error) {
+	flags := jobFlags{}
+	fs := pflag.NewFlagSet("job", pflag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	root.VisitAll(func(f *pflag.Flag) {
+		fs.AddFlag(&pflag.Flag{Name: f.Name, Shorthand: f.Shorthand, NoOptDefVal: f.NoOptDefVal,
+			Value: &recordedValue{name: f.Name, typ: f.Value.Type(), flags: flags}})
+	})
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	var err error
+	fs.Visit(func(f *pflag.Flag) {
+		if err == nil && !slices.Contains(daemonAllowedFlags, f.Name) {
+			err = fmt.Errorf("--%s cannot be used in a submitted job", f.Name)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, v := range flags["info"] {
+		if strings.HasPrefix(v, "@") {
+			return nil, nil, errors.New("--info @file cannot be used in a submitted job; pass the text itself")
+		}
+	}
+	for _, v := range flags["export"] {
+		for _, name := range strings.Split(v, ",") {
+			if slices.Contains(daemonRejectedExports, strings.TrimSpace(name)) {
+				return nil, nil, fmt.Errorf("--export %s cannot be used in a submitted job", strings.TrimSpace(name))
+			}
+		}
+	}
+	return flags, fs.Args(), nil
+}
+
+// last is the last value a job gives the flag, or "".
+func (f jobFlags) last(name string) string {
+	if v := f[name]; len(v) > 0 {
+		return v[len(v)-1]
+	}
+	return ""
+}
+
+// submitLimiter is a token bucket shared by all callers. Each submission
+// starts a dry-run child, so a flood of them, from one teammate or many,
+// would starve the running jobs.
+type submitLimiter struct {
+	mu     sync.Mutex
+	perMin float64 // 0 = no limit
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token, or reports how long until the next one.
+func (l *submitLimiter) allow(now time.Time) (time.Duration, bool) {
+	if l.perMin <= 0 {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.last.IsZero() {
+		l.tokens = l.perMin
+	} else {
+		l.tokens = min(l.perMin, l.tokens+now.Sub(l.last).Minutes()*l.perMin)
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return time.Duration((1 - l.tokens) / l.perMin * float64(time.Minute)), false
+	}
+	l.tokens--
+	return 0, true
+}
+
+// stateDir holds the daemon's socket and queue: $XDG_STATE_HOME/aiguide,
+// else ~/.local/state/aiguide.
+func stateDir() string {
+	if d := os.Getenv("XDG_STATE_HOME"); d != "" {
+		return filepath.Join(d, "aiguide")
+	}
+	return expandHome("~/.local/state/aiguide")
+}
+
+func defaultSocketPath() string {
+	if p := os.Getenv("AIGUIDE_SOCKET"); p != "" {
+		return p
+	}
+	return filepath.Join(stateDir(), "daemon.sock")
+}
+
+type daemon struct {
+	store     *queueStore
+	outputDir string
+	provider  string
+	parallel  int
+	maxCost   float64
+	rootFlags *pflag.FlagSet // the flags a job's argv is parsed with
+	submits   submitLimiter
+
+	mu      sync.Mutex
+	ready   *sync.Cond // signalled when a job is queued or the daemon closes
+	jobs    []*daemonJob
+	nextID  int
+	spent   float64
+	cancels map[int]context.CancelFunc
+	waiters map[int][]chan daemonJob
+	closing bool
+	running sync.WaitGroup
+}
+
+// daemonState is the stored queue, and the queue.json of older versions.
+type daemonState struct {
+	NextID   int          `json:"next_id"`
+	SpentUSD float64      `json:"spent_usd"`
+	Jobs     []*daemonJob `json:"jobs"`
+}
+
+// load reads the stored queue. Jobs that were running when the daemon
+// stopped are queued again and start over.
+func (d *daemon) load() error {
+	st, err := d.store.load()
+	if err != nil {
+		return err
+	}
+	d.jobs, d.nextID, d.spent = st.Jobs, max(st.NextID, 1), st.SpentUSD
+	for _, j := range d.jobs {
+		if j.Status == jobRunning {
+			j.Status, j.Started = jobQueued, nil
+			d.save(j)
+			fmt.Printf("-> Requeued job %d, which was running when the daemon stopped\n", j.ID)
+		}
+	}
+	return nil
+}
+
+// save stores the changed jobs and the counters, and forgets the oldest
+// finished jobs beyond keepFinishedJobs; the caller holds d.mu.
+func (d *daemon) save(changed ...*daemonJob) {
+	var finished int
+	var drop []int
+	for i := len(d.jobs) - 1; i >= 0; i-- {
+		if d.jobs[i].finished() {
+			if finished++; finished > keepFinishedJobs {
+				drop = append(drop, d.jobs[i].ID)
+				d.jobs = slices.Delete(d.jobs, i, i+1)
+			}
+		}
+	}
+	if err := d.store.save(d.nextID, d.spent, changed, drop); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving the queue: %v\n", err)
+	}
+}
+
+func (d *daemon) job(id int) *daemonJob {
+	for _, j := range d.jobs {
+		if j.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+// serve accepts clients on the socket until the daemon is told to stop.
+func (d *daemon) serve(socket string) error {
+	if err := os.MkdirAll(filepath.Dir(socket), 0o755); err != nil {
+		return err
+	}
+	if c, err := net.Dial("unix", socket); err == nil {
+		c.Close()
+		return fmt.Errorf("a daemon is already listening on %s", socket)
+	}
+	os.Remove(socket)
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	// Teammates in the daemon user's group may submit jobs.
+	if err := os.Chmod(socket, 0o660); err != nil {
+		ln.Close()
+		return err
+	}
+	fmt.Printf("-> Listening on %s, writing guides to %s (%d at a time)\n", socket, d.outputDir, d.parallel)
+
+	for i := 0; i < d.parallel; i++ {
+		go d.work()
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		fmt.Println("\n-> Stopping; running jobs will be requeued")
+		d.close()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			d.mu.Lock()
+			closing := d.closing
+			d.mu.Unlock()
+			if closing {
+				d.running.Wait()
+				return nil
+			}
+			return err
+		}
+		go d.handle(conn)
+	}
+}
+
+// close interrupts the running jobs, which the workers then requeue.
+func (d *daemon) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closing = true
+	for _, cancel := range d.cancels {
+		cancel()
+	}
+	d.ready.Broadcast()
+}
+
+func (d *daemon) handle(conn net.Conn) {
+	defer conn.Close()
+	enc := json.NewEncoder(conn)
+	var req daemonRequest
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		enc.Encode(daemonResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+	switch req.Op {
+	case "submit":
+		submitter, err := peerUser(conn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: cannot tell who submitted a job: %v\n", err)
+		}
+		var done chan daemonJob
+		if req.Wait {
+			done = make(chan daemonJob, 1)
+		}
+		job, ahead, err := d.submit(req, submitter, done)
+		if err != nil {
+			enc.Encode(daemonResponse{Error: err.Error()})
+			return
+		}
+		if !req.Wait {
+			enc.Encode(daemonResponse{Job: &job, Ahead: ahead})
+			return
+		}
+		if enc.Encode(daemonResponse{Job: &job, Ahead: ahead}) != nil {
+			return
+		}
+		final := <-done
+		enc.Encode(daemonResponse{Job: &final})
+	case "queue":
+		d.mu.Lock()
+		jobs := make([]daemonJob, len(d.jobs))
+		for i, j := range d.jobs {
+			jobs[i] = *j
+		}
+		d.mu.Unlock()
+		enc.Encode(daemonResponse{Jobs: jobs})
+	case "cancel":
+		job, err := d.cancel(req.ID)
+		if err != nil {
+			enc.Encode(daemonResponse{Error: err.Error()})
+			return
+		}
+		enc.Encode(daemonResponse{Job: &job})
+	default:
+		enc.Encode(daemonResponse{Error: fmt.Sprintf("unknown op %q", req.Op)})
+	}
+}
+
+// submit checks a job's flags and a dry run of it, and queues it. done, if
+// not nil, is told the job's outcome; it is registered before any worker
+// can see the job, so a job that finishes at once still reaches it.
+func (d *daemon) submit(req daemonRequest, submitter string, done chan daemonJob) (daemonJob, int, error) {
+	if wait, ok := d.submits.allow(time.Now()); !ok {
+		return daemonJob{}, 0, fmt.Errorf("too many submissions, try again in %s", wait.Round(time.Second)+time.Second)
+	}
+	_, subject, err := parseJobArgs(d.rootFlags, req.Args)
+	if err != nil {
+		return daemonJob{}, 0, fmt.Errorf("the job was rejected: %v", err)
+	}
+	if len(subject) != 1 {
+		return daemonJob{}, 0, errors.New("a job needs exactly one subject")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var reason string
+	onLine := func(line string, stderr bool) {
+		if stderr && reason == "" && strings.HasPrefix(line, "Error") {
+			reason = strings.TrimPrefix(line, "Error: ")
+		}
+	}
+	if err := runAiguideChild(ctx, d.outputDir, append(d.childArgs(req.Args, 0), "--dry-run"), func(progressEvent) {}, onLine); err != nil {
+		if reason == "" {
+			return daemonJob{}, 0, fmt.Errorf("the job was rejected: %v", err)
+		}
+		return daemonJob{}, 0, fmt.Errorf("the job was rejected: %s", reason)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closing {
+		return daemonJob{}, 0, errors.New("the daemon is stopping")
+	}
+	job := &daemonJob{ID: d.nextID, Args: req.Args, User: submitter, Status: jobQueued, Submitted: time.Now()}
+	d.nextID++
+	ahead := 0
+	for _, j := range d.jobs {
+		if j.Status == jobQueued {
+			ahead++
+		}
+	}
+	d.jobs = append(d.jobs, job)
+	d.save(job)
+	if done != nil {
+		d.waiters[job.ID] = append(d.waiters[job.ID], done)
+	}
+	d.ready.Signal()
+	fmt.Printf("-> Queued job %d from %s: %s\n", job.ID, orUnknown(job.User), strings.Join(job.Args, " "))
+	return *job, ahead, nil
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+func (d *daemon) cancel(id int) (daemonJob, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	j := d.job(id)
+	switch {
+	case j == nil:
+		return daemonJob{}, fmt.Errorf("no job %d", id)
+	case j.Status == jobQueued:
+		d.finish(j, jobCancelled, "")
+	case j.Status == jobRunning:
+		d.cancels[id]()
+	default:
+		return *j, fmt.Errorf("job %d has already finished (%s)", id, j.Status)
+	}
+	return *j, nil
+}
+
+// finish records a job's outcome and tells its waiters; the caller holds
+// d.mu.
+func (d *daemon) finish(j *daemonJob, status, msg string) {
+	now := time.Now()
+	j.Status, j.Error, j.Finished = status, msg, &now
+	d.save(j)
+	for _, w := range d.waiters[j.ID] {
+		w <- *j
+	}
+	delete(d.waiters, j.ID)
+	fmt.Printf("-> Job %d %s\n", j.ID, status)
+}
+
+// work runs queued jobs, oldest first, until the daemon closes.
+func (d *daemon) work() {
+	for {
+		d.mu.Lock()
+		var next *daemonJob
+		for next == nil && !d.closing {
+			for _, j := range d.jobs {
+				if j.Status == jobQueued {
+					next = j
+					break
+				}
+			}
+			if next == nil {
+				d.ready.Wait()
+			}
+		}
+		if d.closing {
+			d.mu.Unlock()
+			return
+		}
+		remaining := 0.0
+		if d.maxCost > 0 {
+			if remaining = d.maxCost - d.spent; remaining <= 0 {
+				d.finish(next, jobFailed, fmt.Sprintf("the daemon's --max-cost budget of $%g is spent", d.maxCost))
+				d.mu.Unlock()
+				continue
+			}
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		now := time.Now()
+		next.Status, next.Started = jobRunning, &now
+		d.cancels[next.ID] = cancel
+		d.running.Add(1)
+		d.save(next)
+		d.mu.Unlock()
+
+		d.run(ctx, next, remaining)
+		cancel()
+		d.running.Done()
+	}
+}
+
+func (d *daemon) run(ctx context.Context, j *daemonJob, budget float64) {
+	fmt.Printf("-> Running job %d: %s\n", j.ID, strings.Join(j.Args, " "))
+	var output string
+	var cost *float64
+	onEvent := func(e progressEvent) {
+		switch e.Event {
+		case "output":
+			output = filepath.Join(d.outputDir, e.Path)
+		case "usage":
+			cost = e.Cost
+		}
+	}
+	onLine := func(line string, stderr bool) {
+		if stderr && strings.TrimSpace(line) != "" {
+			fmt.Fprintf(os.Stderr, "   [job %d] %s\n", j.ID, line)
+		}
+	}
+	err := runAiguideChild(ctx, d.outputDir, d.childArgs(j.Args, budget), onEvent, onLine)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.cancels, j.ID)
+	j.Output, j.Cost = output, cost
+	if cost != nil {
+		d.spent += *cost
+	}
+	var exit *exec.ExitError
+	switch {
+	case ctx.Err() != nil && d.closing:
+		j.Status, j.Started, j.Output = jobQueued, nil, ""
+		d.save(j)
+	case ctx.Err() != nil:
+		d.finish(j, jobCancelled, "")
+	case err == nil:
+		d.finish(j, jobDone, "")
+	case errors.As(err, &exit) && exit.ExitCode() == exitPartial:
+		d.finish(j, jobPartial, "some sections failed")
+	default:
+		d.finish(j, jobFailed, err.Error())
+	}
+}
+
+// childArgs is the argv a job runs with. The daemon's provider and the rest
+// of its budget apply unless the job asks for its own provider or a lower
+// limit.
+func (d *daemon) childArgs(args []string, budget float64) []string {
+	flags, _, _ := parseJobArgs(d.rootFlags, args)
+	argv := append(slices.Clone(args), "--progress-events")
+	if d.provider != "" && flags.last("provider") == "" {
+		argv = append(argv, "--provider", d.provider)
+	}
+	if budget > 0 {
+		if v, err := strconv.ParseFloat(flags.last("max-cost"), 64); err == nil && v > 0 && v < budget {
+			budget = v
+		}
+		argv = append(argv, "--max-cost", strconv.FormatFloat(budget, 'f', -1, 64))
+	}
+	return argv
+}
+
+// callDaemon sends req and returns the daemon's first answer, and with Wait
+// the second one too.
+func callDaemon(socket string, req daemonRequest) ([]daemonResponse, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("no daemon listening on %s (start one with \"aiguide daemon\"): %v", socket, err)
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(conn)
+	var out []daemonResponse
+	for len(out) < 1 || req.Wait && len(out) < 2 {
+		var resp daemonResponse
+		if err := dec.Decode(&resp); err != nil {
+			return out, fmt.Errorf("reading the daemon's answer: %v", err)
+		}
+		if resp.Error != "" {
+			return out, errors.New(resp.Error)
+		}
+		out = append(out, resp)
+	}
+	return out, nil
+}
+
+// uidName is the user name of a uid, or "uid N" when it has none.
+func uidName(uid uint32) string {
+	id := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(id); err == nil {
+		return u.Username
+	}
+	return "uid " + id
+}
+
+func newDaemonCmd() *cobra.Command {
+	d := &daemon{cancels: map[int]context.CancelFunc{}, waiters: map[int][]chan daemonJob{}}
+	d.ready = sync.NewCond(&d.mu)
+	var socket string
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Run a resident job queue that teammates submit guides to",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if d.parallel < 1 {
+				fmt.Fprintln(os.Stderr, "Error: --parallel must be at least 1.")
+				os.Exit(1)
+			}
+			if d.maxCost < 0 {
+				fmt.Fprintln(os.Stderr, "Error: --max-cost cannot be negative.")
+				os.Exit(1)
+			}
+			out, err := filepath.Abs(d.outputDir)
+			if err == nil {
+				err = os.MkdirAll(out, 0o755)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
+				os.Exit(1)
+			}
+			d.outputDir = out
+			d.rootFlags = pflag.NewFlagSet("aiguide", pflag.ContinueOnError)
+			d.rootFlags.AddFlagSet(cmd.Root().Flags())
+			d.rootFlags.AddFlagSet(cmd.Root().PersistentFlags())
+			dir := filepath.Dir(socket)
+			if err := os.MkdirAll(dir, 0o700); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if d.store, err = openQueueStore(filepath.Join(dir, "queue.db")); err != nil {
+				fmt.Fprintf(os.Stderr, "Error opening the queue: %v\n", err)
+				os.Exit(1)
+			}
+			defer d.store.close()
+			if err := d.store.importLegacyQueue(filepath.Join(dir, "queue.json")); err != nil {
+				fmt.Fprintf(os.Stderr, "Error importing the old queue: %v\n", err)
+				os.Exit(1)
+			}
+			if err := d.load(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading the queue: %v\n", err)
+				os.Exit(1)
+			}
+			if err := d.serve(socket); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&socket, "socket", defaultSocketPath(), "Unix socket to listen on (or set AIGUIDE_SOCKET); the queue database is kept next to it")
+	cmd.Flags().StringVar(&d.outputDir, "output-dir", ".", "Directory finished guides are written to")
+	cmd.Flags().IntVar(&d.parallel, "parallel", 1, "Number of jobs run at the same time")
+	cmd.Flags().Float64Var(&d.maxCost, "max-cost", 0, "Total estimated USD all jobs may spend, across restarts (0 = no limit)")
+	cmd.Flags().StringVarP(&d.provider, "provider", "p", "", "Named provider profile for jobs that don't pick their own")
+	cmd.Flags().Float64Var(&d.submits.perMin, "submit-rate", 10, "Submissions accepted per minute from all callers together (0 = no limit)")
+	return cmd
+}
+
+func newSubmitCmd() *cobra.Command {
+	var socket string
+	var wait bool
+	cmd := &cobra.Command{
+		Use:   "submit [--wait] <subject> [flags]",
+		Short: "Queue a guide on the daemon; everything after the subject is passed on as guide flags",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			resps, err := callDaemon(socket, daemonRequest{Op: "submit", Args: args, Wait: wait})
+			if len(resps) > 0 {
+				fmt.Printf("-> Queued job %d (%d ahead of it)\n", resps[0].Job.ID, resps[0].Ahead)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if !wait {
+				return
+			}
+			j := resps[1].Job
+			switch j.Status {
+			case jobDone:
+				fmt.Printf("-> Job %d done: %s\n", j.ID, j.Output)
+			case jobPartial:
+				fmt.Printf("-> Job %d finished with failed sections: %s\n", j.ID, j.Output)
+				os.Exit(exitPartial)
+			case jobCancelled:
+				fmt.Fprintf(os.Stderr, "Error: job %d was cancelled\n", j.ID)
+				os.Exit(exitFailure)
+			default:
+				fmt.Fprintf(os.Stderr, "Error: job %d failed: %s\n", j.ID, j.Error)
+				os.Exit(exitFailure)
+			}
+		},
+	}
+	// Flags after the subject belong to the job.
+	cmd.Flags().SetInterspersed(false)
+	cmd.Flags().StringVar(&socket, "socket", defaultSocketPath(), "Daemon socket (or set AIGUIDE_SOCKET)")
+	cmd.Flags().BoolVar(&wait, "wait", false, "Wait for the job to finish and print its status and output path")
+	return cmd
+}
+
+func newQueueCmd() *cobra.Command {
+	var socket string
+	cmd := &cobra.Command{
+		Use:   "queue",
+		Short: "List the daemon's jobs",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			resps, err := callDaemon(socket, daemonRequest{Op: "queue"})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if len(resps[0].Jobs) == 0 {
+				fmt.Println("No jobs.")
+				return
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tSTATUS\tUSER\tSUBMITTED\tJOB\tOUTPUT")
+			for _, j := range resps[0].Jobs {
+				out := j.Output
+				if j.Error != "" && j.Status == jobFailed {
+					out = firstLine(j.Error)
+				}
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", j.ID, j.Status, orUnknown(j.User), j.Submitted.Format("2006-01-02 15:04"), strings.Join(j.Args, " "), out)
+			}
+			tw.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&socket, "socket", defaultSocketPath(), "Daemon socket (or set AIGUIDE_SOCKET)")
+	return cmd
+}
+
+func newCancelCmd() *cobra.Command {
+	var socket string
+	cmd := &cobra.Command{
+		Use:   "cancel <id>",
+		Short: "Cancel a queued or running daemon job",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.Atoi(args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid job id %q\n", args[0])
+				os.Exit(1)
+			}
+			if _, err := callDaemon(socket, daemonRequest{Op: "cancel", ID: id}); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("-> Cancelled job %d\n", id)
+		},
+	}
+	cmd.Flags().StringVar(&socket, "socket", defaultSocketPath(), "Daemon socket (or set AIGUIDE_SOCKET)")
+	return cmd
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// TestMain lets the test binary stand in for the aiguide child the daemon
+// runs: with AIGUIDE_TEST_CHILD set, it exits at once as a run that worked.
+func TestMain(m *testing.M) {
+	if os.Getenv("AIGUIDE_TEST_CHILD") != "" {
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// testRootFlags has a few of the root command's flags, of each kind.
+func testRootFlags() *pflag.FlagSet {
+	var c Config
+	fs := pflag.NewFlagSet("aiguide", pflag.ContinueOnError)
+	fs.IntVarP(&c.TotalCount, "number", "n", 100, "")
+	fs.BoolVarP(&c.Quiet, "quiet", "q", false, "")
+	fs.BoolVarP(&c.Verbose, "verbose", "v", false, "")
+	fs.BoolVarP(&c.Stdout, "stdout", "o", false, "")
+	fs.StringArrayVarP(&c.Info, "info", "i", nil, "")
+	fs.StringVarP(&c.SystemPromptPath, "system-prompt", "s", "", "")
+	fs.StringVar(&c.Webhook, "webhook", "", "")
+	fs.StringVar(&c.VersionOf, "version-of", "", "")
+	fs.StringSliceVar(&c.Exports, "export", nil, "")
+	fs.Float64Var(&c.MaxCost, "max-cost", 0, "")
+	fs.StringVarP(&c.Provider, "provider", "p", "", "")
+	fs.StringVar(&configPath, "config", "", "")
+	return fs
+}
+
+func TestParseJobArgs(t *testing.T) {
+	root := testRootFlags()
+	tests := []struct {
+		args []string
+		err  string // "" for an accepted job
+	}{
+		{[]string{"Go", "-n", "40", "--info", "be brief", "-qv"}, ""},
+		{[]string{"Go", "-n40", "--export=html,bibtex", "--max-cost=2"}, ""},
+		{[]string{"Go", "--webhook", "http://example.com"}, "--webhook cannot be used"},
+		{[]string{"Go", "--webhook=http://example.com"}, "--webhook cannot be used"},
+		{[]string{"Go", "--version-of=guide.md"}, "--version-of cannot be used"},
+		{[]string{"Go", "-s/etc/passwd"}, "--system-prompt cannot be used"},
+		// -o hides in a bundle of short flags.
+		{[]string{"Go", "-qo"}, "--stdout cannot be used"},
+		{[]string{"Go", "--config=/tmp/c.json"}, "--config cannot be used"},
+		{[]string{"Go", "-i", "@/home/me/.ssh/id_rsa"}, "--info @file cannot be used"},
+		{[]string{"Go", "--info=@notes.txt"}, "--info @file cannot be used"},
+		{[]string{"Go", "--export", "html,notion"}, "--export notion cannot be used"},
+		{[]string{"Go", "--no-such-flag"}, "unknown flag"},
+	}
+	for _, tt := range tests {
+		_, _, err := parseJobArgs(root, tt.args)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%q was rejected: %v", tt.args, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%q: error %v, want %q", tt.args, err, tt.err)
+		}
+	}
+
+	flags, subject, err := parseJobArgs(root, []string{"-p", "work", "Go Concurrency", "--max-cost=1.5", "-pother"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subject) != 1 || subject[0] != "Go Concurrency" || flags.last("provider") != "other" || flags.last("max-cost") != "1.5" {
+		t.Errorf("parseJobArgs = %v, %q", flags, subject)
+	}
+	// The daemon's own config is left alone.
+	if v, _ := root.GetInt("number"); v != 100 {
+		t.Errorf("parsing a job set the daemon's -n to %d", v)
+	}
+}
+
+func TestChildArgs(t *testing.T) {
+	d := &daemon{rootFlags: testRootFlags(), provider: "team"}
+	got := strings.Join(d.childArgs([]string{"Go", "--max-cost=1"}, 5), " ")
+	if want := "Go --max-cost=1 --progress-events --provider team --max-cost 1"; got != want {
+		t.Errorf("childArgs = %s, want %s", got, want)
+	}
+	got = strings.Join(d.childArgs([]string{"Go", "-pmine"}, 5), " ")
+	if want := "Go -pmine --progress-events --max-cost 5"; got != want {
+		t.Errorf("childArgs = %s, want %s", got, want)
+	}
+}
+
+func TestSubmitLimiter(t *testing.T) {
+	l := &submitLimiter{perMin: 2}
+	now := time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if _, ok := l.allow(now); !ok {
+			t.Fatalf("submission %d was refused", i+1)
+		}
+	}
+	wait, ok := l.allow(now)
+	if ok || wait != 30*time.Second {
+		t.Errorf("third submission: allowed %v, wait %s; want a 30s wait", ok, wait)
+	}
+	if _, ok := l.allow(now.Add(30 * time.Second)); !ok {
+		t.Error("refused after the bucket refilled")
+	}
+	if _, ok := (&submitLimiter{}).allow(now); !ok {
+		t.Error("no limit refused a submission")
+	}
+}
+
+func TestQueueStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openQueueStore(filepath.Join(dir, "queue.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openQueueStore(filepath.Join(dir, "queue.db")); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("a second open gave %v", err)
+	}
+
+	// The old queue file is imported once.
+	legacy := daemonState{NextID: 3, SpentUSD: 1.25, Jobs: []*daemonJob{
+		{ID: 1, Args: []string{"Go"}, Status: jobDone},
+		{ID: 2, Args: []string{"Rust"}, Status: jobRunning},
+	}}
+	b, _ := json.Marshal(legacy)
+	if err := os.WriteFile(filepath.Join(dir, "queue.json"), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.importLegacyQueue(filepath.Join(dir, "queue.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "queue.json")); !os.IsNotExist(err) {
+		t.Error("queue.json was not renamed")
+	}
+
+	d := &daemon{store: s}
+	if err := d.load(); err != nil {
+		t.Fatal(err)
+	}
+	if d.nextID != 3 || d.spent != 1.25 || len(d.jobs) != 2 || d.jobs[1].Status != jobQueued {
+		t.Fatalf("loaded %d jobs, next id %d, spent %g: %+v", len(d.jobs), d.nextID, d.spent, d.jobs)
+	}
+	d.jobs[1].Status = jobFailed
+	d.nextID = 4
+	d.save(d.jobs[1])
+	s.close()
+
+	s, err = openQueueStore(filepath.Join(dir, "queue.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	st, err := s.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.NextID != 4 || len(st.Jobs) != 2 || st.Jobs[0].ID != 1 || st.Jobs[1].Status != jobFailed {
+		t.Errorf("reopened store: %+v", st)
+	}
+}
+
+func TestPeerUser(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are read on Linux only")
+	}
+	ln, err := net.Listen("unix", filepath.Join(t.TempDir(), "s.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		if c, err := net.Dial("unix", ln.Addr().String()); err == nil {
+			defer c.Close()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	got, err := peerUser(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := uidName(uint32(os.Getuid())); got != want {
+		t.Errorf("peerUser = %q, want %q", got, want)
+	}
+}
+
+// TestSubmitWaitFinishedAtOnce submits jobs with Wait to a daemon whose
+// budget is spent, so a worker fails each one as soon as it is queued; the
+// client must still get the outcome.
+func TestSubmitWaitFinishedAtOnce(t *testing.T) {
+	t.Setenv("AIGUIDE_TEST_CHILD", "1")
+	s, err := openQueueStore(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	d := &daemon{store: s, rootFlags: testRootFlags(), outputDir: t.TempDir(), maxCost: 1, spent: 1, nextID: 1,
+		cancels: map[int]context.CancelFunc{}, waiters: map[int][]chan daemonJob{}}
+	d.ready = sync.NewCond(&d.mu)
+	go d.work()
+	defer d.close()
+
+	for range 50 {
+		client, server := net.Pipe()
+		go d.handle(server)
+		client.SetDeadline(time.Now().Add(5 * time.Second))
+		if err := json.NewEncoder(client).Encode(daemonRequest{Op: "submit", Args: []string{"Go"}, Wait: true}); err != nil {
+			t.Fatal(err)
+		}
+		dec := json.NewDecoder(client)
+		var queued, final daemonResponse
+		if err := dec.Decode(&queued); err != nil || queued.Job == nil {
+			t.Fatalf("submit answered %+v, %v", queued, err)
+		}
+		if err := dec.Decode(&final); err != nil {
+			t.Fatalf("no outcome for job %d: %v", queued.Job.ID, err)
+		}
+		if final.Job == nil || final.Job.Status != jobFailed || !strings.Contains(final.Job.Error, "budget") {
+			t.Errorf("job %d ended as %+v", queued.Job.ID, final.Job)
+		}
+		client.Close()
+	}
+}
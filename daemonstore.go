@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
+)
+
+// queueStore is the daemon's queue on disk, a bolt database next to the
+// socket. Every change is its own transaction, synced before the daemon
+// answers, so a crash loses no submitted job.
+type queueStore struct {
+	db *bolt.DB
+}
+
+var (
+	jobsBucket = []byte("jobs") // job id, big endian -> daemonJob JSON
+	metaBucket = []byte("meta") // next_id and spent_usd
+)
+
+// openQueueStore opens or creates the database. It is locked while open,
+// so a second daemon on the same state directory fails instead of sharing
+// it.
+func openQueueStore(path string) (*queueStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if errors.Is(err, berrors.ErrTimeout) {
+		return nil, fmt.Errorf("%s is in use by another daemon", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{jobsBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &queueStore{db: db}, nil
+}
+
+func (s *queueStore) close() error { return s.db.Close() }
+
+func jobKey(id int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(id))
+}
+
+// load returns the stored state, jobs in submission order.
+func (s *queueStore) load() (daemonState, error) {
+	var st daemonState
+	err := s.db.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		st.NextID, _ = strconv.Atoi(string(meta.Get([]byte("next_id"))))
+		st.SpentUSD, _ = strconv.ParseFloat(string(meta.Get([]byte("spent_usd"))), 64)
+		return tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			var j daemonJob
+			if err := json.Unmarshal(v, &j); err != nil {
+				return fmt.Errorf("job %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			st.Jobs = append(st.Jobs, &j)
+			return nil
+		})
+	})
+	return st, err
+}
+
+// save writes the counters and the given jobs, and deletes the jobs in
+// drop.
+func (s *queueStore) save(nextID int, spent float64, jobs []*daemonJob, drop []int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if err := meta.Put([]byte("next_id"), []byte(strconv.Itoa(nextID))); err != nil {
+			return err
+		}
+		if err := meta.Put([]byte("spent_usd"), []byte(strconv.FormatFloat(spent, 'f', -1, 64))); err != nil {
+			return err
+		}
+		b := tx.Bucket(jobsBucket)
+		for _, j := range jobs {
+			v, err := json.Marshal(j)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(jobKey(j.ID), v); err != nil {
+				return err
+			}
+		}
+		for _, id := range drop {
+			if err := b.Delete(jobKey(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// importLegacyQueue moves the queue.json of older versions into an empty
+// store, and renames the file so it isn't imported twice.
+func (s *queueStore) importLegacyQueue(path string) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var st daemonState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := s.save(st.NextID, st.SpentUSD, st.Jobs, nil); err != nil {
+		return err
+	}
+	fmt.Printf("-> Imported %d jobs from %s\n", len(st.Jobs), path)
+	return os.Rename(path, path+".imported")
+}
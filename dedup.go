@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dedupShingle is the number of words per shingle.
+const dedupShingle = 5
+
+var dedupWordRe = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// Duplicate records that a section overlaps an earlier one.
+type Duplicate struct {
+	Item       int     `json:"item"`
+	Of         int     `json:"of"`
+	Similarity float64 `json:"similarity"`
+	Rewritten  bool    `json:"rewritten,omitempty"`
+}
+
+type dedupSection struct {
+	chunk    int
+	item     int // 1-based position
+	concept  string
+	text     string
+	shingles map[uint64]bool
+}
+
+// shingles hashes every run of dedupShingle words of text, ignoring case,
+// markup and the heading line.
+func shingles(text string) map[uint64]bool {
+	if _, rest, ok := strings.Cut(text, "\n"); ok {
+		text = rest
+	}
+	words := dedupWordRe.FindAllString(strings.ToLower(text), -1)
+	set := map[uint64]bool{}
+	for i := 0; i+dedupShingle <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+dedupShingle], " ")))
+		set[h.Sum64()] = true
+	}
+	return set
+}
+
+// similarity is the share of the smaller section's shingles found in the
+// other one, so a paragraph copied into a long section still stands out.
+func similarity(a, b map[uint64]bool) float64 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(a) == 0 {
+		return 0
+	}
+	shared := 0
+	for h := range a {
+		if b[h] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a))
+}
+
+// dedupContent compares every pair of concept sections across the chunk
+// results and records each section that overlaps an earlier one by more
+// than cfg.DedupThreshold. In rewrite mode the later section is sent back to
+// the model to cover only what's new. Results are per chunk, for the
+// sidecar and the summary.
+func dedupContent(chunks []chunk, results []string) [][]Duplicate {
+	var all []*dedupSection
+	for i, content := range results {
+		if content == "" {
+			continue
+		}
+		_, sections := splitSections(content, chunkNumbers(chunks[i].items))
+		for _, s := range sections {
+			for k, it := range chunks[i].items {
+				if conceptNumber(it) == s.Number {
+					all = append(all, &dedupSection{chunk: i, item: chunks[i].start + k + 1, concept: it, text: s.Text, shingles: shingles(s.Text)})
+				}
+			}
+		}
+	}
+	sort.Slice(all, func(a, b int) bool { return all[a].item < all[b].item })
+
+	dups := make([][]Duplicate, len(results))
+	found := false
+	for b := 1; b < len(all); b++ {
+		best, bestSim := -1, cfg.DedupThreshold
+		for a := 0; a < b; a++ {
+			if sim := similarity(all[a].shingles, all[b].shingles); sim > bestSim {
+				best, bestSim = a, sim
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		found = true
+		d := Duplicate{Item: all[b].item, Of: all[best].item, Similarity: float64(int(bestSim*100+0.5)) / 100}
+		if cfg.DedupContent == "rewrite" {
+			if text, err := rewriteDuplicate(chunks[all[b].chunk], all[best], all[b]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error rewriting duplicate section %d: %v\n", d.Item, err)
+			} else {
+				results[all[b].chunk] = replaceSection(results[all[b].chunk], chunks[all[b].chunk].items, conceptNumber(all[b].concept), text)
+				d.Rewritten = true
+			}
+		}
+		dups[all[b].chunk] = append(dups[all[b].chunk], d)
+	}
+	if !found {
+		return nil
+	}
+	return dups
+}
+
+func rewriteDuplicate(j chunk, earlier, later *dedupSection) (string, error) {
+	heading, body, _ := strings.Cut(later.text, "\n")
+	if !cfg.Stdout {
+		statusf("-> Rewriting section %d, which repeats section %d...\n", later.item, earlier.item)
+	}
+	prompt := fmt.Sprintf(
+		"The second section below, from a study guide, repeats a lot of the earlier section. Rewrite the body of the "+
+			"second section so it covers only what is new relative to the earlier one. For the shared background, link to "+
+			"the earlier section as [%s](#%s) instead of repeating it. Output ONLY the rewritten body, without the heading.\n\n"+
+			"=== EARLIER SECTION ===\n%s\n\n=== SECTION TO REWRITE ===\n%s",
+		earlier.concept, conceptAnchor(earlier.concept), earlier.text, later.text,
+	)
+	resp, err := callAIWith(callOptions{Model: j.model, Temperature: defaultTemperature, Purpose: "dedup"}, prompt, cfg.SystemPrompt)
+	if err != nil {
+		return "", err
+	}
+
+	// Keep the label line right under the heading, if there is one.
+	var label string
+	if labels := conceptLabels(j); labels != nil {
+		for k, it := range j.items {
+			if it == later.concept && labels[k] != "" && strings.HasPrefix(strings.TrimSpace(body), labels[k]) {
+				label = labels[k] + "\n\n"
+			}
+		}
+	}
+	resp = cleanChunkContent(resp)
+	if h, rest, ok := strings.Cut(resp, "\n"); ok && h == heading {
+		resp = strings.TrimSpace(rest)
+	}
+	return heading + "\n\n" + label + resp, nil
+}
+
+// replaceSection swaps one concept's section of a chunk for text.
+func replaceSection(content string, items []string, number, text string) string {
+	preamble, sections := splitSections(content, chunkNumbers(items))
+	var parts []string
+	if preamble != "" {
+		parts = append(parts, preamble)
+	}
+	for _, s := range sections {
+		if s.Number == number {
+			parts = append(parts, text)
+		} else {
+			parts = append(parts, s.Text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// writeDedupSummary lists the overlapping section pairs.
+func writeDedupSummary(w io.Writer, sections []SectionMeta) {
+	var dups []Duplicate
+	for _, sec := range sections {
+		dups = append(dups, sec.Duplicates...)
+	}
+	if len(dups) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "-> Duplicate content: %d section(s) overlap an earlier one by more than %.0f%%\n", len(dups), cfg.DedupThreshold*100)
+	for _, d := range dups {
+		note := ""
+		if d.Rewritten {
+			note = " (rewritten)"
+		}
+		fmt.Fprintf(w, "   %d repeats %d: %s%s\n", d.Item, d.Of, strconv.FormatFloat(d.Similarity, 'f', 2, 64), note)
+	}
+}
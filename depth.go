@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/yuriiter/aiguide/pkg/guide"
+)
+
+// defaultSubCount is how many subtopics each chapter gets with --depth 2.
+const defaultSubCount = 5
+
+// shiftableHeadingRe matches a heading that can go one level down.
+var shiftableHeadingRe = regexp.MustCompile(`^#{1,5}[ \t]`)
+
+// chapterListPrompt asks for the chapters of a --depth 2 guide.
+func chapterListPrompt(n int, subject string) string {
+	return fmt.Sprintf(
+		"Generate a numbered list of exactly %d chapters that together cover the subject: '%s', from the foundations to the advanced topics. "+
+			"Each chapter names a broad area that can be broken into several subtopics, not a single question. ",
+		n, subject)
+}
+
+// subtopicPrompt asks for the subtopics of one chapter. The other chapters
+// are listed so the subtopics stay within their own.
+func subtopicPrompt(chapter string, chapters []string, n int) string {
+	return fmt.Sprintf(
+		"A study guide about '%s' has these chapters:\n%s\n\n"+
+			"Break the chapter '%s' into a numbered list of exactly %d subtopics, in the order they should be learned. "+
+			"Only list subtopics of this chapter, not ones the other chapters cover. ",
+		cfg.Subject, strings.Join(chapters, "\n"), conceptPrefixRe.ReplaceAllString(chapter, ""), n)
+}
+
+// generateChapters lists the chapters, then the subtopics of every chapter
+// in parallel. It returns the subtopics numbered 1, 2, 3... across the
+// guide, with one group per chapter. A chapter whose subtopics can't be
+// listed is kept as a single section of its own; only when every chapter
+// fails is the error returned.
+func generateChapters() ([]string, []conceptGroup, error) {
+	prompt := chapterListPrompt(cfg.TotalCount, cfg.Subject) + clarificationContext() +
+		guide.ListFormat + languageInstruction()
+	resp, err := callAI(prompt, guide.ListSystemPrompt)
+	if err != nil {
+		return nil, nil, err
+	}
+	chapters := parseConceptList(resp)
+	if len(chapters) == 0 {
+		return nil, nil, nil
+	}
+
+	statusf("-> Listing %d subtopics for each of %d chapters...\n", cfg.SubCount, len(chapters))
+	subtopics := make([][]string, len(chapters))
+	errs := make([]error, len(chapters))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(cfg.Threads, 1))
+	for i, ch := range chapters {
+		wg.Add(1)
+		go func(i int, ch string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			prompt := subtopicPrompt(ch, chapters, cfg.SubCount) + guide.ListFormat + languageInstruction()
+			resp, err := callAIWith(callOptions{Model: cfg.Model, Temperature: defaultTemperature, Purpose: "subtopics"}, prompt, guide.ListSystemPrompt)
+			if err == nil {
+				if subtopics[i] = parseConceptList(resp); len(subtopics[i]) == 0 {
+					err = errors.New("the answer had no numbered list")
+				}
+			}
+			errs[i] = err
+		}(i, ch)
+	}
+	wg.Wait()
+
+	var concepts []string
+	var groups []conceptGroup
+	failed := 0
+	for i, ch := range chapters {
+		name := conceptPrefixRe.ReplaceAllString(ch, "")
+		subs := subtopics[i]
+		if errs[i] != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not list the subtopics of chapter %d (%s): %v; it is answered as one section.\n", i+1, name, errs[i])
+			subs = []string{name}
+			failed++
+		}
+		if len(subs) > cfg.SubCount {
+			subs = subs[:cfg.SubCount]
+		}
+		groups = append(groups, conceptGroup{Name: name, Start: len(concepts), Count: len(subs)})
+		concepts = append(concepts, subs...)
+	}
+	if failed == len(chapters) {
+		return nil, nil, fmt.Errorf("listing the subtopics of every chapter failed: %w", errors.Join(errs...))
+	}
+	return renumberConcepts(concepts), groups, nil
+}
+
+// chapterContext tells the model which chapter a chunk's subtopics belong
+// to, so their answers build on each other instead of each starting over.
+func chapterContext(part string) string {
+	return fmt.Sprintf("\n\nThese are subtopics of %s. Explain each one within that chapter, building on the subtopics before it, "+
+		"without repeating what the chapter's other subtopics cover.", part)
+}
+
+// subtopicHeadings pushes every heading of a chunk one level down, so the
+// subtopics sit under their chapter: "## 3. Foo" becomes "### 3. Foo" and
+// the answer's own "###" headings "####". Code blocks are left alone.
+func subtopicHeadings(content string) string {
+	lines := strings.Split(content, "\n")
+	inFence := false
+	for i, l := range lines {
+		t := strings.TrimSpace(l)
+		switch {
+		case strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~"):
+			inFence = !inFence
+		case !inFence && shiftableHeadingRe.MatchString(l):
+			lines[i] = "#" + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// plannedConcepts is how many concepts the run answers: -n, or -n chapters
+// of --sub-count subtopics each with --depth 2.
+func plannedConcepts() int {
+	if cfg.Depth > 1 {
+		return cfg.TotalCount * cfg.SubCount
+	}
+	return cfg.TotalCount
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultDifficulty = 3
+
+var difficultyLineRe = regexp.MustCompile(`^\s*(\d+)[.):]\s*(\d+)`)
+
+// difficultyEnabled reports whether any flag needs difficulty scores.
+func difficultyEnabled() bool {
+	return cfg.RouteByDiff || cfg.ShowDifficulty || cfg.MaxDifficulty > 0 || cfg.Order == "easy-first" || cfg.Order == "hard-first"
+}
+
+// estimateDifficulty asks the model to score every concept from 1 (basic
+// definition) to 5 (advanced). The returned slice is aligned with concepts;
+// anything the model omits or scores out of range gets defaultDifficulty,
+// with a warning.
+func estimateDifficulty(concepts []string, model string) ([]int, error) {
+	prompt := fmt.Sprintf(
+		"Rate the difficulty of each of the following concepts for a learner of the subject '%s' "+
+			"on a scale from 1 (simple definition) to 5 (advanced, requires deep reasoning).\n\n%s\n\n"+
+			"Respond ONLY with a JSON object mapping each concept number to its score, e.g. {\"%s\": 3}.",
+		cfg.Subject, strings.Join(concepts, "\n"), conceptNumber(concepts[0]),
+	)
+
+	resp, err := callAIWith(callOptions{Model: model, Temperature: 0, Purpose: "difficulty"}, prompt,
+		"You are an experienced curriculum designer who rates concept difficulty tersely.")
+	if err != nil {
+		return nil, err
+	}
+
+	raw := parseDifficultyScores(resp)
+	scores := make([]int, len(concepts))
+	var defaulted []string
+	for i, c := range concepts {
+		num := conceptNumber(c)
+		score, ok := raw[num]
+		if !ok || score < 1 || score > 5 {
+			defaulted = append(defaulted, num)
+			score = defaultDifficulty
+		}
+		scores[i] = score
+	}
+	if len(defaulted) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: no valid difficulty score for concept(s) %s; using %d\n",
+			strings.Join(defaulted, ", "), defaultDifficulty)
+	}
+	return scores, nil
+}
+
+// parseDifficultyScores reads the JSON object the prompt asks for and falls
+// back to "<number>: <score>" lines for models that ignore the format.
+func parseDifficultyScores(resp string) map[string]int {
+	scores := map[string]int{}
+	if start, end := strings.Index(resp, "{"), strings.LastIndex(resp, "}"); start >= 0 && end > start {
+		var raw map[string]float64
+		if json.Unmarshal([]byte(resp[start:end+1]), &raw) == nil {
+			for num, s := range raw {
+				num = strings.TrimRight(strings.TrimSpace(num), ".)")
+				if s == float64(int(s)) {
+					scores[num] = int(s)
+				} else {
+					scores[num] = 0 // fractional scores are out of range
+				}
+			}
+			return scores
+		}
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(resp))
+	for scanner.Scan() {
+		m := difficultyLineRe.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		if _, seen := scores[m[1]]; !seen {
+			scores[m[1]], _ = strconv.Atoi(m[2])
+		}
+	}
+	return scores
+}
+
+// filterByDifficulty returns the indexes of concepts at or below max.
+func filterByDifficulty(difficulty []int, max int) []int {
+	var keep []int
+	for i, d := range difficulty {
+		if d <= max {
+			keep = append(keep, i)
+		}
+	}
+	return keep
+}
+
+// orderByDifficulty returns concept indexes sorted by difficulty. The sort is
+// stable, so concepts of equal difficulty keep the model's order.
+func orderByDifficulty(difficulty []int, hardFirst bool) []int {
+	order := make([]int, len(difficulty))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		if hardFirst {
+			return difficulty[order[a]] > difficulty[order[b]]
+		}
+		return difficulty[order[a]] < difficulty[order[b]]
+	})
+	return order
+}
+
+func difficultyBadge(d int) string {
+	return fmt.Sprintf("*Difficulty:* %s%s %d/5", strings.Repeat("●", d), strings.Repeat("○", 5-d), d)
+}
+
+// conceptNumber returns the leading number of a concept line ("12. Foo" -> "12").
+func conceptNumber(concept string) string {
+	parts := strings.SplitN(concept, " ", 2)
+	return strings.TrimRight(parts[0], ".)")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+func epubPath(guidePath string) string {
+	return strings.TrimSuffix(guidePath, ".md") + ".epub"
+}
+
+// epubUUID derives the book's identifier from the guide's file name, so
+// re-exporting an updated guide replaces the book in a reader's library.
+func epubUUID(guidePath string) string {
+	s := sha256.Sum256([]byte(filepath.Base(guidePath)))
+	s[6] = s[6]&0x0f | 0x50 // version 5 style, name-based
+	s[8] = s[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", s[0:4], s[4:6], s[6:8], s[8:10], s[10:16])
+}
+
+// epubXHTML wraps body in an XHTML content document of d's language and
+// direction.
+func epubXHTML(d *htmlDoc, title, body string) string {
+	return fmt.Sprintf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<!DOCTYPE html>\n"+
+		"<html xmlns=\"http://www.w3.org/1999/xhtml\" xmlns:epub=\"http://www.idpf.org/2007/ops\" lang=\"%s\" xml:lang=\"%s\" dir=\"%s\">\n"+
+		"<head>\n<meta charset=\"utf-8\" />\n<title>%s</title>\n<link rel=\"stylesheet\" type=\"text/css\" href=\"guide.css\" />\n</head>\n"+
+		"<body dir=\"%s\">\n%s</body>\n</html>\n",
+		d.Lang, d.Lang, d.dir(), html.EscapeString(title), d.dir(), body)
+}
+
+// epubNav is the navigation document: the concepts as a nested ordered
+// list, which readers lay out in the book's direction.
+func epubNav(d *htmlDoc) string {
+	var b strings.Builder
+	var list func(entries []htmlTOCEntry)
+	list = func(entries []htmlTOCEntry) {
+		b.WriteString("<ol>\n")
+		for _, e := range entries {
+			fmt.Fprintf(&b, "<li><a href=\"guide.xhtml#%s\">%s</a>", html.EscapeString(e.Anchor), htmlText(e.Text, d.RTL))
+			if len(e.Children) > 0 {
+				b.WriteString("\n")
+				list(e.Children)
+			}
+			b.WriteString("</li>\n")
+		}
+		b.WriteString("</ol>\n")
+	}
+	fmt.Fprintf(&b, "<nav epub:type=\"toc\" id=\"toc\" dir=\"%s\">\n<h1>%s</h1>\n", d.dir(), html.EscapeString(languages[d.Lang].toc))
+	list(d.TOC)
+	b.WriteString("</nav>\n")
+	return epubXHTML(d, languages[d.Lang].toc, b.String())
+}
+
+// epubPackage is the OPF package document. Its spine runs right to left for
+// a right-to-left guide, so readers turn the pages that way.
+func epubPackage(d *htmlDoc, uuid string, modified time.Time) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid" xml:lang="%s" dir="%s">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="uid">urn:uuid:%s</dc:identifier>
+    <dc:title>%s</dc:title>
+    <dc:language>%s</dc:language>
+    <dc:creator>aiguide</dc:creator>
+    <meta property="dcterms:modified">%s</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="guide" href="guide.xhtml" media-type="application/xhtml+xml"/>
+    <item id="css" href="guide.css" media-type="text/css"/>
+  </manifest>
+  <spine page-progression-direction="%s">
+    <itemref idref="guide"/>
+  </spine>
+</package>
+`, d.Lang, d.dir(), uuid, html.EscapeString(d.Title), d.Lang, modified.UTC().Format("2006-01-02T15:04:05Z"), d.dir())
+}
+
+// writeEPUB writes d as an EPUB 3 book. The mimetype entry comes first and
+// uncompressed, as the OCF container format requires.
+func writeEPUB(w io.Writer, d *htmlDoc, uuid string, modified time.Time) error {
+	z := zip.NewWriter(w)
+	mt, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store, Modified: modified})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mt, "application/epub+zip"); err != nil {
+		return err
+	}
+	files := []struct{ name, data string }{
+		{"META-INF/container.xml", epubContainer},
+		{"OEBPS/content.opf", epubPackage(d, uuid, modified)},
+		{"OEBPS/nav.xhtml", epubNav(d)},
+		{"OEBPS/guide.xhtml", epubXHTML(d, d.Title, d.Body)},
+		{"OEBPS/guide.css", guideCSS},
+	}
+	for _, f := range files {
+		fw, err := z.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.data); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// exportEPUB writes the guide as <guide>.epub, with the language and page
+// direction of the guide.
+func exportEPUB(guidePath string) error {
+	d, err := readHTMLDoc(guidePath, true)
+	if err != nil {
+		return err
+	}
+	path := epubPath(guidePath)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeEPUB(f, d, epubUUID(guidePath), time.Now()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	statusf("-> Wrote %s (%s, %s)\n", path, d.Lang, d.dir())
+	return nil
+}
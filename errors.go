@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/yuriiter/aiguide/pkg/guide"
+)
+
+// Errors that end a run map to their own exit codes, so scripts can tell
+// them apart. Provider errors wrap them; check with errors.Is.
+var (
+	ErrAuth           = guide.ErrAuth
+	ErrRateLimited    = guide.ErrRateLimited
+	ErrModelNotFound  = guide.ErrModelNotFound
+	ErrBudgetExceeded = errors.New("budget exceeded")
+	ErrPartialFailure = errors.New("some sections failed")
+	ErrInterrupted    = errors.New("interrupted")
+
+	errShareFailed = errors.New("the guide was written but could not be shared")
+)
+
+// Exit codes. 1 covers invalid flags and every error without a code of its
+// own; exitShareFailed is 3.
+const (
+	exitFailure        = 1
+	exitPartial        = 4
+	exitAuth           = 5
+	exitRateLimited    = 6
+	exitModelNotFound  = 7
+	exitBudgetExceeded = 8
+	exitInterrupted    = 130
+)
+
+// exitCodes maps the sentinels to their exit codes and names, checked in
+// order: the cause of a partial failure wins over the partial failure.
+var exitCodes = []struct {
+	err  error
+	code int
+	name string
+}{
+	{ErrInterrupted, exitInterrupted, "interrupted"},
+	{ErrBudgetExceeded, exitBudgetExceeded, "budget_exceeded"},
+	{ErrAuth, exitAuth, "auth"},
+	{ErrModelNotFound, exitModelNotFound, "model_not_found"},
+	{ErrRateLimited, exitRateLimited, "rate_limited"},
+	{ErrPartialFailure, exitPartial, "partial_failure"},
+	{errShareFailed, exitShareFailed, "share_failed"},
+}
+
+func exitCodeFor(err error) (int, string) {
+	for _, c := range exitCodes {
+		if errors.Is(err, c.err) {
+			return c.code, c.name
+		}
+	}
+	return exitFailure, "failure"
+}
+
+// retryAfter returns how long the server asked to wait before retrying.
+func retryAfter(err error) (time.Duration, bool) {
+	return guide.RetryAfter(err)
+}
+
+// errorHint says what to change to get past err.
+func errorHint(err error) string {
+	switch {
+	case errors.Is(err, ErrInterrupted):
+		return ""
+	case errors.Is(err, ErrBudgetExceeded):
+		return "raise --max-cost or --max-total-tokens, or generate fewer concepts with -n"
+	case errors.Is(err, ErrAuth):
+		if cfg.Provider != "" {
+			return fmt.Sprintf("check the API key of provider %q (api_key_env or api_key_file in %s)", cfg.Provider, defaultConfigPath())
+		}
+		return "check OPENAI_API_KEY, and OPENAI_BASE_URL if you use another endpoint"
+	case errors.Is(err, ErrModelNotFound):
+		return fmt.Sprintf("check --model, --cheap-model or OPENAI_MODEL (the run used %q)", cfg.Model)
+	case errors.Is(err, ErrRateLimited):
+		if d, ok := retryAfter(err); ok {
+			return fmt.Sprintf("the provider asked to wait %s; retry later or lower --threads", d)
+		}
+		return "retry later or lower --threads"
+	case errors.Is(err, ErrPartialFailure):
+		return "the failed sections are marked MISSING in the guide; fill them in with aiguide redo"
+	}
+	return ""
+}
+
+// runError is the --error-format json object.
+type runError struct {
+	Error             string  `json:"error"`
+	Code              string  `json:"code"`
+	ExitCode          int     `json:"exit_code"`
+	Hint              string  `json:"hint,omitempty"`
+	RetryAfterSeconds float64 `json:"retry_after_seconds,omitempty"`
+	RequestID         string  `json:"request_id,omitempty"`
+	UpstreamRequestID string  `json:"upstream_request_id,omitempty"`
+}
+
+// reportError prints the error that ends the run, in --error-format, and
+// returns its exit code. Its message has usually been printed already where
+// it happened; text output only adds the hint.
+func reportError(err error) int {
+	code, name := exitCodeFor(err)
+	hint := errorHint(err)
+	if cfg.ErrorFormat == "json" {
+		re := runError{Error: err.Error(), Code: name, ExitCode: code, Hint: hint}
+		if d, ok := retryAfter(err); ok {
+			re.RetryAfterSeconds = d.Seconds()
+		}
+		if ids, ok := failedRequestIDs(err); ok {
+			re.RequestID, re.UpstreamRequestID = ids.ID, ids.Upstream
+		}
+		b, _ := json.Marshal(re)
+		fmt.Fprintln(os.Stderr, string(b))
+	} else if hint != "" {
+		fmt.Fprintf(os.Stderr, "Hint: %s\n", hint)
+	}
+	return code
+}
+
+// partialFailure returns ErrPartialFailure, wrapping the first section's
+// cause, when any section failed.
+func partialFailure(sections []SectionMeta) error {
+	var failed int
+	var first *SectionMeta
+	for i := range sections {
+		if sections[i].Failed {
+			failed++
+			if first == nil {
+				first = &sections[i]
+			}
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %d of %d chunk(s), first chunk %d: %w", ErrPartialFailure, failed, len(sections), first.Chunk, first.err)
+}
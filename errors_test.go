@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuriiter/aiguide/pkg/guide"
+)
+
+// captureStderr returns what f writes to os.Stderr.
+func captureStderr(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = prev }()
+	f()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func testAPIError(status int, body string) error {
+	return &guide.RequestError{ID: "req-7", Upstream: "up-7", Err: &guide.APIError{Status: fmt.Sprint(status), StatusCode: status, Body: body}}
+}
+
+func TestExitCodeFor(t *testing.T) {
+	authErr := testAPIError(401, "Incorrect API key")
+	tests := []struct {
+		name string
+		err  error
+		code int
+		kind string
+	}{
+		{"plain", errors.New("boom"), 1, "failure"},
+		{"auth", fmt.Errorf("listing concepts: %w", authErr), 5, "auth"},
+		{"rate limited", testAPIError(429, "slow down"), 6, "rate_limited"},
+		{"model not found", testAPIError(404, "The model 'gpt-9' does not exist"), 7, "model_not_found"},
+		{"budget", fmt.Errorf("%w: 1000 tokens used", ErrBudgetExceeded), 8, "budget_exceeded"},
+		{"interrupted", fmt.Errorf("%w: %w", ErrInterrupted, errors.New("context canceled")), 130, "interrupted"},
+		{"partial", fmt.Errorf("%w: 1 of 3 chunk(s)", ErrPartialFailure), 4, "partial_failure"},
+		// The cause of a partial failure wins over the partial failure.
+		{"partial with a cause", fmt.Errorf("%w: 1 of 3 chunk(s), first chunk 2: %w", ErrPartialFailure, authErr), 5, "auth"},
+		{"interrupted over budget", fmt.Errorf("%w: %w", ErrInterrupted, ErrBudgetExceeded), 130, "interrupted"},
+		{"share failed", fmt.Errorf("%w: gist: 422", errShareFailed), exitShareFailed, "share_failed"},
+	}
+	for _, tt := range tests {
+		if code, kind := exitCodeFor(tt.err); code != tt.code || kind != tt.kind {
+			t.Errorf("%s: exitCodeFor = %d %s, want %d %s", tt.name, code, kind, tt.code, tt.kind)
+		}
+	}
+}
+
+func TestPartialFailure(t *testing.T) {
+	if err := partialFailure([]SectionMeta{{Chunk: 1}, {Chunk: 2}}); err != nil {
+		t.Errorf("partialFailure without failed sections = %v", err)
+	}
+	cause := testAPIError(429, "slow down")
+	err := partialFailure([]SectionMeta{{Chunk: 1}, {Chunk: 2, Failed: true, err: cause}, {Chunk: 3, Failed: true, err: errors.New("later")}})
+	if !errors.Is(err, ErrPartialFailure) || !errors.Is(err, ErrRateLimited) {
+		t.Errorf("partialFailure = %v, want it to wrap ErrPartialFailure and the first cause", err)
+	}
+	if re, ok := failedRequestIDs(err); !ok || re.ID != "req-7" {
+		t.Errorf("the request ids of the first failed chunk are lost: %v", err)
+	}
+	if want := "2 of 3 chunk(s), first chunk 2"; !strings.Contains(err.Error(), want) {
+		t.Errorf("partialFailure = %q, want it to name %q", err, want)
+	}
+}
+
+func TestReportErrorJSON(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.ErrorFormat, cfg.Model = "json", "gpt-4o"
+	ae := &guide.APIError{Status: "429 Too Many Requests", StatusCode: 429, Body: "slow down", RetryAfter: 30 * time.Second}
+	err := fmt.Errorf("%w: 1 of 2 chunk(s), first chunk 1: %w", ErrPartialFailure, &guide.RequestError{ID: "req-7", Upstream: "up-7", Err: ae})
+
+	var code int
+	out := captureStderr(t, func() { code = reportError(err) })
+	if code != exitRateLimited {
+		t.Errorf("reportError = %d, want %d", code, exitRateLimited)
+	}
+	var got runError
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("stderr is not one JSON object: %v\n%s", err, out)
+	}
+	want := runError{Error: err.Error(), Code: "rate_limited", ExitCode: exitRateLimited, Hint: "the provider asked to wait 30s; retry later or lower --threads",
+		RetryAfterSeconds: 30, RequestID: "req-7", UpstreamRequestID: "up-7"}
+	if got != want {
+		t.Errorf("reportError printed %+v, want %+v", got, want)
+	}
+}
+
+func TestReportErrorText(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.ErrorFormat, cfg.Model, cfg.Provider = "text", "gpt-9", ""
+	out := captureStderr(t, func() {
+		if code := reportError(testAPIError(404, "model not found")); code != exitModelNotFound {
+			t.Errorf("reportError = %d, want %d", code, exitModelNotFound)
+		}
+	})
+	if want := "Hint: check --model, --cheap-model or OPENAI_MODEL (the run used \"gpt-9\")\n"; out != want {
+		t.Errorf("reportError printed %q, want %q", out, want)
+	}
+	if out := captureStderr(t, func() { reportError(ErrInterrupted) }); out != "" {
+		t.Errorf("an interrupted run printed a hint: %q", out)
+	}
+}
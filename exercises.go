@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	exerciseRetries = 2
+	// exerciseSolutionsDir starts with an underscore so "go test ./..." in
+	// the workspace skips the reference solutions.
+	exerciseSolutionsDir = "_solutions"
+)
+
+var (
+	exerciseFileRe  = regexp.MustCompile(`(?m)^[ \t]*=+[ \t]*(README|STARTER|TEST|SOLUTION)(?:[ \t]+(\S+))?[ \t]*=*[ \t]*$`)
+	exerciseFenceRe = regexp.MustCompile("(?s)^```[^\n]*\n(.*?)\n?```$")
+	exerciseSlugRe  = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// exercise is one concept's set of files as returned by the model.
+type exercise struct {
+	Readme   string
+	Starter  exerciseFile
+	Test     exerciseFile
+	Solution exerciseFile
+}
+
+type exerciseFile struct {
+	Name    string
+	Content string
+}
+
+// exerciseWorkspace writes --mode exercises output: one directory per
+// concept next to the index, and reference solutions under
+// exerciseSolutionsDir when they were asked for.
+type exerciseWorkspace struct {
+	root      string
+	solutions bool
+
+	mu      sync.Mutex
+	written []string // top-level entries of root, for the run outcome
+	goFiles bool
+}
+
+// validateExercisesFlags rejects flags that only make sense for prose
+// guides. In exercises mode --solutions separate asks for reference
+// solutions.
+func validateExercisesFlags(cmd *cobra.Command) {
+	var conflicts []string
+	for _, name := range []string{"stdout", "best-of", "practice", "misconceptions", "pitfalls", "mnemonics"} {
+		if cmd.Flags().Changed(name) {
+			conflicts = append(conflicts, "--"+name)
+		}
+	}
+	if len(conflicts) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: %s cannot be combined with --mode exercises.\n", strings.Join(conflicts, ", "))
+		os.Exit(1)
+	}
+	if cmd.Flags().Changed("solutions") {
+		if cfg.Solutions != "separate" {
+			fmt.Fprintln(os.Stderr, "Error: --mode exercises only supports --solutions separate.")
+			os.Exit(1)
+		}
+		cfg.ExerciseSolutions = true
+	}
+}
+
+func newExerciseWorkspace(root string) *exerciseWorkspace {
+	if cfg.Mode != "exercises" {
+		return nil
+	}
+	return &exerciseWorkspace{root: root, solutions: cfg.ExerciseSolutions}
+}
+
+// build generates and writes the exercises of chunk j and returns the
+// chunk's index entries. Exercises that are malformed or fail the syntax
+// check are asked for again, up to exerciseRetries times.
+func (ws *exerciseWorkspace) build(j chunk) (string, error) {
+	got := map[string]exercise{}
+	problems := map[string]string{}
+	pending := j.items
+
+	for attempt := 0; attempt <= exerciseRetries && len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			retryf("   Chunk %d: regenerating exercise(s) %s...\n", j.id+1, strings.Join(chunkNumbers(pending), ", "))
+		}
+		parsed, err := ws.request(pending, j.model)
+		if err != nil {
+			return "", err
+		}
+		var retry []string
+		for _, item := range pending {
+			num := conceptNumber(item)
+			ex, ok := parsed[num]
+			if !ok {
+				problems[num] = "no exercise in the response"
+				retry = append(retry, item)
+				continue
+			}
+			if err := ws.validate(ex); err != nil {
+				problems[num] = err.Error()
+				retry = append(retry, item)
+				continue
+			}
+			got[num] = ex
+			delete(problems, num)
+		}
+		pending = retry
+	}
+
+	var entries []string
+	for _, item := range j.items {
+		num := conceptNumber(item)
+		ex, ok := got[num]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Warning: no valid exercise for concept %s: %s\n", num, problems[num])
+			entries = append(entries, fmt.Sprintf("## %s\n\n> Exercise not generated: %s", item, problems[num]))
+			continue
+		}
+		dir, err := ws.write(item, ex)
+		if err != nil {
+			return "", err
+		}
+		entries = append(entries, exerciseEntry(item, dir, ex, ws.solutions))
+	}
+	if len(got) == 0 {
+		return "", fmt.Errorf("no valid exercises for concept(s) %s", strings.Join(chunkNumbers(j.items), ", "))
+	}
+	return strings.Join(entries, "\n\n"), nil
+}
+
+func (ws *exerciseWorkspace) request(items []string, model string) (map[string]exercise, error) {
+	solution := ""
+	if ws.solutions {
+		solution = "=== SOLUTION <same file name as the starter> ===\n<the starter file completed so that all tests pass>\n"
+	}
+	prompt := fmt.Sprintf(
+		"Write a small, self-contained coding exercise for EACH of the following concepts.\n\n%s\n\n"+
+			"Use exactly this layout for every concept, where <n> is the concept number:\n"+
+			"=== CONCEPT <n> ===\n"+
+			"=== README ===\n<problem statement in Markdown: goal, requirements and how to run the tests>\n"+
+			"=== STARTER <file name> ===\n<starter source file that compiles, with TODO comments where the learner writes code>\n"+
+			"=== TEST <file name> ===\n<test file that fails until the exercise is solved>\n%s\n"+
+			"File names must be plain names without directories. Do not add any other text.",
+		strings.Join(items, "\n"), solution,
+	)
+	resp, err := callAIWith(callOptions{Model: model, Temperature: defaultTemperature, Purpose: "answer"}, prompt, cfg.SystemPrompt)
+	if err != nil {
+		return nil, err
+	}
+
+	out := map[string]exercise{}
+	for num, body := range parseConceptBlocks(resp) {
+		out[num] = parseExercise(body)
+	}
+	return out, nil
+}
+
+// parseExercise reads the file markers of one concept. Code models like to
+// fence file contents, so a fence around a whole file is removed.
+func parseExercise(body string) exercise {
+	var ex exercise
+	marks := exerciseFileRe.FindAllStringSubmatchIndex(body, -1)
+	for i, m := range marks {
+		end := len(body)
+		if i+1 < len(marks) {
+			end = marks[i+1][0]
+		}
+		content := strings.TrimSpace(body[m[1]:end])
+		if f := exerciseFenceRe.FindStringSubmatch(content); f != nil {
+			content = f[1]
+		}
+		var name string
+		if m[4] >= 0 {
+			name = strings.Trim(body[m[4]:m[5]], "`\"'")
+		}
+		file := exerciseFile{Name: name, Content: content + "\n"}
+		switch body[m[2]:m[3]] {
+		case "README":
+			ex.Readme = content
+		case "STARTER":
+			ex.Starter = file
+		case "TEST":
+			ex.Test = file
+		case "SOLUTION":
+			ex.Solution = file
+		}
+	}
+	return ex
+}
+
+func (ws *exerciseWorkspace) validate(ex exercise) error {
+	if ex.Readme == "" {
+		return fmt.Errorf("missing README")
+	}
+	files := []exerciseFile{ex.Starter, ex.Test}
+	if ws.solutions {
+		files = append(files, ex.Solution)
+	}
+	for _, f := range files {
+		if f.Name == "" || strings.TrimSpace(f.Content) == "" {
+			return fmt.Errorf("missing starter, test or solution file")
+		}
+		if f.Name != filepath.Base(f.Name) || !filepath.IsLocal(f.Name) || strings.EqualFold(f.Name, "README.md") {
+			return fmt.Errorf("invalid file name %q", f.Name)
+		}
+		if err := checkSyntax(f); err != nil {
+			return fmt.Errorf("%s does not parse: %v", f.Name, err)
+		}
+	}
+	if ex.Starter.Name == ex.Test.Name {
+		return fmt.Errorf("starter and test share the name %q", ex.Starter.Name)
+	}
+	if !strings.Contains(ex.Starter.Content, "TODO") {
+		return fmt.Errorf("%s has no TODOs", ex.Starter.Name)
+	}
+	return nil
+}
+
+// checkSyntax parses Go sources with go/parser and Python sources with
+// python3 when it is installed. Other languages are not checked.
+func checkSyntax(f exerciseFile) error {
+	switch filepath.Ext(f.Name) {
+	case ".go":
+		_, err := parser.ParseFile(token.NewFileSet(), f.Name, f.Content, parser.AllErrors)
+		return err
+	case ".py":
+		python, err := exec.LookPath("python3")
+		if err != nil {
+			return nil
+		}
+		cmd := exec.Command(python, "-c", "import ast, sys; ast.parse(sys.stdin.read(), sys.argv[1])", f.Name)
+		cmd.Stdin = strings.NewReader(f.Content)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+			return fmt.Errorf("%s", lines[len(lines)-1])
+		}
+	}
+	return nil
+}
+
+// exerciseDir is the directory of a concept: "03-closures-and-scope".
+func exerciseDir(concept string) string {
+	num := conceptNumber(concept)
+	title := conceptPrefixRe.ReplaceAllString(concept, "")
+	slug := strings.Trim(exerciseSlugRe.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if len(slug) > 40 {
+		slug = strings.TrimRight(slug[:40], "-")
+	}
+	width := len(fmt.Sprint(cfg.TotalCount))
+	if width < 2 {
+		width = 2
+	}
+	n, _ := strconv.Atoi(num)
+	return fmt.Sprintf("%0*d-%s", width, n, slug)
+}
+
+func (ws *exerciseWorkspace) write(concept string, ex exercise) (string, error) {
+	dir := exerciseDir(concept)
+	if err := writeFiles(filepath.Join(ws.root, dir), map[string]string{
+		"README.md":     fmt.Sprintf("# %s\n\n%s\n", concept, ex.Readme),
+		ex.Starter.Name: ex.Starter.Content,
+		ex.Test.Name:    ex.Test.Content,
+	}); err != nil {
+		return "", err
+	}
+	written := []string{dir}
+	if ws.solutions {
+		// The test goes along so the solution can be checked on its own.
+		if err := writeFiles(filepath.Join(ws.root, exerciseSolutionsDir, dir), map[string]string{
+			ex.Solution.Name: ex.Solution.Content,
+			ex.Test.Name:     ex.Test.Content,
+		}); err != nil {
+			return "", err
+		}
+		written = append(written, exerciseSolutionsDir)
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for _, w := range written {
+		if !slices.Contains(ws.written, w) {
+			ws.written = append(ws.written, w)
+		}
+	}
+	ws.goFiles = ws.goFiles || filepath.Ext(ex.Starter.Name) == ".go"
+	return dir, nil
+}
+
+func writeFiles(dir string, files map[string]string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exerciseEntry(concept, dir string, ex exercise, solutions bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s\n\n", concept)
+	if para, _, _ := strings.Cut(strings.TrimSpace(ex.Readme), "\n\n"); !strings.HasPrefix(para, "#") {
+		fmt.Fprintf(&b, "%s\n\n", para)
+	}
+	fmt.Fprintf(&b, "- Exercise: [%s/](%s/README.md)\n", dir, dir)
+	fmt.Fprintf(&b, "- Starter: `%s/%s` · Tests: `%s/%s`", dir, ex.Starter.Name, dir, ex.Test.Name)
+	if solutions {
+		fmt.Fprintf(&b, "\n- Solution (spoiler): `%s/%s/%s`", exerciseSolutionsDir, dir, ex.Solution.Name)
+	}
+	return b.String()
+}
+
+// finish writes the files the whole workspace shares and returns the
+// top-level entries written, for the run outcome.
+func (ws *exerciseWorkspace) finish() []string {
+	var out []string
+	if ws.goFiles {
+		module := strings.Trim(exerciseSlugRe.ReplaceAllString(strings.ToLower(cfg.Subject), "-"), "-")
+		if module == "" {
+			module = "exercises"
+		}
+		goMod := fmt.Sprintf("module %s\n\ngo 1.21\n", module)
+		if err := os.WriteFile(filepath.Join(ws.root, "go.mod"), []byte(goMod), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing go.mod: %v\n", err)
+		} else {
+			out = append(out, filepath.Join(ws.root, "go.mod"))
+		}
+	}
+	if slices.Contains(ws.written, exerciseSolutionsDir) {
+		note := "# Reference solutions\n\nSpoilers: try each exercise before looking here. Every directory holds the solved file and its test.\n"
+		if err := os.WriteFile(filepath.Join(ws.root, exerciseSolutionsDir, "README.md"), []byte(note), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing solutions README: %v\n", err)
+		}
+	}
+	for _, w := range ws.written {
+		out = append(out, filepath.Join(ws.root, w))
+	}
+	return out
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// sectionEndRe matches where a concept section of a finished guide ends: the
+// next level-2 heading or a chunk separator.
+var sectionEndRe = regexp.MustCompile(`(?m)^(?:## |---[ \t]*$)`)
+
+// guideSection locates concept n in a finished guide and returns the byte
+// range of its section, heading included.
+func guideSection(md string, n int) (start, end int, ok bool) {
+	want := strconv.Itoa(n)
+	for _, m := range conceptHeadingRe.FindAllStringSubmatchIndex(md, -1) {
+		if md[m[2]:m[3]] != want || !strings.HasPrefix(md[m[0]:], "## ") {
+			continue
+		}
+		start, end = m[0], len(md)
+		if loc := sectionEndRe.FindStringIndex(md[m[1]:]); loc != nil {
+			end = m[1] + loc[0]
+		}
+		return start, end, true
+	}
+	return 0, 0, false
+}
+
+// sectionRewrite is what expand and condense ask of the model.
+type sectionRewrite struct {
+	purpose     string
+	done        string // for the status line
+	instruction string
+}
+
+var (
+	expandRewrite = sectionRewrite{purpose: "expand", done: "Expanded",
+		instruction: "Rewrite it in more depth: add detail, worked examples and edge cases the section skips over. "}
+	condenseRewrite = sectionRewrite{purpose: "condense", done: "Condensed",
+		instruction: "Rewrite it more concisely: keep the key ideas, the essential example and anything a learner can't do without, and cut repetition and digressions. "}
+)
+
+// rewriteSection asks the model to rewrite concept n of a guide as rw says
+// and writes the new section back in place. With --study-time the
+// section's estimate is recomputed, and the total under the title, the
+// Study Plan and the sidecar follow it. It returns the new section.
+func rewriteSection(guidePath string, n int, rw sectionRewrite) (string, error) {
+	src, err := os.ReadFile(guidePath)
+	if err != nil {
+		return "", err
+	}
+	md := string(src)
+	start, end, ok := guideSection(md, n)
+	if !ok {
+		return "", fmt.Errorf("no section for concept %d in %s", n, guidePath)
+	}
+	section, oldMinutes, timed := stripStudyTime(strings.TrimSpace(md[start:end]))
+
+	title, _ := guideConcepts(parseMarkdown(md))
+	prompt := fmt.Sprintf(
+		"Here is one section of a study guide about %s:\n\n%s\n\n"+
+			rw.instruction+
+			"Keep its heading and numbering exactly as they are and keep everything that is already correct. "+
+			"Output ONLY the rewritten section in markdown.",
+		title, section)
+	resp, err := callAIWith(callOptions{Model: cfg.Model, Temperature: defaultTemperature, Purpose: rw.purpose}, prompt, cfg.SystemPrompt)
+	if err != nil {
+		return "", err
+	}
+	rewritten, _, _ := stripStudyTime(strings.TrimSpace(cleanChunkContent(resp)))
+	if _, _, ok := guideSection(rewritten, n); !ok {
+		return "", fmt.Errorf("the model's answer lost the heading of concept %d; the guide is unchanged", n)
+	}
+
+	var sc *Sidecar
+	minutes := 0
+	if timed {
+		if sc, err = readSidecar(sidecarPath(guidePath)); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Warning: ignoring unreadable sidecar: %v\n", err)
+		}
+		minutes = reestimate(sc, n, rewritten)
+		heading, rest, _ := strings.Cut(rewritten, "\n")
+		rewritten = heading + "\n\n*" + formatStudyTime(minutes) + "*\n" + rest
+	}
+
+	out := md[:start] + rewritten + "\n\n" + md[end:]
+	if timed {
+		out = updateStudyTotals(out, n, oldMinutes, minutes)
+	}
+	if err := writeFileAtomic(guidePath, []byte(out), 0o644); err != nil {
+		return "", err
+	}
+	if sc != nil {
+		if err := writeSidecar(sidecarPath(guidePath), sc); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing sidecar: %v\n", err)
+		}
+	}
+	fmt.Printf("-> %s concept %d of %s (%d -> %d words)\n", rw.done, n, guidePath, len(strings.Fields(section)), len(strings.Fields(rewritten)))
+	emitEvent(progressEvent{Event: "section", Text: rewritten})
+	return rewritten, nil
+}
+
+// newRewriteCmd is the expand or condense subcommand.
+func newRewriteCmd(use, short string, rw sectionRewrite) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   use + " <guide.md> <n>",
+		Short: short,
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "Error: invalid concept number %q\n", args[1])
+				os.Exit(1)
+			}
+			if err := loadEnv(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			cfg.SystemPrompt = modes["guide"].systemPrompt
+			_, err = rewriteSection(args[0], n, rw)
+			emitUsage()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&cfg.Provider, "provider", "p", "", "Named provider profile from the config file")
+	cmd.Flags().StringVarP(&cfg.Model, "model", "m", "", "Model to use (overrides OPENAI_MODEL)")
+	cmd.Flags().BoolVar(&cfg.ProgressEvents, "progress-events", false, "Write machine-readable progress events to stdout")
+	cmd.Flags().MarkHidden("progress-events")
+	return cmd
+}
+
+func newExpandCmd() *cobra.Command {
+	return newRewriteCmd("expand", "Rewrite one concept of an existing guide in more depth", expandRewrite)
+}
+
+func newCondenseCmd() *cobra.Command {
+	return newRewriteCmd("condense", "Rewrite one concept of an existing guide more concisely", condenseRewrite)
+}
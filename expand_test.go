@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yuriiter/aiguide/pkg/guide"
+)
+
+// useFakeModel points gen at a chat completions server that answers every
+// request with answer(prompt) until the test ends.
+func useFakeModel(t *testing.T, answer func(prompt string) string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req guide.CompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": answer(req.Messages[len(req.Messages)-1].Content)}}},
+			"usage":   map[string]int{"prompt_tokens": 10, "completion_tokens": 20, "total_tokens": 30},
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+
+	prev := gen
+	t.Cleanup(func() { gen = prev })
+	cfg.Model = "test-model"
+	var err error
+	if gen, err = newGenerator("", "", srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+const timedGuide = "# Comprehensive Guide: GO\n\n*Estimated study time: ≈ 40 min*\n\n## Table of Contents\n\n" +
+	"- [1. Foo](#1-foo)\n- [2. Bar](#2-bar)\n- [Study Plan](#study-plan)\n\n---\n\n" +
+	"## 1. Foo\n\n*≈ 15 min*\n\nFoo.\n\n" +
+	"## 2. Bar\n\n*≈ 25 min*\n\nBar at length.\n\n---\n\n" +
+	"## Study Plan\n\n- **Day 1, 2026-10-15** (≈ 40 min): [1. Foo](#1-foo) (≈ 15 min), [2. Bar](#2-bar) (≈ 25 min)\n\n---\n\n"
+
+// TestCondenseUpdatesStudyTime checks that a condensed section gets a new
+// estimate, and that the total, the Study Plan and the sidecar follow it.
+func TestCondenseUpdatesStudyTime(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.ReadingSpeed, cfg.DifficultyMults, cfg.ExerciseMinutes = 100, defaultDifficultyMultipliers, 5
+
+	var prompt string
+	useFakeModel(t, func(p string) string {
+		prompt = p
+		// The stale estimate the model copied is dropped.
+		return "```markdown\n## 2. Bar\n\n*≈ 25 min*\n\n" + strings.Repeat("bar ", 397) + "\n```"
+	})
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "guide.md")
+	if err := os.WriteFile(path, []byte(timedGuide), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sc := &Sidecar{
+		Provenance: Provenance{Settings: map[string]string{"reading_speed": "200", "difficulty_multipliers": "1,1,1,2,4"}},
+		Sections: []SectionMeta{
+			{Chunk: 0, Items: []int{1}, StudyMinutes: []int{15}},
+			{Chunk: 1, Items: []int{2}, StudyMinutes: []int{25}, Difficulty: []int{4}, Problems: [][]int{{1}}},
+		},
+	}
+	if err := writeSidecar(sidecarPath(path), sc); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rewriteSection(path, 2, condenseRewrite); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompt, "more concisely") || strings.Contains(prompt, "≈ 25 min") {
+		t.Errorf("prompt:\n%s", prompt)
+	}
+
+	// 400 words at 200 wpm, doubled for difficulty 4, plus one problem.
+	b, _ := os.ReadFile(path)
+	got := string(b)
+	for _, want := range []string{
+		"*Estimated study time: ≈ 24 min*",
+		"## 2. Bar\n\n*≈ 9 min*\n\nbar bar",
+		"- **Day 1, 2026-10-15** (≈ 24 min): [1. Foo](#1-foo) (≈ 15 min), [2. Bar](#2-bar) (≈ 9 min)",
+		"## 1. Foo\n\n*≈ 15 min*\n\nFoo.",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("guide lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "≈ 25 min") != 0 {
+		t.Errorf("stale estimate left:\n%s", got)
+	}
+	sc, err := readSidecar(sidecarPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := sc.Sections[1].StudyMinutes; len(m) != 1 || m[0] != 9 {
+		t.Errorf("sidecar study_minutes = %v, want [9]", m)
+	}
+}
+
+// TestExpandUntimedGuide checks that a guide without --study-time gets no
+// estimate.
+func TestExpandUntimedGuide(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	useFakeModel(t, func(string) string { return "## 1. Foo\n\nFoo, in depth." })
+
+	path := filepath.Join(t.TempDir(), "guide.md")
+	md := "# Comprehensive Guide: GO\n\n## 1. Foo\n\nFoo.\n\n## 2. Bar\n\nBar.\n"
+	if err := os.WriteFile(path, []byte(md), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rewriteSection(path, 1, expandRewrite); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(path)
+	if want := "# Comprehensive Guide: GO\n\n## 1. Foo\n\nFoo, in depth.\n\n## 2. Bar\n\nBar.\n"; string(b) != want {
+		t.Errorf("got:\n%q\nwant:\n%q", b, want)
+	}
+}
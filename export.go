@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// exporters run for each --export value once the guide is on disk, so the
+// same code backs "aiguide export <format> guide.md".
+var exporters = map[string]struct {
+	check func() error
+	run   func(guidePath string) error
+}{
+	"bibtex": {
+		check: func() error { return nil },
+		run:   exportBibTeX,
+	},
+	"conceptmap": {
+		check: func() error { return nil },
+		run:   exportConceptMap,
+	},
+	"confluence": {
+		check: checkConfluence,
+		run:   exportConfluence,
+	},
+	"epub": {
+		check: func() error { return nil },
+		run:   exportEPUB,
+	},
+	"html": {
+		check: func() error { return nil },
+		run:   exportHTML,
+	},
+	"ics": {
+		check: checkICS,
+		run:   exportICS,
+	},
+	"latex": {
+		check: func() error { return nil },
+		run:   exportLaTeX,
+	},
+	"mindmap": {
+		check: func() error { return nil },
+		run:   exportMindmap,
+	},
+	"notion": {
+		check: func() error { return checkNotion(cfg.NotionParent) },
+		run:   func(guidePath string) error { return exportNotion(guidePath, cfg.NotionParent) },
+	},
+}
+
+func exporterNames() string {
+	names := make([]string, 0, len(exporters))
+	for n := range exporters {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// checkExports validates --export before any API call.
+func checkExports() error {
+	if len(cfg.Exports) == 0 {
+		return nil
+	}
+	if cfg.Stdout {
+		return fmt.Errorf("--export needs a file output and cannot be combined with --stdout")
+	}
+	for _, name := range cfg.Exports {
+		e, ok := exporters[name]
+		if !ok {
+			return fmt.Errorf("unknown --export %q (available: %s)", name, exporterNames())
+		}
+		if err := e.check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runExports runs every requested exporter and reports whether all succeeded.
+func runExports(guidePath string) bool {
+	ok := true
+	for _, name := range cfg.Exports {
+		statusf("-> Exporting to %s...\n", name)
+		if err := exporters[name].run(guidePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting to %s (the local guide is intact): %v\n", name, err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+func newExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export an existing guide to another tool",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if err := checkExplanation(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.PersistentFlags().StringVar(&cfg.Explanation, "explanation", "both", "Explanations to export where a concept has two: both, main or alt")
+
+	notion := &cobra.Command{
+		Use:   "notion <guide.md>",
+		Short: "Upload a guide as a Notion page",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := exportNotion(args[0], cfg.NotionParent); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	notion.Flags().StringVar(&cfg.NotionParent, "parent", "", "Parent page id or URL (default $"+notionParentEnvVar+")")
+
+	confluence := &cobra.Command{
+		Use:   "confluence <guide.md>",
+		Short: "Create or update a Confluence page from a guide",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := exportConfluence(args[0]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	confluence.Flags().StringVar(&cfg.ConfluenceURL, "url", "", "Confluence base URL (default $"+confluenceURLEnvVar+")")
+	confluence.Flags().StringVar(&cfg.ConfluenceSpace, "space", "", "Space key (default $"+confluenceSpaceEnv+")")
+	confluence.Flags().StringVar(&cfg.ConfluenceParent, "parent", "", "Parent page id (default $"+confluenceParentEnv+")")
+	confluence.Flags().BoolVar(&cfg.ConfluenceChildPages, "child-pages", false, "Put every concept on its own child page")
+
+	bibtex := &cobra.Command{
+		Use:   "bibtex <guide.md>",
+		Short: "Write a guide's references as a BibTeX file next to it",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := exportBibTeX(args[0]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	latex := &cobra.Command{
+		Use:   "latex <guide.md>",
+		Short: "Write a guide as a LaTeX document citing its BibTeX references",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := exportLaTeX(args[0]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	htmlCmd := &cobra.Command{
+		Use:   "html <guide.md>",
+		Short: "Write a guide as a standalone HTML page next to it",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := exportHTML(args[0]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	epub := &cobra.Command{
+		Use:   "epub <guide.md>",
+		Short: "Write a guide as an EPUB book next to it",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := exportEPUB(args[0]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	mindmap := &cobra.Command{
+		Use:   "mindmap <guide.md>",
+		Short: "Write a guide as OPML and FreeMind mind maps next to it",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := exportMindmap(args[0]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	conceptmap := &cobra.Command{
+		Use:   "conceptmap <guide.md>",
+		Short: "Write an interactive HTML concept map of a guide, and its JSON data",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := exportConceptMap(args[0]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	ics := &cobra.Command{
+		Use:   "ics <guide.md>",
+		Short: "Write a guide's study plan as an iCalendar file next to it",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := exportICS(args[0]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	ics.Flags().StringVar(&cfg.PlanStart, "plan-start", "", "First day of the plan, YYYY-MM-DD (default tomorrow)")
+	ics.Flags().BoolVar(&cfg.WeekendsOff, "weekends-off", false, "Schedule no sessions on weekends")
+	ics.Flags().IntVar(&cfg.SessionsPerWeek, "sessions-per-week", 0, "Maximum sessions per week (0 = one every day)")
+	ics.Flags().IntVar(&cfg.SessionMinutes, "session-minutes", 60, "Study time to fit into one session")
+	ics.Flags().StringVar(&cfg.SessionTime, "session-time", "18:00", "Local time sessions start at, HH:MM")
+
+	cmd.AddCommand(notion, confluence, bibtex, latex, htmlCmd, epub, mindmap, conceptmap, ics)
+	return cmd
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const defaultFilenameTemplate = `{{.SubjectSlug}}_{{.Date "20060102-150405"}}`
+
+// filenameData is what --filename-template can reference. Part and Number
+// are zero for the guide itself and set for outputs written per part or per
+// concept.
+type filenameData struct {
+	Subject     string
+	SubjectSlug string
+	Model       string
+	Lang        string
+	N           int
+	Part        int
+	Number      int
+	startedAt   time.Time
+}
+
+func (d filenameData) Date(layout string) string {
+	return d.startedAt.Format(layout)
+}
+
+var subjectSlugRe = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+func newFilenameData(startedAt time.Time) filenameData {
+	return filenameData{
+		Subject:     cfg.Subject,
+		SubjectSlug: subjectSlugRe.ReplaceAllString(cfg.Subject, "_"),
+		Model:       cfg.Model,
+		Lang:        cfg.Lang,
+		N:           cfg.TotalCount,
+		startedAt:   startedAt,
+	}
+}
+
+// renderFilename renders --filename-template into an output stem; callers add
+// the extension for each artifact. Slashes deliberately create
+// subdirectories, but the result must stay below the working directory, so
+// absolute paths and ".." are rejected.
+func renderFilename(data filenameData) (string, error) {
+	tmpl, err := template.New("filename").Option("missingkey=error").Parse(cfg.FilenameTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid --filename-template: %w", err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("rendering --filename-template: %w", err)
+	}
+
+	name := strings.TrimSuffix(strings.TrimSpace(b.String()), ".md")
+	name = filepath.FromSlash(name)
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("--filename-template rendered %q, which is not a relative path inside the working directory", b.String())
+	}
+	return filepath.Clean(name), nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderFilename(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	data := filenameData{
+		Subject:     "TCP/IP Networking",
+		SubjectSlug: "TCP_IP_Networking",
+		Model:       "gpt-4o",
+		Lang:        "de",
+		N:           40,
+		startedAt:   time.Date(2026, 3, 9, 14, 5, 7, 0, time.UTC),
+	}
+	tests := []struct {
+		tmpl    string
+		want    string
+		wantErr string
+	}{
+		{tmpl: defaultFilenameTemplate, want: "TCP_IP_Networking_20260309-140507"},
+		{tmpl: `guides/{{.Lang}}/{{.SubjectSlug}}-{{.N}}`, want: filepath.FromSlash("guides/de/TCP_IP_Networking-40")},
+		{tmpl: `{{.Date "2006-01-02"}}_{{.Model}}.md`, want: "2026-03-09_gpt-4o"},
+		{tmpl: `  {{.SubjectSlug}}  `, want: "TCP_IP_Networking"},
+		{tmpl: `a/./b//{{.N}}`, want: filepath.FromSlash("a/b/40")},
+		// Slashes in the subject itself make subdirectories too.
+		{tmpl: `{{.Subject}}`, want: filepath.FromSlash("TCP/IP Networking")},
+		{tmpl: `../{{.SubjectSlug}}`, wantErr: "not a relative path"},
+		{tmpl: `out/../../{{.SubjectSlug}}`, wantErr: "not a relative path"},
+		{tmpl: `..`, wantErr: "not a relative path"},
+		{tmpl: `/tmp/{{.SubjectSlug}}`, wantErr: "not a relative path"},
+		{tmpl: ``, wantErr: "not a relative path"},
+		{tmpl: `{{.Nope}}`, wantErr: "rendering --filename-template"},
+		{tmpl: `{{.SubjectSlug`, wantErr: "invalid --filename-template"},
+	}
+	for _, tt := range tests {
+		cfg.FilenameTemplate = tt.tmpl
+		got, err := renderFilename(data)
+		switch {
+		case tt.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: got %q, %v; want an error %q", tt.tmpl, got, err, tt.wantErr)
+			}
+		case err != nil:
+			t.Errorf("%q: unexpected error: %v", tt.tmpl, err)
+		case got != tt.want:
+			t.Errorf("%q = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+// TestRenderFilenameTraversalSubject checks that a subject can't lead the
+// output out of the working directory.
+func TestRenderFilenameTraversalSubject(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.FilenameTemplate = `{{.Subject}}`
+	for _, subject := range []string{"../../etc/passwd", "a/../../b", "..", "/etc/cron.d/x"} {
+		if got, err := renderFilename(filenameData{Subject: subject}); err == nil {
+			t.Errorf("subject %q rendered %q, want an error", subject, got)
+		}
+	}
+	cfg.FilenameTemplate = defaultFilenameTemplate
+	cfg.Subject = "../../etc"
+	got, err := renderFilename(newFilenameData(time.Now()))
+	if err != nil || strings.Contains(got, "..") {
+		t.Errorf("the default template gave %q, %v; want a slug without ..", got, err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// exitShareFailed tells scripts the guide was generated but could not be
+// shared.
+const exitShareFailed = 3
+
+type gistFile struct {
+	Content string `json:"content"`
+}
+
+type gistRequest struct {
+	Description string              `json:"description"`
+	Public      bool                `json:"public"`
+	Files       map[string]gistFile `json:"files"`
+}
+
+func checkGist() error {
+	if cfg.Stdout {
+		return fmt.Errorf("--gist needs a file output and cannot be combined with --stdout")
+	}
+	if os.Getenv("GITHUB_TOKEN") == "" {
+		return fmt.Errorf("--gist requires the GITHUB_TOKEN environment variable")
+	}
+	return nil
+}
+
+// uploadGist creates a gist from files and returns its URL. GitHub lists gist
+// files by name, so the guide (which sorts before its .meta.json) shows first.
+func uploadGist(files []string) (string, error) {
+	req := gistRequest{
+		Description: "aiguide: " + cfg.Subject,
+		Public:      cfg.GistPublic,
+		Files:       make(map[string]gistFile, len(files)),
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return "", err
+		}
+		req.Files[filepath.Base(f)] = gistFile{Content: string(b)}
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	api := os.Getenv("GITHUB_API_URL")
+	if api == "" {
+		api = "https://api.github.com"
+	}
+	httpReq, err := http.NewRequest("POST", strings.TrimSuffix(api, "/")+"/gists", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Accept", "application/vnd.github+json")
+	httpReq.Header.Set("Authorization", "Bearer "+os.Getenv("GITHUB_TOKEN"))
+	httpReq.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("GitHub API error: %s - %s", resp.Status, truncate(string(respBody), 200))
+	}
+
+	var created struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.Unmarshal(respBody, &created); err != nil {
+		return "", err
+	}
+	return created.HTMLURL, nil
+}
+
+// gistOutputs picks what to upload: the guide, plus the sidecar with
+// --gist-sidecar.
+func gistOutputs(outputs []string) []string {
+	var files []string
+	for _, f := range outputs {
+		if strings.HasSuffix(f, ".meta.json") && !cfg.GistSidecar {
+			continue
+		}
+		if st, err := os.Stat(f); err == nil && st.IsDir() {
+			continue // gists are flat; exercise directories stay local
+		}
+		files = append(files, f)
+	}
+	return files
+}
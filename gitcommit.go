@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const defaultGitMessage = "Add study guide: {{.Subject}} ({{.Model}}, {{.Date}})"
+
+type gitMessageData struct {
+	Subject string
+	Model   string
+	Date    string
+}
+
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// checkGitCommit runs before any API call so a misconfigured --git-commit
+// fails without spending tokens.
+func checkGitCommit(outputDir string) error {
+	if cfg.Stdout {
+		return fmt.Errorf("--git-commit needs a file output and cannot be combined with --stdout")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("--git-commit requires the git binary on PATH")
+	}
+	if out, err := git(outputDir, "rev-parse", "--is-inside-work-tree"); err != nil || out != "true" {
+		abs, _ := filepath.Abs(outputDir)
+		return fmt.Errorf("--git-commit: %s is not inside a git work tree", abs)
+	}
+	if _, err := template.New("msg").Parse(cfg.GitMessage); err != nil {
+		return fmt.Errorf("invalid --git-message template: %w", err)
+	}
+	return nil
+}
+
+// gitCommitOutputs commits exactly the files this run produced. The pathspec
+// form of git commit ignores anything else the user already had staged.
+func gitCommitOutputs(files []string, startedAt time.Time) error {
+	if len(files) == 0 {
+		return nil
+	}
+	dir := filepath.Dir(files[0])
+
+	tmpl, err := template.New("msg").Parse(cfg.GitMessage)
+	if err != nil {
+		return err
+	}
+	var msg bytes.Buffer
+	if err := tmpl.Execute(&msg, gitMessageData{
+		Subject: cfg.Subject,
+		Model:   cfg.Model,
+		Date:    startedAt.Format("2006-01-02"),
+	}); err != nil {
+		return fmt.Errorf("rendering --git-message: %w", err)
+	}
+
+	rel := make([]string, len(files))
+	for i, f := range files {
+		rel[i] = filepath.Base(f)
+	}
+
+	if _, err := git(dir, append([]string{"add", "--"}, rel...)...); err != nil {
+		return err
+	}
+	if _, err := git(dir, append([]string{"commit", "-m", msg.String(), "--"}, rel...)...); err != nil {
+		// Leave the index as we found it.
+		git(dir, append([]string{"reset", "-q", "--"}, rel...)...)
+		return err
+	}
+	hash, _ := git(dir, "rev-parse", "--short", "HEAD")
+	statusf("-> Committed %d file(s) as %s\n", len(files), hash)
+
+	if cfg.GitPush {
+		if _, err := git(dir, "push"); err != nil {
+			return fmt.Errorf("commit %s created but push failed: %w", hash, err)
+		}
+		statusf("-> Pushed to the upstream branch\n")
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// historyRecord is one line of history.jsonl: a finished run, successful
+// or not. Settings are the provenance settings, the flags that shape the
+// content.
+type historyRecord struct {
+	ID       string            `json:"id"`
+	Time     time.Time         `json:"time"`
+	Subject  string            `json:"subject"`
+	Output   string            `json:"output,omitempty"`
+	Outputs  []string          `json:"outputs,omitempty"`
+	Provider string            `json:"provider"`
+	Model    string            `json:"model"`
+	Settings map[string]string `json:"settings"`
+	Args     []string          `json:"args"`
+	Duration float64           `json:"duration_seconds"`
+	Tokens   int               `json:"tokens"`
+	CostUSD  *float64          `json:"cost_usd,omitempty"`
+	Status   string            `json:"status"`
+	Stage    string            `json:"stage,omitempty"`
+}
+
+// HistoryConfig is the "history" section of the config file.
+type HistoryConfig struct {
+	MaxSize string `json:"max_size,omitempty"` // e.g. 10MB; the default is defaultHistoryMaxSize
+}
+
+const defaultHistoryMaxSize = 10 << 20
+
+// runHistory is where finishRun records the run; path is empty with
+// --no-history.
+var runHistory struct {
+	path    string
+	maxSize int64
+}
+
+// dataDir holds aiguide's history: $XDG_DATA_HOME/aiguide, else
+// ~/.local/share/aiguide.
+func dataDir() string {
+	if d := os.Getenv("XDG_DATA_HOME"); d != "" {
+		return filepath.Join(d, "aiguide")
+	}
+	return expandHome("~/.local/share/aiguide")
+}
+
+func historyPath() string {
+	return filepath.Join(dataDir(), "history.jsonl")
+}
+
+// rotatedHistoryPath is where a full history file is moved; the one before
+// it is dropped.
+func rotatedHistoryPath(path string) string {
+	return strings.TrimSuffix(path, ".jsonl") + ".1.jsonl"
+}
+
+// configureHistory applies --no-history and the config file's history
+// section to runHistory.
+func configureHistory(fc *FileConfig) error {
+	if cfg.NoHistory {
+		return nil
+	}
+	runHistory.path, runHistory.maxSize = historyPath(), defaultHistoryMaxSize
+	if fc.History.MaxSize != "" {
+		n, err := parseSize(fc.History.MaxSize)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid history max_size %q in the config file", fc.History.MaxSize)
+		}
+		runHistory.maxSize = n
+	}
+	return nil
+}
+
+// recordHistory appends the run to the history. A failure to write it is
+// only a warning: the guide itself is what matters.
+func recordHistory(o runOutcome) {
+	if runHistory.path == "" {
+		return
+	}
+	p := newProvenance(time.Now().Add(-o.Duration), cfg.TotalCount)
+	sum, cost, priced := usage.totals()
+	r := historyRecord{
+		ID:       runID,
+		Time:     time.Now().Add(-o.Duration).UTC().Truncate(time.Second),
+		Subject:  cfg.Subject,
+		Outputs:  o.Outputs,
+		Provider: p.Provider,
+		Model:    cfg.Model,
+		Settings: p.Settings,
+		Args:     redactArgs(os.Args[1:]),
+		Duration: o.Duration.Round(time.Millisecond).Seconds(),
+		Tokens:   sum.TotalTokens,
+		Status:   o.Status,
+		Stage:    o.Stage,
+	}
+	if len(o.Outputs) > 0 {
+		if abs, err := filepath.Abs(o.Outputs[0]); err == nil {
+			r.Output = abs
+		}
+	}
+	if priced {
+		r.CostUSD = &cost
+	}
+	if err := appendHistory(runHistory.path, runHistory.maxSize, r); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not record the run in %s: %v\n", runHistory.path, err)
+	}
+}
+
+// historyRedactedFlags carry credentials: webhook URLs embed tokens.
+var historyRedactedFlags = []string{"--webhook", "--webhook-secret"}
+
+// redactArgs replaces the values of historyRedactedFlags.
+func redactArgs(args []string) []string {
+	out := slices.Clone(args)
+	for i := 0; i < len(out); i++ {
+		name, _, hasValue := strings.Cut(out[i], "=")
+		if !slices.Contains(historyRedactedFlags, name) {
+			continue
+		}
+		if hasValue {
+			out[i] = name + "=REDACTED"
+		} else if i+1 < len(out) {
+			out[i+1] = "REDACTED"
+			i++
+		}
+	}
+	return out
+}
+
+func newHistoryID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// appendHistory adds r as one line, under a lock so simultaneous runs
+// neither interleave lines nor rotate the file twice. A file that would grow
+// past maxSize is rotated first.
+func appendHistory(path string, maxSize int64, r historyRecord) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if fi, err := os.Stat(path); err == nil && fi.Size() > 0 && fi.Size()+int64(len(line)) > maxSize {
+		if err := os.Rename(path, rotatedHistoryPath(path)); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readHistory returns every record, oldest first, including the rotated
+// file's. Lines that don't parse are skipped.
+func readHistory() ([]historyRecord, error) {
+	var out []historyRecord
+	for _, path := range []string{rotatedHistoryPath(historyPath()), historyPath()} {
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 0, 64<<10), 4<<20)
+		for sc.Scan() {
+			var r historyRecord
+			if json.Unmarshal(sc.Bytes(), &r) == nil && r.ID != "" {
+				out = append(out, r)
+			}
+		}
+		err = sc.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// findHistoryRun returns the run whose id starts with prefix.
+func findHistoryRun(prefix string) (historyRecord, error) {
+	records, err := readHistory()
+	if err != nil {
+		return historyRecord{}, err
+	}
+	var match []historyRecord
+	for _, r := range records {
+		if strings.HasPrefix(r.ID, prefix) {
+			match = append(match, r)
+		}
+	}
+	switch len(match) {
+	case 0:
+		return historyRecord{}, fmt.Errorf("no run %q in the history", prefix)
+	case 1:
+		return match[0], nil
+	}
+	return historyRecord{}, fmt.Errorf("%q matches %d runs; give more of the id", prefix, len(match))
+}
+
+// parseSince reads --since: a date (YYYY-MM-DD, local time) or an age such
+// as 7d or 36h.
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	age, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a date such as 2026-01-31 or an age such as 7d")
+	}
+	return time.Now().Add(-age), nil
+}
+
+func formatCost(c *float64) string {
+	if c == nil {
+		return "-"
+	}
+	return fmt.Sprintf("$%.4f", *c)
+}
+
+func newHistoryCmd() *cobra.Command {
+	var subject, since string
+	var failed bool
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "List recent runs, newest first",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			var from time.Time
+			if since != "" {
+				var err error
+				if from, err = parseSince(since); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: invalid --since %q: %v\n", since, err)
+					os.Exit(1)
+				}
+			}
+			records, err := readHistory()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			var shown []historyRecord
+			for i := len(records) - 1; i >= 0 && (limit <= 0 || len(shown) < limit); i-- {
+				r := records[i]
+				switch {
+				case subject != "" && !strings.Contains(strings.ToLower(r.Subject), strings.ToLower(subject)):
+				case !from.IsZero() && r.Time.Before(from):
+				case failed && r.Status == statusSuccess:
+				default:
+					shown = append(shown, r)
+				}
+			}
+			if len(shown) == 0 {
+				fmt.Println("No runs recorded.")
+				return
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tTIME\tSTATUS\tSUBJECT\tMODEL\tDURATION\tCOST\tOUTPUT")
+			for _, r := range shown {
+				out := r.Output
+				if r.Status == statusFailed && r.Stage != "" {
+					out = r.Stage
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.ID, r.Time.Local().Format("2006-01-02 15:04"), r.Status,
+					truncateRunes(r.Subject, 40), r.Model, time.Duration(r.Duration*float64(time.Second)).Round(time.Second).String(), formatCost(r.CostUSD), out)
+			}
+			tw.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&subject, "subject", "", "Only runs whose subject contains this text (case-insensitive)")
+	cmd.Flags().StringVar(&since, "since", "", "Only runs started after this date (YYYY-MM-DD) or within this age (e.g. 7d)")
+	cmd.Flags().BoolVar(&failed, "failed", false, "Only failed and partially failed runs")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "Show at most this many runs (0 = all)")
+
+	show := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Print the full record of a run",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			r, err := findHistoryRun(args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			b, _ := json.MarshalIndent(r, "", "  ")
+			fmt.Println(string(b))
+		},
+	}
+	cmd.AddCommand(show)
+	return cmd
+}
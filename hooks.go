@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hooks run commands the user passed on the command line or in the config
+// file, and only those: nothing from the model or the guide is ever executed. Their output is
+// trusted as much as the user trusts their own command.
+
+// hookCommand builds the platform shell invocation for a user's hook.
+func hookCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// prefixWriter copies complete lines to w, each prefixed, so output of a
+// hook shows up in the log as it is produced.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		fmt.Fprintf(p.w, "%s%s\n", p.prefix, p.buf[:i])
+		p.buf = p.buf[i+1:]
+	}
+}
+
+func (p *prefixWriter) flush() {
+	if len(p.buf) > 0 {
+		fmt.Fprintf(p.w, "%s%s\n", p.prefix, p.buf)
+		p.buf = nil
+	}
+}
+
+// runHook runs command with stdin and the extra environment variables, for
+// at most cfg.HookTimeout. stdout receives the command's output; its stderr
+// is streamed to ours, each line prefixed with label.
+func runHook(command, label string, stdin io.Reader, env []string, stdout io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HookTimeout)
+	defer cancel()
+
+	cmd := hookCommand(ctx, command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	stderr := &prefixWriter{w: os.Stderr, prefix: "   [" + label + "] "}
+	cmd.Stderr = stderr
+	// Don't wait on background processes the hook leaves holding its output.
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	stderr.flush()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", cfg.HookTimeout)
+	}
+	return err
+}
+
+// runHooks are the --pre-hook and --post-hook commands of a run, from the
+// flags or the config file.
+var runHooks struct {
+	pre, post string
+	output    string // the guide's path, "" with --stdout
+	ran       bool   // the pre-hook stage was reached
+}
+
+func runHookEnv() []string {
+	return []string{"AIGUIDE_SUBJECT=" + cfg.Subject, "AIGUIDE_OUTPUT=" + runHooks.output}
+}
+
+// runPreHook runs --pre-hook before the first API call. Its failure aborts
+// the run.
+func runPreHook() error {
+	runHooks.ran = true
+	if runHooks.pre == "" {
+		return nil
+	}
+	fmt.Fprintln(os.Stderr, "-> Running pre-hook...")
+	out := &prefixWriter{w: os.Stderr, prefix: "   [pre-hook] "}
+	err := runHook(runHooks.pre, "pre-hook", nil, runHookEnv(), out)
+	out.flush()
+	return err
+}
+
+// runPostHook runs --post-hook once the run has ended, whatever its
+// outcome. Its exit status is reported but never changes the run's.
+func runPostHook(o runOutcome) {
+	if runHooks.post == "" || !runHooks.ran {
+		return
+	}
+	cost := ""
+	if _, c, priced := usage.totals(); priced {
+		cost = fmt.Sprintf("%.4f", c)
+	}
+	env := append(runHookEnv(),
+		"AIGUIDE_STATUS="+o.Status,
+		"AIGUIDE_FAILED_SECTIONS="+strconv.Itoa(o.Failed),
+		"AIGUIDE_COST="+cost,
+	)
+	fmt.Fprintln(os.Stderr, "-> Running post-hook...")
+	out := &prefixWriter{w: os.Stderr, prefix: "   [post-hook] "}
+	err := runHook(runHooks.post, "post-hook", nil, env, out)
+	out.flush()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: --post-hook failed: %v\n", err)
+	}
+}
+
+// applySectionHook pipes every concept section of a chunk through
+// --section-hook and replaces it with the command's output. A section whose
+// hook fails or prints nothing is kept as it was.
+func applySectionHook(j chunk, content string) string {
+	preamble, sections := splitSections(content, chunkNumbers(j.items))
+	if len(sections) == 0 {
+		return content
+	}
+	titles := make(map[string]string, len(j.items))
+	for _, it := range j.items {
+		_, title, _ := strings.Cut(it, " ")
+		titles[conceptNumber(it)] = strings.TrimSpace(title)
+	}
+
+	var parts []string
+	if preamble != "" {
+		parts = append(parts, preamble)
+	}
+	for _, s := range sections {
+		env := []string{
+			"AIGUIDE_CONCEPT_NUMBER=" + s.Number,
+			"AIGUIDE_CONCEPT_TITLE=" + titles[s.Number],
+			"AIGUIDE_SUBJECT=" + cfg.Subject,
+		}
+		var out bytes.Buffer
+		err := runHook(cfg.SectionHook, "section-hook "+s.Number, strings.NewReader(s.Text+"\n"), env, &out)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Warning: --section-hook failed for concept %s, keeping the original section: %v\n", s.Number, err)
+			parts = append(parts, s.Text)
+		case strings.TrimSpace(out.String()) == "":
+			fmt.Fprintf(os.Stderr, "Warning: --section-hook printed nothing for concept %s, keeping the original section\n", s.Number)
+			parts = append(parts, s.Text)
+		default:
+			parts = append(parts, strings.TrimSpace(out.String()))
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// printDryRun describes the run --dry-run stands in for.
+func printDryRun(filename string) {
+	size := max(cfg.ChunkSize, 1)
+	chunks := (plannedConcepts() + size - 1) / size
+	fmt.Printf("-> Dry run: %d concepts about %q with %s, in about %d chunk(s)\n", plannedConcepts(), cfg.Subject, cfg.Model, chunks)
+	printEstimate()
+	if filename != "" {
+		fmt.Printf("-> Would write: %s\n", filename)
+	} else {
+		fmt.Println("-> Would write to stdout")
+	}
+	if runHooks.pre != "" {
+		fmt.Printf("-> Skipping pre-hook: %s\n", runHooks.pre)
+	}
+	if runHooks.post != "" {
+		fmt.Printf("-> Skipping post-hook: %s\n", runHooks.post)
+	}
+}
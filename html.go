@@ -0,0 +1,268 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+//go:embed guide.css
+var guideCSS string
+
+// latinRunRe matches a run of Latin words, such as C++, std::vector,
+// fmt.Println() or "Go Modules", which a right-to-left guide keeps left to
+// right. Words are taken together, as separate isolates would be laid out
+// right to left. conceptmap.html has the same pattern.
+var latinRunRe = regexp.MustCompile(`[A-Za-z_][\w.+#/:-]*(?:\(\))?(?:,? [A-Za-z_][\w.+#/:-]*(?:\(\))?)*`)
+
+// htmlDoc is a guide rendered for the HTML and EPUB exports.
+type htmlDoc struct {
+	Title string
+	Lang  string
+	RTL   bool
+	Body  string
+	TOC   []htmlTOCEntry // level-2 headings with their level-3 ones
+}
+
+type htmlTOCEntry struct {
+	Text, Anchor string
+	Children     []htmlTOCEntry
+}
+
+func (d *htmlDoc) dir() string {
+	if d.RTL {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// htmlText escapes text. In a right-to-left guide, Latin runs are isolated
+// in a left-to-right bdi, so "C++" or "std::vector" keep their order and
+// don't pull the punctuation around them out of place.
+func htmlText(s string, rtl bool) string {
+	if !rtl {
+		return html.EscapeString(s)
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range latinRunRe.FindAllStringIndex(s, -1) {
+		// Punctuation ending the run belongs to the sentence around it.
+		end := loc[1]
+		for end > loc[0]+1 && strings.IndexByte(".:,/-", s[end-1]) >= 0 {
+			end--
+		}
+		b.WriteString(html.EscapeString(s[last:loc[0]]))
+		b.WriteString(`<bdi dir="ltr">` + html.EscapeString(s[loc[0]:end]) + `</bdi>`)
+		last = end
+	}
+	b.WriteString(html.EscapeString(s[last:]))
+	return b.String()
+}
+
+// htmlInline renders inline markdown as XHTML, which serves both exports.
+// Code is always left to right.
+func htmlInline(text string, rtl bool) string {
+	var b strings.Builder
+	for _, s := range parseInline(text) {
+		var part string
+		switch {
+		case s.Code:
+			part = `<code dir="ltr">` + html.EscapeString(s.Text) + `</code>`
+		case s.Link != "":
+			part = `<a href="` + html.EscapeString(s.Link) + `">` + htmlText(s.Text, rtl) + `</a>`
+		default:
+			part = htmlText(s.Text, rtl)
+		}
+		if s.Italic {
+			part = "<em>" + part + "</em>"
+		}
+		if s.Bold {
+			part = "<strong>" + part + "</strong>"
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// convertHTML renders parsed markdown as the body of an XHTML document.
+// Headings get the markdown anchors as ids, so Table of Contents links keep
+// working; the Table of Contents becomes a nav, which a right-to-left
+// guide mirrors like the rest of the page. With skipTOC it is left out,
+// for EPUB readers that show the nav document instead.
+func convertHTML(blocks []mdBlock, lang string, skipTOC bool) *htmlDoc {
+	d := &htmlDoc{Lang: lang, RTL: languages[lang].rtl}
+	rtl := d.RTL
+	var body strings.Builder
+	var lists []listFrame
+	closeLists := func(depth int) {
+		for len(lists) > 0 && lists[len(lists)-1].depth > depth {
+			fmt.Fprintf(&body, "</li></%s>\n", lists[len(lists)-1].tag)
+			lists = lists[:len(lists)-1]
+		}
+	}
+	inTOC, seenTitle := false, false
+	closeTOC := func() {
+		if inTOC {
+			closeLists(-1)
+			if !skipTOC {
+				body.WriteString("</nav>\n")
+			}
+			inTOC = false
+		}
+	}
+	for _, b := range blocks {
+		isItem := b.Kind == "bullet" || b.Kind == "numbered"
+		if inTOC && isItem && skipTOC {
+			continue
+		}
+		if inTOC && !isItem {
+			closeTOC()
+		}
+		if !isItem {
+			closeLists(-1)
+		}
+
+		switch b.Kind {
+		case "heading":
+			if b.Level == 1 && !seenTitle {
+				seenTitle = true
+				d.Title = plainInline(b.Text)
+				fmt.Fprintf(&body, "<h1>%s</h1>\n", htmlInline(b.Text, rtl))
+				continue
+			}
+			anchor := mdAnchor(b.Text)
+			if isTOCHeading(b.Text) {
+				inTOC = true
+				if !skipTOC {
+					fmt.Fprintf(&body, "<nav id=\"%s\" class=\"toc\" role=\"doc-toc\" dir=\"%s\">\n<h2>%s</h2>\n", html.EscapeString(anchor), d.dir(), htmlInline(b.Text, rtl))
+				}
+				continue
+			}
+			switch {
+			case b.Level == 2:
+				d.TOC = append(d.TOC, htmlTOCEntry{Text: plainInline(b.Text), Anchor: anchor})
+			case b.Level == 3 && len(d.TOC) > 0:
+				last := &d.TOC[len(d.TOC)-1]
+				last.Children = append(last.Children, htmlTOCEntry{Text: plainInline(b.Text), Anchor: anchor})
+			}
+			fmt.Fprintf(&body, "<h%d id=\"%s\">%s</h%d>\n", b.Level, html.EscapeString(anchor), htmlInline(b.Text, rtl), b.Level)
+		case "paragraph":
+			fmt.Fprintf(&body, "<p>%s</p>\n", htmlInline(b.Text, rtl))
+		case "bullet", "numbered":
+			tag := "ul"
+			if b.Kind == "numbered" {
+				tag = "ol"
+			}
+			closeLists(b.Level)
+			top := len(lists) - 1
+			switch {
+			case top >= 0 && lists[top].depth == b.Level && lists[top].tag == tag:
+				body.WriteString("</li>\n<li>")
+			case top >= 0 && lists[top].depth == b.Level:
+				fmt.Fprintf(&body, "</li></%s>\n<%s>\n<li>", lists[top].tag, tag)
+				lists[top].tag = tag
+			default:
+				fmt.Fprintf(&body, "<%s>\n<li>", tag)
+				lists = append(lists, listFrame{tag: tag, depth: b.Level})
+			}
+			body.WriteString(htmlInline(b.Text, rtl))
+		case "code":
+			class := ""
+			if b.Lang != "" {
+				class = ` class="language-` + html.EscapeString(b.Lang) + `"`
+			}
+			fmt.Fprintf(&body, "<pre dir=\"ltr\"><code%s>%s</code></pre>\n", class, html.EscapeString(b.Text))
+		case "quote":
+			lines := strings.Split(b.Text, "\n")
+			for i, l := range lines {
+				lines[i] = htmlInline(l, rtl)
+			}
+			fmt.Fprintf(&body, "<blockquote><p>%s</p></blockquote>\n", strings.Join(lines, "<br />"))
+		case "rule":
+			body.WriteString("<hr />\n")
+		case "table":
+			body.WriteString("<table>\n")
+			for i, row := range b.Rows {
+				cell := "td"
+				if i == 0 {
+					cell = "th"
+				}
+				body.WriteString("<tr>")
+				for _, v := range row {
+					fmt.Fprintf(&body, "<%s>%s</%s>", cell, htmlInline(v, rtl), cell)
+				}
+				body.WriteString("</tr>\n")
+			}
+			body.WriteString("</table>\n")
+		case "html":
+			if strings.HasPrefix(strings.TrimSpace(b.Text), "<!--") {
+				continue
+			}
+			// Only the details blocks aiguide writes are kept as markup;
+			// other raw HTML may not be well-formed XHTML.
+			switch tag, summary := detailsTag(b.Text); tag {
+			case "open":
+				body.WriteString("<details>\n")
+			case "summary":
+				fmt.Fprintf(&body, "<summary>%s</summary>\n", htmlText(summary, rtl))
+			case "close":
+				body.WriteString("</details>\n")
+			default:
+				fmt.Fprintf(&body, "<p>%s</p>\n", html.EscapeString(b.Text))
+			}
+		}
+	}
+	closeTOC()
+	closeLists(-1)
+	d.Body = body.String()
+	return d
+}
+
+// htmlPage is the standalone page of the HTML export.
+func htmlPage(d *htmlDoc) string {
+	return fmt.Sprintf("<!DOCTYPE html>\n<html lang=\"%s\" dir=\"%s\">\n<head>\n<meta charset=\"utf-8\" />\n"+
+		"<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\" />\n<title>%s</title>\n<style>\n%s</style>\n</head>\n"+
+		"<body>\n<main lang=\"%s\" dir=\"%s\">\n%s</main>\n</body>\n</html>\n",
+		d.Lang, d.dir(), html.EscapeString(d.Title), guideCSS, d.Lang, d.dir(), d.Body)
+}
+
+func htmlPath(guidePath string) string {
+	return strings.TrimSuffix(guidePath, ".md") + ".html"
+}
+
+// readHTMLDoc renders a guide for the HTML and EPUB exports, in the
+// language its sidecar records.
+func readHTMLDoc(guidePath string, skipTOC bool) (*htmlDoc, error) {
+	src, err := readGuide(guidePath)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := readSidecar(sidecarPath(guidePath))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring unreadable sidecar: %v\n", err)
+	}
+	d := convertHTML(parseMarkdown(string(src)), guideLanguage(sc), skipTOC)
+	if d.Title == "" {
+		d.Title = strings.TrimSuffix(filepath.Base(guidePath), ".md")
+	}
+	return d, nil
+}
+
+// exportHTML writes the guide as <guide>.html, a single page with its
+// styles inline.
+func exportHTML(guidePath string) error {
+	d, err := readHTMLDoc(guidePath, false)
+	if err != nil {
+		return err
+	}
+	path := htmlPath(guidePath)
+	if err := os.WriteFile(path, []byte(htmlPage(d)), 0o644); err != nil {
+		return err
+	}
+	statusf("-> Wrote %s (%s, %s)\n", path, d.Lang, d.dir())
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTMLText(t *testing.T) {
+	tests := []struct {
+		in   string
+		rtl  bool
+		want string
+	}{
+		{"Go & <C++>", false, "Go &amp; &lt;C++&gt;"},
+		{"مقدمة إلى C++", true, `مقدمة إلى <bdi dir="ltr">C++</bdi>`},
+		// Words are isolated together, and the sentence keeps its period.
+		{"استخدم Go Modules.", true, `استخدم <bdi dir="ltr">Go Modules</bdi>.`},
+		{"الدالة std::vector::push_back() و fmt.Println()", true,
+			`الدالة <bdi dir="ltr">std::vector::push_back()</bdi> و <bdi dir="ltr">fmt.Println()</bdi>`},
+		{"Hello, World: مثال", true, `<bdi dir="ltr">Hello, World</bdi>: مثال`},
+		{"שלום עולם", true, "שלום עולם"},
+	}
+	for _, tt := range tests {
+		if got := htmlText(tt.in, tt.rtl); got != tt.want {
+			t.Errorf("htmlText(%q, %v) = %q, want %q", tt.in, tt.rtl, got, tt.want)
+		}
+	}
+}
+
+// TestMixedDirectionHeadings covers headings that start, end or consist
+// of Latin text in a right-to-left guide: they follow the page's direction,
+// and only their Latin runs are isolated.
+func TestMixedDirectionHeadings(t *testing.T) {
+	tests := []struct{ heading, want string }{
+		{"## 1. مقدمة إلى C++", `<h2 id="1-مقدمة-إلى-c">1. مقدمة إلى <bdi dir="ltr">C++</bdi></h2>`},
+		{"## 2. std::vector في الممارسة", `<h2 id="2-stdvector-في-الممارسة">2. <bdi dir="ltr">std::vector</bdi> في الممارسة</h2>`},
+		{"## 3. Go Modules", `<h2 id="3-go-modules">3. <bdi dir="ltr">Go Modules</bdi></h2>`},
+		{"## 4. `go mod tidy` ו-**Hebrew** יחד", `<h2 id="4-go-mod-tidy-ו-hebrew-יחד">4. <code dir="ltr">go mod tidy</code> ו-<strong><bdi dir="ltr">Hebrew</bdi></strong> יחד</h2>`},
+	}
+	for _, tt := range tests {
+		d := convertHTML(parseMarkdown(tt.heading), "he", false)
+		if got := strings.TrimSpace(d.Body); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.heading, got, tt.want)
+		}
+	}
+}
+
+func TestHTMLGolden(t *testing.T) {
+	for _, tt := range []struct{ name, lang string }{{"rtl", "ar"}, {"ltr", "en"}} {
+		src, err := os.ReadFile(filepath.Join("testdata", "html", tt.name+".md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		page := htmlPage(convertHTML(parseMarkdown(string(src)), tt.lang, false))
+		golden(t, filepath.Join("testdata", "html", tt.name+".html"), page)
+	}
+}
+
+// wellFormed checks that data parses as XML, as EPUB content documents
+// must.
+func wellFormed(t *testing.T, name string, data []byte) {
+	t.Helper()
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		_, err := dec.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("%s is not well-formed: %v", name, err)
+		}
+	}
+}
+
+func TestWriteEPUB(t *testing.T) {
+	src, err := os.ReadFile("testdata/html/rtl.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := convertHTML(parseMarkdown(string(src)), "ar", true)
+	var buf bytes.Buffer
+	if err := writeEPUB(&buf, d, epubUUID("guide.md"), time.Date(2026, 10, 14, 9, 30, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := z.File[0]; f.Name != "mimetype" || f.Method != zip.Store {
+		t.Errorf("first entry is %s (method %d), want an uncompressed mimetype", f.Name, f.Method)
+	}
+	files := map[string]string{}
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(data)
+		if strings.HasSuffix(f.Name, ".xml") || strings.HasSuffix(f.Name, ".opf") || strings.HasSuffix(f.Name, ".xhtml") {
+			wellFormed(t, f.Name, data)
+		}
+	}
+
+	opf := files["OEBPS/content.opf"]
+	for _, want := range []string{
+		"<dc:language>ar</dc:language>",
+		`<spine page-progression-direction="rtl">`,
+		"<dc:identifier id=\"uid\">urn:uuid:" + epubUUID("guide.md") + "</dc:identifier>",
+		`<meta property="dcterms:modified">2026-10-14T09:30:00Z</meta>`,
+	} {
+		if !strings.Contains(opf, want) {
+			t.Errorf("content.opf lacks %s:\n%s", want, opf)
+		}
+	}
+	nav := files["OEBPS/nav.xhtml"]
+	for _, want := range []string{
+		`lang="ar" xml:lang="ar" dir="rtl"`,
+		`<nav epub:type="toc" id="toc" dir="rtl">`,
+		`<li><a href="guide.xhtml#1-مقدمة-إلى-c">1. مقدمة إلى <bdi dir="ltr">C++</bdi></a>` + "\n<ol>\n" +
+			`<li><a href="guide.xhtml#11-hello-world">1.1 <bdi dir="ltr">Hello, World</bdi></a></li>`,
+	} {
+		if !strings.Contains(nav, want) {
+			t.Errorf("nav.xhtml lacks %s:\n%s", want, nav)
+		}
+	}
+	// The nav document replaces the guide's own Table of Contents.
+	if body := files["OEBPS/guide.xhtml"]; strings.Contains(body, "جدول المحتويات") || !strings.Contains(body, `<body dir="rtl">`) {
+		t.Errorf("guide.xhtml:\n%s", body)
+	}
+	if epubUUID("guide.md") == epubUUID("other.md") {
+		t.Error("two guides got the same book id")
+	}
+}
+
+func TestWriteEPUBLeftToRight(t *testing.T) {
+	d := convertHTML(parseMarkdown("# Guide\n\n## 1. Goroutines\n\nText.\n"), "en", true)
+	var buf bytes.Buffer
+	if err := writeEPUB(&buf, d, epubUUID("guide.md"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range z.File {
+		if f.Name != "OEBPS/content.opf" {
+			continue
+		}
+		r, _ := f.Open()
+		data, _ := io.ReadAll(r)
+		r.Close()
+		if !strings.Contains(string(data), "<dc:language>en</dc:language>") || !strings.Contains(string(data), `page-progression-direction="ltr"`) {
+			t.Errorf("content.opf:\n%s", data)
+		}
+	}
+}
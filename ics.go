@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// icsLineOctets is the RFC 5545 limit on a content line, CRLF excluded.
+const icsLineOctets = 75
+
+// studySession is one day of the study plan.
+type studySession struct {
+	Start    time.Time
+	Minutes  int
+	Concepts []*guideConcept
+	Each     []int // minutes per concept
+}
+
+// checkICS validates the study plan flags before any API call.
+func checkICS() error {
+	if _, err := planStartDate(); err != nil {
+		return err
+	}
+	if _, _, err := sessionClock(); err != nil {
+		return err
+	}
+	switch {
+	case cfg.SessionMinutes <= 0:
+		return fmt.Errorf("--session-minutes must be positive")
+	case cfg.SessionsPerWeek < 0 || cfg.SessionsPerWeek > 7:
+		return fmt.Errorf("--sessions-per-week must be between 0 (no limit) and 7")
+	case cfg.WeekendsOff && cfg.SessionsPerWeek > 5:
+		return fmt.Errorf("--sessions-per-week cannot exceed 5 with --weekends-off")
+	}
+	return nil
+}
+
+// planStartDate is --plan-start, or tomorrow by default, in local time.
+func planStartDate() (time.Time, error) {
+	if cfg.PlanStart == "" {
+		y, m, d := time.Now().AddDate(0, 0, 1).Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.Local), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", cfg.PlanStart, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("invalid --plan-start %q (expected YYYY-MM-DD)", cfg.PlanStart)
+	}
+	return t, nil
+}
+
+func sessionClock() (hour, minute int, err error) {
+	t, err := time.Parse("15:04", cfg.SessionTime)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid --session-time %q (expected HH:MM)", cfg.SessionTime)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// conceptMinutes returns each concept's study time: the sidecar's
+// study_minutes when the guide was generated with --study-time, else an
+// estimate from the section text.
+func conceptMinutes(md string, concepts []*guideConcept, sc *Sidecar) []int {
+	minutes := make([]int, len(concepts))
+	diff := map[int]int{}
+	if sc != nil {
+		for _, sec := range sc.Sections {
+			for k, item := range sec.Items {
+				if k < len(sec.StudyMinutes) && item >= 1 && item <= len(minutes) {
+					minutes[item-1] = sec.StudyMinutes[k]
+				}
+				if k < len(sec.Difficulty) {
+					diff[item] = sec.Difficulty[k]
+				}
+			}
+		}
+	}
+	nums := make([]string, len(concepts))
+	for i, c := range concepts {
+		nums[i] = conceptNumber(c.Title)
+	}
+	_, sections := splitSections(md, nums)
+	texts := map[string]string{}
+	for _, s := range sections {
+		texts[s.Number] = s.Text
+	}
+	m := currentStudyModel()
+	for i, c := range concepts {
+		if minutes[i] == 0 {
+			minutes[i] = m.estimate(texts[nums[i]], diff[c.Item], 0)
+		}
+	}
+	return minutes
+}
+
+// planSessions packs the concepts, in guide order, into sessions of up to
+// --session-minutes, one per day from start. Weekends are skipped with
+// --weekends-off, and at most --sessions-per-week fall in one ISO week.
+func planSessions(concepts []*guideConcept, minutes []int, start time.Time) []studySession {
+	hour, minute, _ := sessionClock()
+	var sessions []studySession
+	var cur *studySession
+	for i, c := range concepts {
+		if cur == nil || cur.Minutes+minutes[i] > cfg.SessionMinutes && len(cur.Concepts) > 0 {
+			sessions = append(sessions, studySession{})
+			cur = &sessions[len(sessions)-1]
+		}
+		cur.Concepts = append(cur.Concepts, c)
+		cur.Each = append(cur.Each, minutes[i])
+		cur.Minutes += minutes[i]
+	}
+
+	day := start
+	perWeek := map[string]int{}
+	for i := range sessions {
+		for {
+			y, w := day.ISOWeek()
+			week := fmt.Sprintf("%d-%d", y, w)
+			weekend := day.Weekday() == time.Saturday || day.Weekday() == time.Sunday
+			if !(cfg.WeekendsOff && weekend) && (cfg.SessionsPerWeek == 0 || perWeek[week] < cfg.SessionsPerWeek) {
+				perWeek[week]++
+				break
+			}
+			day = day.AddDate(0, 0, 1)
+		}
+		y, m, d := day.Date()
+		sessions[i].Start = time.Date(y, m, d, hour, minute, 0, 0, time.Local)
+		day = day.AddDate(0, 0, 1)
+	}
+	return sessions
+}
+
+// guideStudyPlan reads the sessions of a guide's Study Plan appendix, so
+// the calendar has the days the guide lists, at --session-time. It returns
+// nil for a guide without one.
+func guideStudyPlan(md string) []studySession {
+	hour, minute, _ := sessionClock()
+	var sessions []studySession
+	inFence := false
+	for _, l := range strings.Split(md, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(l), "```") {
+			inFence = !inFence
+		}
+		if inFence {
+			continue
+		}
+		if _, s, ok := parseStudyPlanLine(l); ok && !s.Start.IsZero() {
+			y, m, d := s.Start.Date()
+			s.Start = time.Date(y, m, d, hour, minute, 0, 0, time.Local)
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions
+}
+
+// icsEscape escapes a TEXT value (RFC 5545 section 3.3.11).
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// icsFold folds a content line at 75 octets without splitting a UTF-8
+// sequence (RFC 5545 section 3.1).
+func icsFold(line string) string {
+	var b strings.Builder
+	limit := icsLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = icsLineOctets - 1 // the leading space counts
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+func icsTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// exportICS writes the study plan of a guide as <guide>.ics. Event UIDs
+// derive from the guide's file name and the session number, so importing
+// an updated plan updates the events instead of duplicating them.
+func exportICS(guidePath string) error {
+	if err := checkICS(); err != nil {
+		return err
+	}
+	src, err := readGuide(guidePath)
+	if err != nil {
+		return err
+	}
+	sc, err := readSidecar(sidecarPath(guidePath))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring unreadable sidecar: %v\n", err)
+	}
+	title, concepts := guideConcepts(parseMarkdown(string(src)))
+	if len(concepts) == 0 {
+		return fmt.Errorf("no concept sections found in %s", guidePath)
+	}
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(guidePath), ".md")
+	}
+	sessions := guideStudyPlan(string(src))
+	if sessions == nil {
+		start, _ := planStartDate()
+		sessions = planSessions(concepts, conceptMinutes(string(src), concepts, sc), start)
+	}
+
+	abs, err := filepath.Abs(guidePath)
+	if err != nil {
+		return err
+	}
+	guideURL := (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String()
+	sum := sha256.Sum256([]byte(filepath.Base(guidePath)))
+	uidBase := hex.EncodeToString(sum[:6])
+	stamp := icsTime(time.Now())
+
+	var b strings.Builder
+	line := func(name, value string) { b.WriteString(icsFold(name + ":" + value)) }
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//aiguide//study plan "+version+"//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", icsEscape(title+" study plan"))
+	for i, s := range sessions {
+		var desc strings.Builder
+		fmt.Fprintf(&desc, "Study time %s:\n", formatStudyTime(s.Minutes))
+		for k, c := range s.Concepts {
+			fmt.Fprintf(&desc, "- %s (%s): %s#%s\n", c.Title, formatStudyTime(s.Each[k]), guideURL, c.Anchor)
+		}
+		line("BEGIN", "VEVENT")
+		line("UID", uidBase+"-session-"+strconv.Itoa(i+1)+"@aiguide")
+		line("DTSTAMP", stamp)
+		line("DTSTART", icsTime(s.Start))
+		line("DTEND", icsTime(s.Start.Add(time.Duration(s.Minutes)*time.Minute)))
+		line("SUMMARY", icsEscape(fmt.Sprintf("Study %s (%d/%d)", title, i+1, len(sessions))))
+		line("DESCRIPTION", icsEscape(strings.TrimSpace(desc.String())))
+		line("URL", guideURL+"#"+s.Concepts[0].Anchor)
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+
+	path := strings.TrimSuffix(guidePath, ".md") + ".ics"
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return err
+	}
+	last := sessions[len(sessions)-1].Start
+	statusf("-> Wrote %s: %d session(s) from %s to %s\n", path, len(sessions), sessions[0].Start.Format("2006-01-02"), last.Format("2006-01-02"))
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// unfoldICS undoes icsFold, checking the folded lines on the way.
+func unfoldICS(t *testing.T, folded string) string {
+	t.Helper()
+	if !strings.HasSuffix(folded, "\r\n") {
+		t.Fatalf("%q doesn't end with CRLF", folded)
+	}
+	lines := strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n")
+	var b strings.Builder
+	for i, l := range lines {
+		if len(l) > icsLineOctets {
+			t.Errorf("line %d is %d octets: %q", i, len(l), l)
+		}
+		if !utf8.ValidString(l) {
+			t.Errorf("line %d splits a UTF-8 sequence: %q", i, l)
+		}
+		if i > 0 {
+			if !strings.HasPrefix(l, " ") {
+				t.Errorf("continuation line %d doesn't start with a space: %q", i, l)
+			}
+			l = l[1:]
+		}
+		b.WriteString(l)
+	}
+	return b.String()
+}
+
+func TestICSFold(t *testing.T) {
+	tests := []struct {
+		name, line string
+		lines      int
+	}{
+		{"short", "SUMMARY:Study", 1},
+		{"exactly 75 octets", strings.Repeat("a", 75), 1},
+		{"76 octets", strings.Repeat("a", 76), 2},
+		{"continuations hold 74 octets", strings.Repeat("a", 75+74+1), 3},
+		// 2-byte runes straddle octet 75 with the odd prefix.
+		{"two-byte runes", "X:" + strings.Repeat("é", 80), 3},
+		{"three-byte runes", "DESCRIPTION:" + strings.Repeat("日本語", 20), 3},
+		{"four-byte runes", "X" + strings.Repeat("🙂", 40), 3},
+	}
+	for _, tt := range tests {
+		folded := icsFold(tt.line)
+		if got := unfoldICS(t, folded); got != tt.line {
+			t.Errorf("%s: unfolded %q, want %q", tt.name, got, tt.line)
+		}
+		if n := strings.Count(folded, "\r\n"); n != tt.lines {
+			t.Errorf("%s: folded into %d lines, want %d:\n%s", tt.name, n, tt.lines, folded)
+		}
+	}
+}
+
+func TestICSEscape(t *testing.T) {
+	got := icsEscape("a\\b; c, d\r\ne\nf")
+	if want := `a\\b\; c\, d\ne\nf`; got != want {
+		t.Errorf("icsEscape = %q, want %q", got, want)
+	}
+}
+
+func TestICSTime(t *testing.T) {
+	berlin := time.FixedZone("CEST", 2*60*60)
+	if got := icsTime(time.Date(2026, 10, 15, 18, 0, 0, 0, berlin)); got != "20261015T160000Z" {
+		t.Errorf("icsTime = %s, want 20261015T160000Z", got)
+	}
+	// The UTC day can differ from the local one.
+	tokyo := time.FixedZone("JST", 9*60*60)
+	if got := icsTime(time.Date(2026, 10, 16, 7, 30, 0, 0, tokyo)); got != "20261015T223000Z" {
+		t.Errorf("icsTime = %s, want 20261015T223000Z", got)
+	}
+}
+
+func TestExportICSFromStudyPlan(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	defer func(l *time.Location) { time.Local = l }(time.Local)
+	time.Local = time.FixedZone("EST", -5*60*60)
+	// The plan's day and times win over --plan-start and --session-minutes.
+	cfg.PlanStart, cfg.SessionTime, cfg.SessionMinutes = "2027-01-01", "19:30", 20
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "guide.md")
+	if err := os.WriteFile(path, []byte(timedGuide), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := exportICS(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "guide.ics"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ics := strings.ReplaceAll(string(data), "\r\n ", "")
+	for _, want := range []string{
+		"DTSTART:20261016T003000Z\r\n",
+		"DTEND:20261016T011000Z\r\n",
+		"SUMMARY:Study GO (1/1)\r\n",
+		`DESCRIPTION:Study time ≈ 40 min:\n- 1. Foo (≈ 15 min): file://`,
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("calendar lacks %q:\n%s", want, ics)
+		}
+	}
+	if n := strings.Count(ics, "BEGIN:VEVENT"); n != 1 {
+		t.Errorf("%d events, want the plan's 1", n)
+	}
+}
+
+func TestExportICSWithoutStudyPlan(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	defer func(l *time.Location) { time.Local = l }(time.Local)
+	time.Local = time.UTC
+	cfg.PlanStart, cfg.SessionTime, cfg.SessionMinutes = "2026-10-16", "18:00", 1
+	cfg.WeekendsOff = true
+	cfg.ReadingSpeed, cfg.DifficultyMults, cfg.ExerciseMinutes = 200, defaultDifficultyMultipliers, 5
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "guide.md")
+	md := timedGuide[:strings.Index(timedGuide, "## Study Plan")]
+	if err := os.WriteFile(path, []byte(md), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := exportICS(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "guide.ics"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without a sidecar the times are estimated, and each concept overfills
+	// a 1-minute session; the Friday session is followed by Monday's.
+	for _, want := range []string{"DTSTART:20261016T180000Z\r\n", "DTSTART:20261019T180000Z\r\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("calendar lacks %q:\n%s", want, data)
+		}
+	}
+}
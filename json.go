@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jsonGuide is the guide as --format json writes it: one entry per concept,
+// cut out of the chunk answers by their numbering.
+type jsonGuide struct {
+	Schema     string        `json:"$schema"`
+	Version    int           `json:"schema_version"`
+	Subject    string        `json:"subject"`
+	Model      string        `json:"model"`
+	Generated  string        `json:"generated"`
+	TotalCount int           `json:"total_count"`
+	Sections   []jsonSection `json:"sections"`
+}
+
+// jsonSection is one concept, with its difficulty and tags when the run
+// rated or tagged the concepts. When a chunk answer can't be cut cleanly at
+// its concepts' headings, its first concept keeps the whole answer and all
+// of the chunk's concepts are marked partial.
+type jsonSection struct {
+	Index      int      `json:"index"`
+	Concept    string   `json:"concept"`
+	Slug       string   `json:"slug"`
+	Content    string   `json:"content"`
+	Difficulty int      `json:"difficulty,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Partial    bool     `json:"partial,omitempty"`
+	Failed     bool     `json:"failed,omitempty"`
+}
+
+func newJSONGuide(startedAt time.Time, concepts []string) *jsonGuide {
+	if cfg.Format != "json" {
+		return nil
+	}
+	return &jsonGuide{Schema: schemaURL("guide"), Version: schemaVersion, Subject: cfg.Subject, Model: cfg.Model, Generated: startedAt.Format(time.RFC3339), TotalCount: len(concepts), Sections: []jsonSection{}}
+}
+
+// add appends the concepts of j, answered by content. The heading of each
+// section is left out; the concept and its slug carry it.
+func (d *jsonGuide) add(j chunk, content string, failed bool) {
+	_, sections := splitSections(content, chunkNumbers(j.items))
+	bodies := make(map[string]string, len(sections))
+	for _, s := range sections {
+		_, body, _ := strings.Cut(s.Text, "\n")
+		bodies[s.Number] = strings.TrimSpace(body)
+	}
+	partial := !failed && len(bodies) < len(j.items)
+	for i, it := range j.items {
+		sec := jsonSection{Concept: conceptPrefixRe.ReplaceAllString(it, ""), Slug: conceptAnchor(it), Partial: partial, Failed: failed}
+		sec.Index, _ = strconv.Atoi(conceptNumber(it))
+		if i < len(j.diff) {
+			sec.Difficulty = j.diff[i]
+		}
+		if i < len(j.tags) {
+			sec.Tags = j.tags[i]
+		}
+		switch {
+		case failed:
+		case partial && i == 0:
+			sec.Content = strings.TrimSpace(content)
+		case !partial:
+			sec.Content = bodies[conceptNumber(it)]
+		}
+		d.Sections = append(d.Sections, sec)
+	}
+}
+
+// write writes the document to filename in one go, or to stdout with
+// --stdout.
+func (d *jsonGuide) write(filename string) error {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if filename == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return writeFileAtomic(filename, b, 0o644)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONGuide(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.Format, cfg.Subject, cfg.Model = "json", "Go Concurrency", "test-model"
+
+	concepts := []string{"1. Goroutines", "2. Channels", "3. Select", "4. Mutexes"}
+	doc := newJSONGuide(time.Date(2026, 10, 14, 9, 30, 0, 0, time.UTC), concepts)
+	// Rated and tagged concepts carry their difficulty and tags.
+	doc.add(chunk{items: concepts[:2], diff: []int{2, 4}, tags: [][]string{{"runtime"}, {"sync", "channels"}}},
+		"## 1. Goroutines\n\nGreen threads.\n\n## 2. Channels\n\nTyped pipes.", false)
+	// An answer that merged its concepts.
+	doc.add(chunk{items: concepts[2:3]}, "Select and more, without a heading.", false)
+	doc.add(chunk{items: concepts[3:], diff: []int{3}}, missingSections(concepts[3:]), true)
+
+	path := filepath.Join(t.TempDir(), "guide.json")
+	if err := doc.write(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs, err := validateDocument("guide", data); err != nil || len(errs) > 0 {
+		t.Fatalf("the guide does not match its schema: %v\n%s", err, strings.Join(errs, "\n"))
+	}
+	var got jsonGuide
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Schema != schemaURL("guide") || got.Version != schemaVersion || got.TotalCount != 4 || len(got.Sections) != 4 {
+		t.Fatalf("document: %+v", got)
+	}
+	s := got.Sections
+	if s[0].Content != "Green threads." || s[0].Difficulty != 2 || strings.Join(s[0].Tags, ",") != "runtime" {
+		t.Errorf("section 1: %+v", s[0])
+	}
+	if s[1].Slug != "2-channels" || s[1].Difficulty != 4 || strings.Join(s[1].Tags, ",") != "sync,channels" {
+		t.Errorf("section 2: %+v", s[1])
+	}
+	if !s[2].Partial || s[2].Content != "Select and more, without a heading." || s[2].Difficulty != 0 || s[2].Tags != nil {
+		t.Errorf("section 3: %+v", s[2])
+	}
+	if !s[3].Failed || s[3].Content != "" || s[3].Difficulty != 3 {
+		t.Errorf("section 4: %+v", s[3])
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// language is an output language: the name the prompts ask for and the
+// scaffolding aiguide writes around the model's sections.
+type language struct {
+	name             string
+	titles           map[string]string // per --mode; the mode's own title when missing
+	toc              string
+	studyTime        string
+	practiceProblems string
+	solutions        string
+	pitfalls         string
+	changelog        string
+	added            string
+	removed          string
+	revised          string
+	lastUpdated      string
+	answer           string
+	timeline         string
+	undated          string
+	glossary         string
+	studyPlan        string
+	day              string // format of a study plan day, given its number
+	rtl              bool   // written right to left
+}
+
+var languages = map[string]language{
+	"en": {name: "English", toc: "Table of Contents", studyTime: "Estimated study time",
+		practiceProblems: "Practice Problems", solutions: "Solutions", pitfalls: "Pitfalls",
+		changelog: "Changelog", added: "Added", removed: "Removed", revised: "Revised", lastUpdated: "Last updated", answer: "Answer",
+		timeline: "Timeline", undated: "Undated", glossary: "Glossary",
+		studyPlan: "Study Plan", day: "Day %d"},
+	"de": {name: "German", titles: map[string]string{"guide": "Umfassender Leitfaden", "interview": "Vorbereitung aufs Vorstellungsgespräch", "exercises": "Programmierübungen", "socratic": "Sokratische Fragen"},
+		toc: "Inhaltsverzeichnis", studyTime: "Geschätzte Lernzeit", practiceProblems: "Übungsaufgaben", solutions: "Lösungen", pitfalls: "Stolperfallen",
+		changelog: "Änderungsprotokoll", added: "Neu", removed: "Entfernt", revised: "Überarbeitet", lastUpdated: "Zuletzt aktualisiert", answer: "Antwort",
+		timeline: "Zeitleiste", undated: "Undatiert", glossary: "Glossar",
+		studyPlan: "Lernplan", day: "Tag %d"},
+	"fr": {name: "French", titles: map[string]string{"guide": "Guide complet", "interview": "Préparation aux entretiens", "exercises": "Exercices de programmation", "socratic": "Questions socratiques"},
+		toc: "Table des matières", studyTime: "Temps d'étude estimé", practiceProblems: "Exercices pratiques", solutions: "Solutions", pitfalls: "Pièges courants",
+		changelog: "Journal des modifications", added: "Ajouts", removed: "Suppressions", revised: "Révisions", lastUpdated: "Dernière mise à jour", answer: "Réponse",
+		timeline: "Chronologie", undated: "Non daté", glossary: "Glossaire",
+		studyPlan: "Plan d'étude", day: "Jour %d"},
+	"es": {name: "Spanish", titles: map[string]string{"guide": "Guía completa", "interview": "Preparación para entrevistas", "exercises": "Ejercicios de programación", "socratic": "Preguntas socráticas"},
+		toc: "Índice", studyTime: "Tiempo de estudio estimado", practiceProblems: "Problemas de práctica", solutions: "Soluciones", pitfalls: "Errores comunes",
+		changelog: "Registro de cambios", added: "Añadidos", removed: "Eliminados", revised: "Revisados", lastUpdated: "Última actualización", answer: "Respuesta",
+		timeline: "Cronología", undated: "Sin fecha", glossary: "Glosario",
+		studyPlan: "Plan de estudio", day: "Día %d"},
+	"it": {name: "Italian", titles: map[string]string{"guide": "Guida completa", "interview": "Preparazione ai colloqui", "exercises": "Esercizi di programmazione", "socratic": "Domande socratiche"},
+		toc: "Indice", studyTime: "Tempo di studio stimato", practiceProblems: "Esercizi pratici", solutions: "Soluzioni", pitfalls: "Errori comuni",
+		changelog: "Registro delle modifiche", added: "Aggiunti", removed: "Rimossi", revised: "Rivisti", lastUpdated: "Ultimo aggiornamento", answer: "Risposta",
+		timeline: "Cronologia", undated: "Non datati", glossary: "Glossario",
+		studyPlan: "Piano di studio", day: "Giorno %d"},
+	"pt": {name: "Portuguese", titles: map[string]string{"guide": "Guia completo", "interview": "Preparação para entrevistas", "exercises": "Exercícios de programação", "socratic": "Perguntas socráticas"},
+		toc: "Índice", studyTime: "Tempo de estudo estimado", practiceProblems: "Problemas práticos", solutions: "Soluções", pitfalls: "Armadilhas comuns",
+		changelog: "Registro de alterações", added: "Adicionados", removed: "Removidos", revised: "Revisados", lastUpdated: "Última atualização", answer: "Resposta",
+		timeline: "Linha do tempo", undated: "Sem data", glossary: "Glossário",
+		studyPlan: "Plano de estudo", day: "Dia %d"},
+	"nl": {name: "Dutch", titles: map[string]string{"guide": "Uitgebreide gids", "interview": "Sollicitatievoorbereiding", "exercises": "Programmeeroefeningen", "socratic": "Socratische vragen"},
+		toc: "Inhoudsopgave", studyTime: "Geschatte studietijd", practiceProblems: "Oefenopgaven", solutions: "Oplossingen", pitfalls: "Valkuilen",
+		changelog: "Wijzigingslogboek", added: "Toegevoegd", removed: "Verwijderd", revised: "Herzien", lastUpdated: "Laatst bijgewerkt", answer: "Antwoord",
+		timeline: "Tijdlijn", undated: "Ongedateerd", glossary: "Woordenlijst",
+		studyPlan: "Studieplan", day: "Dag %d"},
+	"pl": {name: "Polish", titles: map[string]string{"guide": "Kompleksowy przewodnik", "interview": "Przygotowanie do rozmowy kwalifikacyjnej", "exercises": "Ćwiczenia programistyczne", "socratic": "Pytania sokratejskie"},
+		toc: "Spis treści", studyTime: "Szacowany czas nauki", practiceProblems: "Zadania praktyczne", solutions: "Rozwiązania", pitfalls: "Pułapki",
+		changelog: "Dziennik zmian", added: "Dodane", removed: "Usunięte", revised: "Zmienione", lastUpdated: "Ostatnia aktualizacja", answer: "Odpowiedź",
+		timeline: "Oś czasu", undated: "Bez daty", glossary: "Słowniczek",
+		studyPlan: "Plan nauki", day: "Dzień %d"},
+	"ru": {name: "Russian", titles: map[string]string{"guide": "Подробное руководство", "interview": "Подготовка к собеседованию", "exercises": "Упражнения по программированию", "socratic": "Сократовские вопросы"},
+		toc: "Содержание", studyTime: "Примерное время изучения", practiceProblems: "Практические задания", solutions: "Решения", pitfalls: "Типичные ошибки",
+		changelog: "Журнал изменений", added: "Добавлено", removed: "Удалено", revised: "Переработано", lastUpdated: "Последнее обновление", answer: "Ответ",
+		timeline: "Хронология", undated: "Без даты", glossary: "Глоссарий",
+		studyPlan: "План занятий", day: "День %d"},
+	"uk": {name: "Ukrainian", titles: map[string]string{"guide": "Докладний посібник", "interview": "Підготовка до співбесіди", "exercises": "Вправи з програмування", "socratic": "Сократівські запитання"},
+		toc: "Зміст", studyTime: "Орієнтовний час вивчення", practiceProblems: "Практичні завдання", solutions: "Розв'язки", pitfalls: "Типові помилки",
+		changelog: "Журнал змін", added: "Додано", removed: "Вилучено", revised: "Перероблено", lastUpdated: "Останнє оновлення", answer: "Відповідь",
+		timeline: "Хронологія", undated: "Без дати", glossary: "Глосарій",
+		studyPlan: "План занять", day: "День %d"},
+	"ja": {name: "Japanese", titles: map[string]string{"guide": "総合ガイド", "interview": "面接対策", "exercises": "プログラミング演習", "socratic": "ソクラテス式問答"},
+		toc: "目次", studyTime: "推定学習時間", practiceProblems: "練習問題", solutions: "解答", pitfalls: "よくある落とし穴",
+		changelog: "変更履歴", added: "追加", removed: "削除", revised: "改訂", lastUpdated: "最終更新", answer: "答え",
+		timeline: "年表", undated: "年代不明", glossary: "用語集",
+		studyPlan: "学習計画", day: "%d日目"},
+	"zh": {name: "Chinese", titles: map[string]string{"guide": "综合指南", "interview": "面试准备", "exercises": "编程练习", "socratic": "苏格拉底式提问"},
+		toc: "目录", studyTime: "预计学习时间", practiceProblems: "练习题", solutions: "答案", pitfalls: "常见误区",
+		changelog: "更新日志", added: "新增", removed: "移除", revised: "修订", lastUpdated: "最后更新", answer: "答案",
+		timeline: "时间线", undated: "无日期", glossary: "术语表",
+		studyPlan: "学习计划", day: "第%d天"},
+	"ar": {name: "Arabic", rtl: true, titles: map[string]string{"guide": "دليل شامل", "interview": "التحضير للمقابلة", "exercises": "تمارين برمجية", "socratic": "أسئلة سقراطية"},
+		toc: "جدول المحتويات", studyTime: "وقت الدراسة المقدر", practiceProblems: "مسائل تدريبية", solutions: "الحلول", pitfalls: "أخطاء شائعة",
+		changelog: "سجل التغييرات", added: "الإضافات", removed: "المحذوفات", revised: "التنقيحات", lastUpdated: "آخر تحديث", answer: "الإجابة",
+		timeline: "الخط الزمني", undated: "غير مؤرخ", glossary: "مسرد المصطلحات",
+		studyPlan: "خطة الدراسة", day: "اليوم %d"},
+	"he": {name: "Hebrew", rtl: true, titles: map[string]string{"guide": "מדריך מקיף", "interview": "הכנה לראיון", "exercises": "תרגילי תכנות", "socratic": "שאלות סוקרטיות"},
+		toc: "תוכן העניינים", studyTime: "זמן לימוד משוער", practiceProblems: "תרגילים", solutions: "פתרונות", pitfalls: "מלכודות נפוצות",
+		changelog: "יומן שינויים", added: "נוספו", removed: "הוסרו", revised: "עודכנו", lastUpdated: "עודכן לאחרונה", answer: "תשובה",
+		timeline: "ציר זמן", undated: "ללא תאריך", glossary: "מילון מונחים",
+		studyPlan: "תוכנית לימוד", day: "יום %d"},
+	"ko": {name: "Korean", titles: map[string]string{"guide": "종합 가이드", "interview": "면접 준비", "exercises": "프로그래밍 연습", "socratic": "소크라테스식 질문"},
+		toc: "목차", studyTime: "예상 학습 시간", practiceProblems: "연습 문제", solutions: "해설", pitfalls: "흔한 함정",
+		changelog: "변경 내역", added: "추가됨", removed: "삭제됨", revised: "수정됨", lastUpdated: "마지막 업데이트", answer: "정답",
+		timeline: "연표", undated: "연대 미상", glossary: "용어집",
+		studyPlan: "학습 계획", day: "%d일차"},
+}
+
+func languageCodes() string {
+	codes := make([]string, 0, len(languages))
+	for c := range languages {
+		codes = append(codes, c)
+	}
+	sort.Strings(codes)
+	return strings.Join(codes, ", ")
+}
+
+// outputLanguage is the language of the guide being written; English
+// outside a run.
+func outputLanguage() language {
+	if l, ok := languages[cfg.Lang]; ok {
+		return l
+	}
+	return languages["en"]
+}
+
+// guideLanguage is the language a finished guide was written in: the one its
+// sidecar records, else the current run's.
+func guideLanguage(sc *Sidecar) string {
+	if sc != nil {
+		if l := sc.Provenance.Settings["lang"]; l != "" {
+			if _, ok := languages[l]; ok {
+				return l
+			}
+		}
+	}
+	if _, ok := languages[cfg.Lang]; ok {
+		return cfg.Lang
+	}
+	return "en"
+}
+
+func guideTitle() string {
+	if t, ok := outputLanguage().titles[cfg.Mode]; ok {
+		return t
+	}
+	return currentMode().title
+}
+
+// isScaffoldHeading reports whether a level-2 heading is one aiguide wrote
+// itself, in any output language, rather than a concept or a part.
+func isScaffoldHeading(text string) bool {
+	if text == "Provenance" {
+		return true
+	}
+	for _, l := range languages {
+		for _, h := range []string{l.toc, l.practiceProblems, l.solutions, l.pitfalls, l.changelog, l.timeline, l.glossary} {
+			if text == h {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isTOCHeading(text string) bool {
+	text = strings.TrimSpace(text)
+	for _, l := range languages {
+		if strings.EqualFold(text, l.toc) {
+			return true
+		}
+	}
+	return false
+}
+
+// languageInstruction asks the model to write in the output language. It is
+// empty unless --lang was given or a language was detected, so English runs
+// keep their prompts.
+func languageInstruction() string {
+	if !langRequested {
+		return ""
+	}
+	return fmt.Sprintf("\n\nLANGUAGE:\nWrite everything in %s: headings, explanations and examples, even where the subject is given in another language. "+
+		"Keep code, commands and identifiers as they are.", outputLanguage().name)
+}
+
+// langRequested is set when --lang was given or inferred from the subject.
+var langRequested bool
+
+// resolveLanguage sets cfg.Lang from --lang or, without it, from the
+// subject. Only a confident guess switches away from English.
+func resolveLanguage(explicit bool) error {
+	if explicit {
+		cfg.Lang = strings.ToLower(strings.TrimSpace(cfg.Lang))
+		if _, ok := languages[cfg.Lang]; !ok {
+			return fmt.Errorf("invalid --lang %q (expected one of %s)", cfg.Lang, languageCodes())
+		}
+		langRequested = true
+		return nil
+	}
+	cfg.Lang = "en"
+	code, confidence := detectLanguage(cfg.Subject)
+	if code == "" || code == "en" || confidence < minLangConfidence {
+		return nil
+	}
+	cfg.Lang, langRequested = code, true
+	statusf("-> The subject looks %s (%.0f%% confident), writing the guide in %[1]s; pass --lang en to keep English\n", languages[code].name, confidence*100)
+	return nil
+}
+
+const minLangConfidence = 0.9
+
+// detectLanguage guesses the language of a short text and how sure it is,
+// 0-1. Scripts used by a single language decide on their own; Latin text is
+// scored with a character trigram model trained on the samples below. It
+// returns "" when the text gives nothing to go on.
+func detectLanguage(text string) (string, float64) {
+	scripts := map[string]int{}
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Hangul, r):
+			scripts["ko"]++
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			scripts["ja"]++
+		case unicode.Is(unicode.Han, r):
+			scripts["han"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			scripts["cyrillic"]++
+			if strings.ContainsRune("іїєґІЇЄҐ", r) {
+				scripts["uk"]++
+			}
+		case unicode.Is(unicode.Arabic, r):
+			scripts["arabic"]++
+			// Letters Persian and Urdu add to the Arabic alphabet.
+			if strings.ContainsRune("پچژگ", r) {
+				scripts["fa"]++
+			}
+		case unicode.Is(unicode.Hebrew, r):
+			scripts["he"]++
+		case unicode.Is(unicode.Latin, r):
+			scripts["latin"]++
+		}
+	}
+	if letters == 0 {
+		return "", 0
+	}
+	share := func(n int) float64 { return float64(n) / float64(letters) }
+	switch {
+	case scripts["ko"] > 0:
+		return "ko", share(scripts["ko"] + scripts["han"])
+	case scripts["ja"] > 0:
+		// Japanese mixes kana with kanji; Chinese never uses kana.
+		return "ja", share(scripts["ja"] + scripts["han"])
+	case scripts["han"] > 0 && scripts["han"] >= scripts["latin"]:
+		return "zh", share(scripts["han"])
+	case scripts["cyrillic"] > 0 && scripts["cyrillic"] >= scripts["latin"]:
+		if scripts["uk"] > 0 {
+			return "uk", share(scripts["cyrillic"])
+		}
+		return "ru", share(scripts["cyrillic"])
+	case scripts["arabic"] > 0 && scripts["arabic"] >= scripts["latin"]:
+		if scripts["fa"] > 0 {
+			return "", 0
+		}
+		return "ar", share(scripts["arabic"])
+	case scripts["he"] > 0 && scripts["he"] >= scripts["latin"]:
+		return "he", share(scripts["he"])
+	case scripts["latin"] == 0:
+		return "", 0
+	}
+	return latinModel.classify(text)
+}
+
+// trigramModel is a naive Bayes classifier over character trigrams of
+// words padded with spaces.
+type trigramModel struct {
+	langs  []string
+	counts map[string]map[string]int
+	totals map[string]int
+	vocab  int
+}
+
+func trigrams(text string) []string {
+	var out []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		rs := []rune(" " + w + " ")
+		for i := 0; i+3 <= len(rs); i++ {
+			out = append(out, string(rs[i:i+3]))
+		}
+	}
+	return out
+}
+
+func newTrigramModel(samples map[string]string) *trigramModel {
+	m := &trigramModel{counts: map[string]map[string]int{}, totals: map[string]int{}}
+	vocab := map[string]bool{}
+	for lang, sample := range samples {
+		m.langs = append(m.langs, lang)
+		m.counts[lang] = map[string]int{}
+		for _, t := range trigrams(sample) {
+			m.counts[lang][t]++
+			m.totals[lang]++
+			vocab[t] = true
+		}
+	}
+	slices.Sort(m.langs)
+	m.vocab = len(vocab)
+	return m
+}
+
+// classify returns the most likely language of text and its posterior
+// probability, with add-one smoothing and equal priors.
+func (m *trigramModel) classify(text string) (string, float64) {
+	grams := trigrams(text)
+	if len(grams) == 0 {
+		return "", 0
+	}
+	scores := make([]float64, len(m.langs))
+	best := 0
+	for i, lang := range m.langs {
+		for _, t := range grams {
+			scores[i] += math.Log(float64(m.counts[lang][t]+1) / float64(m.totals[lang]+m.vocab))
+		}
+		if scores[i] > scores[best] {
+			best = i
+		}
+	}
+	var sum float64
+	for _, s := range scores {
+		sum += math.Exp(s - scores[best])
+	}
+	return m.langs[best], 1 / sum
+}
+
+// latinSamples are short texts in the register of study guides, one per
+// language written in the Latin script.
+var latinSamples = map[string]string{
+	"en": "This guide explains the core concepts of the subject and how they fit together. Each section starts with a short definition, " +
+		"then works through examples, common mistakes and the questions that come up in practice. Learning a new topic is easier when you " +
+		"understand why things work the way they do, not only what they are called. Read the introduction first, try the exercises on your " +
+		"own and come back to the parts that were hard. The history of the field, its main ideas and the tools people use every day are " +
+		"covered in the following chapters. An introduction to programming, networking, databases, machine learning, operating systems " +
+		"and security for beginners and advanced students.",
+	"de": "Dieser Leitfaden erklärt die grundlegenden Begriffe des Themas und wie sie zusammenhängen. Jeder Abschnitt beginnt mit einer " +
+		"kurzen Definition und zeigt danach Beispiele, häufige Fehler und die Fragen, die in der Praxis auftauchen. Ein neues Gebiet zu " +
+		"lernen ist leichter, wenn man versteht, warum die Dinge so funktionieren, und nicht nur, wie sie heißen. Lies zuerst die " +
+		"Einführung, versuche die Übungen selbstständig und kehre danach zu den schwierigen Teilen zurück. Die Geschichte des Fachs, " +
+		"seine wichtigsten Ideen und die Werkzeuge für den Alltag werden in den folgenden Kapiteln behandelt. Eine Einführung in die " +
+		"Programmierung, Rechnernetze, Datenbanken, maschinelles Lernen, Betriebssysteme und Sicherheit für Anfänger und Fortgeschrittene.",
+	"fr": "Ce guide explique les notions fondamentales du sujet et la façon dont elles s'articulent. Chaque section commence par une " +
+		"courte définition, puis présente des exemples, les erreurs fréquentes et les questions qui se posent en pratique. Apprendre un " +
+		"nouveau domaine est plus facile lorsque l'on comprend pourquoi les choses fonctionnent ainsi, et pas seulement comment elles " +
+		"s'appellent. Lisez d'abord l'introduction, faites les exercices vous-même et revenez ensuite sur les parties difficiles. " +
+		"L'histoire de la discipline, ses idées principales et les outils utilisés au quotidien sont présentés dans les chapitres " +
+		"suivants. Une introduction à la programmation, aux réseaux, aux bases de données, à l'apprentissage automatique, aux systèmes " +
+		"d'exploitation et à la sécurité pour les débutants et les étudiants avancés.",
+	"es": "Esta guía explica los conceptos fundamentales del tema y cómo se relacionan entre sí. Cada sección empieza con una definición " +
+		"breve y después muestra ejemplos, errores frecuentes y las preguntas que surgen en la práctica. Aprender un campo nuevo es más " +
+		"fácil cuando se entiende por qué las cosas funcionan así y no solo cómo se llaman. Lee primero la introducción, intenta resolver " +
+		"los ejercicios por tu cuenta y vuelve después a las partes más difíciles. La historia de la disciplina, sus ideas principales y " +
+		"las herramientas que se usan cada día se tratan en los capítulos siguientes. Una introducción a la programación, las redes, las " +
+		"bases de datos, el aprendizaje automático, los sistemas operativos y la seguridad para principiantes y estudiantes avanzados.",
+	"it": "Questa guida spiega i concetti fondamentali dell'argomento e il modo in cui si collegano tra loro. Ogni sezione comincia con " +
+		"una breve definizione e poi presenta esempi, errori frequenti e le domande che nascono nella pratica. Imparare un nuovo campo è " +
+		"più semplice quando si capisce perché le cose funzionano così e non soltanto come si chiamano. Leggi prima l'introduzione, prova " +
+		"a svolgere gli esercizi da solo e torna poi sulle parti più difficili. La storia della disciplina, le sue idee principali e gli " +
+		"strumenti che si usano ogni giorno sono trattati nei capitoli seguenti. Un'introduzione alla programmazione, alle reti, alle " +
+		"basi di dati, all'apprendimento automatico, ai sistemi operativi e alla sicurezza per principianti e studenti esperti.",
+	"pt": "Este guia explica os conceitos fundamentais do assunto e como eles se relacionam. Cada seção começa com uma definição curta e " +
+		"depois mostra exemplos, erros comuns e as perguntas que aparecem na prática. Aprender uma área nova é mais fácil quando se " +
+		"entende por que as coisas funcionam assim, e não apenas como elas se chamam. Leia primeiro a introdução, tente fazer os " +
+		"exercícios sozinho e volte depois às partes mais difíceis. A história da disciplina, as suas ideias principais e as ferramentas " +
+		"usadas no dia a dia são tratadas nos capítulos seguintes. Uma introdução à programação, às redes de computadores, aos bancos de " +
+		"dados, ao aprendizado de máquina, aos sistemas operacionais e à segurança para iniciantes e estudantes avançados.",
+	"nl": "Deze gids legt de belangrijkste begrippen van het onderwerp uit en hoe ze met elkaar samenhangen. Elk hoofdstuk begint met een " +
+		"korte definitie en laat daarna voorbeelden, veelgemaakte fouten en de vragen zien die in de praktijk opduiken. Een nieuw " +
+		"vakgebied leren is makkelijker als je begrijpt waarom de dingen zo werken, en niet alleen hoe ze heten. Lees eerst de inleiding, " +
+		"probeer de oefeningen zelf te maken en kom daarna terug op de moeilijke delen. De geschiedenis van het vak, de belangrijkste " +
+		"ideeën en het gereedschap dat men elke dag gebruikt komen in de volgende hoofdstukken aan bod. Een inleiding in programmeren, " +
+		"netwerken, gegevensbanken, machinaal leren, besturingssystemen en beveiliging voor beginners en gevorderde studenten.",
+	"pl": "Ten przewodnik wyjaśnia podstawowe pojęcia tematu i to, jak się ze sobą łączą. Każda część zaczyna się od krótkiej definicji, " +
+		"a potem pokazuje przykłady, częste błędy i pytania, które pojawiają się w praktyce. Nauka nowej dziedziny jest łatwiejsza, gdy " +
+		"rozumie się, dlaczego rzeczy działają w ten sposób, a nie tylko jak się nazywają. Najpierw przeczytaj wstęp, spróbuj samodzielnie " +
+		"rozwiązać ćwiczenia i wróć później do trudniejszych fragmentów. Historia dziedziny, jej główne idee i narzędzia używane na co " +
+		"dzień są omówione w kolejnych rozdziałach. Wprowadzenie do programowania, sieci komputerowych, baz danych, uczenia maszynowego, " +
+		"systemów operacyjnych i bezpieczeństwa dla początkujących i zaawansowanych studentów.",
+}
+
+var latinModel = newTrigramModel(latinSamples)
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// latexSections maps markdown heading levels onto sectioning commands; the
+// H1 is the document title.
+var latexSections = map[int]string{2: `\section`, 3: `\subsection`, 4: `\subsubsection`, 5: `\paragraph`, 6: `\subparagraph`}
+
+var (
+	latexEscaper = strings.NewReplacer(`\`, `\textbackslash{}`, `&`, `\&`, `%`, `\%`, `$`, `\$`, `#`, `\#`, `_`, `\_`,
+		`{`, `\{`, `}`, `\}`, `~`, `\textasciitilde{}`, `^`, `\textasciicircum{}`)
+	latexURLEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `#`, `\#`, `{`, `\{`, `}`, `\}`)
+	// latexCiteRe matches the placeholder citeReferences leaves where a
+	// citation marker was.
+	latexCiteRe = regexp.MustCompile("\x01([^\x02]*)\x02")
+)
+
+func latexPath(guidePath string) string {
+	return strings.TrimSuffix(guidePath, ".md") + ".tex"
+}
+
+// citeReferences replaces the citation markers of a guide with placeholders
+// naming the BibTeX keys of entries, and drops the references lists, which
+// become the bibliography. Models number their sources per concept, so the
+// markers are resolved section by section; a marker without a definition
+// is dropped.
+func citeReferences(md string, entries []*bibEntry) string {
+	keyOf := map[string]string{}
+	for _, e := range entries {
+		for _, r := range e.refs {
+			keyOf[strings.TrimSpace(r)] = e.Key
+		}
+	}
+	parts := splitLevel2(md)
+	for i, part := range parts {
+		prose, _, defs := extractCitationDefs(dropBareReferences(part))
+		keys := map[string]string{}
+		for _, d := range defs {
+			if k, ok := keyOf[d.text]; ok {
+				keys[d.key] = k
+			}
+		}
+		parts[i] = forEachProse(prose, func(s string) string {
+			var b strings.Builder
+			last := 0
+			for _, loc := range citationMarkerRe.FindAllStringSubmatchIndex(s, -1) {
+				// [1](url) is a link and [1][x] a reference link, not a citation.
+				if loc[1] < len(s) && (s[loc[1]] == '(' || s[loc[1]] == '[') {
+					continue
+				}
+				var cited []string
+				for g := 2; g < len(loc); g += 2 {
+					if loc[g] >= 0 {
+						for _, k := range citationKeys(s[loc[g]:loc[g+1]]) {
+							if key, ok := keys[k]; ok {
+								cited = append(cited, key)
+							}
+						}
+						break
+					}
+				}
+				b.WriteString(strings.TrimRight(s[last:loc[0]], " "))
+				if len(cited) > 0 {
+					b.WriteString("\x01" + strings.Join(cited, ",") + "\x02")
+				}
+				last = loc[1]
+			}
+			b.WriteString(s[last:])
+			return b.String()
+		})
+	}
+	return strings.Join(parts, "\n")
+}
+
+// splitLevel2 cuts md before every level-2 heading outside code blocks.
+func splitLevel2(md string) []string {
+	var parts []string
+	var cur []string
+	inFence := false
+	for _, line := range strings.Split(md, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+		}
+		if !inFence && strings.HasPrefix(line, "## ") && len(cur) > 0 {
+			parts = append(parts, strings.Join(cur, "\n"))
+			cur = nil
+		}
+		cur = append(cur, line)
+	}
+	return append(parts, strings.Join(cur, "\n"))
+}
+
+// dropBareReferences removes the unnumbered entries of references lists,
+// which nothing can cite; \nocite keeps them in the bibliography.
+// extractCitationDefs takes the numbered ones.
+func dropBareReferences(text string) string {
+	var kept []string
+	inFence, inRefs := false, false
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+		switch {
+		case inFence:
+		case referencesHeadRe.MatchString(trimmed):
+			inRefs = true
+		case inRefs && (trimmed == "" || citationListRe.MatchString(line)):
+		case inRefs && bibBulletRe.MatchString(line):
+			continue
+		default:
+			inRefs = false
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
+
+// latexText escapes text, turning citeReferences' placeholders into \cite.
+func latexText(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range latexCiteRe.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(latexEscaper.Replace(s[last:loc[0]]))
+		fmt.Fprintf(&b, `~\cite{%s}`, s[loc[2]:loc[3]])
+		last = loc[1]
+	}
+	b.WriteString(latexEscaper.Replace(s[last:]))
+	return b.String()
+}
+
+func latexInline(text string) string {
+	var b strings.Builder
+	for _, s := range parseInline(text) {
+		var part string
+		switch {
+		case s.Code:
+			part = `\texttt{` + latexEscaper.Replace(s.Text) + `}`
+		case strings.HasPrefix(s.Link, "#"):
+			part = `\hyperref[` + strings.TrimPrefix(s.Link, "#") + `]{` + latexText(s.Text) + `}`
+		case s.Link != "":
+			part = `\href{` + latexURLEscaper.Replace(s.Link) + `}{` + latexText(s.Text) + `}`
+		default:
+			part = latexText(s.Text)
+		}
+		if s.Italic {
+			part = `\emph{` + part + `}`
+		}
+		if s.Bold {
+			part = `\textbf{` + part + `}`
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// convertLaTeX renders parsed markdown as a LaTeX document. The guide's H1
+// becomes the title and its Table of Contents \tableofcontents; headings
+// are labelled with the markdown anchors, so links between sections keep
+// working. bib names the BibTeX file without its extension, or is empty
+// when the guide has no references.
+func convertLaTeX(blocks []mdBlock, bib string) string {
+	var title string
+	for _, b := range blocks {
+		if b.Kind == "heading" && b.Level == 1 {
+			title = plainInline(b.Text)
+			break
+		}
+	}
+
+	var body strings.Builder
+	body.WriteString("\\documentclass{article}\n\\usepackage[utf8]{inputenc}\n\\usepackage[T1]{fontenc}\n\\usepackage{hyperref}\n\n")
+	fmt.Fprintf(&body, "\\title{%s}\n\\date{}\n\n\\begin{document}\n\\maketitle\n\\tableofcontents\n", latexText(title))
+
+	var lists []listFrame
+	closeLists := func(depth int) {
+		for len(lists) > 0 && lists[len(lists)-1].depth > depth {
+			fmt.Fprintf(&body, "\\end{%s}\n", lists[len(lists)-1].tag)
+			lists = lists[:len(lists)-1]
+		}
+	}
+	inTOC, seenTitle := false, false
+	for _, b := range blocks {
+		isItem := b.Kind == "bullet" || b.Kind == "numbered"
+		if inTOC && isItem {
+			continue
+		}
+		if !isItem {
+			inTOC = false
+			closeLists(-1)
+		}
+
+		switch b.Kind {
+		case "heading":
+			if b.Level == 1 && !seenTitle {
+				seenTitle = true
+				continue
+			}
+			if isTOCHeading(b.Text) {
+				inTOC = true
+				continue
+			}
+			cmd, ok := latexSections[b.Level]
+			if !ok {
+				cmd = `\section`
+			}
+			text := b.Text
+			if conceptTitleRe.MatchString(text) {
+				// LaTeX numbers the sections itself.
+				text = conceptPrefixRe.ReplaceAllString(text, "")
+			}
+			fmt.Fprintf(&body, "\n%s{%s}\\label{%s}\n", cmd, latexInline(text), mdAnchor(b.Text))
+		case "paragraph":
+			fmt.Fprintf(&body, "\n%s\n", latexInline(b.Text))
+		case "bullet", "numbered":
+			env := "itemize"
+			if b.Kind == "numbered" {
+				env = "enumerate"
+			}
+			closeLists(b.Level)
+			top := len(lists) - 1
+			switch {
+			case top >= 0 && lists[top].depth == b.Level && lists[top].tag == env:
+			case top >= 0 && lists[top].depth == b.Level:
+				fmt.Fprintf(&body, "\\end{%s}\n\\begin{%s}\n", lists[top].tag, env)
+				lists[top].tag = env
+			default:
+				fmt.Fprintf(&body, "\\begin{%s}\n", env)
+				lists = append(lists, listFrame{tag: env, depth: b.Level})
+			}
+			fmt.Fprintf(&body, "\\item %s\n", latexInline(b.Text))
+		case "code":
+			fmt.Fprintf(&body, "\n\\begin{verbatim}\n%s\n\\end{verbatim}\n", b.Text)
+		case "quote":
+			lines := strings.Split(b.Text, "\n")
+			for i, l := range lines {
+				lines[i] = latexInline(l)
+			}
+			fmt.Fprintf(&body, "\n\\begin{quote}\n%s\n\\end{quote}\n", strings.Join(lines, " \\\\\n"))
+		case "table":
+			if len(b.Rows) == 0 {
+				continue
+			}
+			fmt.Fprintf(&body, "\n\\begin{tabular}{|%s}\n\\hline\n", strings.Repeat("l|", len(b.Rows[0])))
+			for i, row := range b.Rows {
+				cells := make([]string, len(row))
+				for k, v := range row {
+					cells[k] = latexInline(v)
+					if i == 0 {
+						cells[k] = `\textbf{` + cells[k] + `}`
+					}
+				}
+				fmt.Fprintf(&body, "%s \\\\\n\\hline\n", strings.Join(cells, " & "))
+			}
+			body.WriteString("\\end{tabular}\n")
+		}
+		// Rules only separate chunks, and raw HTML (comments, <details>)
+		// has no LaTeX counterpart.
+	}
+	closeLists(-1)
+	if bib != "" {
+		fmt.Fprintf(&body, "\n\\nocite{*}\n\\bibliographystyle{plain}\n\\bibliography{%s}\n", bib)
+	}
+	body.WriteString("\\end{document}\n")
+	return body.String()
+}
+
+// exportLaTeX writes the guide as <guide>.tex, with its references in
+// <guide>.bib and cited with \cite instead of the guide's numbers.
+func exportLaTeX(guidePath string) error {
+	md, err := readGuide(guidePath)
+	if err != nil {
+		return err
+	}
+	entries := buildBibliography(guideReferences(string(md)))
+	bib := ""
+	if len(entries) > 0 {
+		if err := os.WriteFile(bibtexPath(guidePath), []byte(formatBibliography(entries)), 0o644); err != nil {
+			return err
+		}
+		bib = strings.TrimSuffix(filepath.Base(bibtexPath(guidePath)), ".bib")
+	}
+	tex := convertLaTeX(parseMarkdown(citeReferences(string(md), entries)), bib)
+	path := latexPath(guidePath)
+	if err := os.WriteFile(path, []byte(tex), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("-> Wrote %s", path)
+	if bib != "" {
+		fmt.Printf(" with %d reference(s) in %s", len(entries), bibtexPath(guidePath))
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLaTeXGolden(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/latex/*.md")
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("no inputs: %v", err)
+	}
+	for _, in := range inputs {
+		t.Run(filepath.Base(in), func(t *testing.T) {
+			src, err := os.ReadFile(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries := buildBibliography(guideReferences(string(src)))
+			tex := convertLaTeX(parseMarkdown(citeReferences(string(src), entries)), "guide")
+			golden(t, strings.TrimSuffix(in, ".md")+".tex", tex)
+			golden(t, strings.TrimSuffix(in, ".md")+".bib", formatBibliography(entries))
+		})
+	}
+}
+
+// TestCiteReferences checks that markers are resolved against their own
+// section's list, since models number sources per concept.
+func TestCiteReferences(t *testing.T) {
+	src, err := os.ReadFile("testdata/latex/cited.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := buildBibliography(guideReferences(string(src)))
+	tex := convertLaTeX(parseMarkdown(citeReferences(string(src), entries)), "guide")
+	for _, want := range []string{
+		`synchronized time~\cite{lamport1978time}.`,
+		`extend them~\cite{fidge1988timestamps}`,
+		`\textbf{defined} in~\cite{lamport1978time,fidge1988timestamps}.`,
+		`Paxos~\cite{lamport1998part} solves`,
+		`Raft~\cite{ongaro2014search} is`,
+		`\hyperref[1-logical-clocks]{1. Logical Clocks}`,
+		`\href{https://example.com/50\%}{a link}`,
+		`\section{Logical Clocks}\label{1-logical-clocks}`,
+		"\\nocite{*}\n\\bibliographystyle{plain}\n\\bibliography{guide}\n",
+	} {
+		if !strings.Contains(tex, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+	for _, unwanted := range []string{"[7]", "[1]", "References", "Further reading", "Kleppmann", "Table of Contents"} {
+		if strings.Contains(tex, unwanted) {
+			t.Errorf("%q left in the document", unwanted)
+		}
+	}
+	// The 1978 paper cited in the first section and listed in the second is
+	// one entry; the uncited book is in the bibliography too.
+	bib := formatBibliography(entries)
+	if n := strings.Count(bib, "@article{lamport1978time,"); n != 1 {
+		t.Errorf("lamport1978time appears %d times", n)
+	}
+	if !strings.Contains(bib, "@book{kleppmann2017designing,") {
+		t.Errorf("uncited book missing:\n%s", bib)
+	}
+}
+
+func TestExportLaTeX(t *testing.T) {
+	src, err := os.ReadFile("testdata/latex/cited.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "Distributed.md")
+	if err := os.WriteFile(path, src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := exportLaTeX(path); err != nil {
+		t.Fatal(err)
+	}
+	tex, err := os.ReadFile(strings.TrimSuffix(path, ".md") + ".tex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(tex), `\bibliography{Distributed}`) {
+		t.Errorf("the document doesn't name its .bib")
+	}
+	if _, err := os.Stat(strings.TrimSuffix(path, ".md") + ".bib"); err != nil {
+		t.Error(err)
+	}
+}
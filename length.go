@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// minConceptWords is the smallest word target given to a concept.
+	minConceptWords = 60
+	// fitTolerance is how far a section may miss its target, as a fraction,
+	// before the fitting pass considers rewriting it.
+	fitTolerance = 0.35
+	// fitShare is the share of concepts the fitting pass rewrites at most,
+	// so it stays a small fraction of the run's cost.
+	fitShare = 0.1
+)
+
+// parseTargetLength reads --target-length: a number of words (20000w or
+// 20000) or of pages (40p), at wordsPerPage words a page.
+func parseTargetLength(s string, wordsPerPage int) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	unit := 1
+	if n, ok := strings.CutSuffix(s, "p"); ok {
+		s, unit = n, wordsPerPage
+	} else {
+		s = strings.TrimSuffix(s, "w")
+	}
+	n, err := strconv.Atoi(strings.ReplaceAll(s, ",", ""))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("expected a number of words such as 20000w or of pages such as 40p")
+	}
+	return n * unit, nil
+}
+
+// lengthBudget shares --target-length out between the concepts as chunks
+// start. Each chunk reserves its share of what is left; once it is written
+// its actual length counts instead, so sections that overshoot leave less
+// for the ones still to come.
+type lengthBudget struct {
+	mu       sync.Mutex
+	target   int
+	weights  []float64 // per concept, aligned with the plan
+	left     float64   // weight of the concepts not started yet
+	written  int       // words of the finished chunks plus the reservations
+	refitted int
+}
+
+// lengths is the --target-length budget of the run, nil without the flag.
+var lengths *lengthBudget
+
+// newLengthBudget weights harder concepts up to 1.5 times and easier ones
+// down to half, when there are difficulty scores.
+func newLengthBudget(target int, difficulty []int, n int) *lengthBudget {
+	b := &lengthBudget{target: target, weights: make([]float64, n)}
+	for i := range b.weights {
+		b.weights[i] = 1
+		if i < len(difficulty) && difficulty[i] > 0 {
+			b.weights[i] = 1 + float64(difficulty[i]-3)*0.25
+		}
+		b.left += b.weights[i]
+	}
+	return b
+}
+
+// reserve returns the word target of each concept of j.
+func (b *lengthBudget) reserve(j chunk) []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	perWeight := float64(b.target-b.written) / math.Max(b.left, 1e-9)
+	targets := make([]int, len(j.items))
+	for k := range j.items {
+		w := b.weights[j.start+k]
+		targets[k] = max(minConceptWords, int(math.Round(w*perWeight/10))*10)
+		b.left -= w
+		b.written += targets[k]
+	}
+	return targets
+}
+
+// finish replaces j's reservation with the words actually written. A
+// failed chunk keeps its reservation, so the rest of the guide doesn't grow
+// to make up for it.
+func (b *lengthBudget) finish(targets, words []int) {
+	if words == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for k := range targets {
+		b.written += words[k] - targets[k]
+	}
+}
+
+func lengthInstruction(items []string, targets []int) string {
+	parts := make([]string, len(items))
+	for k, it := range items {
+		parts[k] = fmt.Sprintf("concept %s about %d words", conceptNumber(it), targets[k])
+	}
+	return "\n\nLENGTH: The guide has a fixed length budget. Write " + strings.Join(parts, ", ") +
+		". Stay close to these lengths."
+}
+
+// sectionWords counts the words of each concept of j in content, nil when
+// the sections can't be told apart.
+func sectionWords(j chunk, content string) []int {
+	_, sections := splitSections(content, chunkNumbers(j.items))
+	if len(sections) != len(j.items) {
+		return nil
+	}
+	byNumber := map[string]int{}
+	for _, s := range sections {
+		byNumber[s.Number] = len(strings.Fields(s.Text))
+	}
+	words := make([]int, len(j.items))
+	for k, it := range j.items {
+		words[k] = byNumber[conceptNumber(it)]
+	}
+	return words
+}
+
+// fitLengths rewrites the sections furthest from their targets, at most
+// fitShare of the concepts, and keeps a rewrite only when it lands closer.
+func fitLengths(chunks []chunk, results []string, sections []SectionMeta) {
+	type offender struct {
+		chunk, item int
+		miss        float64
+	}
+	var worst []offender
+	concepts := 0
+	for i, sec := range sections {
+		concepts += len(sec.Items)
+		if sec.Failed || sec.Words == nil {
+			continue
+		}
+		for k, w := range sec.Words {
+			if miss := math.Abs(float64(w)/float64(sec.TargetWords[k]) - 1); miss > fitTolerance {
+				worst = append(worst, offender{i, k, miss})
+			}
+		}
+	}
+	if len(worst) == 0 {
+		return
+	}
+	sort.Slice(worst, func(a, b int) bool { return worst[a].miss > worst[b].miss })
+	worst = worst[:min(len(worst), max(1, int(float64(concepts)*fitShare)))]
+	statusf("-> Fitting %d section(s) to their length targets...\n", len(worst))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sem := make(chan struct{}, max(cfg.Threads, 1))
+	for _, o := range worst {
+		wg.Add(1)
+		go func(o offender) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			j := chunks[o.chunk]
+			item := j.items[o.item]
+			target := sections[o.chunk].TargetWords[o.item]
+			mu.Lock()
+			_, secs := splitSections(results[o.chunk], chunkNumbers(j.items))
+			mu.Unlock()
+			var section string
+			for _, sec := range secs {
+				if sec.Number == conceptNumber(item) {
+					section = sec.Text
+				}
+			}
+			if section == "" {
+				return
+			}
+			text, err := fitSection(item, j.model, section, target)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: could not fit concept %s to its length: %v\n", conceptNumber(item), err)
+				return
+			}
+			words := len(strings.Fields(text))
+			mu.Lock()
+			defer mu.Unlock()
+			if math.Abs(float64(words-target)) >= math.Abs(float64(sections[o.chunk].Words[o.item]-target)) {
+				return
+			}
+			results[o.chunk] = replaceSections(results[o.chunk], j.items, map[string]string{conceptNumber(item): text})
+			sections[o.chunk].Words[o.item] = words
+			lengths.mu.Lock()
+			lengths.refitted++
+			lengths.mu.Unlock()
+		}(o)
+	}
+	wg.Wait()
+}
+
+// fitSection asks for the section of item rewritten to about target words.
+func fitSection(item, model, section string, target int) (string, error) {
+	verb := "Shorten"
+	if len(strings.Fields(section)) < target {
+		verb = "Expand"
+	}
+	prompt := fmt.Sprintf(
+		"Here is one section of a study guide:\n\n%s\n\n"+
+			"%s it to about %d words. Keep its heading and numbering exactly as they are, keep what matters most and keep the same style. "+
+			"Output ONLY the rewritten section in markdown.",
+		section, verb, target)
+	resp, err := callAIWith(callOptions{Model: model, Temperature: defaultTemperature, Purpose: "length"}, prompt, cfg.SystemPrompt)
+	if err != nil {
+		return "", err
+	}
+	text := cleanChunkContent(resp)
+	if _, secs := splitSections(text, []string{conceptNumber(item)}); len(secs) != 1 {
+		return "", fmt.Errorf("the rewrite lost the section's heading")
+	}
+	return text, nil
+}
+
+func writeLengthSummary(w io.Writer, sections []SectionMeta) {
+	if lengths == nil {
+		return
+	}
+	actual := 0
+	for _, sec := range sections {
+		for _, n := range sec.Words {
+			actual += n
+		}
+	}
+	diff := 100 * float64(actual-lengths.target) / float64(lengths.target)
+	line := fmt.Sprintf("-> Length: %d words for a target of %d (%+.0f%%)", actual, lengths.target, diff)
+	if lengths.refitted > 0 {
+		line += fmt.Sprintf(", %d section(s) fitted", lengths.refitted)
+	}
+	fmt.Fprintln(w, line)
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	linkCheckParallel = 8
+	linkMaxRedirects  = 5
+	// linkHostDelay spaces out requests to the same host.
+	linkHostDelay = 500 * time.Millisecond
+)
+
+var (
+	httpLinkRe = regexp.MustCompile(`!?\[([^\]\n]*)\]\((https?://[^\s)]+)\)`)
+	bareLinkRe = regexp.MustCompile(`https?://[^\s<>()\[\]"'` + "`" + `]+`)
+)
+
+// LinkCheck is the result for one distinct URL.
+type LinkCheck struct {
+	URL    string `json:"url"`
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Broken bool   `json:"broken"`
+}
+
+// linkChecker checks URLs with bounded parallelism and a delay between
+// requests to the same host. It talks to the links directly, never through
+// the model client, so it costs no API budget.
+type linkChecker struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	hosts map[string]*hostGate
+}
+
+type hostGate struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+func newLinkChecker(timeout time.Duration) *linkChecker {
+	return &linkChecker{
+		client: &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= linkMaxRedirects {
+					return fmt.Errorf("more than %d redirects", linkMaxRedirects)
+				}
+				return nil
+			},
+		},
+		hosts: map[string]*hostGate{},
+	}
+}
+
+func (c *linkChecker) wait(host string) {
+	c.mu.Lock()
+	g, ok := c.hosts[host]
+	if !ok {
+		g = &hostGate{}
+		c.hosts[host] = g
+	}
+	c.mu.Unlock()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if d := time.Until(g.last.Add(linkHostDelay)); d > 0 {
+		time.Sleep(d)
+	}
+	g.last = time.Now()
+}
+
+// check tries HEAD first and falls back to GET, since plenty of servers
+// reject or mishandle HEAD.
+func (c *linkChecker) check(raw string) LinkCheck {
+	res := LinkCheck{URL: raw}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		res.Error, res.Broken = "invalid URL", true
+		return res
+	}
+
+	var status int
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		c.wait(u.Host)
+		status, err = c.do(method, raw)
+		if err == nil && status < 400 {
+			break
+		}
+	}
+	res.Status = status
+	switch {
+	case err != nil:
+		res.Error, res.Broken = err.Error(), true
+	case status == http.StatusTooManyRequests:
+		// Rate limited: the server is there, so don't call it broken.
+	case status >= 400:
+		res.Error, res.Broken = http.StatusText(status), true
+	}
+	return res
+}
+
+func (c *linkChecker) do(method, raw string) (int, error) {
+	req, err := http.NewRequest(method, raw, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "aiguide-link-checker/"+version)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// checkLinks checks every distinct http(s) link in the chunk contents and
+// rewrites broken ones per --broken-links. The results are returned per
+// chunk, for the sidecar and the report.
+func checkLinks(contents []string) [][]LinkCheck {
+	perChunk := make([][]string, len(contents))
+	seen := map[string]bool{}
+	var all []string
+	for i, content := range contents {
+		for _, u := range extractLinks(content) {
+			perChunk[i] = append(perChunk[i], u)
+			if !seen[u] {
+				seen[u] = true
+				all = append(all, u)
+			}
+		}
+	}
+	if len(all) == 0 {
+		return nil
+	}
+
+	if !cfg.Stdout {
+		statusf("-> Checking %d links...\n", len(all))
+	}
+	checker := newLinkChecker(cfg.LinkTimeout)
+	results := make(map[string]LinkCheck, len(all))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, linkCheckParallel)
+	for _, u := range all {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(u string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r := checker.check(u)
+			mu.Lock()
+			results[u] = r
+			mu.Unlock()
+		}(u)
+	}
+	wg.Wait()
+
+	// If nothing answered at all, we are most likely offline; flagging every
+	// link would only damage the guide.
+	reachable := false
+	for _, r := range results {
+		if r.Status != 0 {
+			reachable = true
+			break
+		}
+	}
+	if !reachable {
+		fmt.Fprintln(os.Stderr, "Warning: no link could be reached (offline?); leaving links unchanged")
+		return nil
+	}
+
+	checks := make([][]LinkCheck, len(contents))
+	for i, content := range contents {
+		broken := map[string]bool{}
+		for _, u := range perChunk[i] {
+			checks[i] = append(checks[i], results[u])
+			if results[u].Broken {
+				broken[u] = true
+			}
+		}
+		if len(broken) > 0 && cfg.BrokenLinks != "keep" {
+			contents[i] = rewriteBrokenLinks(content, broken, cfg.BrokenLinks)
+		}
+	}
+	return checks
+}
+
+// extractLinks returns the distinct links of content in order of first
+// appearance, leaving out code, where URLs are usually examples.
+func extractLinks(content string) []string {
+	var links []string
+	seen := map[string]bool{}
+	forEachProse(content, func(text string) string {
+		for _, u := range bareLinkRe.FindAllString(text, -1) {
+			u = trimLinkPunct(u)
+			if !seen[u] {
+				seen[u] = true
+				links = append(links, u)
+			}
+		}
+		return text
+	})
+	return links
+}
+
+func rewriteBrokenLinks(content string, broken map[string]bool, mode string) string {
+	return forEachProse(content, func(text string) string {
+		text = httpLinkRe.ReplaceAllStringFunc(text, func(m string) string {
+			sub := httpLinkRe.FindStringSubmatch(m)
+			if !broken[trimLinkPunct(sub[2])] {
+				return m
+			}
+			if mode == "strip" {
+				return sub[1]
+			}
+			return m + " (link unverified)"
+		})
+		// Bare URLs; the ones inside markdown links were handled above.
+		var b strings.Builder
+		last := 0
+		for _, loc := range bareLinkRe.FindAllStringIndex(text, -1) {
+			u := trimLinkPunct(text[loc[0]:loc[1]])
+			end := loc[0] + len(u)
+			if !broken[u] || (loc[0] > 0 && text[loc[0]-1] == '(') || strings.HasPrefix(text[end:], " (link unverified)") {
+				continue
+			}
+			b.WriteString(text[last:loc[0]])
+			if mode != "strip" {
+				b.WriteString(u + " (link unverified)")
+			}
+			last = end
+		}
+		b.WriteString(text[last:])
+		return b.String()
+	})
+}
+
+func trimLinkPunct(u string) string {
+	return strings.TrimRight(u, ".,;:!?*_")
+}
+
+// forEachProse applies fn to the parts of content outside fenced code and
+// inline code spans.
+func forEachProse(content string, fn func(string) string) string {
+	var out strings.Builder
+	var prose strings.Builder
+	flush := func() {
+		parts := strings.Split(prose.String(), "`")
+		for i := range parts {
+			if i%2 == 0 {
+				parts[i] = fn(parts[i])
+			}
+		}
+		out.WriteString(strings.Join(parts, "`"))
+		prose.Reset()
+	}
+
+	inFence := false
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if !inFence {
+				flush()
+			}
+			inFence = !inFence
+			out.WriteString(line)
+			continue
+		}
+		if inFence {
+			out.WriteString(line)
+		} else {
+			prose.WriteString(line)
+		}
+	}
+	flush()
+	return out.String()
+}
+
+// writeLinkSummary reports the links checked and every broken one.
+func writeLinkSummary(w io.Writer, sections []SectionMeta) {
+	results := map[string]LinkCheck{}
+	for _, sec := range sections {
+		for _, l := range sec.Links {
+			results[l.URL] = l
+		}
+	}
+	if len(results) == 0 {
+		return
+	}
+	var broken []LinkCheck
+	for _, l := range results {
+		if l.Broken {
+			broken = append(broken, l)
+		}
+	}
+	sort.Slice(broken, func(a, b int) bool { return broken[a].URL < broken[b].URL })
+
+	fmt.Fprintf(w, "-> Links: %d checked, %d broken\n", len(results), len(broken))
+	for _, l := range broken {
+		fmt.Fprintf(w, "   %s: %s\n", l.URL, l.Error)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCheckLinksStripsStreamedGuide runs a generation that would write its
+// chunks as they finish and checks that --broken-links strip still reaches
+// the guide: with the rewrite pending, the chunks are held until the links
+// are checked.
+func TestCheckLinksStripsStreamedGuide(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	sites := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/docs" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer sites.Close()
+	answer := "## 1. Foo\n\nSee [the docs](" + sites.URL + "/docs) and [the old page](" + sites.URL + "/gone)."
+	useFakeModel(t, func(string) string { return answer })
+	cfg.Subject, cfg.Mode, cfg.Format, cfg.Threads, cfg.Quiet = "Go", "guide", "markdown", 1, true
+	cfg.CheckLinks, cfg.BrokenLinks, cfg.LinkTimeout = true, "strip", 5*time.Second
+
+	if streamChunks(nil) {
+		t.Fatal("chunks are written as they finish although --broken-links strip rewrites them")
+	}
+	if conflicts := strings.Join(streamConflicts(), ", "); !strings.Contains(conflicts, "--check-links --broken-links strip") {
+		t.Errorf("streamConflicts = %q, want --check-links named", conflicts)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "go.md")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &conceptPlan{concepts: []string{"1. Foo"}}
+	state := newRunState(filepath.Join(dir, "go.state.json"), path, plan, nil)
+	sections := processChunks(f, []chunk{{items: plan.concepts}}, nil, nil, nil, nil, state, streamChunks(nil))
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(got), "/gone") || !strings.Contains(string(got), "the old page") || !strings.Contains(string(got), sites.URL+"/docs") {
+		t.Errorf("the broken link was not stripped:\n%s", got)
+	}
+	if links := sections[0].Links; len(links) != 2 {
+		t.Errorf("links reported: %+v", links)
+	}
+
+	// Links that are only reported leave the guide as it streamed.
+	cfg.BrokenLinks = "keep"
+	if !streamChunks(nil) || len(streamConflicts()) != 0 {
+		t.Errorf("--broken-links keep turns off streaming: %q", streamConflicts())
+	}
+}
@@ -1,341 +1,1944 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
-	_ "embed"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"math/rand/v2"
 	"net/url"
 	"os"
-	"regexp"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/yuriiter/aiguide/pkg/guide"
 )
 
-//go:embed system_prompt.txt
-var embedSystemPrompt string
+var embedSystemPrompt = guide.DefaultSystemPrompt
 
 type Config struct {
-	BaseURL          string
-	Token            string
-	Model            string
-	Subject          string
-	TotalCount       int
-	ChunkSize        int
-	Stdout           bool
-	Threads          int
-	Info             string
-	SystemPromptPath string
-	SystemPrompt     string
+	BaseURL              string
+	Token                string
+	Model                string
+	Subject              string
+	TotalCount           int
+	ChunkSize            int
+	Stdout               bool
+	Stream               bool
+	Threads              int
+	Info                 []string
+	SystemPromptPath     string
+	SystemPrompt         string
+	NoProvenance         bool
+	ProvenanceStyle      string
+	NoSidecar            bool
+	CheapModel           string
+	RouteByDiff          bool
+	RouteThreshold       int
+	BestOf               int
+	Provider             string
+	Headers              map[string]string
+	Quirks               map[string]bool
+	MaxTokens            int
+	SystemRole           string
+	Notify               bool
+	Webhook              string
+	WebhookSecret        string
+	WebhookStrict        bool
+	WebhookFormat        string
+	GitCommit            bool
+	GitPush              bool
+	GitMessage           string
+	Gist                 bool
+	GistPublic           bool
+	GistSidecar          bool
+	Exports              []string
+	NotionParent         string
+	ConfluenceURL        string
+	ConfluenceSpace      string
+	ConfluenceParent     string
+	ConfluenceChildPages bool
+	FilenameTemplate     string
+	Tags                 bool
+	TagSet               []string
+	OnlyTags             []string
+	SkipTags             []string
+	GroupBy              string
+	Depth                int
+	SubCount             int
+	ShowDifficulty       bool
+	Prerequisites        bool
+	Order                string
+	Seed                 uint64
+	MaxDifficulty        int
+	Practice             int
+	Solutions            string
+	Bloom                bool
+	BloomMaxRemember     float64
+	ShowBloom            bool
+	Misconceptions       bool
+	Pitfalls             bool
+	Mnemonics            bool
+	Mode                 string
+	ExerciseSolutions    bool
+	VerifyCode           bool
+	FixCode              bool
+	CheckLinks           bool
+	BrokenLinks          string
+	LinkTimeout          time.Duration
+	DedupContent         string
+	DedupThreshold       float64
+	Readability          bool
+	ReadabilityTarget    float64
+	ReadabilityFix       bool
+	Tables               bool
+	StudyTime            bool
+	StudyPlan            bool
+	ReadingSpeed         int
+	DifficultyMults      string
+	ExerciseMinutes      float64
+	CitationStyle        string
+	FootnotePlacement    string
+	PlanStart            string
+	WeekendsOff          bool
+	SessionsPerWeek      int
+	SessionMinutes       int
+	SessionTime          string
+	OutlineOnly          bool
+	ProgressEvents       bool
+	SectionHook          string
+	HookTimeout          time.Duration
+	PreHook              string
+	PostHook             string
+	DryRun               bool
+	ErrorFormat          string
+	MaxCost              float64
+	MaxTotalTokens       int
+	PriceIn              float64
+	PriceOut             float64
+	Lang                 string
+	MetricsListen        string
+	VersionOf            string
+	AltExplanations      bool
+	AltModel             string
+	Explanation          string
+	NoAnswers            bool
+	NoHistory            bool
+	Clarify              bool
+	ClarifyAnswers       string
+	TargetLength         string
+	WordsPerPage         int
+	AnalogyDomain        string
+	Timeline             bool
+	Profile              string
+	ConsistentTerms      bool
+	Glossary             bool
+	Retries              int
+	RetryMaxWait         time.Duration
+	Resume               string
+	Format               string
+	ConceptsFile         string
+	ConceptsExtra        string
+	NoVerify             bool
+	Quiet                bool
+	Verbose              bool
 }
 
 var cfg Config
 
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+const defaultTemperature = 0.7
+
+func main() {
+	rootCmd := &cobra.Command{
+		Use:   "aiguide [subject]",
+		Short: "Generate an AI-powered study guide",
+		Args: func(cmd *cobra.Command, args []string) error {
+			// A resumed run takes its subject from the state file.
+			if cmd.Flags().Changed("resume") {
+				return cobra.MaximumNArgs(1)(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		Run: run,
+	}
+
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Path to the config file (default $XDG_CONFIG_HOME/aiguide/config.json)")
+	rootCmd.AddCommand(newProvidersCmd(), newProfilesCmd())
+	rootCmd.AddCommand(newExportCmd())
+	rootCmd.AddCommand(newSchemaCmd())
+	rootCmd.AddCommand(newExpandCmd())
+	rootCmd.AddCommand(newCondenseCmd())
+	rootCmd.AddCommand(newMCPCmd())
+	rootCmd.AddCommand(newAnswerCmd())
+	rootCmd.AddCommand(newRefreshCmd())
+	rootCmd.AddCommand(newRedoCmd())
+	rootCmd.AddCommand(newDaemonCmd(), newSubmitCmd(), newQueueCmd(), newCancelCmd())
+	rootCmd.AddCommand(newCacheCmd())
+	rootCmd.AddCommand(newHistoryCmd(), newOpenCmd())
+	rootCmd.AddCommand(newStatsCmd())
+
+	rootCmd.Flags().StringVarP(&cfg.Provider, "provider", "p", "", "Named provider profile from the config file")
+	rootCmd.Flags().StringVar(&cfg.Profile, "profile", "", "Named bundle of flags from the config file or profiles.d; flags given on the command line win")
+	rootCmd.Flags().IntVarP(&cfg.TotalCount, "number", "n", 100, "Total number of questions/concepts to generate")
+	rootCmd.Flags().IntVarP(&cfg.ChunkSize, "chunk", "c", 2, "Number of questions to process per API call")
+	rootCmd.Flags().BoolVarP(&cfg.Stdout, "stdout", "o", false, "Output to stdout instead of file")
+	rootCmd.Flags().BoolVar(&cfg.Stream, "stream", false, "Write each answer to stdout as it arrives (the default with --stdout and one thread)")
+	rootCmd.Flags().IntVarP(&cfg.Threads, "threads", "t", 1, "Number of concurrent threads for generating answers")
+	rootCmd.Flags().StringArrayVarP(&cfg.Info, "info", "i", nil, "Additional instructions or context to append to system prompt, or @file to read them from a file (repeatable)")
+	rootCmd.Flags().StringVarP(&cfg.SystemPromptPath, "system-prompt", "s", "", "Custom system prompt: a file path, an http(s) URL or - for stdin")
+	rootCmd.Flags().StringVar(&cfg.Mode, "mode", "guide", "Guide shape: guide (study guide), interview (questions, probing, strong answers, follow-ups), exercises (a workspace of coding exercises) or socratic (guiding questions, answers hidden)")
+	rootCmd.Flags().StringVar(&cfg.FilenameTemplate, "filename-template", defaultFilenameTemplate, "Output name without extension, as a Go template ({{.Subject}}, {{.SubjectSlug}}, {{.Date \"2006-01-02\"}}, {{.Model}}, {{.Lang}}, {{.N}}); / creates subdirectories, absolute paths and .. are rejected")
+	rootCmd.Flags().BoolVar(&cfg.NoProvenance, "no-provenance", false, "Omit the provenance footer from the generated guide")
+	rootCmd.Flags().StringVar(&cfg.ProvenanceStyle, "provenance-style", "comment", "Provenance footer style: comment (HTML comment) or section (visible)")
+	rootCmd.Flags().StringVarP(&cfg.Model, "model", "m", "", "Model to use (overrides OPENAI_MODEL)")
+	rootCmd.Flags().StringVar(&cfg.CheapModel, "cheap-model", "", "Cheaper model used for easy chunks with --route-by-difficulty")
+	rootCmd.Flags().BoolVar(&cfg.RouteByDiff, "route-by-difficulty", false, "Estimate concept difficulty and answer easy chunks with --cheap-model")
+	rootCmd.Flags().IntVar(&cfg.RouteThreshold, "route-threshold", 3, "Highest difficulty (1-5) still routed to --cheap-model")
+	rootCmd.Flags().BoolVar(&cfg.ShowDifficulty, "show-difficulty", false, "Score concept difficulty and show a 1-5 badge under each heading")
+	rootCmd.Flags().BoolVar(&cfg.Prerequisites, "prerequisites", false, "Find the concepts each concept builds on and store them in the sidecar (implied by --export conceptmap)")
+	rootCmd.Flags().StringVar(&cfg.Order, "order", "model", "Concept order: model, alpha, shuffle, easy-first or hard-first")
+	rootCmd.Flags().Uint64Var(&cfg.Seed, "seed", 0, "Seed for --order shuffle, to repeat an order (default random)")
+	rootCmd.Flags().IntVar(&cfg.MaxDifficulty, "max-difficulty", 0, "Drop concepts scored above this difficulty (1-5)")
+	rootCmd.Flags().IntVar(&cfg.Practice, "practice", 0, "Add N practice problems with worked solutions per concept")
+	rootCmd.Flags().StringVar(&cfg.Solutions, "solutions", "inline", "Where practice problems go: inline (after each concept), end (a Practice Problems part) or separate (solutions in their own file)")
+	rootCmd.Flags().BoolVar(&cfg.Bloom, "bloom", false, "Label concepts with a Bloom's taxonomy level and report the coverage")
+	rootCmd.Flags().Float64Var(&cfg.BloomMaxRemember, "bloom-max-remember", 0, "Rewrite recall-only concepts until at most this share (0-1) remain (implies --bloom)")
+	rootCmd.Flags().BoolVar(&cfg.ShowBloom, "show-bloom", false, "Show the Bloom level under each heading (implies --bloom)")
+	rootCmd.Flags().BoolVar(&cfg.Misconceptions, "misconceptions", false, "End every concept with a Common misconceptions subsection")
+	rootCmd.Flags().BoolVar(&cfg.Pitfalls, "pitfalls", false, "Collect the misconceptions into a Pitfalls appendix (implies --misconceptions)")
+	rootCmd.Flags().BoolVar(&cfg.Mnemonics, "mnemonics", false, "End each concept with a memory aid (acronym, association or rhyme) where one fits")
+	rootCmd.Flags().BoolVar(&cfg.VerifyCode, "verify-code", false, "Compile fenced Go blocks (never run them) and flag the ones that fail")
+	rootCmd.Flags().BoolVar(&cfg.FixCode, "fix-code", false, "Send failing blocks back to the model for one repair attempt (implies --verify-code)")
+	rootCmd.Flags().BoolVar(&cfg.CheckLinks, "check-links", false, "Check every http(s) link after generation and report the broken ones")
+	rootCmd.Flags().StringVar(&cfg.BrokenLinks, "broken-links", "annotate", "What to do with broken links: annotate, strip or keep")
+	rootCmd.Flags().DurationVar(&cfg.LinkTimeout, "link-timeout", 10*time.Second, "Timeout per link check")
+	rootCmd.Flags().StringVar(&cfg.DedupContent, "dedup-content", "off", "Find sections that repeat earlier ones: off, report or rewrite (the later one covers only what's new)")
+	rootCmd.Flags().Float64Var(&cfg.DedupThreshold, "dedup-threshold", 0.4, "Overlap (0-1) above which two sections count as duplicates")
+	rootCmd.Flags().BoolVar(&cfg.Readability, "readability", false, "Score each section's Flesch-Kincaid grade and reading ease and report outliers")
+	rootCmd.Flags().Float64Var(&cfg.ReadabilityTarget, "readability-target", 0, "Grade level sections should read at (default: from difficulty scores, else the median) (implies --readability)")
+	rootCmd.Flags().BoolVar(&cfg.ReadabilityFix, "readability-fix", false, "Ask the model to simplify or deepen outlier sections (implies --readability)")
+	rootCmd.Flags().BoolVar(&cfg.Tables, "tables", false, "Add a comparison table to \"X vs Y\" concepts and repair malformed tables")
+	rootCmd.Flags().BoolVar(&cfg.StudyTime, "study-time", false, "Show an estimated study time under each heading and a total under the title")
+	rootCmd.Flags().IntVar(&cfg.ReadingSpeed, "reading-speed", 200, "Reading speed in words per minute for --study-time (implies --study-time)")
+	rootCmd.Flags().StringVar(&cfg.DifficultyMults, "difficulty-multipliers", defaultDifficultyMultipliers, "Study time multipliers for difficulty 1-5, comma-separated (implies --study-time)")
+	rootCmd.Flags().Float64Var(&cfg.ExerciseMinutes, "exercise-minutes", 5, "Minutes of study time per practice problem or exercise (implies --study-time)")
+	rootCmd.Flags().BoolVar(&cfg.StudyPlan, "study-plan", false, "Add a Study Plan appendix packing the concepts into daily sessions, with each day's study time (implies --study-time)")
+	rootCmd.Flags().StringVar(&cfg.CitationStyle, "citation-style", "inline", "How citation markers are rendered: inline or footnote")
+	rootCmd.Flags().StringVar(&cfg.FootnotePlacement, "footnote-placement", "section", "Where footnote definitions go with --citation-style footnote: section or document")
+	rootCmd.Flags().StringVar(&cfg.PlanStart, "plan-start", "", "First day of the --study-plan or --export ics study plan, YYYY-MM-DD (default tomorrow)")
+	rootCmd.Flags().BoolVar(&cfg.WeekendsOff, "weekends-off", false, "Schedule no study sessions on weekends")
+	rootCmd.Flags().IntVar(&cfg.SessionsPerWeek, "sessions-per-week", 0, "Maximum study sessions per week (0 = one every day)")
+	rootCmd.Flags().IntVar(&cfg.SessionMinutes, "session-minutes", 60, "Study time to fit into one session")
+	rootCmd.Flags().StringVar(&cfg.SessionTime, "session-time", "18:00", "Local time study sessions start at, HH:MM")
+	rootCmd.Flags().BoolVar(&cfg.OutlineOnly, "outline-only", false, "Print the concept list, after any filtering and reordering, and exit without answering")
+	rootCmd.Flags().BoolVar(&cfg.ProgressEvents, "progress-events", false, "Write machine-readable progress events to stdout")
+	rootCmd.Flags().MarkHidden("progress-events")
+	rootCmd.Flags().StringVar(&cfg.SectionHook, "section-hook", "", "Shell command each finished section is piped through; its stdout replaces the section (runs your command, nothing else)")
+	rootCmd.Flags().DurationVar(&cfg.HookTimeout, "hook-timeout", 30*time.Second, "Time limit for each hook command")
+	rootCmd.Flags().StringVar(&cfg.PreHook, "pre-hook", "", "Shell command run before the first API call; a failure aborts the run (default from the config file)")
+	rootCmd.Flags().StringVar(&cfg.PostHook, "post-hook", "", "Shell command run when the run ends, even if it failed (default from the config file)")
+	rootCmd.Flags().BoolVar(&cfg.DryRun, "dry-run", false, "Check the flags, show what the run would do and exit without any API call or hook")
+	rootCmd.Flags().StringVar(&cfg.ErrorFormat, "error-format", "text", "How the error that ends a run is printed: text or json (one object on stderr)")
+	rootCmd.Flags().Float64Var(&cfg.MaxCost, "max-cost", 0, "Stop making API calls once the estimated cost reaches this many USD (0 = no limit)")
+	rootCmd.Flags().IntVar(&cfg.MaxTotalTokens, "max-total-tokens", 0, "Start no new chunks once the run has used this many tokens (0 = no limit)")
+	rootCmd.Flags().Float64Var(&cfg.PriceIn, "price-in", 0, "USD per 1M input tokens of --model, for models without a known price")
+	rootCmd.Flags().Float64Var(&cfg.PriceOut, "price-out", 0, "USD per 1M output tokens of --model, for models without a known price")
+	rootCmd.Flags().StringVar(&cfg.Lang, "lang", "", "Output language code, e.g. de or ja (default: detected from the subject, else en)")
+	rootCmd.Flags().StringVar(&cfg.MetricsListen, "metrics-listen", "", "Serve Prometheus metrics on this address while the run lasts, e.g. :9090")
+	rootCmd.Flags().StringVar(&cfg.VersionOf, "version-of", "", "Regenerate this guide: revise its concept list, add a Changelog and keep it as <name>.v<N>.md")
+	rootCmd.Flags().BoolVar(&cfg.AltExplanations, "alt-explanations", false, "Follow each concept's explanation with a second, different one under \"Another way to look at it\"")
+	rootCmd.Flags().StringVar(&cfg.AltModel, "alt-model", "", "Model that writes the second explanations, for genuinely different phrasing (implies --alt-explanations)")
+	rootCmd.Flags().BoolVar(&cfg.NoAnswers, "no-answers", false, "In --mode socratic, leave out the model answers instead of hiding them")
+	rootCmd.Flags().BoolVar(&cfg.NoHistory, "no-history", false, "Don't record this run in the run history")
+	rootCmd.Flags().BoolVar(&cfg.Clarify, "clarify", false, "Let the model ask up to three questions about an ambiguous subject before generating")
+	rootCmd.Flags().StringVar(&cfg.ClarifyAnswers, "clarify-answers", "", "Answer the --clarify questions from this file, one answer per line, instead of asking")
+	rootCmd.Flags().StringVar(&cfg.TargetLength, "target-length", "", "Approximate total length of the guide, in words (20000w) or pages (40p)")
+	rootCmd.Flags().IntVar(&cfg.WordsPerPage, "words-per-page", 500, "Words in a page for --target-length")
+	rootCmd.Flags().StringVar(&cfg.AnalogyDomain, "analogy-domain", "", "Add a short analogy from this domain (e.g. cooking) to the concepts it genuinely helps")
+	rootCmd.Flags().BoolVar(&cfg.Timeline, "timeline", false, "Date every concept, order them chronologically and add a timeline after the Table of Contents")
+	rootCmd.Flags().BoolVar(&cfg.ConsistentTerms, "consistent-terms", false, "Agree on the subject's core terms before generating, give them to every chunk and report sections that stray")
+	rootCmd.Flags().BoolVar(&cfg.Glossary, "glossary", false, "Add the --consistent-terms sheet to the guide as a Glossary (implies --consistent-terms)")
+	rootCmd.Flags().IntVar(&cfg.Retries, "retries", 3, "Retries of an API call after a rate limit, a transient 5xx, a connection reset or a timeout (0 disables)")
+	rootCmd.Flags().DurationVar(&cfg.RetryMaxWait, "retry-max-wait", time.Minute, "Longest wait between retries; a longer Retry-After from the provider fails the call instead")
+	rootCmd.Flags().StringVar(&cfg.Resume, "resume", "", "Continue an interrupted run from its state file (.aiguide_state_<subject>.json), answering only the missing chunks")
+	rootCmd.Flags().StringVar(&cfg.Format, "format", "markdown", "Output format: markdown, anki (a .tsv of flashcards, one per concept, for Anki's importer) or json (one entry per concept)")
+	rootCmd.Flags().StringVar(&cfg.ConceptsFile, "concepts-file", "", "Use the concepts in this file (one per line, - for stdin) instead of generating the list")
+	rootCmd.Flags().StringVar(&cfg.ConceptsExtra, "concepts-extra", "", "Append the concepts in this file (one per line, - for stdin) to the generated list, skipping duplicates")
+	rootCmd.Flags().BoolVar(&cfg.NoVerify, "no-verify", false, "Don't check that each chunk answers all of its concepts, or ask again for the ones it left out")
+	rootCmd.Flags().BoolVarP(&cfg.Quiet, "quiet", "q", false, "Print only errors, warnings and the failure summary")
+	rootCmd.Flags().BoolVarP(&cfg.Verbose, "verbose", "v", false, "Print each chunk as it starts, each request's timing and each retry instead of the progress line")
+	rootCmd.Flags().StringVar(&cfg.SystemRole, "system-role", "auto", "Role for the system prompt: auto, system or developer")
+	rootCmd.Flags().IntVar(&cfg.BestOf, "best-of", 1, "Generate each chunk N times and keep the judge's pick per concept")
+	rootCmd.Flags().BoolVar(&cfg.Tags, "tags", false, "Tag every concept with 1-3 topics and show the tags under each heading")
+	rootCmd.Flags().StringSliceVar(&cfg.TagSet, "tag-set", nil, "Only assign tags from this list (implies --tags)")
+	rootCmd.Flags().StringSliceVar(&cfg.OnlyTags, "only-tags", nil, "Answer only concepts carrying one of these tags (implies --tags)")
+	rootCmd.Flags().StringSliceVar(&cfg.SkipTags, "skip-tags", nil, "Skip concepts carrying any of these tags (implies --tags)")
+	rootCmd.Flags().StringVar(&cfg.GroupBy, "group-by", "", "Reorder the guide into parts: tag (implies --tags)")
+	rootCmd.Flags().IntVar(&cfg.Depth, "depth", 1, "Levels of the guide: 1 for a list of concepts, 2 for -n chapters broken into subtopics")
+	rootCmd.Flags().IntVar(&cfg.SubCount, "sub-count", defaultSubCount, "Subtopics per chapter with --depth 2")
+	rootCmd.Flags().BoolVar(&cfg.Notify, "notify", false, "Show a desktop notification when the run finishes or fails")
+	rootCmd.Flags().StringVar(&cfg.Webhook, "webhook", "", "POST a JSON summary to this URL when the run ends (or set AIGUIDE_WEBHOOK)")
+	rootCmd.Flags().StringVar(&cfg.WebhookSecret, "webhook-secret", "", "Sign webhook bodies with HMAC-SHA256 in X-Aiguide-Signature")
+	rootCmd.Flags().BoolVar(&cfg.WebhookStrict, "webhook-strict", false, "Exit non-zero when the webhook cannot be delivered")
+	rootCmd.Flags().StringVar(&cfg.WebhookFormat, "webhook-format", "json", "Webhook payload format: json or slack")
+	rootCmd.Flags().BoolVar(&cfg.GitCommit, "git-commit", false, "Commit the generated files when the output directory is a git work tree")
+	rootCmd.Flags().BoolVar(&cfg.GitPush, "git-push", false, "Push after --git-commit")
+	rootCmd.Flags().StringVar(&cfg.GitMessage, "git-message", defaultGitMessage, "Commit message template for --git-commit ({{.Subject}}, {{.Model}}, {{.Date}})")
+	rootCmd.Flags().BoolVar(&cfg.Gist, "gist", false, "Upload the generated guide to a GitHub Gist (requires GITHUB_TOKEN)")
+	rootCmd.Flags().BoolVar(&cfg.GistPublic, "gist-public", false, "Create a public gist instead of a secret one")
+	rootCmd.Flags().BoolVar(&cfg.GistSidecar, "gist-sidecar", false, "Include the .meta.json sidecar in the gist")
+	rootCmd.Flags().StringSliceVar(&cfg.Exports, "export", nil, "Export the finished guide: notion, confluence, bibtex, latex, html, epub, mindmap, conceptmap, ics (repeatable)")
+	rootCmd.Flags().StringVar(&cfg.NotionParent, "notion-parent", "", "Parent page id or URL for --export notion (default $"+notionParentEnvVar+")")
+	rootCmd.Flags().StringVar(&cfg.ConfluenceURL, "confluence-url", "", "Confluence base URL for --export confluence (default $"+confluenceURLEnvVar+")")
+	rootCmd.Flags().StringVar(&cfg.ConfluenceSpace, "confluence-space", "", "Confluence space key (default $"+confluenceSpaceEnv+")")
+	rootCmd.Flags().StringVar(&cfg.ConfluenceParent, "confluence-parent", "", "Confluence parent page id (default $"+confluenceParentEnv+")")
+	rootCmd.Flags().BoolVar(&cfg.ConfluenceChildPages, "confluence-child-pages", false, "Put every concept on its own child page")
+	rootCmd.Flags().BoolVar(&cfg.NoSidecar, "no-sidecar", false, "Do not write the .meta.json sidecar next to the guide")
+
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
 
-type CompletionRequest struct {
-	Model       string    `json:"model"`
-	Messages    []Message `json:"messages"`
-	Temperature float64   `json:"temperature"`
-}
+func run(cmd *cobra.Command, args []string) {
+	if len(args) > 0 {
+		cfg.Subject = args[0]
+	}
+	startedAt := time.Now()
+	if cfg.Profile != "" {
+		if err := applyProfile(cmd, cfg.Profile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var resumed *runState
+	if cfg.Resume != "" {
+		var err error
+		if resumed, err = loadRunState(cfg.Resume); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading --resume: %v\n", err)
+			os.Exit(1)
+		}
+		switch {
+		case cfg.Subject == "":
+			cfg.Subject = resumed.Subject
+		case cfg.Subject != resumed.Subject:
+			fmt.Fprintf(os.Stderr, "Error: --resume %s is a run about %q, not %q.\n", cfg.Resume, resumed.Subject, cfg.Subject)
+			os.Exit(1)
+		}
+		// The saved plan decides whether the guide has chapters.
+		if cfg.Depth = max(resumed.Depth, 1); cfg.Depth > 1 {
+			cfg.SubCount = resumed.SubCount
+		}
+	}
+	if err := loadEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if cfg.ProvenanceStyle != "comment" && cfg.ProvenanceStyle != "section" {
+		fmt.Fprintf(os.Stderr, "Error: invalid --provenance-style %q (expected comment or section)\n", cfg.ProvenanceStyle)
+		os.Exit(1)
+	}
+
+	if cfg.RouteByDiff && cfg.CheapModel == "" {
+		fmt.Fprintln(os.Stderr, "Error: --route-by-difficulty requires --cheap-model.")
+		os.Exit(1)
+	}
+
+	switch cfg.ErrorFormat {
+	case "text", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --error-format %q (expected text or json)\n", cfg.ErrorFormat)
+		os.Exit(1)
+	}
+	if cfg.MaxCost < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --max-cost cannot be negative.")
+		os.Exit(1)
+	}
+	if cfg.MaxTotalTokens < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --max-total-tokens cannot be negative.")
+		os.Exit(1)
+	}
+	if cfg.PriceIn < 0 || cfg.PriceOut < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --price-in and --price-out cannot be negative.")
+		os.Exit(1)
+	}
+	if cmd.Flags().Changed("price-in") != cmd.Flags().Changed("price-out") {
+		fmt.Fprintln(os.Stderr, "Error: --price-in and --price-out go together.")
+		os.Exit(1)
+	}
+
+	switch cfg.SystemRole {
+	case "auto", "system", "developer":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --system-role %q (expected auto, system or developer)\n", cfg.SystemRole)
+		os.Exit(1)
+	}
+
+	validateWebhookFlags()
+
+	if cfg.GitPush && !cfg.GitCommit {
+		cfg.GitCommit = true
+	}
+	if cfg.GitCommit {
+		if err := checkGitCommit("."); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.Gist {
+		if err := checkGist(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.FixCode {
+		cfg.VerifyCode = true
+	}
+	switch cfg.BrokenLinks {
+	case "annotate", "strip", "keep":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --broken-links %q (expected annotate, strip or keep)\n", cfg.BrokenLinks)
+		os.Exit(1)
+	}
+	switch cfg.DedupContent {
+	case "off", "report", "rewrite":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --dedup-content %q (expected off, report or rewrite)\n", cfg.DedupContent)
+		os.Exit(1)
+	}
+	switch cfg.CitationStyle {
+	case "inline", "footnote":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --citation-style %q (expected inline or footnote)\n", cfg.CitationStyle)
+		os.Exit(1)
+	}
+	switch cfg.FootnotePlacement {
+	case "section", "document":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --footnote-placement %q (expected section or document)\n", cfg.FootnotePlacement)
+		os.Exit(1)
+	}
+	if cfg.DedupThreshold <= 0 || cfg.DedupThreshold >= 1 {
+		fmt.Fprintln(os.Stderr, "Error: --dedup-threshold must be between 0 and 1, e.g. 0.4.")
+		os.Exit(1)
+	}
+	if cfg.ReadabilityTarget < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --readability-target cannot be negative.")
+		os.Exit(1)
+	}
+	if cfg.ReadabilityFix || cfg.ReadabilityTarget > 0 {
+		cfg.Readability = true
+	}
+	if cmd.Flags().Changed("reading-speed") || cmd.Flags().Changed("difficulty-multipliers") || cmd.Flags().Changed("exercise-minutes") || cfg.StudyPlan {
+		cfg.StudyTime = true
+	}
+	if cfg.StudyPlan {
+		if cfg.Format != "markdown" {
+			fmt.Fprintln(os.Stderr, "Error: --study-plan needs --format markdown.")
+			os.Exit(1)
+		}
+		if err := checkICS(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.ReadingSpeed <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --reading-speed must be positive.")
+		os.Exit(1)
+	}
+	if cfg.ExerciseMinutes < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --exercise-minutes cannot be negative.")
+		os.Exit(1)
+	}
+	if _, err := parseDifficultyMultipliers(cfg.DifficultyMults); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --difficulty-multipliers %q: %v\n", cfg.DifficultyMults, err)
+		os.Exit(1)
+	}
+	if cfg.HookTimeout <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --hook-timeout must be positive.")
+		os.Exit(1)
+	}
+	if cfg.LinkTimeout <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --link-timeout must be positive.")
+		os.Exit(1)
+	}
+	if cfg.VerifyCode {
+		if err := checkVerifyCode(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := checkExports(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch cfg.Order {
+	case "model", "alpha", "shuffle", "easy-first", "hard-first":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --order %q (expected model, alpha, shuffle, easy-first or hard-first)\n", cfg.Order)
+		os.Exit(1)
+	}
+	if cmd.Flags().Changed("seed") && cfg.Order != "shuffle" {
+		fmt.Fprintln(os.Stderr, "Error: --seed only applies to --order shuffle.")
+		os.Exit(1)
+	}
+	if cfg.Order == "shuffle" && !cmd.Flags().Changed("seed") {
+		cfg.Seed = rand.Uint64()
+	}
+	if cfg.WordsPerPage < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --words-per-page must be at least 1.")
+		os.Exit(1)
+	}
+	if cfg.TargetLength != "" {
+		target, err := parseTargetLength(cfg.TargetLength, cfg.WordsPerPage)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --target-length %q (%v)\n", cfg.TargetLength, err)
+			os.Exit(1)
+		}
+		if cfg.Mode == "exercises" {
+			fmt.Fprintln(os.Stderr, "Error: --target-length doesn't apply to --mode exercises.")
+			os.Exit(1)
+		}
+		if per := target / max(cfg.TotalCount, 1); per < 80 {
+			fmt.Fprintf(os.Stderr, "Warning: --target-length %s leaves about %d words per concept; sections get at least %d.\n", cfg.TargetLength, per, minConceptWords)
+		}
+	}
+	if cmd.Flags().Changed("analogy-domain") {
+		if cfg.AnalogyDomain = strings.TrimSpace(cfg.AnalogyDomain); cfg.AnalogyDomain == "" {
+			fmt.Fprintln(os.Stderr, "Error: --analogy-domain must not be empty.")
+			os.Exit(1)
+		}
+		if cfg.Mode == "exercises" {
+			fmt.Fprintln(os.Stderr, "Error: --analogy-domain doesn't apply to --mode exercises.")
+			os.Exit(1)
+		}
+	}
+	if cfg.Glossary {
+		cfg.ConsistentTerms = true
+	}
+	if cfg.Timeline {
+		switch {
+		case cfg.Order != "model":
+			fmt.Fprintln(os.Stderr, "Error: --timeline orders the concepts chronologically and cannot be combined with --order.")
+			os.Exit(1)
+		case cfg.GroupBy != "":
+			fmt.Fprintln(os.Stderr, "Error: --timeline cannot be combined with --group-by.")
+			os.Exit(1)
+		case cfg.VersionOf != "":
+			fmt.Fprintln(os.Stderr, "Error: --timeline cannot be combined with --version-of.")
+			os.Exit(1)
+		}
+	}
+	if cfg.Depth < 1 || cfg.Depth > 2 {
+		fmt.Fprintln(os.Stderr, "Error: --depth must be 1 or 2.")
+		os.Exit(1)
+	}
+	if cfg.Depth == 2 {
+		switch {
+		case cfg.SubCount < 1:
+			fmt.Fprintln(os.Stderr, "Error: --sub-count must be at least 1.")
+			os.Exit(1)
+		case cfg.Mode != "guide":
+			fmt.Fprintln(os.Stderr, "Error: --depth 2 needs --mode guide.")
+			os.Exit(1)
+		case cfg.GroupBy != "" || cfg.Timeline:
+			fmt.Fprintln(os.Stderr, "Error: --depth 2 groups the concepts into chapters and cannot be combined with --group-by or --timeline.")
+			os.Exit(1)
+		case cfg.Order != "model" || len(cfg.OnlyTags) > 0 || len(cfg.SkipTags) > 0 || cfg.MaxDifficulty > 0:
+			fmt.Fprintln(os.Stderr, "Error: --depth 2 keeps each chapter's subtopics together and cannot be combined with --order, --only-tags, --skip-tags or --max-difficulty.")
+			os.Exit(1)
+		case cfg.ConceptsFile != "" || cfg.ConceptsExtra != "" || cfg.VersionOf != "":
+			fmt.Fprintln(os.Stderr, "Error: --depth 2 cannot be combined with --concepts-file, --concepts-extra or --version-of.")
+			os.Exit(1)
+		case len(cfg.Exports) > 0:
+			fmt.Fprintln(os.Stderr, "Error: the exports read guides of one level and cannot be combined with --depth 2.")
+			os.Exit(1)
+		}
+		// One chapter per chunk unless --chunk says otherwise.
+		if !cmd.Flags().Changed("chunk") {
+			cfg.ChunkSize = cfg.SubCount
+		}
+	}
+	switch cfg.Format {
+	case "markdown":
+	case "anki":
+		switch {
+		case cfg.Mode != "guide" && cfg.Mode != "interview":
+			fmt.Fprintln(os.Stderr, "Error: --format anki needs --mode guide or interview.")
+			os.Exit(1)
+		case len(cfg.Exports) > 0 || cfg.VersionOf != "":
+			fmt.Fprintln(os.Stderr, "Error: --export and --version-of read markdown guides and cannot be combined with --format anki.")
+			os.Exit(1)
+		case cfg.Practice > 0 || cfg.Pitfalls || cfg.Glossary || cfg.CitationStyle == "footnote":
+			fmt.Fprintln(os.Stderr, "Error: --format anki has no place for --practice, --pitfalls, --glossary or footnotes.")
+			os.Exit(1)
+		}
+	case "json":
+		switch {
+		case cfg.Mode == "exercises":
+			fmt.Fprintln(os.Stderr, "Error: --format json cannot be combined with --mode exercises.")
+			os.Exit(1)
+		case len(cfg.Exports) > 0 || cfg.VersionOf != "":
+			fmt.Fprintln(os.Stderr, "Error: --export and --version-of read markdown guides and cannot be combined with --format json.")
+			os.Exit(1)
+		case cfg.Practice > 0 || cfg.Pitfalls || cfg.Glossary || cfg.CitationStyle == "footnote":
+			fmt.Fprintln(os.Stderr, "Error: --format json has no place for --practice, --pitfalls, --glossary or footnotes.")
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --format %q (expected markdown, anki or json)\n", cfg.Format)
+		os.Exit(1)
+	}
+	if cfg.Quiet && cfg.Verbose {
+		fmt.Fprintln(os.Stderr, "Error: --quiet and --verbose cannot be combined.")
+		os.Exit(1)
+	}
+	if cfg.Retries < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --retries must not be negative.")
+		os.Exit(1)
+	}
+	if cfg.RetryMaxWait <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --retry-max-wait must be positive.")
+		os.Exit(1)
+	}
+	if cfg.MaxDifficulty < 0 || cfg.MaxDifficulty > 5 {
+		fmt.Fprintln(os.Stderr, "Error: --max-difficulty must be between 1 and 5.")
+		os.Exit(1)
+	}
+
+	if cfg.BloomMaxRemember < 0 || cfg.BloomMaxRemember >= 1 {
+		fmt.Fprintln(os.Stderr, "Error: --bloom-max-remember must be a share between 0 and 1, e.g. 0.3.")
+		os.Exit(1)
+	}
+
+	if cfg.Practice < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --practice cannot be negative.")
+		os.Exit(1)
+	}
+	switch cfg.Solutions {
+	case "inline", "end":
+	case "separate":
+		if cfg.Stdout && cfg.Practice > 0 {
+			fmt.Fprintln(os.Stderr, "Error: --solutions separate needs a file output and cannot be combined with --stdout.")
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --solutions %q (expected inline, end or separate)\n", cfg.Solutions)
+		os.Exit(1)
+	}
+
+	if cfg.Pitfalls {
+		cfg.Misconceptions = true
+	}
+	if cfg.AltModel != "" {
+		cfg.AltExplanations = true
+	}
+
+	if _, ok := modes[cfg.Mode]; !ok {
+		fmt.Fprintf(os.Stderr, "Error: invalid --mode %q (expected guide, interview, exercises or socratic)\n", cfg.Mode)
+		os.Exit(1)
+	}
+	if cfg.Mode == "exercises" {
+		validateExercisesFlags(cmd)
+	}
+	if cfg.NoAnswers && cfg.Mode != "socratic" {
+		fmt.Fprintln(os.Stderr, "Error: --no-answers only applies to --mode socratic.")
+		os.Exit(1)
+	}
+
+	if cfg.Stream {
+		switch conflicts := streamConflicts(); {
+		case !cfg.Stdout:
+			fmt.Fprintln(os.Stderr, "Error: --stream writes the guide to stdout as it is generated and needs --stdout.")
+			os.Exit(1)
+		case cfg.Threads > 1 && cmd.Flags().Changed("threads"):
+			fmt.Fprintln(os.Stderr, "Error: --stream answers one chunk at a time and cannot be combined with --threads above 1.")
+			os.Exit(1)
+		case len(conflicts) > 0:
+			fmt.Fprintf(os.Stderr, "Error: --stream cannot be combined with %s, which change answers after they arrive.\n", strings.Join(conflicts, ", "))
+			os.Exit(1)
+		}
+		cfg.Threads = 1
+	} else if !cmd.Flags().Changed("stream") {
+		cfg.Stream = cfg.Stdout && cfg.Threads == 1 && len(streamConflicts()) == 0
+	}
+
+	var clarifyAnswers []string
+	if cfg.ClarifyAnswers != "" {
+		cfg.Clarify = true
+		var err error
+		if clarifyAnswers, err = loadClarifyAnswers(cfg.ClarifyAnswers); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if cfg.GroupBy != "" && cfg.GroupBy != "tag" {
+		fmt.Fprintf(os.Stderr, "Error: invalid --group-by %q (expected tag)\n", cfg.GroupBy)
+		os.Exit(1)
+	}
+
+	if cfg.BestOf < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --best-of must be at least 1.")
+		os.Exit(1)
+	}
+
+	if resumed != nil {
+		switch {
+		case cfg.VersionOf != "":
+			fmt.Fprintln(os.Stderr, "Error: --resume cannot be combined with --version-of.")
+			os.Exit(1)
+		case cfg.Practice > 0 || cfg.Mode == "exercises":
+			fmt.Fprintln(os.Stderr, "Error: --resume doesn't support --practice or --mode exercises.")
+			os.Exit(1)
+		}
+	}
+
+	var prev *previousVersion
+	if cfg.VersionOf != "" {
+		if cfg.Stdout || cfg.Mode == "exercises" {
+			fmt.Fprintln(os.Stderr, "Error: --version-of replaces a guide file and cannot be combined with --stdout or --mode exercises.")
+			os.Exit(1)
+		}
+		var err error
+		if prev, err = loadPreviousVersion(cfg.VersionOf); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading --version-of: %v\n", err)
+			os.Exit(1)
+		}
+		if !cmd.Flags().Changed("number") {
+			cfg.TotalCount = len(prev.concepts)
+		}
+	}
+
+	var givenConcepts, extraConcepts []string
+	if cfg.ConceptsFile != "" || cfg.ConceptsExtra != "" {
+		stdinUsers := 0
+		for _, src := range []string{cfg.ConceptsFile, cfg.ConceptsExtra, cfg.SystemPromptPath} {
+			if src == "-" {
+				stdinUsers++
+			}
+		}
+		switch {
+		case cfg.ConceptsFile != "" && cfg.ConceptsExtra != "":
+			fmt.Fprintln(os.Stderr, "Error: --concepts-file and --concepts-extra cannot be combined.")
+			os.Exit(1)
+		case prev != nil || resumed != nil:
+			fmt.Fprintln(os.Stderr, "Error: --concepts-file and --concepts-extra cannot be combined with --version-of or --resume.")
+			os.Exit(1)
+		case cfg.Timeline:
+			fmt.Fprintln(os.Stderr, "Error: --timeline dates the concepts as it generates them and cannot be combined with --concepts-file or --concepts-extra.")
+			os.Exit(1)
+		case stdinUsers > 1 || (stdinUsers == 1 && cfg.Clarify && cfg.ClarifyAnswers == ""):
+			fmt.Fprintln(os.Stderr, "Error: stdin can only be read once; give the other inputs as files (--clarify asks on stdin unless --clarify-answers is set).")
+			os.Exit(1)
+		}
+	}
+	if cfg.ConceptsFile != "" {
+		lines, err := readConceptLines(cfg.ConceptsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading --concepts-file: %v\n", err)
+			os.Exit(1)
+		}
+		switch {
+		case !cmd.Flags().Changed("number"):
+			cfg.TotalCount = len(lines)
+		case len(lines) > cfg.TotalCount:
+			fmt.Fprintf(os.Stderr, "Warning: %s has %d concepts, keeping the first %d (-n).\n", conceptSource(cfg.ConceptsFile), len(lines), cfg.TotalCount)
+			lines = lines[:cfg.TotalCount]
+		default:
+			cfg.TotalCount = len(lines)
+		}
+		var renumbered bool
+		if givenConcepts, renumbered = numberConcepts(lines); renumbered {
+			fmt.Fprintf(os.Stderr, "Warning: renumbered the concepts of %s 1 to %d, as the headings are.\n", conceptSource(cfg.ConceptsFile), len(givenConcepts))
+		}
+	}
+	if cfg.ConceptsExtra != "" {
+		var err error
+		if extraConcepts, err = readConceptLines(cfg.ConceptsExtra); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading --concepts-extra: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := resolveLanguage(cmd.Flags().Changed("lang")); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var filename string
+	if !cfg.Stdout {
+		outputStem, err := renderFilename(newFilenameData(startedAt))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		filename = outputStem + ".md"
+		switch cfg.Format {
+		case "anki":
+			filename = outputStem + ".tsv"
+		case "json":
+			filename = outputStem + ".json"
+		}
+		if cfg.Mode == "exercises" {
+			filename = filepath.Join(outputStem, "README.md")
+		}
+		if prev != nil {
+			filename = prev.path
+		}
+		// Resume into the file the interrupted run was writing.
+		if resumed != nil && resumed.Output != "" && !cmd.Flags().Changed("filename-template") {
+			filename = resumed.Output
+		}
+	}
+
+	fc, err := loadFileConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if err := configureHistory(fc); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	runHooks.pre, runHooks.post, runHooks.output = cfg.PreHook, cfg.PostHook, filename
+	if !cmd.Flags().Changed("pre-hook") {
+		runHooks.pre = fc.Hooks.Pre
+	}
+	if !cmd.Flags().Changed("post-hook") {
+		runHooks.post = fc.Hooks.Post
+	}
+
+	if cfg.SystemPromptPath != "" {
+		prompt, err := loadSystemPrompt(cfg.SystemPromptPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.SystemPrompt = prompt
+	} else {
+		cfg.SystemPrompt = currentMode().systemPrompt
+	}
+
+	if cfg.SystemPrompt, err = withInstructions(cfg.SystemPrompt, cfg.Info); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.Format == "anki" {
+		cfg.SystemPrompt += ankiInstruction
+	}
+
+	if cfg.DryRun {
+		printDryRun(filename)
+		if prev != nil {
+			fmt.Printf("-> Would keep the previous version as %s\n", prev.archivePath())
+		}
+		return
+	}
+	if cfg.MetricsListen != "" {
+		m := newPromMetrics()
+		if err := serveMetrics(cfg.MetricsListen, m); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		metrics = m
+	}
+	if err := runPreHook(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --pre-hook failed, nothing was generated: %v\n", err)
+		failRun(startedAt, "the pre-hook failed", err)
+	}
+
+	if cfg.MaxCost > 0 && !modelsPriced() {
+		fmt.Fprintln(os.Stderr, "Warning: --max-cost cannot be enforced, some of the models used have no known price.")
+	}
+	handleInterrupt(startedAt)
+
+	if resumed != nil {
+		clarifications = resumed.Clarifications
+		cfg.SystemPrompt += clarificationContext()
+	} else if cfg.Clarify {
+		if err := clarifySubject(clarifyAnswers); err != nil {
+			fmt.Fprintf(os.Stderr, "Error asking clarifying questions: %v\n", err)
+			failRun(startedAt, "could not ask clarifying questions", err)
+		}
+		cfg.SystemPrompt += clarificationContext()
+	}
+
+	if !cfg.OutlineOnly {
+		printEstimate()
+	}
+	setupStart := time.Now()
+	var plan *conceptPlan
+	var groups []conceptGroup
+	if resumed != nil {
+		statusf("-> Resuming %d concepts from %s (%d chunk(s) saved)...\n", len(resumed.Concepts), resumed.path, resumed.answered())
+		plan, groups = resumed.plan(), resumed.Groups
+	} else {
+		if plan, groups, err = planConcepts(prev, givenConcepts, extraConcepts); err != nil {
+			failStage(startedAt, err)
+		}
+	}
+	concepts := plan.concepts
+
+	if cfg.OutlineOnly {
+		for i, c := range concepts {
+			if cfg.Depth > 1 {
+				// Chapters head their subtopics, which are indented.
+				for g, grp := range groups {
+					if grp.Start == i {
+						fmt.Println(groupTitle(g, grp))
+					}
+				}
+				c = "  " + c
+			}
+			fmt.Println(c)
+		}
+		emitEvent(progressEvent{Event: "outline", Concepts: concepts})
+		emitUsage()
+		return
+	}
+
+	if resumed != nil {
+		if terminology = resumed.Terminology; terminology != nil {
+			cfg.SystemPrompt += terminologyInstruction(terminology)
+		}
+	} else if cfg.ConsistentTerms {
+		statusf("-> Agreeing on the terminology of %d concepts...\n", len(concepts))
+		terminology, err = terminologySheet(concepts, auxModel())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error building the terminology sheet: %v\n", err)
+			failRun(startedAt, "could not build the terminology sheet", err)
+		}
+		cfg.SystemPrompt += terminologyInstruction(terminology)
+	}
+
+	var writer io.Writer
+	var archived []string
+	if cfg.Stdout {
+		writer = os.Stdout
+	} else {
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
+			failRun(startedAt, "could not create the output directory", err)
+		}
+		if prev != nil {
+			if archived, err = prev.archive(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error keeping the previous version: %v\n", err)
+				failRun(startedAt, "could not keep the previous version", err)
+			}
+			statusf("-> Kept the previous version as %s\n", archived[0])
+		}
+		if cfg.Format == "json" {
+			// The JSON document is written whole once the run ends.
+			writer = io.Discard
+		} else {
+			f, err := os.Create(filename)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating file: %v\n", err)
+				failRun(startedAt, "could not create the output file", err)
+			}
+			defer f.Close()
+			writer = f
+		}
+		statusf("-> Outputting to: %s\n", filename)
+		emitEvent(progressEvent{Event: "output", Path: filename})
+	}
+
+	state := resumed
+	if state != nil {
+		state.checkSettings()
+	} else {
+		state = newRunState(statePath(filename), filename, plan, groups)
+		if err := state.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: cannot save progress to %s: %v\n", state.path, err)
+		}
+	}
 
-type CompletionResponse struct {
-	Choices []struct {
-		Message Message `json:"message"`
-	} `json:"choices"`
-	Error *struct {
-		Message string `json:"message"`
-	} `json:"error"`
-}
+	// Unless streamChunks allows writing chunks as they finish, the body is
+	// buffered so the header can show the total study time.
+	chunks := planChunks(plan, groups)
+	if cfg.TargetLength != "" {
+		target, _ := parseTargetLength(cfg.TargetLength, cfg.WordsPerPage)
+		lengths = newLengthBudget(target, plan.difficulty, len(plan.concepts))
+	}
+	book := newPracticeBook(len(chunks))
+	ws := newExerciseWorkspace(filepath.Dir(filename))
+	notes := newFootnotes()
+	doc := newJSONGuide(startedAt, concepts)
+	stream := streamChunks(prev)
+	var body bytes.Buffer
+	out := io.Writer(&body)
+	switch {
+	case cfg.Format == "anki":
+		writeAnkiHeader(writer)
+		out = writer
+	case cfg.Format == "json":
+		out = io.Discard
+	case stream:
+		writeHeaderAndToC(writer, concepts, plan.periods, groups, 0)
+		out = writer
+	}
+	setup := time.Since(setupStart)
+	before, _, _ := usage.totals()
+	answering.Store(true)
+	sections := processChunks(out, chunks, book, ws, notes, doc, state, stream)
+	after, _, _ := usage.totals()
+	recordTimings(setup, after.TotalTokens-before.TotalTokens)
+	var changes *changelog
+	if prev != nil {
+		changes = diffVersions(prev, body.String())
+	}
+	if !stream && cfg.Format == "markdown" {
+		writeHeaderAndToC(writer, concepts, plan.periods, groups, totalStudyTime(sections))
+		body.WriteTo(writer)
+	}
+	var workspaceFiles []string
+	if ws != nil {
+		workspaceFiles = ws.finish()
+	}
+	var solutionsFile string
+	if book != nil {
+		solutionsFile, err = book.writeEnd(writer, filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing solutions: %v\n", err)
+		}
+	}
+	if cfg.Pitfalls {
+		writePitfalls(writer, concepts, sections)
+	}
+	if cfg.Glossary {
+		writeGlossary(writer, terminology)
+	}
+	if cfg.StudyPlan {
+		writeStudyPlan(writer, concepts, sections)
+	}
+	if notes != nil {
+		notes.writeEnd(writer)
+	}
+	var version *VersionInfo
+	if changes != nil {
+		changes.write(writer)
+		version = changes.info()
+	}
 
-func main() {
-	rootCmd := &cobra.Command{
-		Use:   "aiguide [subject]",
-		Short: "Generate an AI-powered study guide",
-		Args:  cobra.ExactArgs(1),
-		Run:   run,
+	prov := newProvenance(startedAt, len(concepts))
+	if doc != nil {
+		if err := doc.write(filename); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing the guide: %v\n", err)
+			failRun(startedAt, "could not write the guide", err)
+		}
+	}
+	if !cfg.NoProvenance && cfg.Format == "markdown" {
+		writeProvenanceFooter(writer, prov, cfg.ProvenanceStyle)
 	}
 
-	rootCmd.Flags().IntVarP(&cfg.TotalCount, "number", "n", 100, "Total number of questions/concepts to generate")
-	rootCmd.Flags().IntVarP(&cfg.ChunkSize, "chunk", "c", 2, "Number of questions to process per API call")
-	rootCmd.Flags().BoolVarP(&cfg.Stdout, "stdout", "o", false, "Output to stdout instead of file")
-	rootCmd.Flags().IntVarP(&cfg.Threads, "threads", "t", 1, "Number of concurrent threads for generating answers")
-	rootCmd.Flags().StringVarP(&cfg.Info, "info", "i", "", "Additional instructions or context to append to system prompt")
-	rootCmd.Flags().StringVarP(&cfg.SystemPromptPath, "system-prompt", "s", "", "Path to custom system prompt file")
+	if !cfg.Stdout && !cfg.NoSidecar {
+		if err := writeSidecar(sidecarPath(filename), &Sidecar{Provenance: prov, Sections: sections, Version: version, Clarifications: clarifications, Terminology: terminology, Usage: usage.runUsage()}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing sidecar: %v\n", err)
+		}
+	}
 
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	// With --quiet only what went wrong is reported.
+	if cfg.Quiet {
+		writeFailureSummary(os.Stderr, sections)
+		writeResumeHint(os.Stderr, state, sections)
+	} else {
+		sw := statusOut()
+		if !cfg.Stdout {
+			if runCtx.Err() != nil {
+				fmt.Fprintln(sw, "\n-> Interrupted; the guide holds the chunks done so far.")
+			} else if partialFailure(sections) != nil {
+				fmt.Fprintln(sw, "\n-> Done, but some sections failed; see below.")
+			} else {
+				fmt.Fprintln(sw, "\n-> Done! Guide generated successfully.")
+			}
+		}
+		usage.writeSummary(sw, cfg.Model)
+		if cfg.BestOf > 1 {
+			writeBestOfSummary(sw)
+		}
+		writeBloomSummary(sw, plan.bloom)
+		writeCodeSummary(sw, sections)
+		writeLinkSummary(sw, sections)
+		writeDedupSummary(sw, sections)
+		writeReadabilitySummary(sw, sections)
+		writeTablesSummary(sw, sections)
+		writeLengthSummary(sw, sections)
+		writeTermsSummary(sw, sections)
+		writeMissingSummary(sw, sections)
+		writeFailureSummary(sw, sections)
+		writeResumeHint(sw, state, sections)
+	}
+	if partialFailure(sections) == nil {
+		if err := os.Remove(state.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "Warning: cannot remove the state file: %v\n", err)
+		}
 	}
-}
 
-func run(cmd *cobra.Command, args []string) {
-	cfg.Subject = args[0]
-	loadEnv()
+	outcome := runOutcome{Status: statusSuccess, Duration: time.Since(startedAt)}
+	for _, sec := range sections {
+		if sec.Failed {
+			outcome.Failed++
+		} else {
+			outcome.Succeeded++
+		}
+	}
+	if outcome.Failed > 0 {
+		outcome.Status = statusPartial
+	}
+	// Nothing is committed, shared or exported after Ctrl-C.
+	interrupted := runCtx.Err() != nil
+	if interrupted {
+		outcome.Stage = "the run was interrupted"
+	}
+	if filename != "" {
+		outcome.Outputs = append(outcome.Outputs, filename)
+		if !cfg.NoSidecar {
+			outcome.Outputs = append(outcome.Outputs, sidecarPath(filename))
+		}
+		if solutionsFile != "" {
+			outcome.Outputs = append(outcome.Outputs, solutionsFile)
+		}
+		outcome.Outputs = append(outcome.Outputs, workspaceFiles...)
+	}
+	var gitErr error
+	if cfg.GitCommit && !interrupted {
+		if gitErr = gitCommitOutputs(append(outcome.Outputs, archived...), startedAt); gitErr != nil {
+			fmt.Fprintf(os.Stderr, "Error committing guide: %v\n", gitErr)
+		}
+	}
 
-	if cfg.SystemPromptPath != "" {
-		b, err := os.ReadFile(cfg.SystemPromptPath)
+	var shareErr error
+	if cfg.Gist && !interrupted {
+		gistURL, err := uploadGist(gistOutputs(outcome.Outputs))
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading system prompt file: %v\n", err)
-			os.Exit(1)
+			shareErr = err
+			fmt.Fprintf(os.Stderr, "Error uploading gist (the local guide is intact): %v\n", err)
+		} else {
+			statusf("-> Gist: %s\n", gistURL)
+			outcome.Outputs = append(outcome.Outputs, gistURL)
 		}
-		cfg.SystemPrompt = string(b)
-	} else {
-		cfg.SystemPrompt = embedSystemPrompt
 	}
 
-	if cfg.Info != "" {
-		cfg.SystemPrompt += "\n\nADDITIONAL USER INSTRUCTIONS:\n" + cfg.Info
+	if len(cfg.Exports) > 0 && !interrupted && !runExports(filename) {
+		shareErr = fmt.Errorf("export failed")
 	}
 
-	fmt.Printf("-> Generating list of %d concepts for subject: %s...\n", cfg.TotalCount, cfg.Subject)
-	concepts, err := generateConceptList()
+	if err := finishRun(outcome); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		if cfg.WebhookStrict {
+			os.Exit(reportError(err))
+		}
+	}
+	if interrupted {
+		os.Exit(reportError(ErrInterrupted))
+	}
+	if err := partialFailure(sections); err != nil {
+		os.Exit(reportError(err))
+	}
+	if gitErr != nil {
+		os.Exit(reportError(fmt.Errorf("committing guide: %w", gitErr)))
+	}
+	if shareErr != nil {
+		os.Exit(reportError(fmt.Errorf("%w: %v", errShareFailed, shareErr)))
+	}
+}
+
+// planConcepts generates the concept list, or takes the given one, and
+// everything decided before answering: Bloom levels, tags, difficulty,
+// filters, order and parts. Extra concepts are added to a generated list.
+func planConcepts(prev *previousVersion, given, extra []string) (*conceptPlan, []conceptGroup, error) {
+	var concepts, periods []string
+	var groups []conceptGroup
+	var err error
+	switch {
+	case prev != nil:
+		statusf("-> Revising the %d concepts of %s...\n", len(prev.concepts), prev.path)
+		concepts, err = reviseConceptList(prev)
+	case given != nil:
+		statusf("-> Using the %d concepts of %s\n", len(given), conceptSource(cfg.ConceptsFile))
+		concepts = given
+	case cfg.Depth > 1:
+		statusf("-> Generating list of %d chapters for subject: %s...\n", cfg.TotalCount, cfg.Subject)
+		concepts, groups, err = generateChapters()
+	default:
+		statusf("-> Generating list of %d concepts for subject: %s...\n", cfg.TotalCount, cfg.Subject)
+		if cfg.Timeline {
+			concepts, periods, err = generateTimelineList()
+		} else {
+			concepts, err = generateConceptList()
+		}
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error generating concepts: %v\n", err)
-		os.Exit(1)
+		return nil, nil, &stageError{"could not generate the concept list", err}
+	}
+	if extra != nil {
+		var added int
+		concepts, added = mergeConcepts(concepts, extra)
+		concepts = renumberConcepts(concepts)
+		statusf("-> Added %d of the %d concepts of %s (%d already listed)\n", added, len(extra), conceptSource(cfg.ConceptsExtra), len(extra)-added)
 	}
 
 	if len(concepts) == 0 {
 		fmt.Println("No concepts were generated. Exiting.")
-		os.Exit(1)
+		return nil, nil, &stageError{"no concepts were generated", nil}
 	}
 
-	var writer io.Writer
+	plan := &conceptPlan{concepts: concepts, periods: periods}
+	reordered := false
+	if bloomEnabled() {
+		statusf("-> Classifying %d concepts by Bloom level...\n", len(plan.concepts))
+		plan.bloom, err = classifyBloom(plan.concepts, auxModel())
+		if err == nil && cfg.BloomMaxRemember > 0 {
+			plan.concepts, plan.bloom, err = rebalanceBloom(plan.concepts, plan.bloom, auxModel())
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error classifying Bloom levels: %v\n", err)
+			return nil, nil, &stageError{"could not classify Bloom levels", err}
+		}
+	}
 
-	if cfg.Stdout {
-		writer = os.Stdout
-	} else {
-		cleanSubject := regexp.MustCompile(`[^a-zA-Z0-9]+`).ReplaceAllString(cfg.Subject, "_")
-		filename := fmt.Sprintf("%s_%s.md", cleanSubject, time.Now().Format("20060102-150405"))
-		f, err := os.Create(filename)
+	if tagsEnabled() {
+		statusf("-> Tagging %d concepts...\n", len(plan.concepts))
+		plan.tags, err = assignTags(plan.concepts, auxModel(), normalizeTags(cfg.TagSet))
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating file: %v\n", err)
-			os.Exit(1)
+			fmt.Fprintf(os.Stderr, "Error tagging concepts: %v\n", err)
+			return nil, nil, &stageError{"could not tag concepts", err}
+		}
+		if len(cfg.OnlyTags) > 0 || len(cfg.SkipTags) > 0 {
+			keep := filterByTags(plan.tags)
+			if len(keep) == 0 {
+				fmt.Fprintln(os.Stderr, "Error: no concepts left after --only-tags/--skip-tags.")
+				return nil, nil, &stageError{"no concepts matched the tag filters", nil}
+			}
+			statusf("-> Kept %d of %d concepts after tag filtering\n", len(keep), len(plan.concepts))
+			plan.apply(keep)
+			reordered = true
 		}
-		defer f.Close()
-		writer = f
-		fmt.Printf("-> Outputting to: %s\n", filename)
 	}
 
-	writeHeaderAndToC(writer, concepts)
+	if difficultyEnabled() {
+		statusf("-> Estimating difficulty of %d concepts...\n", len(plan.concepts))
+		plan.difficulty, err = estimateDifficulty(plan.concepts, auxModel())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error estimating difficulty: %v\n", err)
+			return nil, nil, &stageError{"could not estimate difficulty", err}
+		}
+		if cfg.MaxDifficulty > 0 {
+			keep := filterByDifficulty(plan.difficulty, cfg.MaxDifficulty)
+			if len(keep) == 0 {
+				fmt.Fprintf(os.Stderr, "Error: no concepts at difficulty %d or below.\n", cfg.MaxDifficulty)
+				return nil, nil, &stageError{"no concepts matched --max-difficulty", nil}
+			}
+			statusf("-> Kept %d of %d concepts at difficulty %d or below\n", len(keep), len(plan.concepts), cfg.MaxDifficulty)
+			plan.apply(keep)
+			reordered = true
+		}
+		if cfg.Order == "easy-first" || cfg.Order == "hard-first" {
+			plan.apply(orderByDifficulty(plan.difficulty, cfg.Order == "hard-first"))
+			reordered = true
+		}
+	}
 
-	processChunks(writer, concepts)
+	switch cfg.Order {
+	case "alpha":
+		plan.apply(orderAlphabetically(plan.concepts))
+		reordered = true
+	case "shuffle":
+		statusf("-> Shuffled the concepts with --seed %d\n", cfg.Seed)
+		plan.apply(shuffledOrder(len(plan.concepts), cfg.Seed))
+		reordered = true
+	}
 
-	if !cfg.Stdout {
-		fmt.Println("\n-> Done! Guide generated successfully.")
+	if cfg.GroupBy == "tag" {
+		var order []int
+		order, groups = groupByTag(plan.tags)
+		plan.apply(order)
+		reordered = true
 	}
+	if cfg.Timeline {
+		order, dated := orderChronologically(plan.periods)
+		if dated == 0 {
+			fmt.Fprintln(os.Stderr, "Warning: none of the concepts could be dated; keeping the model's order.")
+		} else {
+			statusf("-> Ordered %d concepts chronologically (%d undated)\n", len(plan.concepts), len(plan.concepts)-dated)
+			plan.apply(order)
+			groups = timelineGroups(plan.periods, dated)
+			reordered = true
+		}
+	}
+	if reordered {
+		plan.concepts = renumberConcepts(plan.concepts)
+	}
+	if prerequisitesEnabled() {
+		// Asked for last, so the numbers are those of the guide.
+		statusf("-> Finding the prerequisites of %d concepts...\n", len(plan.concepts))
+		plan.prerequisites, err = findPrerequisites(plan.concepts, auxModel())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error finding prerequisites: %v\n", err)
+			return nil, nil, &stageError{"could not find prerequisites", err}
+		}
+	}
+	if cfg.Timeline {
+		plan.concepts = withPeriods(plan.concepts, plan.periods)
+	}
+	return plan, groups, nil
 }
 
-func loadEnv() {
-	rawURL := os.Getenv("OPENAI_BASE_URL")
+// loadEnv resolves the provider, API key and model into cfg and builds gen
+// for them.
+func loadEnv() error {
+	var prof ProviderProfile
+	if cfg.Provider != "" {
+		p, err := findProvider(cfg.Provider)
+		if err != nil {
+			return err
+		}
+		prof = p
+	}
+
+	rawURL := prof.BaseURL
+	if rawURL == "" {
+		rawURL = os.Getenv("OPENAI_BASE_URL")
+	}
 	if rawURL == "" {
 		rawURL = "https://api.openai.com/v1"
 	}
+	if _, err := url.Parse(rawURL); err != nil {
+		return fmt.Errorf("parsing Base URL: %w", err)
+	}
 
-	u, err := url.Parse(rawURL)
+	token, declared, err := prof.apiKey()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing Base URL: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("provider %q: %w", cfg.Provider, err)
+	}
+	if !declared {
+		token = os.Getenv("OPENAI_API_KEY")
+	}
+	cfg.Token = token
+	switch {
+	case cfg.Token != "":
+	case cfg.Provider == "":
+		return errors.New("OPENAI_API_KEY environment variable is required.")
+	case prof.APIKeyEnv != "":
+		return fmt.Errorf("provider %q expects its API key in $%s, which is empty.", cfg.Provider, prof.APIKeyEnv)
 	}
-	cfg.BaseURL = u.JoinPath("chat", "completions").String()
 
-	cfg.Token = os.Getenv("OPENAI_API_KEY")
-	if cfg.Token == "" {
-		fmt.Fprintln(os.Stderr, "Error: OPENAI_API_KEY environment variable is required.")
-		os.Exit(1)
+	cfg.Headers = prof.Headers
+	cfg.Quirks = make(map[string]bool, len(prof.Quirks))
+	for _, q := range prof.Quirks {
+		cfg.Quirks[q] = true
+	}
+	cfg.MaxTokens = prof.MaxTokens
+	if cfg.MaxTokens == 0 && cfg.Quirks[quirkRequiresMaxTokens] {
+		cfg.MaxTokens = guide.DefaultMaxTokens
+	}
+
+	if cfg.Model == "" {
+		cfg.Model = prof.Model
+	}
+	if cfg.Model == "" {
+		cfg.Model = os.Getenv("OPENAI_MODEL")
+	}
+	if cfg.Model == "" && prof.Type == "tgi" {
+		// TGI serves a single model and accepts any name on its chat route.
+		cfg.Model = "tgi"
 	}
-	cfg.Model = os.Getenv("OPENAI_MODEL")
 	if cfg.Model == "" {
 		cfg.Model = "gpt-4o"
 	}
+
+	if gen, err = newGenerator(prof.Type, prof.ChatTemplate, rawURL); err != nil {
+		return err
+	}
+	cfg.BaseURL = gen.URL()
+	return nil
 }
 
 func generateConceptList() ([]string, error) {
-	prompt := fmt.Sprintf(
-		"Generate a numbered list of exactly %d core questions or concepts regarding the subject: '%s'. "+
-			"Output ONLY the numbered list. Do not add introductions or conclusions. "+
-			"Ensure every line starts with a number followed by a dot.",
-		cfg.TotalCount, cfg.Subject,
-	)
-
-	resp, err := callAI(prompt, "You are a helpful assistant that lists concepts concisely.")
-	if err != nil {
-		return nil, err
-	}
+	prompt := currentMode().listPrompt(cfg.TotalCount, cfg.Subject) + clarificationContext() +
+		guide.ListFormat + languageInstruction()
 
-	var cleanList []string
-	scanner := bufio.NewScanner(strings.NewReader(resp))
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" && (unicodeIsDigit(line[0]) || strings.HasPrefix(line, "-")) {
-			cleanList = append(cleanList, line)
-		}
-	}
-	return cleanList, nil
+	concepts, err := gen.ListConcepts(runCtx, prompt)
+	return concepts, interrupted(err)
+}
+
+// parseConceptList keeps the numbered or bulleted lines of a model's list.
+func parseConceptList(resp string) []string {
+	return guide.ParseConceptList(resp)
 }
 
 func unicodeIsDigit(b byte) bool {
 	return b >= '0' && b <= '9'
 }
 
-func writeHeaderAndToC(w io.Writer, concepts []string) {
-	title := fmt.Sprintf("# Comprehensive Guide: %s\n\n", strings.ToUpper(cfg.Subject))
-	toc := "## Table of Contents\n\n"
+// writeHeaderAndToC writes the title and Table of Contents. With groups the
+// ToC is nested under one entry per part; with periods a timeline follows.
+func writeHeaderAndToC(w io.Writer, concepts, periods []string, groups []conceptGroup, studyMinutes int) {
+	lang := outputLanguage()
+	heading := fmt.Sprintf("%s: %s", guideTitle(), strings.ToUpper(cfg.Subject))
+	title := "# " + heading + "\n\n"
+	if studyMinutes > 0 {
+		title += fmt.Sprintf("*%s: %s*\n\n", lang.studyTime, formatStudyTime(studyMinutes))
+	}
+	toc := fmt.Sprintf("## %s\n\n", lang.toc)
+	// Anchors are numbered like GitHub numbers repeated headings, in the
+	// order the headings appear.
+	slugs := guide.Slugger{}
+	slugs.Unique(mdAnchor(heading))
+	slugs.Unique(mdAnchor(lang.toc))
+	link := func(indent, text, anchor string) {
+		toc += fmt.Sprintf("%s- [%s](#%s)\n", indent, text, slugs.Unique(anchor))
+	}
+
+	indent := ""
+	for i, c := range concepts {
+		for g, grp := range groups {
+			if grp.Start == i {
+				link("", groupTitle(g, grp), mdAnchor(groupTitle(g, grp)))
+				indent = "  "
+			}
+		}
 
-	for _, c := range concepts {
 		parts := strings.SplitN(c, " ", 2)
 		if len(parts) < 2 {
 			continue
 		}
 
-		content := strings.ToLower(parts[1])
-		reg := regexp.MustCompile("[^a-z0-9 ]+")
-		content = reg.ReplaceAllString(content, "")
-		slug := strings.ReplaceAll(strings.TrimSpace(content), " ", "-")
-
-		numberStr := strings.TrimSuffix(parts[0], ".")
-		fullSlug := fmt.Sprintf("%s-%s", numberStr, slug)
-
-		toc += fmt.Sprintf("- [%s](#%s)\n", c, fullSlug)
+		link(indent, c, conceptAnchor(c))
 	}
-	toc += "\n---\n\n"
+	if cfg.Practice > 0 && cfg.Solutions != "inline" {
+		link("", lang.practiceProblems, mdAnchor(lang.practiceProblems))
+		if cfg.Solutions == "end" {
+			link("", lang.solutions, mdAnchor(lang.solutions))
+		}
+	}
+	if cfg.Pitfalls {
+		link("", lang.pitfalls, mdAnchor(lang.pitfalls))
+	}
+	if cfg.Glossary {
+		link("", lang.glossary, mdAnchor(lang.glossary))
+	}
+	if cfg.StudyPlan {
+		link("", lang.studyPlan, mdAnchor(lang.studyPlan))
+	}
+	if cfg.VersionOf != "" {
+		link("", lang.changelog, mdAnchor(lang.changelog))
+	}
+	toc += "\n"
+	if periods != nil {
+		toc += timelineOverview(concepts, periods)
+	}
+	toc += "---\n\n"
 
 	fmt.Fprint(w, title)
 	fmt.Fprint(w, toc)
 }
 
-func processChunks(w io.Writer, concepts []string) {
-	total := len(concepts)
-	numChunks := (total + cfg.ChunkSize - 1) / cfg.ChunkSize
-	results := make([]string, numChunks)
+// auxModel answers the cheap bookkeeping passes (tags, difficulty).
+func auxModel() string {
+	if cfg.CheapModel != "" {
+		return cfg.CheapModel
+	}
+	return cfg.Model
+}
+
+// conceptLabels returns the line shown under each concept heading of j, or
+// nil when there is nothing to show.
+func conceptLabels(j chunk) []string {
+	showDiff := cfg.ShowDifficulty && j.diff != nil
+	showBloom := cfg.ShowBloom && j.bloom != nil
+	if !showDiff && !showBloom && j.tags == nil {
+		return nil
+	}
+	labels := make([]string, len(j.items))
+	for k := range j.items {
+		var parts []string
+		if showDiff {
+			parts = append(parts, difficultyBadge(j.diff[k]))
+		}
+		if showBloom && j.bloom[k] != "" {
+			parts = append(parts, bloomBadge(j.bloom[k]))
+		}
+		if j.tags != nil {
+			parts = append(parts, tagLabel(j.tags[k]))
+		}
+		labels[k] = strings.Join(parts, " | ")
+	}
+	return labels
+}
+
+// conceptAnchor returns the ToC anchor of a concept line ("3. Foo Bar" ->
+// "3-foo-bar").
+func conceptAnchor(concept string) string {
+	return guide.ConceptAnchor(concept)
+}
+
+type chunk struct {
+	id      int
+	start   int
+	items   []string
+	model   string
+	diff    []int
+	tags    [][]string
+	bloom   []string
+	prereqs [][]int
+	part    string // heading written before the chunk when it opens a part
+}
+
+// conceptPlan is the concept list plus the optional per-concept data
+// gathered before answering, kept aligned through filtering and reordering.
+type conceptPlan struct {
+	concepts   []string
+	tags       [][]string
+	difficulty []int
+	bloom      []string
+	periods    []string // with --timeline
+	// prerequisites are concept numbers, found after the concepts are
+	// ordered and renumbered.
+	prerequisites [][]int
+}
+
+// apply keeps the concepts at idx, in that order.
+func (p *conceptPlan) apply(idx []int) {
+	p.concepts = pick(p.concepts, idx)
+	p.tags = pick(p.tags, idx)
+	p.difficulty = pick(p.difficulty, idx)
+	p.bloom = pick(p.bloom, idx)
+	p.periods = pick(p.periods, idx)
+}
+
+// planChunks splits concepts into chunks of at most cfg.ChunkSize. With
+// difficulty routing, a new chunk is started whenever the routing tier
+// changes so every chunk can be answered by a single model; with groups,
+// chunks never cross a part boundary.
+func planChunks(plan *conceptPlan, groups []conceptGroup) []chunk {
+	partAt := make(map[int]string, len(groups))
+	for g, grp := range groups {
+		partAt[grp.Start] = groupTitle(g, grp)
+	}
+
+	var chunks []chunk
+	for i, concept := range plan.concepts {
+		model := cfg.Model
+		if cfg.RouteByDiff && plan.difficulty[i] <= cfg.RouteThreshold {
+			model = cfg.CheapModel
+		}
+
+		n := len(chunks)
+		part, newPart := partAt[i]
+		if n == 0 || len(chunks[n-1].items) >= cfg.ChunkSize || chunks[n-1].model != model || newPart {
+			chunks = append(chunks, chunk{id: n, start: i, model: model, part: part})
+			n++
+		}
+		c := &chunks[n-1]
+		c.items = append(c.items, concept)
+		if plan.difficulty != nil {
+			c.diff = append(c.diff, plan.difficulty[i])
+		}
+		if plan.tags != nil {
+			c.tags = append(c.tags, plan.tags[i])
+		}
+		if plan.bloom != nil {
+			c.bloom = append(c.bloom, plan.bloom[i])
+		}
+		if plan.prerequisites != nil {
+			c.prereqs = append(c.prereqs, plan.prerequisites[i])
+		}
+	}
+	return chunks
+}
 
-	type job struct {
-		chunkID int
-		items   []string
+// chunkItems returns the concept numbers of j.
+func chunkItems(j chunk) []int {
+	items := make([]int, len(j.items))
+	for k := range items {
+		items[k] = j.start + k + 1
 	}
+	return items
+}
+
+// streamChunks reports whether chunks can be written as they finish: no
+// pass rewrites finished chunks, and the header doesn't depend on them.
+func streamChunks(prev *previousVersion) bool {
+	return lengths == nil && cfg.DedupContent != "rewrite" && !cfg.ReadabilityFix && !cfg.StudyTime && prev == nil &&
+		!(cfg.CheckLinks && cfg.BrokenLinks != "keep")
+}
 
-	jobs := make(chan job, numChunks)
+// processChunks answers the chunks and writes them to w in order. With
+// stream, each chunk is written as soon as the chunks before it are;
+// otherwise all of them are, after the passes over the whole guide.
+func processChunks(w io.Writer, chunks []chunk, book *practiceBook, ws *exerciseWorkspace, notes *footnotes, doc *jsonGuide, state *runState, stream bool) []SectionMeta {
+	numChunks := len(chunks)
+	results := make([]string, numChunks)
+	sections := make([]SectionMeta, numChunks)
+	// The chunks written to w as they were answered, with --stream.
+	streamed := make([]*liveChunk, numChunks)
+
+	jobs := make(chan chunk, numChunks)
 	var wg sync.WaitGroup
 	var resultMu sync.Mutex
+	done := 0
+
+	writeChunk := func(i int) {
+		content := results[i]
+		if chunks[i].part != "" && cfg.Format == "markdown" && streamed[i] == nil {
+			fmt.Fprintf(w, "## %s\n\n", chunks[i].part)
+		}
+		if content != "" {
+			if notes != nil {
+				content = notes.convert(chunks[i], content)
+			}
+			if book != nil {
+				content, sections[i].Problems = book.render(chunks[i], content)
+			}
+			if cfg.StudyTime && !sections[i].Failed {
+				content, sections[i].StudyMinutes = studyTimes(chunks[i], content, sections[i].Problems)
+			}
+			if cfg.SectionHook != "" && !sections[i].Failed {
+				content = applySectionHook(chunks[i], content)
+			}
+			if cfg.Format == "anki" {
+				writeAnkiCards(w, chunks[i], content)
+				return
+			}
+			if doc != nil {
+				doc.add(chunks[i], content, sections[i].Failed)
+				return
+			}
+			if cfg.Depth > 1 {
+				content = subtopicHeadings(content)
+			}
+			if streamed[i] != nil {
+				content = streamed[i].rest(content, sections[i].Failed)
+			}
+			fmt.Fprintln(w, content)
+			fmt.Fprintln(w, "\n---")
+		}
+	}
+	// When streaming, next is the first chunk not written yet. Unless a
+	// report pass reads them afterwards, written chunks are dropped.
+	next := 0
+	finished := make([]bool, numChunks)
+	keep := cfg.DedupContent != "off" || cfg.Readability || cfg.CheckLinks
+	flush := func() {
+		for ; stream && next < numChunks && finished[next]; next++ {
+			writeChunk(next)
+			if !keep {
+				results[next] = ""
+			}
+		}
+	}
+
+	// Chunks a resumed run already answered are taken as they were saved.
+	var pending []chunk
+	for _, c := range chunks {
+		saved, ok := state.completed(c)
+		if !ok {
+			pending = append(pending, c)
+			continue
+		}
+		results[c.id], sections[c.id] = saved.Content, saved.Section
+		sections[c.id].Chunk = c.id + 1
+		if lengths != nil && ws == nil {
+			lengths.finish(lengths.reserve(c), saved.Section.Words)
+		}
+		finished[c.id] = true
+		done++
+	}
+	flush()
+	if done > 0 {
+		statusf("-> Reusing %d of %d chunk(s) from %s\n", done, numChunks, state.path)
+	}
+	startProgress(numChunks, done)
 
 	for i := 0; i < cfg.Threads; i++ {
 		wg.Add(1)
 		go func(workerID int) {
 			defer wg.Done()
 			for j := range jobs {
-				startIdx := j.chunkID * cfg.ChunkSize
+				// After Ctrl-C or once the budget is spent, the remaining
+				// jobs are drained unanswered.
+				if runCtx.Err() != nil || budgetSpent() {
+					continue
+				}
+				metrics.workerActive(1)
+				chunkStart := time.Now()
+				startIdx := j.start
 				endIdx := startIdx + len(j.items)
 
-				if !cfg.Stdout {
-					fmt.Printf("   [Worker %d] Processing chunk %d (Items %d-%d)...\n", workerID, j.chunkID+1, startIdx+1, endIdx)
+				verbosef("   [Worker %d] Processing chunk %d (Items %d-%d)...\n", workerID, j.id+1, startIdx+1, endIdx)
+
+				prompt := chunkRequest(j.items)
+				if cfg.Depth > 1 && j.part != "" {
+					prompt += chapterContext(j.part)
+				}
+				var targets []int
+				if lengths != nil && ws == nil {
+					targets = lengths.reserve(j)
+					prompt += lengthInstruction(j.items, targets)
+				}
+
+				var live *liveChunk
+				if cfg.Stream {
+					// The chunks before this one are written, so its
+					// answer can follow them as it arrives.
+					if j.part != "" {
+						fmt.Fprintf(w, "## %s\n\n", j.part)
+					}
+					live = newLiveChunk(w, j)
+				}
+
+				var content string
+				var judge []JudgeChoice
+				var missing []int
+				var err error
+				if ws != nil {
+					content, err = ws.build(j)
+				} else {
+					content, judge, missing, err = answerChunk(j, prompt, live)
+				}
+				failed := err != nil
+				var refusal *refusalError
+				switch {
+				case runCtx.Err() != nil, errors.Is(err, ErrBudgetExceeded):
+					// Interrupted or out of budget: the chunk is left out,
+					// not reported.
+				case errors.As(err, &refusal):
+					fmt.Fprintf(os.Stderr, "Chunk %d (concepts %d-%d) refused after retry: %s\n", j.id+1, startIdx+1, endIdx, refusal.Text)
+					content = fmt.Sprintf("## Section %d-%d not generated\n\n> The model declined to answer: %s", startIdx+1, endIdx, refusal.Text)
+				case err != nil:
+					fmt.Fprintf(os.Stderr, "Error processing chunk %d (concepts %d-%d): %v\n", j.id+1, startIdx+1, endIdx, err)
+					content = missingSections(j.items)
+				}
+
+				if ws != nil {
+					content = cleanChunkContent(content)
+				}
+				if !failed && ws == nil {
+					var lost []string
+					if content, lost = guide.CanonicalHeadings(content, j.items); lost != nil {
+						fmt.Fprintf(os.Stderr, "Warning: chunk %d has no heading for concept(s) %s; their Table of Contents links lead nowhere.\n", j.id+1, strings.Join(chunkNumbers(lost), ", "))
+					}
+				}
+				var codeChecks []CodeCheck
+				if cfg.VerifyCode && !failed {
+					content, codeChecks = verifyCode(j, content)
+				}
+				var tables *TableStats
+				if cfg.Tables && !failed {
+					content, tables = ensureTables(j, content)
+				}
+				var misconceptions [][]string
+				if cfg.Misconceptions && !failed {
+					content, misconceptions = ensureMisconceptions(j, content)
+				}
+				var alts []bool
+				if cfg.AltExplanations && !failed {
+					content, alts = ensureAltExplanations(j, content)
+				}
+				var analogies []bool
+				if cfg.AnalogyDomain != "" && !failed {
+					content, analogies = styleAnalogies(j, content)
+				}
+				var mnemonics []string
+				if cfg.Mnemonics && !failed {
+					mnemonics = mnemonicsFor(j)
+					content = appendToSections(content, j.items, mnemonicBlocks(j.items, mnemonics))
+				}
+				if labels := conceptLabels(j); labels != nil && !failed {
+					content = labelSections(content, j.items, labels)
+				}
+				var questions [][]string
+				if cfg.Mode == "socratic" && !failed {
+					content, questions = hideAnswers(j, content)
+				}
+
+				var deviations []TermDeviation
+				if terminology != nil && !failed {
+					deviations = checkTerminology(j, content)
+				}
+				var words []int
+				if targets != nil {
+					if !failed {
+						words = sectionWords(j, content)
+					}
+					lengths.finish(targets, words)
 				}
 
-				chunkText := strings.Join(j.items, "\n")
-				prompt := fmt.Sprintf(
-					"Here is a list of concepts/questions:\n%s\n\n"+
-						"Provide a detailed, numbered explanation for EACH one based on the system prompt instructions. "+
-						"Maintain the original numbering exactly.",
-					chunkText,
-				)
-
-				content, err := callAI(prompt, cfg.SystemPrompt)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error processing chunk %d: %v\n", j.chunkID, err)
-					content = fmt.Sprintf("## Error generating section %d-%d\n\nAPI Error: %v", startIdx+1, endIdx, err)
+				if book != nil && !failed {
+					book.generate(j)
 				}
 
-				content = strings.TrimSpace(content)
-				content = strings.TrimPrefix(content, "```markdown")
-				content = strings.TrimPrefix(content, "```")
-				content = strings.TrimSuffix(content, "```")
+				items := chunkItems(j)
+				// A chunk still being finished when Ctrl-C came is left out
+				// whole rather than written with parts missing.
+				if runCtx.Err() != nil || errors.Is(err, ErrBudgetExceeded) {
+					metrics.workerActive(-1)
+					continue
+				}
 
 				resultMu.Lock()
-				results[j.chunkID] = content
+				results[j.id] = content
+				streamed[j.id] = live
+				sections[j.id] = SectionMeta{Chunk: j.id + 1, Items: items, Model: j.model, Difficulty: j.diff, Tags: j.tags, Bloom: j.bloom, Prerequisites: j.prereqs, Misconceptions: misconceptions, AltExplanations: alts, Analogies: analogies, GuidingQuestions: questions, Mnemonics: mnemonics, CodeChecks: codeChecks, Tables: tables, Judge: judge, Words: words, TermDeviations: deviations, Missing: missing, Failed: failed, err: err}
+				if words != nil {
+					sections[j.id].TargetWords = targets
+				}
+				finished[j.id] = true
+				done++
+				emitEvent(progressEvent{Event: "progress", Done: done, Total: numChunks})
+				progress.chunkDone(failed)
+				flush()
 				resultMu.Unlock()
+				if !failed {
+					state.record(j, content, sections[j.id])
+				}
+				metrics.chunkDone(time.Since(chunkStart), failed)
+				if !failed {
+					addChunkTiming(time.Since(chunkStart))
+				}
+				metrics.workerActive(-1)
 			}
 		}(i)
 	}
 
-	for i := 0; i < numChunks; i++ {
-		start := i * cfg.ChunkSize
-		end := start + cfg.ChunkSize
-		if end > total {
-			end = total
-		}
-		jobs <- job{
-			chunkID: i,
-			items:   concepts[start:end],
-		}
+	for _, c := range pending {
+		jobs <- c
 	}
 	close(jobs)
 
 	wg.Wait()
+	progress.finish()
 
-	for _, content := range results {
-		if content != "" {
-			fmt.Fprintln(w, content)
-			fmt.Fprintln(w, "\n---")
+	// Chunks Ctrl-C or the budget stopped are recorded as failed and not
+	// written; the passes over the whole guide are skipped.
+	stopErr := error(ErrInterrupted)
+	if runCtx.Err() == nil {
+		stopErr = checkBudget()
+	}
+	interrupted := -1
+	for i, ok := range finished {
+		if !ok {
+			sections[i] = SectionMeta{Chunk: i + 1, Items: chunkItems(chunks[i]), Model: chunks[i].model, Failed: true, err: stopErr}
+			if interrupted < 0 {
+				interrupted = i
+			}
 		}
 	}
-}
-
-func callAI(userPrompt, sysPrompt string) (string, error) {
-	reqBody := CompletionRequest{
-		Model: cfg.Model,
-		Messages: []Message{
-			{Role: "system", Content: sysPrompt},
-			{Role: "user", Content: userPrompt},
-		},
-		Temperature: 0.7,
+	if interrupted >= 0 {
+		for ; next < numChunks; next++ {
+			if finished[next] {
+				writeChunk(next)
+			}
+		}
+		note := fmt.Sprintf("Generation interrupted at chunk %d of %d.", interrupted+1, numChunks)
+		if runCtx.Err() == nil {
+			note = fmt.Sprintf("Generation stopped at chunk %d of %d: %v.", interrupted+1, numChunks, stopErr)
+		}
+		if cfg.Format != "markdown" {
+			fmt.Fprintln(os.Stderr, note)
+		} else {
+			fmt.Fprintf(w, "> %s\n\n---\n", note)
+		}
+		return sections
 	}
 
-	jsonBody, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", err
+	if lengths != nil {
+		fitLengths(chunks, results, sections)
+	}
+	if cfg.DedupContent != "off" {
+		for i, dups := range dedupContent(chunks, results) {
+			sections[i].Duplicates = dups
+		}
+	}
+	if cfg.Readability {
+		for i, scores := range scoreSections(chunks, results) {
+			sections[i].Readability = scores
+		}
+	}
+	if cfg.CheckLinks {
+		for i, links := range checkLinks(results) {
+			sections[i].Links = links
+		}
 	}
 
-	client := &http.Client{Timeout: 120 * time.Second}
-	req, err := http.NewRequest("POST", cfg.BaseURL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return "", err
+	if !stream {
+		for i := range results {
+			writeChunk(i)
+		}
 	}
+	return sections
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+cfg.Token)
+// answerChunk generates one chunk's content. A refusal is retried once with a
+// softened prompt before it is returned to the caller, and headings the model
+// renumbered are put back on the requested concept numbers.
+func answerChunk(j chunk, prompt string, live *liveChunk) (string, []JudgeChoice, []int, error) {
+	generate := func(prompt string, stream func(string)) (string, []JudgeChoice, error) {
+		if cfg.BestOf > 1 {
+			content, judge, err := bestOfChunk(j, prompt)
+			var refusal *refusalError
+			if errors.As(err, &refusal) {
+				retryf("   Chunk %d was refused, retrying with a softened prompt...\n", j.id+1)
+				content, judge, err = bestOfChunk(j, prompt+guide.SoftenedPromptSuffix)
+			}
+			return content, judge, err
+		}
+		content, _, err := gen.AnswerChunk(runCtx, guide.Chunk{Concepts: j.items, Prompt: prompt, System: cfg.SystemPrompt,
+			Model: j.model, Label: fmt.Sprintf("Chunk %d", j.id+1), Stream: stream})
+		return content, nil, interrupted(err)
+	}
 
-	resp, err := client.Do(req)
+	var stream func(string)
+	if live != nil {
+		stream = live.delta
+	}
+	content, judge, err := generate(prompt, stream)
 	if err != nil {
-		return "", err
+		return content, judge, nil, err
 	}
-	defer resp.Body.Close()
-
-	bodyBytes, _ := io.ReadAll(resp.Body)
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API error: %s - %s", resp.Status, string(bodyBytes))
+	if cfg.BestOf <= 1 {
+		// Answers asked for again to fix the numbering aren't shown.
+		content = fixNumbering(j, prompt, content, func(prompt string) (string, error) {
+			content, _, err := generate(prompt, nil)
+			return content, err
+		})
 	}
-
-	var completion CompletionResponse
-	if err := json.Unmarshal(bodyBytes, &completion); err != nil {
-		return "", err
+	var missing []int
+	if !cfg.NoVerify {
+		content, missing = completeChunk(j, content, live != nil)
 	}
+	return content, judge, missing, nil
+}
 
-	if completion.Error != nil {
-		return "", fmt.Errorf("API returned error: %s", completion.Error.Message)
+// chunkRequest is the request for the concepts items: the mode's chunk
+// prompt and what the per-section options ask of each answer.
+func chunkRequest(items []string) string {
+	prompt := currentMode().chunkPrompt(strings.Join(items, "\n"))
+	if cfg.Misconceptions {
+		prompt += misconceptionsInstruction
 	}
-
-	if len(completion.Choices) == 0 {
-		return "", fmt.Errorf("no choices returned")
+	if cfg.Tables {
+		prompt += tablesInstruction(items)
+	}
+	if cfg.AltExplanations && cfg.AltModel == "" {
+		prompt += altInstruction
 	}
+	if cfg.AnalogyDomain != "" {
+		prompt += analogyInstruction(cfg.AnalogyDomain)
+	}
+	return prompt
+}
 
-	return completion.Choices[0].Message.Content, nil
+// cleanChunkContent strips the markdown fences models like to wrap answers in.
+func cleanChunkContent(content string) string {
+	return guide.CleanContent(content)
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/yuriiter/aiguide/pkg/guide"
+)
+
+var tocLinkRe = regexp.MustCompile(`\]\(#([^)]+)\)`)
+
+// TestToCAnchorsMatchHeadings checks that every Table of Contents link
+// lands on a heading once guide.CanonicalHeadings has rewritten the
+// model's, for titles with punctuation, emoji, other scripts and repeats.
+func TestToCAnchorsMatchHeadings(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.Subject, cfg.Mode, cfg.Lang = "Go", "guide", "en"
+
+	concepts := []string{"1. Горутины и каналы", "2. What's `select`?", "3. Channels", "4. Channels", "5. Launch 🚀"}
+	answers := []struct {
+		items   []string
+		content string
+	}{
+		{concepts[:3], "### 1) горутины и каналы\n\nA.\n\n# **Concept 2: select**\n\nB.\n\n## Question 3 — channels\n\nC."},
+		{concepts[3:], "Buffered ones.\n\n#### 5. Launch\n\nE."},
+	}
+	var doc strings.Builder
+	writeHeaderAndToC(&doc, concepts, nil, nil, 0)
+	header := doc.String()
+	for _, a := range answers {
+		content, _ := guide.CanonicalHeadings(a.content, a.items)
+		doc.WriteString(content + "\n\n---\n\n")
+	}
+
+	slugs := guide.Slugger{}
+	anchors := map[string]bool{}
+	for _, line := range strings.Split(doc.String(), "\n") {
+		if text, ok := strings.CutPrefix(strings.TrimLeft(line, "#"), " "); ok && strings.HasPrefix(line, "#") {
+			anchors[slugs.Unique(mdAnchor(text))] = true
+		}
+	}
+	links := tocLinkRe.FindAllStringSubmatch(header, -1)
+	if len(links) != len(concepts) {
+		t.Fatalf("%d ToC links for %d concepts:\n%s", len(links), len(concepts), header)
+	}
+	for i, m := range links {
+		if m[1] != guide.ConceptAnchor(concepts[i]) {
+			t.Errorf("ToC entry %d links to %q, want %q", i+1, m[1], guide.ConceptAnchor(concepts[i]))
+		}
+		if !anchors[m[1]] {
+			t.Errorf("ToC link #%s has no heading; the headings give %v", m[1], anchors)
+		}
+	}
+}
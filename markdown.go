@@ -0,0 +1,256 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/yuriiter/aiguide/pkg/guide"
+)
+
+// mdBlock is one block-level element of a guide. The parser only understands
+// the subset of markdown that models actually emit in guides; exporters map
+// these blocks onto their own document models.
+type mdBlock struct {
+	Kind  string // heading, paragraph, bullet, numbered, code, quote, rule, table, html
+	Level int    // heading level, or list nesting depth starting at 0
+	Text  string
+	Lang  string     // code blocks
+	Rows  [][]string // tables, header row first
+}
+
+var (
+	mdHeadingRe  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdRuleRe     = regexp.MustCompile(`^\s*(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	mdBulletRe   = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdNumberedRe = regexp.MustCompile(`^(\s*)\d+[.)]\s+(.*)$`)
+	mdFenceRe    = regexp.MustCompile("^\\s*(```+|~~~+)\\s*([\\w+#.-]*)")
+	mdTableSepRe = regexp.MustCompile(`^\s*\|?\s*:?-{2,}:?\s*(\|\s*:?-{2,}:?\s*)*\|?\s*$`)
+)
+
+func parseMarkdown(src string) []mdBlock {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	var blocks []mdBlock
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed == "" {
+			continue
+		}
+
+		if m := mdFenceRe.FindStringSubmatch(line); m != nil {
+			fence := m[1]
+			var body []string
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), fence[:3]) {
+					break
+				}
+				body = append(body, lines[i])
+			}
+			blocks = append(blocks, mdBlock{Kind: "code", Lang: strings.ToLower(m[2]), Text: strings.Join(body, "\n")})
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "<!--") {
+			var body []string
+			for ; i < len(lines); i++ {
+				body = append(body, lines[i])
+				if strings.Contains(lines[i], "-->") {
+					break
+				}
+			}
+			blocks = append(blocks, mdBlock{Kind: "html", Text: strings.Join(body, "\n")})
+			continue
+		}
+
+		if m := mdHeadingRe.FindStringSubmatch(line); m != nil {
+			blocks = append(blocks, mdBlock{Kind: "heading", Level: len(m[1]), Text: m[2]})
+			continue
+		}
+
+		if mdRuleRe.MatchString(line) {
+			blocks = append(blocks, mdBlock{Kind: "rule"})
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "|") && i+1 < len(lines) && mdTableSepRe.MatchString(lines[i+1]) {
+			rows := [][]string{splitTableRow(trimmed)}
+			for i += 2; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				rows = append(rows, splitTableRow(strings.TrimSpace(lines[i])))
+			}
+			i--
+			blocks = append(blocks, mdBlock{Kind: "table", Rows: rows})
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, ">") {
+			var body []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				body = append(body, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")))
+			}
+			i--
+			blocks = append(blocks, mdBlock{Kind: "quote", Text: strings.Join(body, "\n")})
+			continue
+		}
+
+		if kind, depth, text, ok := listItem(line); ok {
+			// Indented lines that aren't new items continue the current one.
+			for i+1 < len(lines) {
+				next := lines[i+1]
+				if strings.TrimSpace(next) == "" || !strings.HasPrefix(next, "  ") {
+					break
+				}
+				if _, _, _, isItem := listItem(next); isItem {
+					break
+				}
+				text += " " + strings.TrimSpace(next)
+				i++
+			}
+			blocks = append(blocks, mdBlock{Kind: kind, Level: depth, Text: text})
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "<") && strings.HasSuffix(trimmed, ">") {
+			blocks = append(blocks, mdBlock{Kind: "html", Text: trimmed})
+			continue
+		}
+
+		para := []string{trimmed}
+		for i+1 < len(lines) && startsParagraphContinuation(lines[i+1]) {
+			i++
+			para = append(para, strings.TrimSpace(lines[i]))
+		}
+		blocks = append(blocks, mdBlock{Kind: "paragraph", Text: strings.Join(para, " ")})
+	}
+	return blocks
+}
+
+func listItem(line string) (kind string, depth int, text string, ok bool) {
+	if m := mdBulletRe.FindStringSubmatch(line); m != nil && !mdRuleRe.MatchString(line) {
+		return "bullet", indentDepth(m[1]), m[2], true
+	}
+	if m := mdNumberedRe.FindStringSubmatch(line); m != nil {
+		return "numbered", indentDepth(m[1]), m[2], true
+	}
+	return "", 0, "", false
+}
+
+func indentDepth(indent string) int {
+	indent = strings.ReplaceAll(indent, "\t", "    ")
+	return len(indent) / 2
+}
+
+func startsParagraphContinuation(line string) bool {
+	t := strings.TrimSpace(line)
+	if t == "" || strings.HasPrefix(t, ">") || strings.HasPrefix(t, "|") || strings.HasPrefix(t, "<!--") {
+		return false
+	}
+	if mdHeadingRe.MatchString(line) || mdRuleRe.MatchString(line) || mdFenceRe.MatchString(line) {
+		return false
+	}
+	_, _, _, isItem := listItem(line)
+	return !isItem
+}
+
+func splitTableRow(line string) []string {
+	line = strings.TrimPrefix(strings.TrimSuffix(line, "|"), "|")
+	cells := strings.Split(line, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// mdSpan is a run of inline text with uniform formatting.
+type mdSpan struct {
+	Text   string
+	Bold   bool
+	Italic bool
+	Code   bool
+	Link   string
+}
+
+var mdLinkRe = regexp.MustCompile(`^!?\[([^\]]*)\]\(([^)\s]+)(?:\s+"[^"]*")?\)`)
+
+// parseInline splits text into spans for **bold**, *italic*/_italic_,
+// `code` and [links](url). Images are returned as links; unbalanced markers
+// are kept as literal text.
+func parseInline(text string) []mdSpan {
+	var spans []mdSpan
+	var buf strings.Builder
+	bold, italic := false, false
+
+	flush := func() {
+		if buf.Len() > 0 {
+			spans = append(spans, mdSpan{Text: buf.String(), Bold: bold, Italic: italic})
+			buf.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		switch {
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end >= 0 {
+				flush()
+				spans = append(spans, mdSpan{Text: rest[1 : end+1], Code: true, Bold: bold, Italic: italic})
+				i += end + 2
+				continue
+			}
+		case rest[0] == '[' || strings.HasPrefix(rest, "!["):
+			if m := mdLinkRe.FindStringSubmatch(rest); m != nil {
+				flush()
+				spans = append(spans, mdSpan{Text: m[1], Link: m[2], Bold: bold, Italic: italic})
+				i += len(m[0])
+				continue
+			}
+		case strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "__"):
+			if bold || strings.Contains(rest[2:], rest[:2]) {
+				flush()
+				bold = !bold
+				i += 2
+				continue
+			}
+		case rest[0] == '*' || (rest[0] == '_' && underscoreDelimits(text, i, italic)):
+			if italic || strings.ContainsRune(rest[1:], rune(rest[0])) {
+				flush()
+				italic = !italic
+				i++
+				continue
+			}
+		}
+		buf.WriteByte(text[i])
+		i++
+	}
+	flush()
+	return spans
+}
+
+// underscoreDelimits reports whether the _ at i opens or closes emphasis
+// rather than sitting inside a word like snake_case.
+func underscoreDelimits(text string, i int, closing bool) bool {
+	if closing {
+		return i+1 == len(text) || !isWordByte(text[i+1])
+	}
+	return i == 0 || !isWordByte(text[i-1])
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// plainInline drops inline markup and returns just the text.
+func plainInline(text string) string {
+	var b strings.Builder
+	for _, s := range parseInline(text) {
+		b.WriteString(s.Text)
+	}
+	return b.String()
+}
+
+// mdAnchor returns the GitHub-style anchor for a heading, which is what the
+// guide's Table of Contents links to.
+func mdAnchor(heading string) string {
+	return guide.Slug(plainInline(heading))
+}
@@ -0,0 +1,634 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// progressEvent is one machine-readable line written with --progress-events.
+// The MCP server runs every tool call as a child aiguide process and reads
+// these to report progress and find the results.
+type progressEvent struct {
+	Event             string   `json:"event"` // progress, output, outline, section, request or usage
+	Done              int      `json:"done,omitempty"`
+	Total             int      `json:"total,omitempty"`
+	Path              string   `json:"path,omitempty"`
+	Concepts          []string `json:"concepts,omitempty"`
+	Text              string   `json:"text,omitempty"`
+	PromptTokens      int      `json:"prompt_tokens,omitempty"`
+	CompletionTokens  int      `json:"completion_tokens,omitempty"`
+	Cost              *float64 `json:"cost_usd,omitempty"` // nil when a model has no known price
+	RunID             string   `json:"run_id,omitempty"`
+	RequestID         string   `json:"request_id,omitempty"`
+	UpstreamRequestID string   `json:"upstream_request_id,omitempty"`
+	HTTPStatus        int      `json:"http_status,omitempty"`
+	Error             string   `json:"error,omitempty"`
+}
+
+const progressEventPrefix = "@aiguide-event "
+
+func emitEvent(e progressEvent) {
+	if !cfg.ProgressEvents {
+		return
+	}
+	e.RunID = runID
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	fmt.Printf("%s%s\n", progressEventPrefix, b)
+}
+
+// emitUsage reports the tokens and cost of the process, once it is done.
+func emitUsage() {
+	sum, cost, priced := usage.totals()
+	e := progressEvent{Event: "usage", PromptTokens: sum.PromptTokens, CompletionTokens: sum.CompletionTokens}
+	if priced {
+		e.Cost = &cost
+	}
+	emitEvent(e)
+}
+
+// mcpProtocolVersions are the MCP revisions the server speaks, newest first.
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// mcpInlineLimit is the largest guide returned inline by generate_guide;
+// bigger ones are returned as a file path.
+const mcpInlineLimit = 64 << 10
+
+// mcpLogLevels are the syslog levels of MCP logging, least severe first.
+var mcpLogLevels = []string{"debug", "info", "notice", "warning", "error", "critical", "alert", "emergency"}
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+var mcpTools = []mcpTool{
+	{
+		Name:        "generate_outline",
+		Description: "List the concepts aiguide would cover for a subject, without writing the guide.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"subject": map[string]any{"type": "string", "description": "Subject of the guide"},
+				"n":       map[string]any{"type": "integer", "minimum": 1, "description": "Number of concepts (default 10)"},
+			},
+			"required": []string{"subject"},
+		},
+	},
+	{
+		Name: "generate_guide",
+		Description: "Generate a study guide and return its markdown. Guides over " + strconv.Itoa(mcpInlineLimit>>10) +
+			" KB are returned as the path of the written file instead.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"subject": map[string]any{"type": "string", "description": "Subject of the guide"},
+				"options": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"n":          map[string]any{"type": "integer", "minimum": 1, "description": "Number of concepts (default 10)"},
+						"model":      map[string]any{"type": "string", "description": "Model to use"},
+						"mode":       map[string]any{"enum": []string{"guide", "interview", "exercises", "socratic"}},
+						"info":       map[string]any{"type": "string", "description": "Additional instructions for the model"},
+						"chunk":      map[string]any{"type": "integer", "minimum": 1, "description": "Concepts per API call"},
+						"threads":    map[string]any{"type": "integer", "minimum": 1, "description": "Concurrent API calls"},
+						"output_dir": map[string]any{"type": "string", "description": "Directory the guide is written to (default the server's working directory)"},
+						"flags":      map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Any other aiguide command-line flags, e.g. [\"--tables\", \"--practice\", \"2\"]"},
+					},
+				},
+			},
+			"required": []string{"subject"},
+		},
+	},
+	{
+		Name:        "expand_section",
+		Description: "Rewrite concept n of an existing guide in more depth, in place, and return the new section.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"path": map[string]any{"type": "string", "description": "Path of the guide's markdown file"},
+				"n":    map[string]any{"type": "integer", "minimum": 1, "description": "Number of the concept to expand"},
+			},
+			"required": []string{"path", "n"},
+		},
+	},
+}
+
+// mcpServer speaks MCP over stdio. Tool calls run concurrently, each in its
+// own child process, and are cancelled through their context.
+type mcpServer struct {
+	out      io.Writer
+	outMu    sync.Mutex
+	provider string
+	model    string
+
+	mu       sync.Mutex
+	calls    map[string]context.CancelFunc
+	logLevel int
+
+	metricsListen string
+	metrics       *promMetrics // nil without --metrics-listen
+}
+
+func (s *mcpServer) send(msg any) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding MCP message: %v\n", err)
+		return
+	}
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	s.out.Write(append(b, '\n'))
+}
+
+func (s *mcpServer) reply(id json.RawMessage, result any) {
+	s.send(map[string]any{"jsonrpc": "2.0", "id": id, "result": result})
+}
+
+func (s *mcpServer) replyError(id json.RawMessage, code int, message string) {
+	s.send(map[string]any{"jsonrpc": "2.0", "id": id, "error": rpcError{Code: code, Message: message}})
+}
+
+func (s *mcpServer) notify(method string, params any) {
+	s.send(map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// log forwards a line of child output as an MCP log message. Lines the
+// client asked not to see still reach the server's stderr.
+func (s *mcpServer) log(level, line string) {
+	fmt.Fprintln(os.Stderr, line)
+	s.mu.Lock()
+	min := s.logLevel
+	s.mu.Unlock()
+	if slices.Index(mcpLogLevels, level) >= min {
+		s.notify("notifications/message", map[string]any{"level": level, "logger": "aiguide", "data": line})
+	}
+}
+
+func (s *mcpServer) serve(in io.Reader) error {
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	var wg sync.WaitGroup
+	for sc.Scan() {
+		var msg rpcMessage
+		if err := json.Unmarshal(sc.Bytes(), &msg); err != nil {
+			s.replyError(json.RawMessage("null"), -32700, "parse error: "+err.Error())
+			continue
+		}
+		if msg.Method == "" {
+			continue // a response; the server sends no requests
+		}
+		if msg.ID == nil {
+			s.handleNotification(msg)
+			continue
+		}
+		if msg.Method == "tools/call" {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.callTool(msg)
+			}()
+			continue
+		}
+		s.handleRequest(msg)
+	}
+	// stdin closed: the client is gone, so stop whatever is still running.
+	s.mu.Lock()
+	for _, cancel := range s.calls {
+		cancel()
+	}
+	s.mu.Unlock()
+	wg.Wait()
+	return sc.Err()
+}
+
+func (s *mcpServer) handleRequest(msg rpcMessage) {
+	switch msg.Method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(msg.Params, &p)
+		v := mcpProtocolVersions[0]
+		if slices.Contains(mcpProtocolVersions, p.ProtocolVersion) {
+			v = p.ProtocolVersion
+		}
+		s.reply(msg.ID, map[string]any{
+			"protocolVersion": v,
+			"capabilities":    map[string]any{"tools": map[string]any{}, "logging": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "aiguide", "version": version},
+		})
+	case "ping":
+		s.reply(msg.ID, map[string]any{})
+	case "tools/list":
+		s.reply(msg.ID, map[string]any{"tools": mcpTools})
+	case "logging/setLevel":
+		var p struct {
+			Level string `json:"level"`
+		}
+		json.Unmarshal(msg.Params, &p)
+		i := slices.Index(mcpLogLevels, p.Level)
+		if i < 0 {
+			s.replyError(msg.ID, -32602, fmt.Sprintf("unknown log level %q", p.Level))
+			return
+		}
+		s.mu.Lock()
+		s.logLevel = i
+		s.mu.Unlock()
+		s.reply(msg.ID, map[string]any{})
+	default:
+		s.replyError(msg.ID, -32601, "method not found: "+msg.Method)
+	}
+}
+
+func (s *mcpServer) handleNotification(msg rpcMessage) {
+	if msg.Method != "notifications/cancelled" {
+		return
+	}
+	var p struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	json.Unmarshal(msg.Params, &p)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, ok := s.calls[string(p.RequestID)]; ok {
+		cancel()
+	}
+}
+
+func (s *mcpServer) callTool(msg rpcMessage) {
+	var p struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+		Meta      struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(msg.Params, &p); err != nil {
+		s.replyError(msg.ID, -32602, "invalid params: "+err.Error())
+		return
+	}
+	if !slices.ContainsFunc(mcpTools, func(t mcpTool) bool { return t.Name == p.Name }) {
+		s.replyError(msg.ID, -32602, "unknown tool: "+p.Name)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	key := string(msg.ID)
+	s.mu.Lock()
+	s.calls[key] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.calls, key)
+		s.mu.Unlock()
+		cancel()
+	}()
+
+	if s.metrics != nil {
+		s.metrics.jobStarted(p.Name)
+	}
+	started := time.Now()
+	text, err := s.runTool(ctx, p.Name, p.Arguments, p.Meta.ProgressToken)
+	if s.metrics != nil {
+		outcome := "ok"
+		switch {
+		case ctx.Err() != nil:
+			outcome = "cancelled"
+		case err != nil:
+			outcome = "error"
+		}
+		s.metrics.jobFinished(p.Name, outcome, time.Since(started))
+	}
+	if ctx.Err() != nil {
+		return // cancelled: the client expects no response
+	}
+	if err != nil {
+		s.reply(msg.ID, mcpToolResult{Content: []mcpContent{{Type: "text", Text: err.Error()}}, IsError: true})
+		return
+	}
+	content := make([]mcpContent, len(text))
+	for i, t := range text {
+		content[i] = mcpContent{Type: "text", Text: t}
+	}
+	s.reply(msg.ID, mcpToolResult{Content: content})
+}
+
+func (s *mcpServer) runTool(ctx context.Context, name string, raw json.RawMessage, token json.RawMessage) ([]string, error) {
+	var args struct {
+		Subject string `json:"subject"`
+		N       int    `json:"n"`
+		Path    string `json:"path"`
+		Options struct {
+			N         int      `json:"n"`
+			Model     string   `json:"model"`
+			Mode      string   `json:"mode"`
+			Info      string   `json:"info"`
+			Chunk     int      `json:"chunk"`
+			Threads   int      `json:"threads"`
+			OutputDir string   `json:"output_dir"`
+			Flags     []string `json:"flags"`
+		} `json:"options"`
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+
+	switch name {
+	case "generate_outline":
+		if args.Subject == "" {
+			return nil, errors.New("subject is required")
+		}
+		argv := s.childArgs(args.Subject, "-n", strconv.Itoa(orDefault(args.N, 10)), "--outline-only")
+		events, err := s.runChild(ctx, name, "", token, argv)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range events {
+			if e.Event == "outline" {
+				return []string{strings.Join(e.Concepts, "\n")}, nil
+			}
+		}
+		return nil, errors.New("aiguide returned no outline")
+
+	case "generate_guide":
+		if args.Subject == "" {
+			return nil, errors.New("subject is required")
+		}
+		o := args.Options
+		for _, f := range o.Flags {
+			if f == "--stdout" || f == "-o" || strings.HasPrefix(f, "--progress-events") {
+				return nil, fmt.Errorf("flag %s cannot be used through MCP", f)
+			}
+		}
+		extra := []string{"-n", strconv.Itoa(orDefault(o.N, 10))}
+		if o.Model != "" {
+			extra = append(extra, "--model", o.Model)
+		}
+		if o.Mode != "" {
+			extra = append(extra, "--mode", o.Mode)
+		}
+		if o.Info != "" {
+			extra = append(extra, "--info", o.Info)
+		}
+		if o.Chunk > 0 {
+			extra = append(extra, "--chunk", strconv.Itoa(o.Chunk))
+		}
+		if o.Threads > 0 {
+			extra = append(extra, "--threads", strconv.Itoa(o.Threads))
+		}
+		argv := s.childArgs(args.Subject, append(extra, o.Flags...)...)
+		events, err := s.runChild(ctx, name, o.OutputDir, token, argv)
+		if err != nil {
+			return nil, err
+		}
+		var path string
+		for _, e := range events {
+			if e.Event == "output" {
+				path = e.Path
+			}
+		}
+		if path == "" {
+			return nil, errors.New("aiguide reported no output file")
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(o.OutputDir, path)
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > mcpInlineLimit {
+			return []string{fmt.Sprintf("The guide is %d KB, too large to return inline. It was written to %s", len(b)>>10, path)}, nil
+		}
+		return []string{string(b), "Written to " + path}, nil
+
+	case "expand_section":
+		if args.Path == "" || args.N < 1 {
+			return nil, errors.New("path and a concept number n of at least 1 are required")
+		}
+		argv := []string{"expand", args.Path, strconv.Itoa(args.N), "--progress-events"}
+		argv = append(argv, s.commonArgs()...)
+		events, err := s.runChild(ctx, name, "", token, argv)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range events {
+			if e.Event == "section" {
+				return []string{e.Text}, nil
+			}
+		}
+		return nil, errors.New("aiguide returned no section")
+	}
+	return nil, fmt.Errorf("unknown tool %q", name)
+}
+
+func orDefault(n, def int) int {
+	if n > 0 {
+		return n
+	}
+	return def
+}
+
+// commonArgs passes the server's own --config, --provider and --model on to
+// child processes.
+func (s *mcpServer) commonArgs() []string {
+	var argv []string
+	if configPath != "" {
+		argv = append(argv, "--config", configPath)
+	}
+	if s.provider != "" {
+		argv = append(argv, "--provider", s.provider)
+	}
+	if s.model != "" {
+		argv = append(argv, "--model", s.model)
+	}
+	return argv
+}
+
+// childArgs builds a generation command line. Later flags win, so options
+// from the tool call override the server's defaults.
+func (s *mcpServer) childArgs(subject string, extra ...string) []string {
+	argv := append([]string{subject, "--progress-events"}, s.commonArgs()...)
+	return append(argv, extra...)
+}
+
+// runChild runs aiguide with argv in dir and returns the progress events it
+// wrote. Progress events become MCP progress notifications when the client
+// sent a progress token; every other line becomes a log message. Cancelling
+// ctx interrupts the child and kills it if it doesn't exit in time.
+func (s *mcpServer) runChild(ctx context.Context, tool, dir string, token json.RawMessage, argv []string) ([]progressEvent, error) {
+	var events []progressEvent
+	onEvent := func(e progressEvent) {
+		events = append(events, e)
+		if e.Event == "usage" && s.metrics != nil {
+			s.metrics.jobUsage(tool, e)
+		}
+		if e.Event == "progress" && token != nil {
+			s.notify("notifications/progress", map[string]any{
+				"progressToken": token,
+				"progress":      e.Done,
+				"total":         e.Total,
+				"message":       fmt.Sprintf("Answered chunk %d of %d", e.Done, e.Total),
+			})
+		}
+	}
+	onLine := func(line string, stderr bool) {
+		level := "info"
+		switch {
+		case !stderr:
+		case strings.HasPrefix(line, "Error"):
+			level = "error"
+		case strings.HasPrefix(line, "Warning"):
+			level = "warning"
+		}
+		s.log(level, line)
+	}
+	if err := runAiguideChild(ctx, dir, argv, onEvent, onLine); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// runAiguideChild runs this executable with argv in dir, calling onEvent for
+// every progress event and onLine for every other non-empty line. Cancelling
+// ctx interrupts the child and kills it if it doesn't exit in time. A failure
+// carries the last lines of the child's stderr.
+func runAiguideChild(ctx context.Context, dir string, argv []string, onEvent func(progressEvent), onLine func(line string, stderr bool)) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, exe, argv...)
+	cmd.Dir = dir
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = 10 * time.Second
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	var tail []string
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sc := bufio.NewScanner(stdout)
+		sc.Buffer(make([]byte, 64<<10), 16<<20)
+		for sc.Scan() {
+			line := sc.Text()
+			raw, ok := strings.CutPrefix(line, progressEventPrefix)
+			if !ok {
+				if strings.TrimSpace(line) != "" {
+					onLine(line, false)
+				}
+				continue
+			}
+			var e progressEvent
+			if json.Unmarshal([]byte(raw), &e) == nil {
+				onEvent(e)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		sc := bufio.NewScanner(stderr)
+		for sc.Scan() {
+			line := sc.Text()
+			onLine(line, true)
+			if tail = append(tail, line); len(tail) > 10 {
+				tail = tail[1:]
+			}
+		}
+	}()
+	wg.Wait()
+	if err := cmd.Wait(); err != nil {
+		if len(tail) > 0 {
+			return fmt.Errorf("aiguide failed (%w):\n%s", err, strings.Join(tail, "\n"))
+		}
+		return fmt.Errorf("aiguide failed: %w", err)
+	}
+	return nil
+}
+
+func newMCPCmd() *cobra.Command {
+	s := &mcpServer{calls: map[string]context.CancelFunc{}, logLevel: slices.Index(mcpLogLevels, "info")}
+	cmd := &cobra.Command{
+		Use:   "mcp",
+		Short: "Serve guide generation as Model Context Protocol tools over stdio",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			// stdout carries the protocol alone; anything else printed in
+			// this process goes to stderr.
+			s.out = os.Stdout
+			os.Stdout = os.Stderr
+			if s.metricsListen != "" {
+				s.metrics = newPromMetrics()
+				s.metrics.serverMode()
+				if err := serveMetrics(s.metricsListen, s.metrics); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if err := s.serve(os.Stdin); err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading MCP input: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&s.provider, "provider", "p", "", "Named provider profile used for every tool call")
+	cmd.Flags().StringVarP(&s.model, "model", "m", "", "Default model for every tool call")
+	cmd.Flags().StringVar(&s.metricsListen, "metrics-listen", "", "Serve Prometheus metrics with per-tool job series on this address, e.g. :9090")
+	return cmd
+}
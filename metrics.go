@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsSink receives what the pipeline measures. It is noMetrics unless
+// --metrics-listen is set, so a plain run only pays for the interface calls.
+type metricsSink interface {
+	apiRequest(model, status string, d time.Duration)
+	retry(model string)
+	rateLimitWait(d time.Duration)
+	chunkDone(d time.Duration, failed bool)
+	workerActive(delta int)
+}
+
+type noMetrics struct{}
+
+func (noMetrics) apiRequest(string, string, time.Duration) {}
+func (noMetrics) retry(string)                             {}
+func (noMetrics) rateLimitWait(time.Duration)              {}
+func (noMetrics) chunkDone(time.Duration, bool)            {}
+func (noMetrics) workerActive(int)                         {}
+
+var metrics metricsSink = noMetrics{}
+
+// requestStatus labels a finished API request with its HTTP status, or
+// "error" when no usable answer came back.
+func requestStatus(err error) string {
+	var ae *apiError
+	switch {
+	case err == nil:
+		return "200"
+	case errors.As(err, &ae):
+		return strconv.Itoa(ae.StatusCode)
+	}
+	return "error"
+}
+
+var (
+	requestBuckets = []float64{0.5, 1, 2.5, 5, 10, 20, 30, 60, 120}
+	chunkBuckets   = []float64{1, 5, 10, 30, 60, 120, 300, 600}
+	jobBuckets     = []float64{1, 10, 30, 60, 300, 600, 1800, 3600}
+)
+
+// promMetrics is the metricsSink behind --metrics-listen, served in the
+// Prometheus text format. Labels only carry bounded values: model names,
+// HTTP statuses and, in server mode, tool names.
+type promMetrics struct {
+	reg           *registry
+	requests      *family
+	requestTime   *family
+	retries       *family
+	rlWaits       *family
+	rlWaitSeconds *family
+	chunkTime     *family
+	workers       *family
+	tokens        *family
+	cost          *family
+
+	// Server mode only.
+	jobs       *family
+	jobsActive *family
+	jobTime    *family
+	jobTokens  *family
+	jobCost    *family
+}
+
+func newPromMetrics() *promMetrics {
+	r := &registry{}
+	m := &promMetrics{
+		reg:           r,
+		requests:      r.add("aiguide_api_requests_total", "counter", "API requests by model and HTTP status (error: no usable answer).", nil, "model", "status"),
+		requestTime:   r.add("aiguide_api_request_duration_seconds", "histogram", "Time per API request.", requestBuckets, "model"),
+		retries:       r.add("aiguide_api_retries_total", "counter", "API requests retried after a retryable error.", nil, "model"),
+		rlWaits:       r.add("aiguide_rate_limit_waits_total", "counter", "Waits before retrying a rate-limited request.", nil),
+		rlWaitSeconds: r.add("aiguide_rate_limit_wait_seconds_total", "counter", "Time spent in those waits.", nil),
+		chunkTime:     r.add("aiguide_chunk_duration_seconds", "histogram", "Time to answer one chunk, by outcome.", chunkBuckets, "outcome"),
+		workers:       r.add("aiguide_active_workers", "gauge", "Workers answering a chunk right now.", nil),
+		tokens:        r.add("aiguide_tokens_total", "counter", "Tokens used, by model and type (prompt or completion).", nil, "model", "type"),
+		cost:          r.add("aiguide_estimated_cost_usd", "gauge", "Estimated cost so far; absent while a model has no known price.", nil),
+	}
+	m.workers.set(0)
+	r.collect = func() {
+		usage.mu.Lock()
+		for model, u := range usage.byModel {
+			m.tokens.set(float64(u.PromptTokens), model, "prompt")
+			m.tokens.set(float64(u.CompletionTokens), model, "completion")
+		}
+		_, cost, priced := usage.totalsLocked()
+		usage.mu.Unlock()
+		if priced {
+			m.cost.set(cost)
+		}
+	}
+	return m
+}
+
+// serverMode adds the per-job series of "aiguide mcp", labeled by tool.
+func (m *promMetrics) serverMode() {
+	m.jobs = m.reg.add("aiguide_jobs_total", "counter", "Finished tool calls by tool and outcome (ok, error or cancelled).", nil, "tool", "outcome")
+	m.jobsActive = m.reg.add("aiguide_jobs_active", "gauge", "Tool calls running right now.", nil, "tool")
+	m.jobTime = m.reg.add("aiguide_job_duration_seconds", "histogram", "Time per tool call.", jobBuckets, "tool")
+	m.jobTokens = m.reg.add("aiguide_job_tokens_total", "counter", "Tokens used by tool calls, by tool and type.", nil, "tool", "type")
+	m.jobCost = m.reg.add("aiguide_job_estimated_cost_usd_total", "counter", "Estimated cost of tool calls with priced models.", nil, "tool")
+}
+
+func (m *promMetrics) apiRequest(model, status string, d time.Duration) {
+	m.requests.inc(1, model, status)
+	m.requestTime.observe(d.Seconds(), model)
+}
+
+func (m *promMetrics) retry(model string) { m.retries.inc(1, model) }
+
+func (m *promMetrics) rateLimitWait(d time.Duration) {
+	m.rlWaits.inc(1)
+	m.rlWaitSeconds.inc(d.Seconds())
+}
+
+func (m *promMetrics) chunkDone(d time.Duration, failed bool) {
+	outcome := "ok"
+	if failed {
+		outcome = "failed"
+	}
+	m.chunkTime.observe(d.Seconds(), outcome)
+}
+
+func (m *promMetrics) workerActive(delta int) { m.workers.inc(float64(delta)) }
+
+func (m *promMetrics) jobStarted(tool string) { m.jobsActive.inc(1, tool) }
+
+func (m *promMetrics) jobFinished(tool, outcome string, d time.Duration) {
+	m.jobsActive.inc(-1, tool)
+	m.jobs.inc(1, tool, outcome)
+	m.jobTime.observe(d.Seconds(), tool)
+}
+
+// jobUsage adds the usage event of a tool call's child process.
+func (m *promMetrics) jobUsage(tool string, e progressEvent) {
+	m.jobTokens.inc(float64(e.PromptTokens), tool, "prompt")
+	m.jobTokens.inc(float64(e.CompletionTokens), tool, "completion")
+	if e.Cost != nil {
+		m.jobCost.inc(*e.Cost, tool)
+	}
+}
+
+// serveMetrics starts serving /metrics on addr. The listener is opened
+// before it returns, so a busy port fails the run up front.
+func serveMetrics(addr string, m *promMetrics) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("--metrics-listen: %w", err)
+	}
+	go http.Serve(ln, metricsHandler(m))
+	statusf("-> Serving metrics on http://%s/metrics\n", ln.Addr())
+	return nil
+}
+
+// metricsHandler serves m on /metrics.
+func metricsHandler(m *promMetrics) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.reg.write(w)
+	})
+	return mux
+}
+
+// registry is a minimal Prometheus registry: counters, gauges and
+// histograms with fixed label names, written in the text format.
+type registry struct {
+	mu       sync.Mutex
+	families []*family
+	collect  func() // refreshes values read from elsewhere, before a scrape
+}
+
+type family struct {
+	reg              *registry
+	name, kind, help string
+	labels           []string
+	buckets          []float64
+	series           map[string]*series
+}
+
+type series struct {
+	labels []string
+	value  float64  // counter or gauge; the sum for a histogram
+	counts []uint64 // histogram: observations per bucket, not cumulative
+	count  uint64
+}
+
+func (r *registry) add(name, kind, help string, buckets []float64, labels ...string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := &family{reg: r, name: name, kind: kind, help: help, labels: labels, buckets: buckets, series: map[string]*series{}}
+	if len(labels) == 0 && kind == "counter" {
+		f.get(nil) // scrapes show an unlabeled counter from the start
+	}
+	r.families = append(r.families, f)
+	return f
+}
+
+// get returns the series for the label values; the caller holds reg.mu.
+func (f *family) get(values []string) *series {
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: values}
+		if f.kind == "histogram" {
+			s.counts = make([]uint64, len(f.buckets)+1)
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) inc(v float64, values ...string) {
+	f.reg.mu.Lock()
+	defer f.reg.mu.Unlock()
+	f.get(values).value += v
+}
+
+func (f *family) set(v float64, values ...string) {
+	f.reg.mu.Lock()
+	defer f.reg.mu.Unlock()
+	f.get(values).value = v
+}
+
+func (f *family) observe(v float64, values ...string) {
+	f.reg.mu.Lock()
+	defer f.reg.mu.Unlock()
+	s := f.get(values)
+	i, _ := slices.BinarySearch(f.buckets, v)
+	s.counts[i]++
+	s.count++
+	s.value += v
+}
+
+func (r *registry) write(w io.Writer) {
+	if r.collect != nil {
+		r.collect()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range r.families {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			s := f.series[k]
+			if f.kind != "histogram" {
+				fmt.Fprintf(w, "%s%s %s\n", f.name, labelString(f.labels, s.labels, ""), formatValue(s.value))
+				continue
+			}
+			var cum uint64
+			for i, b := range f.buckets {
+				cum += s.counts[i]
+				fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labelString(f.labels, s.labels, formatValue(b)), cum)
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labelString(f.labels, s.labels, "+Inf"), s.count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", f.name, labelString(f.labels, s.labels, ""), formatValue(s.value))
+			fmt.Fprintf(w, "%s_count%s %d\n", f.name, labelString(f.labels, s.labels, ""), s.count)
+		}
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelString renders {name="value",...}, with le appended for histogram
+// buckets.
+func labelString(names, values []string, le string) string {
+	var parts []string
+	for i, n := range names {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, n, labelEscaper.Replace(values[i])))
+	}
+	if le != "" {
+		parts = append(parts, fmt.Sprintf(`le="%s"`, le))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
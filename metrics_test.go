@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestMetricsScrape makes a call that is rate limited once, then scrapes
+// /metrics over HTTP and checks the series the call produced.
+func TestMetricsScrape(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	defer func(m metricsSink) { metrics = m }(metrics)
+	prev := gen
+	defer func() { gen = prev }()
+
+	var calls atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, `{"error":{"message":"slow down"}}`, http.StatusTooManyRequests)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": "ok"}}},
+			"usage":   map[string]int{"prompt_tokens": 7, "completion_tokens": 11, "total_tokens": 18},
+		})
+	}))
+	defer api.Close()
+
+	// A model of its own, so usage from other tests doesn't show up.
+	cfg.Model, cfg.Retries, cfg.RetryMaxWait = "metrics-model", 2, 10*time.Millisecond
+	var err error
+	if gen, err = newGenerator("", "", api.URL); err != nil {
+		t.Fatal(err)
+	}
+	m := newPromMetrics()
+	metrics = m
+	stderr := captureStderr(t, func() {
+		if _, err := callAI("prompt", "system"); err != nil {
+			t.Error(err)
+		}
+	})
+	if !strings.Contains(stderr, "retrying") {
+		t.Errorf("no retry line on stderr:\n%s", stderr)
+	}
+	metrics.workerActive(1)
+	metrics.chunkDone(3*time.Second, false)
+
+	srv := httptest.NewServer(metricsHandler(m))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# TYPE aiguide_api_requests_total counter\n",
+		`aiguide_api_requests_total{model="metrics-model",status="429"} 1` + "\n",
+		`aiguide_api_requests_total{model="metrics-model",status="200"} 1` + "\n",
+		`aiguide_api_request_duration_seconds_count{model="metrics-model"} 2` + "\n",
+		`aiguide_api_request_duration_seconds_bucket{model="metrics-model",le="+Inf"} 2` + "\n",
+		`aiguide_api_retries_total{model="metrics-model"} 1` + "\n",
+		"aiguide_rate_limit_waits_total 1\n",
+		`aiguide_tokens_total{model="metrics-model",type="prompt"} 7` + "\n",
+		`aiguide_tokens_total{model="metrics-model",type="completion"} 11` + "\n",
+		"aiguide_active_workers 1\n",
+		`aiguide_chunk_duration_seconds_bucket{outcome="ok",le="1"} 0` + "\n",
+		`aiguide_chunk_duration_seconds_bucket{outcome="ok",le="5"} 1` + "\n",
+		`aiguide_chunk_duration_seconds_sum{outcome="ok"} 3` + "\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("scrape lacks %q:\n%s", want, body)
+		}
+	}
+	if resp, err := http.Get(srv.URL + "/other"); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("/other answered %s", resp.Status)
+		}
+	}
+}
+
+func TestLabelString(t *testing.T) {
+	got := labelString([]string{"model", "status"}, []string{`a"b\c`, "line\nbreak"}, "0.5")
+	if want := `{model="a\"b\\c",status="line\nbreak",le="0.5"}`; got != want {
+		t.Errorf("labelString = %s, want %s", got, want)
+	}
+	if got := labelString(nil, nil, ""); got != "" {
+		t.Errorf("labelString without labels = %q", got)
+	}
+}
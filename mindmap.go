@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// mindmapNodeLen is how many characters of a concept fit on a node; the
+// full text goes into the note.
+const mindmapNodeLen = 60
+
+var (
+	takeawayHeadingRe = regexp.MustCompile(`(?i)\b(?:key\s+takeaways?|takeaways?|key\s+points|summary|tl;?dr)\b`)
+	labelLineRe       = regexp.MustCompile(`^\*(?:Difficulty:|Bloom:|Tags:|≈)`)
+)
+
+// guideConcept is what the map exporters need from one concept section.
+type guideConcept struct {
+	Item    int // 1-based position in the guide
+	Title   string
+	Anchor  string
+	Part    string
+	Summary string   // key takeaways as "- " lines, else the first paragraph
+	Links   []string // anchors of other sections this one links to
+}
+
+// guideConcepts reads the concept sections of a guide, with the part each
+// one belongs to.
+func guideConcepts(blocks []mdBlock) (title string, concepts []*guideConcept) {
+	var cur *guideConcept
+	var takeaways []string
+	var firstPara, part string
+	inTakeaways, skip := false, false
+
+	finish := func() {
+		if cur == nil {
+			return
+		}
+		cur.Summary = firstPara
+		if len(takeaways) > 0 {
+			cur.Summary = "- " + strings.Join(takeaways, "\n- ")
+		}
+		cur, takeaways, firstPara, inTakeaways = nil, nil, "", false
+	}
+
+	for _, b := range blocks {
+		switch {
+		case b.Kind == "heading" && b.Level == 1:
+			title = plainInline(b.Text)
+			if _, subject, ok := strings.Cut(title, ": "); ok {
+				title = subject
+			}
+		case b.Kind == "heading" && b.Level == 2 && conceptTitleRe.MatchString(b.Text):
+			finish()
+			skip = false
+			cur = &guideConcept{Item: len(concepts) + 1, Title: plainInline(b.Text), Anchor: mdAnchor(b.Text), Part: part}
+			concepts = append(concepts, cur)
+		case b.Kind == "heading" && b.Level == 2:
+			finish()
+			if isScaffoldHeading(plainInline(b.Text)) {
+				skip = true // not part of the concept structure
+			} else {
+				skip, part = false, plainInline(b.Text)
+			}
+		case cur == nil || skip:
+		default:
+			for _, sp := range parseInline(b.Text) {
+				if a, ok := strings.CutPrefix(sp.Link, "#"); ok && a != cur.Anchor && !slices.Contains(cur.Links, a) {
+					cur.Links = append(cur.Links, a)
+				}
+			}
+			switch {
+			case b.Kind == "heading":
+				inTakeaways = takeawayHeadingRe.MatchString(b.Text)
+			case inTakeaways && (b.Kind == "bullet" || b.Kind == "numbered") && b.Level == 0:
+				takeaways = append(takeaways, plainInline(b.Text))
+			case b.Kind == "paragraph" && firstPara == "" && !labelLineRe.MatchString(b.Text):
+				firstPara = plainInline(b.Text)
+			}
+		}
+	}
+	finish()
+	return title, concepts
+}
+
+// sidecarFacts returns "Difficulty: 3/5 · Tags: a, b" style notes per item.
+func sidecarFacts(sc *Sidecar) map[int]string {
+	facts := map[int]string{}
+	if sc == nil {
+		return facts
+	}
+	for _, sec := range sc.Sections {
+		for k, item := range sec.Items {
+			var f []string
+			if sec.Difficulty != nil && k < len(sec.Difficulty) {
+				f = append(f, fmt.Sprintf("Difficulty: %d/5", sec.Difficulty[k]))
+			}
+			if sec.Tags != nil && k < len(sec.Tags) && len(sec.Tags[k]) > 0 {
+				f = append(f, "Tags: "+strings.Join(sec.Tags[k], ", "))
+			}
+			if len(f) > 0 {
+				facts[item] = strings.Join(f, " · ")
+			}
+		}
+	}
+	return facts
+}
+
+// mindmapNode is a node of the map: the subject at the root, parts as
+// branches and concepts as leaves.
+type mindmapNode struct {
+	Text     string
+	Note     string
+	Children []*mindmapNode
+}
+
+// buildMindmap turns a guide into a tree. The sidecar, when there is one,
+// adds each concept's difficulty and tags to its note.
+func buildMindmap(blocks []mdBlock, sc *Sidecar) *mindmapNode {
+	title, concepts := guideConcepts(blocks)
+	facts := sidecarFacts(sc)
+	root := &mindmapNode{Text: title}
+	branch := root
+	for _, c := range concepts {
+		if c.Part != "" && (branch == root || branch.Text != c.Part) {
+			branch = &mindmapNode{Text: c.Part}
+			root.Children = append(root.Children, branch)
+		}
+		leaf := &mindmapNode{Text: truncateRunes(c.Title, mindmapNodeLen)}
+		var note []string
+		if leaf.Text != c.Title {
+			note = append(note, c.Title)
+		}
+		if c.Summary != "" {
+			note = append(note, c.Summary)
+		}
+		if f := facts[c.Item]; f != "" {
+			note = append(note, f)
+		}
+		leaf.Note = strings.Join(note, "\n\n")
+		branch.Children = append(branch.Children, leaf)
+	}
+	return root
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	cut := strings.TrimRight(string(r[:n-1]), " ")
+	if i := strings.LastIndex(cut, " "); i > n/2 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+// xmlText escapes s for XML text and attribute values, newlines included.
+func xmlText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func writeOPML(path string, root *mindmapNode) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	fmt.Fprintf(&b, "<opml version=\"2.0\">\n  <head>\n    <title>%s</title>\n    <dateCreated>%s</dateCreated>\n  </head>\n  <body>\n",
+		xmlText(root.Text), time.Now().UTC().Format(time.RFC1123Z))
+	var walk func(n *mindmapNode, depth int)
+	walk = func(n *mindmapNode, depth int) {
+		indent := strings.Repeat("  ", depth)
+		fmt.Fprintf(&b, "%s<outline text=\"%s\"", indent, xmlText(n.Text))
+		if n.Note != "" {
+			fmt.Fprintf(&b, " _note=\"%s\"", xmlText(n.Note))
+		}
+		if len(n.Children) == 0 {
+			b.WriteString("/>\n")
+			return
+		}
+		b.WriteString(">\n")
+		for _, c := range n.Children {
+			walk(c, depth+1)
+		}
+		fmt.Fprintf(&b, "%s</outline>\n", indent)
+	}
+	walk(root, 2)
+	b.WriteString("  </body>\n</opml>\n")
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// writeFreeMind writes a FreeMind 1.0 map. Notes are rich content in
+// XHTML, one paragraph per line of the note.
+func writeFreeMind(path string, root *mindmapNode) error {
+	var b strings.Builder
+	b.WriteString("<map version=\"1.0.1\">\n")
+	var walk func(n *mindmapNode, depth int)
+	walk = func(n *mindmapNode, depth int) {
+		indent := strings.Repeat("  ", depth)
+		fmt.Fprintf(&b, "%s<node TEXT=\"%s\"", indent, xmlText(n.Text))
+		if depth == 2 {
+			b.WriteString(" FOLDED=\"true\"")
+		}
+		b.WriteString(">\n")
+		if n.Note != "" {
+			fmt.Fprintf(&b, "%s  <richcontent TYPE=\"NOTE\"><html><head/><body>", indent)
+			for _, line := range strings.Split(n.Note, "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					fmt.Fprintf(&b, "<p>%s</p>", xmlText(line))
+				}
+			}
+			b.WriteString("</body></html></richcontent>\n")
+		}
+		for _, c := range n.Children {
+			walk(c, depth+1)
+		}
+		fmt.Fprintf(&b, "%s</node>\n", indent)
+	}
+	walk(root, 1)
+	b.WriteString("</map>\n")
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// exportMindmap writes the guide as <guide>.opml and <guide>.mm, using its
+// sidecar when there is one.
+func exportMindmap(guidePath string) error {
+	src, err := readGuide(guidePath)
+	if err != nil {
+		return err
+	}
+	sc, err := readSidecar(sidecarPath(guidePath))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring unreadable sidecar: %v\n", err)
+	}
+	root := buildMindmap(parseMarkdown(string(src)), sc)
+	if root.Text == "" {
+		root.Text = strings.TrimSuffix(guidePath, ".md")
+	}
+
+	stem := strings.TrimSuffix(guidePath, ".md")
+	if err := writeOPML(stem+".opml", root); err != nil {
+		return err
+	}
+	if err := writeFreeMind(stem+".mm", root); err != nil {
+		return err
+	}
+	statusf("-> Wrote %s.opml and %s.mm\n", stem, stem)
+	return nil
+}
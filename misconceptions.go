@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// misconceptionsHeading sits below the concept and subsection levels so it
+// never competes with them in a table of contents.
+const misconceptionsHeading = "#### Common misconceptions"
+
+const misconceptionsInstruction = "\n\nUnder EVERY concept, end with a subsection headed exactly \"" + misconceptionsHeading +
+	"\" containing 2-4 bullets. Each bullet states a belief learners commonly hold that is wrong, then the correction, " +
+	"in the form \"- **Misconception:** ... **Correction:** ...\"."
+
+var (
+	misconceptionsHeadingRe = regexp.MustCompile(`(?im)^[ \t]*(?:#{2,6}[ \t]*|\*\*)[ \t]*(?:common[ \t]+)?misconceptions?\b[^\n]*$`)
+	anyHeadingRe            = regexp.MustCompile(`(?m)^[ \t]*(?:#{1,6}[ \t]|---+[ \t]*$)`)
+	bulletLineRe            = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+(.+)$`)
+)
+
+// findMisconceptions locates the misconceptions subsection of a concept
+// section and returns its bounds and bullets; start is -1 when it's missing.
+func findMisconceptions(section string) (start, end int, bullets []string) {
+	loc := misconceptionsHeadingRe.FindStringIndex(section)
+	if loc == nil {
+		return -1, -1, nil
+	}
+	end = len(section)
+	if next := anyHeadingRe.FindStringIndex(section[loc[1]:]); next != nil {
+		end = loc[1] + next[0]
+	}
+	for _, line := range strings.Split(section[loc[1]:end], "\n") {
+		if m := bulletLineRe.FindStringSubmatch(line); m != nil {
+			bullets = append(bullets, strings.TrimSpace(m[1]))
+		}
+	}
+	return loc[0], end, bullets
+}
+
+// ensureMisconceptions normalizes each concept's misconceptions heading and
+// re-asks the model for the subsections it skipped. It returns the updated
+// content and the bullets per item, aligned with j.items.
+func ensureMisconceptions(j chunk, content string) (string, [][]string) {
+	preamble, sections := splitSections(content, chunkNumbers(j.items))
+	if len(sections) == 0 {
+		return content, nil
+	}
+
+	texts := map[string]string{}
+	var missing []string
+	for _, s := range sections {
+		texts[s.Number] = s.Text
+		if start, _, bullets := findMisconceptions(s.Text); start < 0 || len(bullets) == 0 {
+			missing = append(missing, s.Number)
+		}
+	}
+	for _, it := range j.items {
+		if _, ok := texts[conceptNumber(it)]; !ok {
+			missing = append(missing, conceptNumber(it))
+		}
+	}
+
+	if len(missing) > 0 {
+		var items []string
+		for _, it := range j.items {
+			for _, num := range missing {
+				if conceptNumber(it) == num {
+					items = append(items, it)
+				}
+			}
+		}
+		retryf("   Chunk %d skipped misconceptions for concept(s) %s, asking again...\n", j.id+1, strings.Join(missing, ", "))
+		added, err := requestMisconceptions(items, j.model)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error re-asking misconceptions for chunk %d: %v\n", j.id+1, err)
+		}
+		for num, sub := range added {
+			if text, ok := texts[num]; ok {
+				if start, end, _ := findMisconceptions(text); start >= 0 {
+					text = text[:start] + text[end:]
+				}
+				texts[num] = strings.TrimSpace(text) + "\n\n" + sub
+			}
+		}
+	}
+
+	bullets := make([][]string, len(j.items))
+	var parts []string
+	if preamble != "" {
+		parts = append(parts, preamble)
+	}
+	for _, s := range sections {
+		text := texts[s.Number]
+		start, end, b := findMisconceptions(text)
+		if start >= 0 {
+			heading := misconceptionsHeadingRe.FindString(text[start:end])
+			body := strings.TrimSpace(text[start+len(heading) : end])
+			text = text[:start] + misconceptionsHeading + "\n\n" + body + "\n\n" + strings.TrimLeft(text[end:], "\n")
+			text = strings.TrimSpace(text)
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: concept %s has no misconceptions subsection\n", s.Number)
+		}
+		for k, it := range j.items {
+			if conceptNumber(it) == s.Number {
+				bullets[k] = b
+			}
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, "\n\n"), bullets
+}
+
+func requestMisconceptions(items []string, model string) (map[string]string, error) {
+	prompt := fmt.Sprintf(
+		"For EACH of the following concepts, write ONLY its misconceptions subsection.\n\n%s\n\n"+
+			"Start each concept with a line \"=== CONCEPT <number> ===\", then the heading \"%s\" and 2-4 bullets "+
+			"in the form \"- **Misconception:** ... **Correction:** ...\". Do not add any other text.",
+		strings.Join(items, "\n"), misconceptionsHeading,
+	)
+	resp, err := callAIWith(callOptions{Model: model, Temperature: defaultTemperature, Purpose: "misconceptions"}, prompt, cfg.SystemPrompt)
+	if err != nil {
+		return nil, err
+	}
+
+	out := map[string]string{}
+	for num, body := range parseConceptBlocks(resp) {
+		if start, _, bullets := findMisconceptions(body); start >= 0 && len(bullets) > 0 {
+			out[num] = body[start:]
+		}
+	}
+	return out, nil
+}
+
+// writePitfalls collects every concept's misconception bullets into an
+// appendix that links back to the concept.
+func writePitfalls(w io.Writer, concepts []string, sections []SectionMeta) {
+	var b strings.Builder
+	for _, sec := range sections {
+		for k, pos := range sec.Items {
+			if k >= len(sec.Misconceptions) || len(sec.Misconceptions[k]) == 0 {
+				continue
+			}
+			c := concepts[pos-1]
+			fmt.Fprintf(&b, "**[%s](#%s)**\n\n", c, conceptAnchor(c))
+			for _, bullet := range sec.Misconceptions[k] {
+				fmt.Fprintf(&b, "- %s\n", bullet)
+			}
+			b.WriteString("\n")
+		}
+	}
+	if b.Len() == 0 {
+		return
+	}
+	fmt.Fprintf(w, "## %s\n\n%s---\n\n", outputLanguage().pitfalls, b.String())
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxMissingAttempts caps the follow-up requests for the concepts a chunk's
+// answer left out.
+const maxMissingAttempts = 2
+
+const missingPlaceholder = "> MISSING: the model gave no answer for this concept."
+
+// missingSection is the section of a concept that has no answer: its
+// heading, so Table of Contents links still land, and the placeholder.
+func missingSection(item string) string {
+	return fmt.Sprintf("## %s\n\n%s", item, missingPlaceholder)
+}
+
+// missingSections is what a failed chunk is written as: every concept of it
+// marked MISSING, where "aiguide redo" can fill them in.
+func missingSections(items []string) string {
+	parts := make([]string, len(items))
+	for i, it := range items {
+		parts[i] = missingSection(it)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// completeChunk asks again for the concepts of j that the answer has no
+// section for, as when the model skipped one or merged two, and splices the
+// answers in at their place. After maxMissingAttempts, the concepts still
+// missing get a visible placeholder, and their numbers are returned. With
+// appendOnly, for an answer already shown as it streamed, the new sections
+// follow the answer instead.
+func completeChunk(j chunk, content string, appendOnly bool) (string, []int) {
+	numbers := chunkNumbers(j.items)
+	preamble, sections := splitSections(content, numbers)
+	if len(sections) == len(numbers) {
+		return content, nil
+	}
+	found := make(map[string]string, len(numbers))
+	for _, s := range sections {
+		found[s.Number] = s.Text
+	}
+	// The concepts the answer has a section for, left where they are with
+	// appendOnly.
+	answered := make(map[string]bool, len(found))
+	for n := range found {
+		answered[n] = true
+	}
+
+	for attempt := 1; attempt <= maxMissingAttempts && len(found) < len(numbers); attempt++ {
+		var missing []string
+		for k, it := range j.items {
+			if _, ok := found[numbers[k]]; !ok {
+				missing = append(missing, it)
+			}
+		}
+		retryf("   Chunk %d has no answer for concept(s) %s, asking for them (%d/%d)...\n", j.id+1, strings.Join(chunkNumbers(missing), ", "), attempt, maxMissingAttempts)
+		resp, err := callAIWith(callOptions{Model: j.model, Temperature: defaultTemperature, Purpose: "missing"}, chunkRequest(missing)+numberingRetrySuffix, cfg.SystemPrompt)
+		if err != nil {
+			if errors.Is(err, ErrInterrupted) || errors.Is(err, ErrBudgetExceeded) {
+				break
+			}
+			continue
+		}
+		// The follow-up numbers its answers from 1 as often as the chunk did.
+		fixed, _ := renumberSections(chunk{id: j.id, items: missing}, cleanChunkContent(resp))
+		_, got := splitSections(fixed, chunkNumbers(missing))
+		for _, s := range got {
+			found[s.Number] = s.Text
+		}
+	}
+
+	var b strings.Builder
+	if p := strings.TrimSpace(preamble); p != "" && !appendOnly {
+		b.WriteString(p + "\n\n")
+	}
+	var still []int
+	for k, it := range j.items {
+		text, ok := found[numbers[k]]
+		if !ok {
+			n, _ := strconv.Atoi(numbers[k])
+			still = append(still, n)
+			text = missingSection(it)
+		}
+		switch {
+		case appendOnly && answered[numbers[k]]:
+			continue
+		case appendOnly:
+			b.WriteString("\n\n")
+		case k > 0:
+			b.WriteString("\n\n")
+		}
+		b.WriteString(text)
+	}
+	if still != nil {
+		fmt.Fprintf(os.Stderr, "Warning: chunk %d still has no answer for concept(s) %s; the guide marks them MISSING.\n", j.id+1, joinInts(still))
+	}
+	if appendOnly {
+		return content + b.String(), still
+	}
+	return b.String(), still
+}
+
+func writeMissingSummary(w io.Writer, sections []SectionMeta) {
+	var missing []int
+	for _, sec := range sections {
+		missing = append(missing, sec.Missing...)
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(w, "-> Missing: no answer for concepts %s, marked MISSING in the guide\n", joinInts(missing))
+	}
+}
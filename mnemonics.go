@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// noMnemonicRe matches the answers the prompt allows for concepts that don't
+// lend themselves to a memory aid.
+var noMnemonicRe = regexp.MustCompile(`(?i)^\W*(?:none|n/?a|no mnemonic(?: is)? appropriate)\W*$`)
+
+// mnemonicsFor asks for one memory aid per concept of j. The result is
+// aligned with j.items; concepts without a fitting aid stay empty.
+func mnemonicsFor(j chunk) []string {
+	prompt := fmt.Sprintf(
+		"For EACH of the following concepts, write a short memory aid that helps a learner memorize it: "+
+			"an acronym, a vivid association or a rhyme, at most three lines.\n\n%s\n\n"+
+			"Start each concept with a line \"=== CONCEPT <number> ===\" followed by its memory aid. "+
+			"If no mnemonic is appropriate for a concept, write NONE under its line instead. Do not add any other text.",
+		strings.Join(j.items, "\n"),
+	)
+	resp, err := callAIWith(callOptions{Model: j.model, Temperature: defaultTemperature, Purpose: "mnemonics"}, prompt, cfg.SystemPrompt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating mnemonics for chunk %d: %v\n", j.id+1, err)
+		return nil
+	}
+
+	blocks := parseConceptBlocks(resp)
+	mnemonics := make([]string, len(j.items))
+	for k, it := range j.items {
+		if m := blocks[conceptNumber(it)]; !noMnemonicRe.MatchString(m) {
+			mnemonics[k] = m
+		}
+	}
+	return mnemonics
+}
+
+// mnemonicBlocks renders each memory aid as a blockquote, keyed by concept
+// number for appendToSections.
+func mnemonicBlocks(items, mnemonics []string) map[string]string {
+	blocks := map[string]string{}
+	for k, m := range mnemonics {
+		if m == "" {
+			continue
+		}
+		// Hard line breaks keep rhymes from running into one line.
+		lines := strings.Split("**Mnemonic:** "+m, "\n")
+		for i, l := range lines {
+			lines[i] = "> " + strings.TrimSpace(l)
+		}
+		blocks[conceptNumber(items[k])] = strings.Join(lines, "  \n")
+	}
+	return blocks
+}
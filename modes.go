@@ -0,0 +1,84 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+
+	"github.com/yuriiter/aiguide/pkg/guide"
+)
+
+var (
+	//go:embed interview_prompt.txt
+	embedInterviewPrompt string
+	//go:embed exercises_prompt.txt
+	embedExercisesPrompt string
+	//go:embed socratic_prompt.txt
+	embedSocraticPrompt string
+)
+
+// modePreset is what a --mode changes: the default system prompt, the
+// concept-list request, the request for each chunk and the guide's title. In
+// exercises mode the guide becomes the index of an exerciseWorkspace.
+type modePreset struct {
+	systemPrompt string
+	listPrompt   func(n int, subject string) string
+	chunkPrompt  func(items string) string
+	title        string
+}
+
+func guideListPrompt(n int, subject string) string {
+	return guide.ListPrompt(n, subject)
+}
+
+func explainChunkPrompt(items string) string {
+	return guide.ChunkPrompt(items)
+}
+
+var modes = map[string]modePreset{
+	"guide": {
+		systemPrompt: embedSystemPrompt,
+		listPrompt:   guideListPrompt,
+		chunkPrompt:  explainChunkPrompt,
+		title:        "Comprehensive Guide",
+	},
+	"interview": {
+		systemPrompt: embedInterviewPrompt,
+		listPrompt: func(n int, subject string) string {
+			return fmt.Sprintf(
+				"Generate a numbered list of exactly %d realistic interview questions a candidate could be asked about: '%s'. "+
+					"Mix conceptual questions, practical hands-on ones and, where they fit the subject, "+
+					"behavioral \"Tell me about a time...\" questions. Phrase each one as the interviewer would ask it. ",
+				n, subject)
+		},
+		chunkPrompt: explainChunkPrompt,
+		title:       "Interview Prep",
+	},
+	"exercises": {
+		systemPrompt: embedExercisesPrompt,
+		listPrompt: func(n int, subject string) string {
+			return fmt.Sprintf(
+				"Generate a numbered list of exactly %d core concepts of the subject '%s' that can each be practiced "+
+					"with a small, self-contained coding exercise with automated tests. ",
+				n, subject)
+		},
+		chunkPrompt: explainChunkPrompt,
+		title:       "Coding Exercises",
+	},
+	"socratic": {
+		systemPrompt: embedSocraticPrompt,
+		listPrompt:   guideListPrompt,
+		chunkPrompt: func(items string) string {
+			return fmt.Sprintf(
+				"Here is a list of concepts/questions:\n%s\n\n"+
+					"For EACH one, write the ladder of guiding questions and the model answer the system prompt asks for. "+
+					"Maintain the original numbering exactly.",
+				items,
+			)
+		},
+		title: "Socratic Questions",
+	},
+}
+
+func currentMode() modePreset {
+	return modes[cfg.Mode]
+}
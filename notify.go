@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// notifyDesktop shows a native notification, falling back to a terminal
+// bell when no notifier is available. Callers must keep secrets and prompts
+// out of title and body.
+func notifyDesktop(title, body string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd", "netbsd":
+		if path, err := exec.LookPath("notify-send"); err == nil {
+			cmd = exec.CommandContext(ctx, path, "--app-name=aiguide", title, body)
+		} else if path, err := exec.LookPath("gdbus"); err == nil {
+			cmd = exec.CommandContext(ctx, path, "call", "--session",
+				"--dest=org.freedesktop.Notifications",
+				"--object-path=/org/freedesktop/Notifications",
+				"--method=org.freedesktop.Notifications.Notify",
+				"aiguide", "0", "", title, body, "[]", "{}", "5000")
+		}
+	case "darwin":
+		if path, err := exec.LookPath("osascript"); err == nil {
+			script := fmt.Sprintf("display notification %s with title %s", appleScriptString(body), appleScriptString(title))
+			cmd = exec.CommandContext(ctx, path, "-e", script)
+		}
+	case "windows":
+		if path, err := exec.LookPath("powershell"); err == nil {
+			cmd = exec.CommandContext(ctx, path, "-NoProfile", "-NonInteractive", "-Command", windowsToastScript(title, body))
+		}
+	}
+
+	if cmd == nil || cmd.Run() != nil {
+		fmt.Fprint(os.Stderr, "\a")
+	}
+}
+
+func appleScriptString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+func windowsToastScript(title, body string) string {
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	return `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null;` +
+		`$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02);` +
+		`$n = $t.GetElementsByTagName('text');` +
+		`$n.Item(0).AppendChild($t.CreateTextNode(` + quote(title) + `)) | Out-Null;` +
+		`$n.Item(1).AppendChild($t.CreateTextNode(` + quote(body) + `)) | Out-Null;` +
+		`[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('aiguide').Show([Windows.UI.Notifications.ToastNotification]::new($t))`
+}
+
+// notifyRun reports a finished or failed run when --notify is set.
+func notifyRun(o runOutcome) {
+	if !cfg.Notify {
+		return
+	}
+	if o.Status == statusFailed {
+		notifyDesktop("aiguide: "+cfg.Subject, fmt.Sprintf("Failed after %s: %s", o.Duration.Round(time.Second), o.Stage))
+		return
+	}
+	body := fmt.Sprintf("Finished in %s", o.Duration.Round(time.Second))
+	if o.Failed > 0 {
+		body += fmt.Sprintf(" · %d failed sections", o.Failed)
+	}
+	if len(o.Outputs) > 0 {
+		body += " · " + o.Outputs[0]
+	}
+	notifyDesktop("aiguide: "+cfg.Subject, body)
+}
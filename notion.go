@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	notionAPI          = "https://api.notion.com/v1"
+	notionVersion      = "2022-06-28"
+	notionBatchSize    = 100 // children per request
+	notionTextLimit    = 2000
+	notionMinInterval  = 350 * time.Millisecond // ~3 requests/s
+	notionMaxRetries   = 5
+	notionStateSuffix  = ".notion-state.json"
+	notionParentEnvVar = "NOTION_PARENT_PAGE"
+)
+
+var notionLanguages = map[string]string{
+	"": "plain text", "text": "plain text", "txt": "plain text",
+	"go": "go", "golang": "go", "python": "python", "py": "python",
+	"javascript": "javascript", "js": "javascript", "typescript": "typescript", "ts": "typescript",
+	"bash": "bash", "sh": "shell", "shell": "shell", "zsh": "shell", "powershell": "powershell",
+	"json": "json", "yaml": "yaml", "yml": "yaml", "toml": "toml", "xml": "xml", "html": "html", "css": "css",
+	"sql": "sql", "rust": "rust", "java": "java", "kotlin": "kotlin", "swift": "swift", "ruby": "ruby",
+	"c": "c", "cpp": "c++", "c++": "c++", "csharp": "c#", "cs": "c#", "c#": "c#", "php": "php",
+	"scala": "scala", "haskell": "haskell", "lua": "lua", "r": "r", "dockerfile": "docker", "docker": "docker",
+	"makefile": "makefile", "markdown": "markdown", "md": "markdown", "mermaid": "mermaid", "latex": "latex",
+	"diff": "diff", "graphql": "graphql",
+}
+
+type notionConverter struct {
+	warnings map[string]int
+}
+
+func (c *notionConverter) warn(msg string) {
+	c.warnings[msg]++
+}
+
+func (c *notionConverter) richText(text string) []any {
+	if strings.Contains(text, "![") {
+		c.warn("image replaced by its alt text")
+	}
+	var out []any
+	for _, s := range parseInline(text) {
+		for _, piece := range splitText(s.Text, notionTextLimit) {
+			t := map[string]any{"content": piece}
+			if strings.HasPrefix(s.Link, "http://") || strings.HasPrefix(s.Link, "https://") {
+				t["link"] = map[string]any{"url": s.Link}
+			}
+			out = append(out, map[string]any{
+				"type": "text",
+				"text": t,
+				"annotations": map[string]any{
+					"bold": s.Bold, "italic": s.Italic, "code": s.Code,
+				},
+			})
+		}
+	}
+	if len(out) > 100 {
+		c.warn("long formatted text truncated to 100 spans")
+		out = out[:100]
+	}
+	return out
+}
+
+func notionBlock(kind string, content map[string]any) map[string]any {
+	return map[string]any{"object": "block", "type": kind, kind: content}
+}
+
+// convert maps parsed markdown onto Notion blocks. The guide's H1 becomes the
+// page title, its Table of Contents becomes a native TOC block and a details
+// block, like a hidden Socratic answer, becomes a toggle.
+func (c *notionConverter) convert(blocks []mdBlock) (string, []map[string]any) {
+	var title string
+	var out []map[string]any
+	lastItem := -1
+	inTOC := false
+	toggles := map[int]bool{}
+	details := -1 // the toggle of the open details block
+
+	for _, b := range blocks {
+		if inTOC && (b.Kind == "bullet" || b.Kind == "numbered") {
+			continue
+		}
+		inTOC = false
+		if b.Kind != "bullet" && b.Kind != "numbered" {
+			lastItem = -1
+		}
+
+		switch b.Kind {
+		case "heading":
+			if b.Level == 1 && title == "" {
+				title = plainInline(b.Text)
+				continue
+			}
+			if isAltHeading(b.Text) {
+				toggles[len(out)] = true
+				out = append(out, notionBlock("toggle", map[string]any{"rich_text": c.richText(plainInline(b.Text))}))
+				continue
+			}
+			if isTOCHeading(b.Text) {
+				out = append(out, notionBlock("table_of_contents", map[string]any{}))
+				inTOC = true
+				continue
+			}
+			level := b.Level
+			if level > 3 {
+				c.warn("heading deeper than level 3 rendered as level 3")
+				level = 3
+			}
+			out = append(out, notionBlock(fmt.Sprintf("heading_%d", level), map[string]any{"rich_text": c.richText(b.Text)}))
+		case "paragraph":
+			out = append(out, notionBlock("paragraph", map[string]any{"rich_text": c.richText(b.Text)}))
+		case "bullet", "numbered":
+			kind := "bulleted_list_item"
+			if b.Kind == "numbered" {
+				kind = "numbered_list_item"
+			}
+			item := notionBlock(kind, map[string]any{"rich_text": c.richText(b.Text)})
+			if b.Level > 0 && lastItem >= 0 {
+				if b.Level > 1 {
+					c.warn("list nested deeper than two levels flattened")
+				}
+				parent := out[lastItem][out[lastItem]["type"].(string)].(map[string]any)
+				children, _ := parent["children"].([]map[string]any)
+				parent["children"] = append(children, item)
+				continue
+			}
+			out = append(out, item)
+			lastItem = len(out) - 1
+		case "code":
+			lang, ok := notionLanguages[b.Lang]
+			if !ok {
+				c.warn(fmt.Sprintf("code language %q shown as plain text", b.Lang))
+				lang = "plain text"
+			}
+			var rt []any
+			for _, piece := range splitText(b.Text, notionTextLimit) {
+				rt = append(rt, map[string]any{"type": "text", "text": map[string]any{"content": piece}})
+			}
+			out = append(out, notionBlock("code", map[string]any{"rich_text": rt, "language": lang}))
+		case "quote":
+			out = append(out, notionBlock("quote", map[string]any{"rich_text": c.richText(b.Text)}))
+		case "rule":
+			out = append(out, notionBlock("divider", map[string]any{}))
+		case "table":
+			width := 0
+			for _, r := range b.Rows {
+				if len(r) > width {
+					width = len(r)
+				}
+			}
+			var rows []map[string]any
+			for _, r := range b.Rows {
+				cells := make([]any, width)
+				for i := range cells {
+					cell := ""
+					if i < len(r) {
+						cell = r[i]
+					}
+					cells[i] = c.richText(cell)
+				}
+				rows = append(rows, notionBlock("table_row", map[string]any{"cells": cells}))
+			}
+			out = append(out, notionBlock("table", map[string]any{
+				"table_width": width, "has_column_header": true, "has_row_header": false, "children": rows,
+			}))
+		case "html":
+			if strings.HasPrefix(strings.TrimSpace(b.Text), "<!--") {
+				c.warn("HTML comment dropped")
+				continue
+			}
+			switch tag, summary := detailsTag(b.Text); {
+			case tag == "open":
+				details = len(out)
+				out = append(out, notionBlock("toggle", map[string]any{"rich_text": c.richText("Details")}))
+				continue
+			case tag == "summary" && details >= 0:
+				out[details]["toggle"].(map[string]any)["rich_text"] = c.richText(summary)
+				continue
+			case tag == "close" && details >= 0:
+				if children := out[details+1:]; len(children) > 0 {
+					out[details]["toggle"].(map[string]any)["children"] = slices.Clone(children)
+				}
+				for i := range toggles {
+					if i > details {
+						delete(toggles, i)
+					}
+				}
+				out, details = out[:details+1], -1
+				continue
+			}
+			c.warn("raw HTML kept as plain text")
+			out = append(out, notionBlock("paragraph", map[string]any{"rich_text": []any{
+				map[string]any{"type": "text", "text": map[string]any{"content": truncate(b.Text, notionTextLimit-1)}},
+			}}))
+		}
+	}
+	return title, foldToggles(out, toggles)
+}
+
+// foldToggles moves the blocks after each toggle, up to the next heading or
+// divider, into it, so alternate explanations start collapsed.
+func foldToggles(blocks []map[string]any, toggles map[int]bool) []map[string]any {
+	if len(toggles) == 0 {
+		return blocks
+	}
+	var out []map[string]any
+	for i := 0; i < len(blocks); i++ {
+		out = append(out, blocks[i])
+		if !toggles[i] {
+			continue
+		}
+		toggle := blocks[i]["toggle"].(map[string]any)
+		var children []map[string]any
+		for i+1 < len(blocks) && !toggles[i+1] && !strings.HasPrefix(blocks[i+1]["type"].(string), "heading_") && blocks[i+1]["type"] != "divider" {
+			i++
+			children = append(children, blocks[i])
+		}
+		if len(children) > 0 {
+			toggle["children"] = children
+		}
+	}
+	return out
+}
+
+// splitText cuts s into pieces of at most n bytes without splitting runes.
+func splitText(s string, n int) []string {
+	var out []string
+	for len(s) > n {
+		cut := n
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		out = append(out, s[:cut])
+		s = s[cut:]
+	}
+	if s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+type notionClient struct {
+	token string
+	http  *http.Client
+	last  time.Time
+}
+
+func (c *notionClient) do(method, path string, body any) (map[string]any, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		if wait := notionMinInterval - time.Since(c.last); wait > 0 {
+			time.Sleep(wait)
+		}
+		c.last = time.Now()
+
+		req, err := http.NewRequest(method, notionAPI+path, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		req.Header.Set("Notion-Version", notionVersion)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500) && attempt < notionMaxRetries {
+			wait := time.Duration(1<<attempt) * time.Second
+			if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				wait = time.Duration(secs) * time.Second
+			}
+			time.Sleep(wait)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Notion API error: %s - %s", resp.Status, truncate(string(respBody), 300))
+		}
+
+		var out map[string]any
+		if err := json.Unmarshal(respBody, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+}
+
+// notionState lets an interrupted upload continue where it stopped instead of
+// creating a second page.
+type notionState struct {
+	GuideHash string `json:"guide_sha256"`
+	PageID    string `json:"page_id"`
+	PageURL   string `json:"page_url"`
+	Uploaded  int    `json:"uploaded_blocks"`
+}
+
+func saveNotionState(path string, st notionState) error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+var notionIDRe = regexp.MustCompile(`[0-9a-fA-F]{32}$`)
+
+// notionPageID accepts a bare page id, a dashed UUID or a page URL.
+func notionPageID(s string) string {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "-", "")
+	if i := strings.IndexAny(s, "?#"); i >= 0 {
+		s = s[:i]
+	}
+	if m := notionIDRe.FindString(s); m != "" {
+		return m
+	}
+	return s
+}
+
+func checkNotion(parent string) error {
+	if os.Getenv("NOTION_TOKEN") == "" {
+		return fmt.Errorf("Notion export requires the NOTION_TOKEN environment variable")
+	}
+	if parent == "" && os.Getenv(notionParentEnvVar) == "" {
+		return fmt.Errorf("Notion export requires --notion-parent (or %s)", notionParentEnvVar)
+	}
+	return nil
+}
+
+func exportNotion(guidePath, parent string) error {
+	if parent == "" {
+		parent = os.Getenv(notionParentEnvVar)
+	}
+	if err := checkNotion(parent); err != nil {
+		return err
+	}
+
+	src, err := readGuide(guidePath)
+	if err != nil {
+		return err
+	}
+
+	conv := &notionConverter{warnings: map[string]int{}}
+	title, blocks := conv.convert(parseMarkdown(string(src)))
+	if title == "" {
+		title = strings.TrimSuffix(guidePath, ".md")
+	}
+
+	client := &notionClient{token: os.Getenv("NOTION_TOKEN"), http: &http.Client{Timeout: 60 * time.Second}}
+	statePath := guidePath + notionStateSuffix
+	hash := promptHash(string(src))
+
+	var st notionState
+	if b, err := os.ReadFile(statePath); err == nil {
+		if json.Unmarshal(b, &st) != nil || st.GuideHash != hash {
+			st = notionState{}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if st.PageID == "" {
+		first := blocks[:min(notionBatchSize, len(blocks))]
+		page, err := client.do("POST", "/pages", map[string]any{
+			"parent":     map[string]any{"page_id": notionPageID(parent)},
+			"properties": map[string]any{"title": map[string]any{"title": conv.richText(title)}},
+			"children":   first,
+		})
+		if err != nil {
+			return err
+		}
+		st = notionState{GuideHash: hash, Uploaded: len(first)}
+		st.PageID, _ = page["id"].(string)
+		st.PageURL, _ = page["url"].(string)
+		if err := saveNotionState(statePath, st); err != nil {
+			return err
+		}
+	} else {
+		statusf("-> Resuming Notion upload at block %d of %d\n", st.Uploaded+1, len(blocks))
+	}
+
+	for st.Uploaded < len(blocks) {
+		batch := blocks[st.Uploaded:min(st.Uploaded+notionBatchSize, len(blocks))]
+		if _, err := client.do("PATCH", "/blocks/"+st.PageID+"/children", map[string]any{"children": batch}); err != nil {
+			return fmt.Errorf("uploading blocks %d-%d (rerun to resume): %w", st.Uploaded+1, st.Uploaded+len(batch), err)
+		}
+		st.Uploaded += len(batch)
+		if err := saveNotionState(statePath, st); err != nil {
+			return err
+		}
+	}
+	os.Remove(statePath)
+
+	statusf("-> Notion page: %s\n", st.PageURL)
+	if len(conv.warnings) > 0 {
+		msgs := make([]string, 0, len(conv.warnings))
+		for m := range conv.warnings {
+			msgs = append(msgs, m)
+		}
+		sort.Strings(msgs)
+		fmt.Fprintln(os.Stderr, "-> Notion conversion warnings:")
+		for _, m := range msgs {
+			fmt.Fprintf(os.Stderr, "   %s (%dx)\n", m, conv.warnings[m])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Models often renumber a chunk's answers from 1, so concepts 21-25 come
+// back as "## 1." to "## 5." and no longer match the Table of Contents.
+// renumberSections maps the returned headings back onto the requested
+// concepts and rewrites their numbers.
+
+const numberingRetrySuffix = "\n\nIMPORTANT: Number every header with the concept's number from the list above, " +
+	"not from 1, and give every concept its own header; never combine two concepts under one."
+
+// minTitleMatch is the word overlap, as a Dice coefficient, a returned
+// heading needs with a concept's title to be taken for it.
+const minTitleMatch = 0.5
+
+// titleStopwords don't count towards a title match.
+var titleStopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "the": true, "of": true, "in": true, "on": true, "for": true,
+	"to": true, "with": true, "vs": true, "or": true, "is": true, "how": true, "what": true, "why": true,
+}
+
+var headingPrefixRe = regexp.MustCompile(`(?i)^#{1,6}[ \t]+\**[ \t]*(?:(?:question|concept)[ \t]+)?\d+[.):]?\**[ \t]*`)
+
+// numberingError is a chunk whose headings can't be mapped onto its concepts
+// without guessing.
+type numberingError struct {
+	reason string
+}
+
+func (e *numberingError) Error() string { return "ambiguous numbering: " + e.reason }
+
+type numberedHeading struct {
+	start, end int // the number within the content
+	level      int
+	title      string
+}
+
+// renumberSections returns content with every concept heading carrying its
+// requested number. Headings are mapped by position when there are as many
+// as concepts, else by title. It returns a *numberingError when a concept
+// has no heading of its own or a heading matches several concepts, as when
+// the model merged two of them.
+func renumberSections(j chunk, content string) (string, error) {
+	numbers := chunkNumbers(j.items)
+	if _, sections := splitSections(content, numbers); len(sections) == len(numbers) {
+		return content, nil
+	}
+
+	headings := topNumberedHeadings(content)
+	if len(headings) == 0 {
+		return content, &numberingError{"the answer has no numbered headings"}
+	}
+	target := make([]int, len(headings)) // index into j.items
+	if len(headings) == len(j.items) {
+		for i := range headings {
+			target[i] = i
+		}
+	} else {
+		claimed := make([]int, len(j.items))
+		for i, h := range headings {
+			var matches []int
+			for k, it := range j.items {
+				if titleMatch(h.title, conceptPrefixRe.ReplaceAllString(it, "")) >= minTitleMatch {
+					matches = append(matches, k)
+				}
+			}
+			switch len(matches) {
+			case 0:
+				return content, &numberingError{fmt.Sprintf("heading %q matches none of the concepts", h.title)}
+			case 1:
+				target[i] = matches[0]
+				claimed[matches[0]]++
+			default:
+				return content, &numberingError{fmt.Sprintf("heading %q matches %d concepts", h.title, len(matches))}
+			}
+		}
+		for k, n := range claimed {
+			if n != 1 {
+				return content, &numberingError{fmt.Sprintf("concept %s has %d headings", numbers[k], n)}
+			}
+		}
+	}
+
+	var b strings.Builder
+	last := 0
+	for i, h := range headings {
+		b.WriteString(content[last:h.start])
+		b.WriteString(numbers[target[i]])
+		last = h.end
+	}
+	b.WriteString(content[last:])
+	return b.String(), nil
+}
+
+// topNumberedHeadings finds the numbered headings at the shallowest level
+// any numbered heading uses, so numbered steps inside an answer ("### 1.
+// Install") are left alone.
+func topNumberedHeadings(content string) []numberedHeading {
+	var all []numberedHeading
+	top := 7
+	for _, m := range conceptHeadingRe.FindAllStringSubmatchIndex(content, -1) {
+		line := content[m[0]:]
+		if nl := strings.IndexByte(line, '\n'); nl >= 0 {
+			line = line[:nl]
+		}
+		level := len(line) - len(strings.TrimLeft(line, "#"))
+		title := strings.Trim(headingPrefixRe.ReplaceAllString(line, ""), "* \t")
+		all = append(all, numberedHeading{start: m[2], end: m[3], level: level, title: title})
+		top = min(top, level)
+	}
+	var out []numberedHeading
+	for _, h := range all {
+		if h.level == top {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+func titleWords(s string) map[string]bool {
+	words := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		if !titleStopwords[w] {
+			words[w] = true
+		}
+	}
+	return words
+}
+
+// titleMatch is the Dice coefficient of the two titles' words.
+func titleMatch(a, b string) float64 {
+	wa, wb := titleWords(a), titleWords(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+	common := 0
+	for w := range wa {
+		if wb[w] {
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(wa)+len(wb))
+}
+
+// fixNumbering renumbers a chunk's answer, asking once more with a stricter
+// instruction when the mapping is ambiguous. If the retry is ambiguous too,
+// the first answer is kept as it is.
+func fixNumbering(j chunk, prompt, content string, regenerate func(prompt string) (string, error)) string {
+	fixed, err := renumberSections(j, content)
+	if err == nil {
+		return fixed
+	}
+	retryf("   Chunk %d came back with %v, asking again...\n", j.id+1, err)
+	retry, rerr := regenerate(prompt + numberingRetrySuffix)
+	if rerr == nil {
+		if fixed, err = renumberSections(j, retry); err == nil {
+			return fixed
+		}
+	}
+	if rerr != nil {
+		err = rerr
+	}
+	fmt.Fprintf(os.Stderr, "Warning: chunk %d keeps its own numbering, some headings may not match the Table of Contents: %v\n", j.id+1, err)
+	return content
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// numberingChunk is the third chunk of a guide, concepts 21-23.
+var numberingChunk = chunk{id: 2, start: 20, items: []string{"21. Channels", "22. Select", "23. Mutexes"}}
+
+func readNumberingFixture(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", "numbering", name+".md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// TestRenumberSections runs renumberSections on answers whose numbering
+// drifted: the renumbered ones are compared with their .golden file, the
+// ones that can't be mapped with the error they give.
+func TestRenumberSections(t *testing.T) {
+	tests := []struct {
+		name string
+		err  string // "" when the answer is renumbered
+	}{
+		{"requested", ""},
+		// Numbered steps inside an answer keep their numbers.
+		{"from-one", ""},
+		{"bold-concept", ""},
+		// Two concepts merged under one heading.
+		{"merged", `heading "Channels and Select" matches 2 concepts`},
+		// One concept split over two headings.
+		{"split", "concept 21 has 2 headings"},
+		{"unnumbered", "the answer has no numbered headings"},
+	}
+	for _, tt := range tests {
+		content := readNumberingFixture(t, tt.name)
+		got, err := renumberSections(numberingChunk, content)
+		if tt.err != "" {
+			var ne *numberingError
+			if !errors.As(err, &ne) || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+			}
+			if got != content {
+				t.Errorf("%s: an ambiguous answer was changed", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		golden(t, filepath.Join("testdata", "numbering", tt.name+".golden"), got)
+		if _, sections := splitSections(got, chunkNumbers(numberingChunk.items)); len(sections) != 3 {
+			t.Errorf("%s: %d sections after renumbering, want 3", tt.name, len(sections))
+		}
+	}
+}
+
+func TestTitleMatch(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"Channels", "Channels", 1},
+		{"The Select Statement", "select statement", 1},
+		{"Buffered Channels", "Channels", 2.0 / 3},
+		{"Mutexes", "Channels", 0},
+		{"How and why", "Channels", 0},
+	}
+	for _, tt := range tests {
+		if got := titleMatch(tt.a, tt.b); got != tt.want {
+			t.Errorf("titleMatch(%q, %q) = %g, want %g", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFixNumbering(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.Quiet = false
+	merged := readNumberingFixture(t, "merged")
+	fromOne := readNumberingFixture(t, "from-one")
+
+	// A merged answer is asked for again, and the retry is renumbered.
+	var prompts []string
+	var got string
+	stderr := captureStderr(t, func() {
+		got = fixNumbering(numberingChunk, "PROMPT", merged, func(p string) (string, error) {
+			prompts = append(prompts, p)
+			return fromOne, nil
+		})
+	})
+	if len(prompts) != 1 || prompts[0] != "PROMPT"+numberingRetrySuffix {
+		t.Errorf("retry prompts = %q", prompts)
+	}
+	if !strings.HasPrefix(got, "## 21. Channels") || !strings.Contains(got, "## 23. Mutexes") {
+		t.Errorf("fixNumbering kept:\n%s", got)
+	}
+	if !strings.Contains(stderr, "Chunk 3 came back with ambiguous numbering") {
+		t.Errorf("stderr:\n%s", stderr)
+	}
+
+	// When the retry merges concepts too, the first answer is kept.
+	stderr = captureStderr(t, func() {
+		got = fixNumbering(numberingChunk, "PROMPT", merged, func(string) (string, error) { return merged, nil })
+	})
+	if got != merged {
+		t.Errorf("fixNumbering replaced the answer:\n%s", got)
+	}
+	if !strings.Contains(stderr, "Warning: chunk 3 keeps its own numbering") {
+		t.Errorf("stderr:\n%s", stderr)
+	}
+
+	// A failed retry is reported, and the first answer kept.
+	stderr = captureStderr(t, func() {
+		got = fixNumbering(numberingChunk, "PROMPT", merged, func(string) (string, error) { return "", errors.New("boom") })
+	})
+	if got != merged || !strings.Contains(stderr, "chunk 3 keeps its own numbering, some headings may not match the Table of Contents: boom") {
+		t.Errorf("stderr:\n%s", stderr)
+	}
+
+	// An answer that already matches isn't retried.
+	requested := readNumberingFixture(t, "requested")
+	if got := fixNumbering(numberingChunk, "PROMPT", requested, func(string) (string, error) {
+		t.Error("regenerated an answer that matched")
+		return "", nil
+	}); got != requested {
+		t.Errorf("fixNumbering changed a matching answer:\n%s", got)
+	}
+}
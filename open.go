@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// latestGuideRun is the most recent run in the history that wrote a guide.
+func latestGuideRun() (historyRecord, error) {
+	records, err := readHistory()
+	if err != nil {
+		return historyRecord{}, err
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		if r := records[i]; r.Output != "" && r.Status != statusFailed {
+			return r, nil
+		}
+	}
+	return historyRecord{}, errors.New("no generated guide in the history yet (runs with --no-history or --stdout aren't recorded)")
+}
+
+// openCommand is the program that opens path: with, else $VISUAL or $EDITOR
+// for markdown, else the platform opener, which for HTML is the default
+// browser.
+func openCommand(path, with string) []string {
+	if with != "" {
+		return append(strings.Fields(with), path)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".md") {
+		for _, env := range []string{"VISUAL", "EDITOR"} {
+			if e := strings.Fields(os.Getenv(env)); len(e) > 0 {
+				return append(e, path)
+			}
+		}
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"open", path}
+	case "windows":
+		return []string{"cmd", "/c", "start", "", path}
+	}
+	return []string{"xdg-open", path}
+}
+
+func newOpenCmd() *cobra.Command {
+	var with string
+	var printPath bool
+	cmd := &cobra.Command{
+		Use:   "open [history-id]",
+		Short: "Open the most recently generated guide, or the one a run in the history wrote",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var r historyRecord
+			var err error
+			if len(args) == 1 {
+				r, err = findHistoryRun(args[0])
+				if err == nil && r.Output == "" {
+					err = fmt.Errorf("run %s wrote no guide (status %s)", r.ID, r.Status)
+				}
+			} else {
+				r, err = latestGuideRun()
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if _, err := os.Stat(r.Output); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s, written by run %s on %s, no longer exists; it was moved or deleted.\n",
+					r.Output, r.ID, r.Time.Local().Format("2006-01-02 15:04"))
+				fmt.Fprintf(os.Stderr, "Pick another run with aiguide history, or see how to regenerate it with aiguide history show %s.\n", r.ID)
+				os.Exit(1)
+			}
+
+			if printPath {
+				fmt.Println(r.Output)
+				return
+			}
+			argv := openCommand(r.Output, with)
+			c := exec.Command(argv[0], argv[1:]...)
+			c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+			if err := c.Run(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error opening %s with %s: %v\n", r.Output, argv[0], err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&with, "with", "", "Program to open the guide with, e.g. \"code -n\"")
+	cmd.Flags().BoolVar(&printPath, "print", false, "Print the guide's path instead of opening it")
+	return cmd
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"math/rand/v2"
+	"sort"
+	"strings"
+)
+
+// orderAlphabetically returns the indexes of concepts sorted by title,
+// ignoring their numbers and case, for reference-style guides.
+func orderAlphabetically(concepts []string) []int {
+	titles := make([]string, len(concepts))
+	order := make([]int, len(concepts))
+	for i, c := range concepts {
+		titles[i] = strings.ToLower(strings.Trim(conceptPrefixRe.ReplaceAllString(c, ""), "*_ "))
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return titles[order[a]] < titles[order[b]] })
+	return order
+}
+
+// shuffledOrder returns a permutation of n concepts, the same for the same
+// seed, so a self-test guide doesn't give answers away by position.
+func shuffledOrder(n int, seed uint64) []int {
+	r := rand.New(rand.NewPCG(seed, seed))
+	return r.Perm(n)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	statusSuccess = "success"
+	statusPartial = "partial"
+	statusFailed  = "failed"
+)
+
+// runOutcome summarizes a run for notifications and webhooks. Stage is a
+// short fixed description of what failed, never an upstream error message,
+// so secrets and prompts can't leak through it.
+type runOutcome struct {
+	Status    string
+	Stage     string
+	Outputs   []string
+	Succeeded int
+	Failed    int
+	Duration  time.Duration
+}
+
+// finishRun runs the post-hook and announces the outcome. The returned
+// error is a webhook delivery failure, which only matters with
+// --webhook-strict.
+func finishRun(o runOutcome) error {
+	emitUsage()
+	recordHistory(o)
+	runPostHook(o)
+	notifyRun(o)
+	return sendWebhook(o)
+}
+
+// failRun announces a fatal failure and exits with the code of err, or of
+// a plain failure when err is nil.
+func failRun(startedAt time.Time, stage string, err error) {
+	if werr := finishRun(runOutcome{Status: statusFailed, Stage: stage, Duration: time.Since(startedAt)}); werr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", werr)
+	}
+	if err == nil {
+		err = errors.New(stage)
+	}
+	os.Exit(reportError(err))
+}
+
+// stageError is an error that ends the run at stage, the short fixed
+// description the outcome reports; err may be nil.
+type stageError struct {
+	stage string
+	err   error
+}
+
+func (e *stageError) Error() string {
+	if e.err == nil {
+		return e.stage
+	}
+	return e.err.Error()
+}
+
+func (e *stageError) Unwrap() error { return e.err }
+
+// failStage is failRun for an error that names its stage.
+func failStage(startedAt time.Time, err error) {
+	var se *stageError
+	if errors.As(err, &se) {
+		failRun(startedAt, se.stage, se.err)
+	}
+	failRun(startedAt, "the run failed", err)
+}
+
+// runCtx is cancelled by the first Ctrl-C while chunks are being answered;
+// API calls made under it are aborted.
+var runCtx, cancelRun = context.WithCancel(context.Background())
+
+// answering is set while processChunks runs. An interrupt then lets the
+// finished chunks be written instead of ending the run at once.
+var answering atomic.Bool
+
+// handleInterrupt handles Ctrl-C and SIGTERM. While chunks are answered, the
+// first one cancels runCtx so the run can write what it has; otherwise it
+// ends the run with ErrInterrupted after the post-hook and notifications.
+// A second one always quits at once.
+func handleInterrupt(startedAt time.Time) {
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		if !answering.Load() {
+			fmt.Fprintln(os.Stderr, "\nInterrupted.")
+			failRun(startedAt, "the run was interrupted", ErrInterrupted)
+		}
+		fmt.Fprintln(os.Stderr, "\nInterrupted: writing the chunks already done. Press Ctrl-C again to quit now.")
+		cancelRun()
+		<-sig
+		fmt.Fprintln(os.Stderr, "\nInterrupted again, quitting.")
+		os.Exit(exitInterrupted)
+	}()
+}
@@ -0,0 +1,34 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// peerUser names the user on the other end of a daemon connection, as the
+// kernel reports it with SO_PEERCRED; unlike a name in the request, the
+// client can't choose it.
+func peerUser(conn net.Conn) (string, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return "", errors.New("not a Unix socket")
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return "", err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return "", err
+	}
+	if credErr != nil {
+		return "", credErr
+	}
+	return uidName(cred.Uid), nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// peerUser is only implemented on Linux; elsewhere jobs are recorded
+// without a submitter.
+func peerUser(net.Conn) (string, error) {
+	return "", errors.New("peer credentials are not available on this system")
+}
@@ -0,0 +1,383 @@
+package guide
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type CompletionRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	Seed        *int      `json:"seed,omitempty"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+	// WebSearch asks a search-capable model to ground its answer in a web
+	// search (OpenAI's search models, OpenRouter).
+	WebSearch     *struct{}      `json:"web_search_options,omitempty"`
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type CompletionResponse struct {
+	Choices []struct {
+		Message ResponseMessage `json:"message"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type ResponseMessage struct {
+	Role      string         `json:"role"`
+	Content   MessageContent `json:"content"`
+	Refusal   string         `json:"refusal"`
+	ToolCalls []struct {
+		Type     string `json:"type"`
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	} `json:"tool_calls"`
+}
+
+// Usage is the token usage the API reports for a call.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u *Usage) add(o Usage) {
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.TotalTokens += o.TotalTokens
+}
+
+// ErrRefused means the model declined to answer; a *RefusalError carries
+// its text.
+var ErrRefused = errors.New("model refused")
+
+// RefusalError means the model declined to answer. AnswerChunk retries it
+// with a softened prompt before giving up.
+type RefusalError struct {
+	Text string
+}
+
+func (e *RefusalError) Error() string {
+	return "model refused: " + e.Text
+}
+
+func (e *RefusalError) Is(target error) bool { return target == ErrRefused }
+
+// MessageContent is the text of a response message. Besides a plain string,
+// some servers (and the Responses API) send an array of typed parts; text
+// parts are concatenated and anything else is rejected rather than silently
+// dropped.
+type MessageContent string
+
+type contentPart struct {
+	Type    string `json:"type"`
+	Text    string `json:"text"`
+	Refusal string `json:"refusal"`
+}
+
+func (c *MessageContent) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*c = ""
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*c = MessageContent(s)
+		return nil
+	}
+
+	var parts []contentPart
+	if err := json.Unmarshal(b, &parts); err != nil {
+		return fmt.Errorf("message content is neither a string nor an array of parts: %s", truncate(string(b), 80))
+	}
+
+	var sb strings.Builder
+	for _, p := range parts {
+		switch p.Type {
+		case "text", "output_text":
+			sb.WriteString(p.Text)
+		case "refusal":
+			return &RefusalError{Text: p.Refusal}
+		default:
+			return fmt.Errorf("unsupported message content part %q", p.Type)
+		}
+	}
+	*c = MessageContent(sb.String())
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "…"
+}
+
+// Call is one system+user exchange with the model.
+type Call struct {
+	Model  string // default Config.Model
+	System string
+	User   string
+	// Temperature of the call; nil means Config.Temperature.
+	Temperature *float64
+	Seed        *int
+	WebSearch   bool
+	// Purpose tags the call for the Observer, such as "answer" or "tags".
+	Purpose string
+	// Label names the call in what the Observer shows, such as "Chunk 3".
+	Label string
+	// Stream, when set, asks for the answer as server-sent events and
+	// receives its text as it arrives.
+	Stream func(delta string)
+}
+
+// backend sends one call to an API and returns the answer text and, when
+// the API reports it, token usage.
+type backend interface {
+	complete(ctx context.Context, c Call) (string, *Usage, error)
+}
+
+// APIError is a non-200 response. Backends decide whether it is worth
+// retrying and for how long to wait.
+type APIError struct {
+	Status     string
+	StatusCode int
+	Body       string
+	Retryable  bool
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error: %s - %s", e.Status, e.Body)
+}
+
+// Complete sends c, retrying transient failures up to Config.Retries times,
+// and returns the answer with the tokens it used, retries included. The
+// Limiter is waited for before every attempt.
+func (g *Generator) Complete(ctx context.Context, c Call) (string, Usage, error) {
+	if c.Model == "" {
+		c.Model = g.cfg.Model
+	}
+	if c.Temperature == nil {
+		c.Temperature = g.cfg.Temperature
+	}
+	var total Usage
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return "", total, err
+		}
+		if g.cfg.Limiter != nil {
+			if err := g.cfg.Limiter.Wait(ctx); err != nil {
+				return "", total, err
+			}
+		}
+		start := time.Now()
+		content, u, err := g.backend.complete(ctx, c)
+		g.cfg.Observer.Attempt(c, time.Since(start), u, err)
+		if u != nil {
+			total.add(*u)
+			g.addUsage(*u)
+		}
+
+		if err != nil && Retryable(err) && attempt < *g.cfg.Retries {
+			if wait, ok := retryDelay(attempt, err, g.cfg.RetryMaxWait); ok {
+				g.cfg.Observer.Retry(c, attempt+1, *g.cfg.Retries, wait, err)
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+				}
+				continue
+			}
+		}
+		return content, total, err
+	}
+}
+
+// buildRequest assembles the request body, applying the Config's quirks.
+func (g *Generator) buildRequest(c Call) CompletionRequest {
+	req := CompletionRequest{
+		Model: c.Model,
+		Messages: []Message{
+			{Role: SystemRole(c.Model, g.cfg.SystemRole), Content: c.System},
+			{Role: "user", Content: c.User},
+		},
+		Seed:      c.Seed,
+		MaxTokens: g.cfg.MaxTokens,
+	}
+	// Search models reject a temperature.
+	if !g.cfg.NoTemperature && !c.WebSearch {
+		req.Temperature = c.Temperature
+	}
+	if c.WebSearch {
+		req.WebSearch = &struct{}{}
+	}
+	if c.Stream != nil {
+		req.Stream = true
+		req.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+	if g.cfg.NoSeed {
+		req.Seed = nil
+	}
+	return req
+}
+
+// developerRoleFamilies are model name prefixes that expect the system
+// prompt under the "developer" role.
+var developerRoleFamilies = []string{"o1", "o3", "o4", "gpt-5"}
+
+// SystemRole returns the role the system prompt of model is sent under:
+// override unless it is empty or "auto", otherwise a default by model
+// family.
+func SystemRole(model, override string) string {
+	if override != "" && override != "auto" {
+		return override
+	}
+	name := model
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		// Gateways like OpenRouter prefix the vendor: "openai/o3-mini".
+		name = name[i+1:]
+	}
+	for _, prefix := range developerRoleFamilies {
+		if strings.HasPrefix(name, prefix) {
+			return "developer"
+		}
+	}
+	return "system"
+}
+
+// postJSON sends body to url with the configured auth and extra headers,
+// and a fresh X-Request-ID. Non-200 responses are returned as *APIError;
+// every error names the request ids.
+func (g *Generator) postJSON(ctx context.Context, url string, body any) ([]byte, requestIDs, error) {
+	resp, ids, err := g.openJSON(ctx, g.cfg.HTTPClient, url, body)
+	if err != nil {
+		return nil, ids, err
+	}
+	defer resp.Body.Close()
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	return bodyBytes, ids, nil
+}
+
+// openJSON is postJSON that leaves reading the body of a 200 response to
+// the caller, who closes it.
+func (g *Generator) openJSON(ctx context.Context, client *http.Client, url string, body any) (*http.Response, requestIDs, error) {
+	ids := g.newRequestIDs()
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, ids, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, ids, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", ids.ID)
+	if g.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+g.cfg.APIKey)
+	}
+	for k, v := range g.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		g.cfg.Observer.Request(RequestInfo{ID: ids.ID, Err: err})
+		return nil, ids, ids.wrap(err)
+	}
+	ids.readUpstream(resp)
+	g.cfg.Observer.Request(RequestInfo{ID: ids.ID, Upstream: ids.Upstream, Status: resp.StatusCode})
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		ae := &APIError{Status: resp.Status, StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+		ae.Retryable = retryableStatus[resp.StatusCode]
+		ae.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		return nil, ids, ids.wrap(ae)
+	}
+	return resp, ids, nil
+}
+
+// chatCompletion performs an OpenAI-style chat completions call against url.
+func (g *Generator) chatCompletion(ctx context.Context, url string, c Call) (string, *Usage, error) {
+	if c.Stream != nil {
+		return g.streamCompletion(ctx, url, c)
+	}
+	bodyBytes, ids, err := g.postJSON(ctx, url, g.buildRequest(c))
+	if err != nil {
+		return "", nil, err
+	}
+	content, u, err := parseCompletion(bodyBytes, c.Model)
+	return content, u, ids.wrap(err)
+}
+
+// parseCompletion reads the answer of a chat completions response from
+// model.
+func parseCompletion(bodyBytes []byte, model string) (string, *Usage, error) {
+	var completion CompletionResponse
+	if err := json.Unmarshal(bodyBytes, &completion); err != nil {
+		return "", nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	if completion.Error != nil {
+		return "", completion.Usage, fmt.Errorf("API returned error: %s", completion.Error.Message)
+	}
+
+	if len(completion.Choices) == 0 {
+		return "", completion.Usage, fmt.Errorf("no choices returned")
+	}
+
+	msg := completion.Choices[0].Message
+	if msg.Refusal != "" {
+		return "", completion.Usage, &RefusalError{Text: msg.Refusal}
+	}
+	if len(msg.ToolCalls) > 0 {
+		names := make([]string, len(msg.ToolCalls))
+		for i, tc := range msg.ToolCalls {
+			names[i] = tc.Function.Name
+		}
+		return "", completion.Usage, fmt.Errorf("model %s answered with tool calls (%s) although no tools were offered; "+
+			"check the provider or model configuration", model, strings.Join(names, ", "))
+	}
+
+	content := string(msg.Content)
+	if strings.TrimSpace(content) == "" {
+		return "", completion.Usage, fmt.Errorf("model %s returned an empty message", model)
+	}
+	return content, completion.Usage, nil
+}
+
+// openAIBackend is an OpenAI-compatible chat completions endpoint.
+type openAIBackend struct {
+	g   *Generator
+	url string
+}
+
+func (b openAIBackend) complete(ctx context.Context, c Call) (string, *Usage, error) {
+	return b.g.chatCompletion(ctx, b.url, c)
+}
@@ -0,0 +1,129 @@
+package guide
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSystemRole(t *testing.T) {
+	tests := []struct {
+		model, override, want string
+	}{
+		{"gpt-4o", "", "system"},
+		{"gpt-4o-mini", "auto", "system"},
+		{"o1-preview", "", "developer"},
+		{"o3-mini", "", "developer"},
+		{"o4-mini", "auto", "developer"},
+		{"gpt-5", "", "developer"},
+		{"gpt-5-nano", "", "developer"},
+		{"openai/o3-mini", "", "developer"},
+		{"openrouter/openai/gpt-5", "", "developer"},
+		{"meta-llama/llama-3-70b", "", "system"},
+		// Only the name after the vendor prefix counts.
+		{"o3-labs/llama-3", "", "system"},
+		{"claude-o1", "", "system"},
+		{"o3-mini", "system", "system"},
+		{"gpt-4o", "developer", "developer"},
+		{"gpt-4o", "user", "user"},
+	}
+	for _, tt := range tests {
+		if got := SystemRole(tt.model, tt.override); got != tt.want {
+			t.Errorf("SystemRole(%q, %q) = %q, want %q", tt.model, tt.override, got, tt.want)
+		}
+	}
+}
+
+func TestBuildRequestSystemRole(t *testing.T) {
+	g, err := New(Config{SystemRole: "auto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := g.buildRequest(Call{Model: "o3-mini", System: "sys", User: "user"})
+	if len(req.Messages) != 2 || req.Messages[0].Role != "developer" || req.Messages[0].Content != "sys" || req.Messages[1].Role != "user" {
+		t.Errorf("messages = %+v, want the system prompt as developer, then the user's", req.Messages)
+	}
+}
+
+func TestMessageContentUnmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		refusal string
+		wantErr bool
+	}{
+		{name: "string", in: `"hello"`, want: "hello"},
+		{name: "null", in: `null`, want: ""},
+		{name: "empty string", in: `""`, want: ""},
+		{name: "text parts", in: `[{"type":"text","text":"a"},{"type":"text","text":"b"}]`, want: "ab"},
+		{name: "output_text parts", in: `[{"type":"output_text","text":"x"},{"type":"text","text":"y"}]`, want: "xy"},
+		{name: "no parts", in: `[]`, want: ""},
+		{name: "refusal part", in: `[{"type":"text","text":"a"},{"type":"refusal","refusal":"no"}]`, refusal: "no"},
+		{name: "image part", in: `[{"type":"image_url","image_url":{"url":"x"}}]`, wantErr: true},
+		{name: "number", in: `42`, wantErr: true},
+		{name: "object", in: `{"text":"a"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c MessageContent
+			err := c.UnmarshalJSON([]byte(tt.in))
+			var refusal *RefusalError
+			switch {
+			case tt.refusal != "":
+				if !errors.As(err, &refusal) || refusal.Text != tt.refusal {
+					t.Fatalf("err = %v, want a refusal %q", err, tt.refusal)
+				}
+			case tt.wantErr:
+				if err == nil {
+					t.Fatalf("got %q, want an error", c)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case string(c) != tt.want:
+				t.Errorf("got %q, want %q", c, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCompletion(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr string
+		tokens  int
+	}{
+		{name: "string content", body: `{"choices":[{"message":{"role":"assistant","content":"## 1. A"}}],"usage":{"total_tokens":7}}`, want: "## 1. A", tokens: 7},
+		{name: "content parts", body: `{"choices":[{"message":{"content":[{"type":"text","text":"## 1. "},{"type":"output_text","text":"A"}]}}]}`, want: "## 1. A"},
+		{name: "api error", body: `{"error":{"message":"overloaded"}}`, wantErr: "API returned error: overloaded"},
+		{name: "no choices", body: `{"choices":[],"usage":{"total_tokens":3}}`, wantErr: "no choices returned", tokens: 3},
+		{name: "empty message", body: `{"choices":[{"message":{"content":"  \n"}}]}`, wantErr: "model m returned an empty message"},
+		{name: "null content", body: `{"choices":[{"message":{"content":null}}]}`, wantErr: "model m returned an empty message"},
+		{name: "unsupported part", body: `{"choices":[{"message":{"content":[{"type":"audio"}]}}]}`, wantErr: `unsupported message content part "audio"`},
+		{name: "not json", body: `<html>`, wantErr: "decoding response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, u, err := parseCompletion([]byte(tt.body), "m")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+			tokens := 0
+			if u != nil {
+				tokens = u.TotalTokens
+			}
+			if tokens != tt.tokens {
+				t.Errorf("total tokens = %d, want %d", tokens, tt.tokens)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package guide
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Errors an API call can fail with. *APIError wraps them; check with
+// errors.Is.
+var (
+	ErrAuth          = errors.New("authentication failed")
+	ErrRateLimited   = errors.New("rate limited")
+	ErrModelNotFound = errors.New("model not found")
+)
+
+// Unwrap classifies an API error, so errors.Is sees what went wrong. The
+// retry delay of a rate-limited request stays in RetryAfter.
+func (e *APIError) Unwrap() error {
+	body := strings.ToLower(e.Body)
+	switch {
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ErrAuth
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case (e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusBadRequest) && strings.Contains(body, "model") &&
+		(strings.Contains(body, "not found") || strings.Contains(body, "not_found") || strings.Contains(body, "does not exist") || strings.Contains(body, "invalid model")):
+		return ErrModelNotFound
+	}
+	return nil
+}
+
+// RetryAfter returns how long the server asked to wait before retrying.
+func RetryAfter(err error) (time.Duration, bool) {
+	var ae *APIError
+	if errors.As(err, &ae) && ae.RetryAfter > 0 {
+		return ae.RetryAfter, true
+	}
+	return 0, false
+}
@@ -0,0 +1,99 @@
+package guide
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAPIErrorUnwrap(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   error
+	}{
+		{http.StatusUnauthorized, `{"error":{"message":"Incorrect API key provided"}}`, ErrAuth},
+		{http.StatusForbidden, `{"error":{"message":"not allowed"}}`, ErrAuth},
+		{http.StatusTooManyRequests, `{"error":{"message":"Rate limit reached"}}`, ErrRateLimited},
+		{http.StatusNotFound, `{"error":{"message":"The model 'gpt-9' does not exist","code":"model_not_found"}}`, ErrModelNotFound},
+		{http.StatusBadRequest, `{"error":{"message":"invalid model ID"}}`, ErrModelNotFound},
+		// A 404 or 400 about something else is no model error.
+		{http.StatusNotFound, `404 page not found`, nil},
+		{http.StatusBadRequest, `{"error":{"message":"maximum context length exceeded"}}`, nil},
+		{http.StatusInternalServerError, `{"error":{"message":"model overloaded"}}`, nil},
+	}
+	for _, tt := range tests {
+		ae := &APIError{Status: http.StatusText(tt.status), StatusCode: tt.status, Body: tt.body}
+		if got := ae.Unwrap(); got != tt.want {
+			t.Errorf("%d %s: Unwrap = %v, want %v", tt.status, tt.body, got, tt.want)
+		}
+		// The sentinel survives the request ids and callers' wrapping.
+		err := fmt.Errorf("chunk 3: %w", requestIDs{ID: "req-1"}.wrap(ae))
+		for _, sentinel := range []error{ErrAuth, ErrRateLimited, ErrModelNotFound} {
+			if errors.Is(err, sentinel) != (sentinel == tt.want) {
+				t.Errorf("%d %s: errors.Is(%v) = %v", tt.status, tt.body, sentinel, !(sentinel == tt.want))
+			}
+		}
+		var got *APIError
+		if !errors.As(err, &got) || got != ae {
+			t.Errorf("%d: errors.As doesn't find the *APIError", tt.status)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", &RequestError{ID: "req-1", Err: &APIError{StatusCode: 429, RetryAfter: 7 * time.Second}})
+	if d, ok := RetryAfter(err); !ok || d != 7*time.Second {
+		t.Errorf("RetryAfter = %v, %v, want 7s", d, ok)
+	}
+	if _, ok := RetryAfter(&APIError{StatusCode: 429}); ok {
+		t.Error("RetryAfter found a delay the server didn't send")
+	}
+	if _, ok := RetryAfter(errors.New("boom")); ok {
+		t.Error("RetryAfter found a delay in a plain error")
+	}
+}
+
+func TestCompleteClassifiesErrors(t *testing.T) {
+	tests := []struct {
+		status     int
+		retryAfter string
+		body       string
+		want       error
+	}{
+		{http.StatusUnauthorized, "", `{"error":{"message":"Incorrect API key provided"}}`, ErrAuth},
+		{http.StatusTooManyRequests, "120", `{"error":{"message":"Rate limit reached"}}`, ErrRateLimited},
+		{http.StatusNotFound, "", `{"error":{"message":"The model 'gpt-9' does not exist"}}`, ErrModelNotFound},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Request-Id", "upstream-1")
+			if tt.retryAfter != "" {
+				w.Header().Set("Retry-After", tt.retryAfter)
+			}
+			w.WriteHeader(tt.status)
+			fmt.Fprint(w, tt.body)
+		}))
+		retries := 0
+		g, err := New(Config{BaseURL: srv.URL, APIKey: "x", Retries: &retries, RequestIDPrefix: "test-"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = g.Complete(context.Background(), Call{System: "s", User: "u"})
+		srv.Close()
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%d: Complete = %v, want %v", tt.status, err, tt.want)
+		}
+		re, ok := FailedRequest(err)
+		if !ok || re.ID != "test-0001" || re.Upstream != "upstream-1" {
+			t.Errorf("%d: FailedRequest = %+v, %v", tt.status, re, ok)
+		}
+		if d, ok := RetryAfter(err); ok != (tt.retryAfter != "") || ok && d != 2*time.Minute {
+			t.Errorf("%d: RetryAfter = %v, %v", tt.status, d, ok)
+		}
+	}
+}
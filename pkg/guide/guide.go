@@ -0,0 +1,389 @@
+// Package guide generates study guides with an OpenAI-compatible chat
+// completions API: a numbered list of the core concepts of a subject, then
+// a markdown guide that explains them a few at a time.
+//
+// The aiguide command makes every API call through a Generator; its flags,
+// files and extra passes stay in the command. Every error is returned,
+// nothing is printed: an Observer is told what the calls do.
+package guide
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config is what a Generator needs. Only Subject is required, and only by
+// the methods that generate a whole guide.
+type Config struct {
+	// BaseURL is the API root, such as https://api.openai.com/v1 (the
+	// default); /chat/completions is appended.
+	BaseURL string
+	APIKey  string
+	Model   string // default gpt-4o
+	Subject string
+
+	Count     int // concepts to list, default 100
+	ChunkSize int // concepts answered per call, default 2
+	Threads   int // calls in flight at once, default 1
+
+	// Temperature of every call; nil means DefaultTemperature.
+	Temperature *float64
+	// SystemPrompt explains how to answer; default DefaultSystemPrompt.
+	SystemPrompt string
+	// HTTPClient sends the requests; default a client with a two-minute
+	// timeout. Streamed calls use a copy without the timeout.
+	HTTPClient *http.Client
+
+	// Backend is the kind of API at BaseURL: "openai" (the default), or
+	// "tgi" for Hugging Face Text Generation Inference, whose /generate
+	// route takes prompts in ChatTemplate (chatml, llama3, mistral or
+	// plain; default chatml).
+	Backend      string
+	ChatTemplate string
+	// Headers are sent with every request.
+	Headers map[string]string
+	// MaxTokens caps every answer; zero sends no cap.
+	MaxTokens int
+	// SystemRole is the role the system prompt is sent under; empty or
+	// "auto" picks one by model family (see SystemRole).
+	SystemRole string
+	// NoTemperature and NoSeed leave the temperature and the seed out of
+	// requests, for APIs that reject them.
+	NoTemperature bool
+	NoSeed        bool
+
+	// Retries of a call after a transient failure; nil means
+	// DefaultRetries. RetryMaxWait is the longest wait between two,
+	// default a minute; a longer Retry-After fails the call instead.
+	Retries      *int
+	RetryMaxWait time.Duration
+	// RequestIDPrefix starts the X-Request-ID of every request, which
+	// ends in a sequence number.
+	RequestIDPrefix string
+	// Limiter, when set, is waited for before every attempt of a call.
+	Limiter Limiter
+	// Observer is told about every request, attempt and retry.
+	Observer Observer
+}
+
+// Defaults of the zero Config fields, the same as the aiguide command's.
+const (
+	DefaultBaseURL      = "https://api.openai.com/v1"
+	DefaultModel        = "gpt-4o"
+	DefaultCount        = 100
+	DefaultChunkSize    = 2
+	DefaultTemperature  = 0.7
+	DefaultRetries      = 3
+	DefaultRetryMaxWait = time.Minute
+)
+
+// Generator generates the guide of one Config. Its methods may be called
+// from several goroutines.
+type Generator struct {
+	cfg     Config
+	url     string
+	backend backend
+	seq     atomic.Int64
+
+	mu    sync.Mutex
+	usage Usage
+}
+
+// New checks cfg and fills in its defaults.
+func New(cfg Config) (*Generator, error) {
+	if cfg.Count < 0 || cfg.ChunkSize < 0 || cfg.Threads < 0 {
+		return nil, errors.New("guide: Count, ChunkSize and Threads cannot be negative")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	u, err := url.Parse(cfg.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("guide: parsing the base URL: %w", err)
+	}
+	if cfg.Model == "" {
+		cfg.Model = DefaultModel
+	}
+	if cfg.Count == 0 {
+		cfg.Count = DefaultCount
+	}
+	if cfg.ChunkSize == 0 {
+		cfg.ChunkSize = DefaultChunkSize
+	}
+	if cfg.Threads == 0 {
+		cfg.Threads = 1
+	}
+	if cfg.Temperature == nil {
+		t := DefaultTemperature
+		cfg.Temperature = &t
+	}
+	if cfg.SystemPrompt == "" {
+		cfg.SystemPrompt = DefaultSystemPrompt
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 120 * time.Second}
+	}
+	if cfg.Retries == nil {
+		n := DefaultRetries
+		cfg.Retries = &n
+	}
+	if *cfg.Retries < 0 {
+		return nil, errors.New("guide: Retries cannot be negative")
+	}
+	if cfg.RetryMaxWait <= 0 {
+		cfg.RetryMaxWait = DefaultRetryMaxWait
+	}
+	if cfg.Observer == nil {
+		cfg.Observer = noObserver{}
+	}
+
+	g := &Generator{cfg: cfg}
+	switch cfg.Backend {
+	case "", "openai":
+		g.url = u.JoinPath("chat", "completions").String()
+		g.backend = openAIBackend{g: g, url: g.url}
+	case "tgi":
+		tgi := newTGIBackend(g, cfg.BaseURL, cfg.ChatTemplate)
+		g.url = tgi.chatURL()
+		g.backend = tgi
+	default:
+		return nil, fmt.Errorf("guide: unknown backend %q", cfg.Backend)
+	}
+	return g, nil
+}
+
+// URL is the chat completions endpoint the Generator calls.
+func (g *Generator) URL() string {
+	return g.url
+}
+
+// Usage returns the tokens the generator's calls have used so far.
+func (g *Generator) Usage() Usage {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.usage
+}
+
+func (g *Generator) addUsage(u Usage) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.usage.add(u)
+}
+
+// ListConcepts asks for a list with prompt, such as ListPrompt with
+// ListFormat, and returns its numbered or bulleted lines as the model wrote
+// them.
+func (g *Generator) ListConcepts(ctx context.Context, prompt string) ([]string, error) {
+	resp, _, err := g.Complete(ctx, Call{System: ListSystemPrompt, User: prompt, Purpose: "list"})
+	if err != nil {
+		return nil, err
+	}
+	return ParseConceptList(resp), nil
+}
+
+// GenerateConcepts asks for the concept list, numbered 1, 2, 3... in the
+// order the model gave.
+func (g *Generator) GenerateConcepts(ctx context.Context) ([]Concept, error) {
+	if err := g.checkSubject(); err != nil {
+		return nil, err
+	}
+	lines, err := g.ListConcepts(ctx, ListPrompt(g.cfg.Count, g.cfg.Subject)+ListFormat)
+	if err != nil {
+		return nil, fmt.Errorf("generating the concept list: %w", err)
+	}
+	concepts := numberConcepts(lines)
+	if len(concepts) == 0 {
+		return nil, errors.New("the model returned no concepts")
+	}
+	return concepts, nil
+}
+
+func (g *Generator) checkSubject() error {
+	if strings.TrimSpace(g.cfg.Subject) == "" {
+		return errors.New("guide: the subject is empty")
+	}
+	return nil
+}
+
+// SoftenedPromptSuffix is added to the prompt of a chunk the model refused,
+// for the one retry it gets.
+const SoftenedPromptSuffix = "\n\nThis is an educational study guide. Explain each item factually and at a conceptual level; " +
+	"where a topic is sensitive, focus on definitions, history, context and safety considerations."
+
+// Chunk is a request for the explanations of a few concepts.
+type Chunk struct {
+	// Concepts are the lines of the concepts, such as "3. Foo".
+	Concepts []string
+	// Prompt asks for them; default ChunkPrompt of the Concepts.
+	Prompt string
+	System string // default Config.SystemPrompt
+	Model  string // default Config.Model
+	Label  string // names the chunk in what the Observer is told
+	// Stream, when set, receives the answer as it arrives.
+	Stream func(delta string)
+}
+
+// AnswerChunk explains the concepts of c. A refusal is retried once with
+// SoftenedPromptSuffix; the answer is returned without the fences models
+// wrap it in, with the tokens both attempts used.
+func (g *Generator) AnswerChunk(ctx context.Context, c Chunk) (string, Usage, error) {
+	if c.Prompt == "" {
+		c.Prompt = ChunkPrompt(strings.Join(c.Concepts, "\n"))
+	}
+	if c.System == "" {
+		c.System = g.cfg.SystemPrompt
+	}
+	call := Call{Model: c.Model, System: c.System, User: c.Prompt, Purpose: "answer", Label: c.Label, Stream: c.Stream}
+	content, u, err := g.Complete(ctx, call)
+	var refusal *RefusalError
+	if errors.As(err, &refusal) {
+		g.cfg.Observer.Retry(call, 1, 1, 0, err)
+		call.User += SoftenedPromptSuffix
+		var retry Usage
+		content, retry, err = g.Complete(ctx, call)
+		u.add(retry)
+	}
+	if err != nil {
+		return "", u, err
+	}
+	return CleanContent(content), u, nil
+}
+
+// GenerateGuide generates the concept list and writes the guide to w: the
+// title, the Table of Contents, then the explanations in concept order.
+// Chunks are answered Threads at a time; the first error stops the run.
+func (g *Generator) GenerateGuide(ctx context.Context, w io.Writer) error {
+	concepts, err := g.GenerateConcepts(ctx)
+	if err != nil {
+		return err
+	}
+	return g.WriteGuide(ctx, w, concepts)
+}
+
+// WriteGuide writes the guide of the given concepts to w.
+func (g *Generator) WriteGuide(parent context.Context, w io.Writer, concepts []Concept) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	if err := g.checkSubject(); err != nil {
+		return err
+	}
+	if err := writeHeader(w, g.cfg.Subject, concepts); err != nil {
+		return err
+	}
+
+	var chunks [][]Concept
+	for i := 0; i < len(concepts); i += g.cfg.ChunkSize {
+		chunks = append(chunks, concepts[i:min(i+g.cfg.ChunkSize, len(concepts))])
+	}
+	results := make([]chan string, len(chunks))
+	for i := range results {
+		results[i] = make(chan string, 1)
+	}
+
+	var once sync.Once
+	var firstErr error
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range g.cfg.Threads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				content, err := g.answer(ctx, i, chunks[i])
+				if err != nil {
+					fail(fmt.Errorf("chunk %d (concepts %d-%d): %w", i+1, chunks[i][0].Number, chunks[i][len(chunks[i])-1].Number, err))
+					close(results[i])
+					continue
+				}
+				results[i] <- content
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range chunks {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Chunks are written in order as soon as they and the ones before them
+	// are done.
+	written := 0
+	for i := range chunks {
+		var content string
+		var ok bool
+		select {
+		case content, ok = <-results[i]:
+		case <-ctx.Done():
+		}
+		if !ok {
+			break
+		}
+		if _, err := fmt.Fprintf(w, "%s\n\n---\n", content); err != nil {
+			fail(err)
+			break
+		}
+		written++
+	}
+	cancel()
+	wg.Wait()
+	switch {
+	case firstErr != nil:
+		return firstErr
+	case written < len(chunks):
+		return parent.Err()
+	}
+	return nil
+}
+
+// answer explains the concepts of one chunk.
+func (g *Generator) answer(ctx context.Context, i int, chunk []Concept) (string, error) {
+	lines := make([]string, len(chunk))
+	for k, c := range chunk {
+		lines[k] = c.String()
+	}
+	content, _, err := g.AnswerChunk(ctx, Chunk{Concepts: lines, Label: fmt.Sprintf("Chunk %d", i+1)})
+	if err != nil {
+		return "", err
+	}
+	content, lost := CanonicalHeadings(content, lines)
+	if lost != nil {
+		g.cfg.Observer.Notice(fmt.Sprintf("chunk %d has no heading for %s; their Table of Contents links lead nowhere", i+1, strings.Join(lost, ", ")))
+	}
+	return content, nil
+}
+
+func writeHeader(w io.Writer, subject string, concepts []Concept) error {
+	var b strings.Builder
+	title := "Comprehensive Guide: " + strings.ToUpper(subject)
+	fmt.Fprintf(&b, "# %s\n\n## Table of Contents\n\n", title)
+	slugs := Slugger{}
+	slugs.Unique(Slug(title))
+	slugs.Unique(Slug("Table of Contents"))
+	for _, c := range concepts {
+		fmt.Fprintf(&b, "- [%s](#%s)\n", c, slugs.Unique(ConceptAnchor(c.String())))
+	}
+	b.WriteString("\n---\n\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
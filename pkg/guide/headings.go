@@ -0,0 +1,197 @@
+package guide
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ConceptHeadingRe matches a heading that starts with a concept number,
+// however the model worded it: "## 3. Foo", "### Question 3: Foo",
+// "## **3) Foo**".
+var ConceptHeadingRe = regexp.MustCompile(`(?im)^#{1,6}[ \t]+\**[ \t]*(?:(?:question|concept)[ \t]+)?(\d+)\b`)
+
+// headingLineRe matches any markdown heading line.
+var headingLineRe = regexp.MustCompile(`(?m)^(#{1,6})[ \t]+(.*?)[ \t#]*$`)
+
+type heading struct {
+	start, end int // the line, without its newline
+	level      int
+	title      string
+	numbered   bool // starts with a concept number, as ConceptHeadingRe sees it
+}
+
+// headingsOutsideFences lists the headings of content, leaving out lines
+// in fenced code blocks, such as shell or Python comments.
+func headingsOutsideFences(content string) []heading {
+	var out []heading
+	inFence := false
+	for off := 0; off < len(content); {
+		end := strings.IndexByte(content[off:], '\n')
+		if end < 0 {
+			end = len(content)
+		} else {
+			end += off
+		}
+		line := content[off:end]
+		if t := strings.TrimSpace(line); strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			inFence = !inFence
+		} else if m := headingLineRe.FindStringSubmatch(line); m != nil && !inFence {
+			out = append(out, heading{start: off, end: end, level: len(m[1]), title: m[2], numbered: ConceptHeadingRe.MatchString(line)})
+		}
+		off = end + 1
+	}
+	return out
+}
+
+// normalTitle is a heading or concept title compared loosely: without
+// emphasis, case or a trailing colon.
+func normalTitle(s string) string {
+	return strings.ToLower(strings.TrimRight(strings.TrimSpace(strings.ReplaceAll(s, "*", "")), ":"))
+}
+
+// CanonicalHeadings rewrites the heading of each concept in items, lines
+// such as "3. Foo", to "## 3. Foo": the text its Table of Contents entry
+// links to, whatever level and wording the model used. A concept's heading
+// is the first one with its number, so numbered steps inside an answer are
+// left alone. A concept with no numbered heading takes an unnumbered one:
+// its title, or the one at its place between the other concepts' headings.
+// Failing that, a heading is inserted where its answer starts, when that
+// can be told. The concepts still without a heading are returned: their
+// Table of Contents links lead nowhere.
+func CanonicalHeadings(content string, items []string) (string, []string) {
+	index := make(map[string]int, len(items))
+	for i, it := range items {
+		index[strings.TrimRight(strings.SplitN(it, " ", 2)[0], ".)")] = i
+	}
+	headings := headingsOutsideFences(content)
+	taken := make([]int, len(items)) // index into headings, -1 for none
+	for i := range taken {
+		taken[i] = -1
+	}
+	used := make([]bool, len(headings))
+
+	// By number. The number sits where ConceptHeadingRe finds it.
+	top := 7 // level of the shallowest concept heading
+	for _, m := range ConceptHeadingRe.FindAllStringSubmatchIndex(content, -1) {
+		i, ok := index[content[m[2]:m[3]]]
+		if !ok || taken[i] >= 0 {
+			continue
+		}
+		for h := range headings {
+			if headings[h].start == m[0] {
+				taken[i], used[h] = h, true
+				top = min(top, headings[h].level)
+			}
+		}
+	}
+
+	// By title.
+	for i, it := range items {
+		if taken[i] >= 0 {
+			continue
+		}
+		_, title, _ := strings.Cut(it, " ")
+		for h, hd := range headings {
+			if !used[h] && !hd.numbered && normalTitle(hd.title) == normalTitle(title) {
+				taken[i], used[h] = h, true
+				top = min(top, hd.level)
+				break
+			}
+		}
+	}
+
+	// By place: the concepts still without a heading, in runs between the
+	// concept headings found. The first concept's answer may come before any
+	// heading; then it gets one at the top. Otherwise a run takes the
+	// unnumbered headings at the concepts' level between its neighbours': as
+	// many as it has concepts, each turned into one, or a lone concept's
+	// heading goes before the first of several. A run with no such heading
+	// was merged into a neighbour's answer and can't be placed.
+	var rest []int
+	for h, hd := range headings {
+		if !used[h] && !hd.numbered && (top == 7 || hd.level <= top) {
+			rest = append(rest, h)
+		}
+	}
+	if top == 7 && len(rest) > 0 {
+		// No concept heading to go by: only the shallowest level counts.
+		level := 7
+		for _, h := range rest {
+			level = min(level, headings[h].level)
+		}
+		rest = slices.DeleteFunc(rest, func(h int) bool { return headings[h].level != level })
+	}
+
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+	var lead string // the heading put on top, if any
+	var lost []string
+	for i, h := range taken {
+		if h >= 0 {
+			edits = append(edits, edit{headings[h].start, headings[h].end, "## " + items[i]})
+		}
+	}
+	for a := 0; a < len(items); a++ {
+		if taken[a] >= 0 {
+			continue
+		}
+		b := a
+		for b+1 < len(items) && taken[b+1] < 0 {
+			b++
+		}
+		from, to := 0, len(content)
+		if a > 0 {
+			from = headings[taken[a-1]].end
+		}
+		if b+1 < len(items) {
+			to = headings[taken[b+1]].start
+		}
+		if a == 0 {
+			first := len(content)
+			if len(headings) > 0 {
+				first = headings[0].start
+			}
+			if strings.TrimSpace(content[:first]) != "" {
+				lead = "## " + items[0] + "\n\n"
+				a++
+			}
+		}
+		var between []int
+		for _, h := range rest {
+			if headings[h].start >= from && headings[h].start < to {
+				between = append(between, h)
+			}
+		}
+		run := items[a : b+1]
+		switch {
+		case len(run) == 0:
+		case len(between) == len(run):
+			for k, h := range between {
+				edits = append(edits, edit{headings[h].start, headings[h].end, "## " + run[k]})
+			}
+		case len(run) == 1 && len(between) > 1:
+			edits = append(edits, edit{headings[between[0]].start, headings[between[0]].start, "## " + run[0] + "\n\n"})
+		default:
+			lost = append(lost, run...)
+		}
+		a = b
+	}
+
+	slices.SortStableFunc(edits, func(a, b edit) int { return a.start - b.start })
+	var out strings.Builder
+	last := 0
+	for _, e := range edits {
+		out.WriteString(content[last:e.start])
+		out.WriteString(e.text)
+		last = e.end
+	}
+	out.WriteString(content[last:])
+	if lead != "" {
+		return lead + strings.TrimSpace(out.String()), lost
+	}
+	return out.String(), lost
+}
@@ -0,0 +1,131 @@
+package guide
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalHeadings(t *testing.T) {
+	items := []string{"4. Channels", "5. Select", "6. Mutexes"}
+	canonical := "## 4. Channels\n\nA.\n\n## 5. Select\n\nB.\n\n## 6. Mutexes\n\nC."
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		lost    []string
+	}{
+		{"already canonical", canonical, canonical, nil},
+		{
+			"other levels and wording",
+			"### **Concept 4: Channels**\n\nA.\n\n# 5) The select statement\n\nB.\n\n## Question 6 — Mutexes\n\nC.",
+			canonical, nil,
+		},
+		{
+			"one heading without its number",
+			"## 4. Channels\n\nA.\n\n## Select\n\nB.\n\n## 6. Mutexes\n\nC.",
+			canonical, nil,
+		},
+		{
+			"unnumbered headings taken by title",
+			"## **Mutexes:**\n\nC.\n\n## Channels\n\nA.",
+			"## 6. Mutexes\n\nC.\n\n## 4. Channels\n\nA.", []string{"5. Select"},
+		},
+		{
+			"unnumbered headings taken in order",
+			"## Passing values\n\nA.\n\n## Waiting on several\n\nB.\n\n## Locking\n\nC.",
+			canonical, nil,
+		},
+		{
+			"the last concept under an unnumbered heading",
+			"## 4. Channels\n\nA.\n\n## 5. Select\n\nB.\n\n## Locking\n\nC.",
+			canonical, nil,
+		},
+		{
+			"the first concept before any heading",
+			"A.\n\n## 5. Select\n\nB.\n\n## 6. Mutexes\n\nC.",
+			canonical, nil,
+		},
+		{
+			"numbered steps and subheadings left alone",
+			"## 4. Channels\n\n### 1. Make one\n\n### Closing\n\n```sh\n# 5 workers\n```\n\n## 5. Select\n\n### 4. Again\n\n## 6. Mutexes\n\nC.",
+			"## 4. Channels\n\n### 1. Make one\n\n### Closing\n\n```sh\n# 5 workers\n```\n\n## 5. Select\n\n### 4. Again\n\n## 6. Mutexes\n\nC.", nil,
+		},
+		{
+			// Two headings between its neighbours': the concept's answer
+			// starts at the first.
+			"a heading inserted for a concept in the middle",
+			"## 4. Channels\n\nA.\n\n## Choosing a case\n\n## Default cases\n\nB.\n\n## 6. Mutexes\n\nC.",
+			"## 4. Channels\n\nA.\n\n## 5. Select\n\n## Choosing a case\n\n## Default cases\n\nB.\n\n## 6. Mutexes\n\nC.", nil,
+		},
+		{
+			"the first concept before an unnumbered heading",
+			"A.\n\n## More on it\n\nA2.\n\n## 5. Select\n\nB.\n\n## 6. Mutexes\n\nC.",
+			"## 4. Channels\n\nA.\n\n## More on it\n\nA2.\n\n## 5. Select\n\nB.\n\n## 6. Mutexes\n\nC.", nil,
+		},
+		{
+			// Merged into the answer before it, a concept can't be placed.
+			"a concept merged into its neighbour",
+			"## 4. Channels\n\nA and B.\n\n## 6. Mutexes\n\nC.",
+			"## 4. Channels\n\nA and B.\n\n## 6. Mutexes\n\nC.", []string{"5. Select"},
+		},
+		{
+			// A heading out of place is not taken for a concept.
+			"unnumbered heading out of order",
+			"## Intro\n\n## 4. Channels\n\nA.\n\n## 6. Mutexes\n\nC.",
+			"## Intro\n\n## 4. Channels\n\nA.\n\n## 6. Mutexes\n\nC.", []string{"5. Select"},
+		},
+		{
+			"two concepts and one heading left",
+			"## 4. Channels\n\nA.\n\n## Picking and locking\n\nB and C.",
+			"## 4. Channels\n\nA.\n\n## Picking and locking\n\nB and C.", []string{"5. Select", "6. Mutexes"},
+		},
+		{
+			"a heading on top and the last concept lost",
+			"A.\n\n## 5. Select\n\nB and C.\n",
+			"## 4. Channels\n\nA.\n\n## 5. Select\n\nB and C.", []string{"6. Mutexes"},
+		},
+	}
+	for _, tt := range tests {
+		got, lost := CanonicalHeadings(tt.content, items)
+		if got != tt.want {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", tt.name, got, tt.want)
+		}
+		if !slices.Equal(lost, tt.lost) {
+			t.Errorf("%s: concepts without a heading %q, want %q", tt.name, lost, tt.lost)
+		}
+	}
+
+	// A lone concept answered without a heading gets one.
+	if got, lost := CanonicalHeadings("\nJust the answer.\n", items[:1]); got != "## 4. Channels\n\nJust the answer." || lost != nil {
+		t.Errorf("lone concept: %q, %q", got, lost)
+	}
+	if got, lost := CanonicalHeadings("", items[:1]); got != "" || !slices.Equal(lost, items[:1]) {
+		t.Errorf("empty answer: %q, %q", got, lost)
+	}
+}
+
+// TestWriteGuideLostHeading checks that the Generator tells its Observer
+// about a concept whose heading couldn't be placed.
+func TestWriteGuideLostHeading(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"## 1. Channels\n\nChannels, and select over them."}}]}`)
+	}))
+	defer srv.Close()
+	obs := &recorder{}
+	g, err := New(Config{BaseURL: srv.URL, APIKey: "x", Subject: "Go", ChunkSize: 2, Observer: obs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := g.WriteGuide(context.Background(), &out, []Concept{{1, "Channels"}, {2, "Select"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(obs.notices) != 1 || !strings.Contains(obs.notices[0], "chunk 1 has no heading for 2. Select") {
+		t.Errorf("notices = %q", obs.notices)
+	}
+}
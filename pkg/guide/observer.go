@@ -0,0 +1,43 @@
+package guide
+
+import (
+	"context"
+	"time"
+)
+
+// Observer is told what the Generator's calls do, to show progress or keep
+// metrics. Its methods may be called from several goroutines.
+type Observer interface {
+	// Request follows every HTTP request.
+	Request(r RequestInfo)
+	// Attempt follows every attempt of a call, with the tokens it used when
+	// the API reported them.
+	Attempt(c Call, took time.Duration, u *Usage, err error)
+	// Retry precedes retry n of of, after wait; err is why. A refused call
+	// retried with a softened prompt is reported with a *RefusalError.
+	Retry(c Call, n, of int, wait time.Duration, err error)
+	// Notice reports a change of course the caller may want to show, such
+	// as a fallback to another endpoint.
+	Notice(msg string)
+}
+
+// RequestInfo is one HTTP request to the model.
+type RequestInfo struct {
+	ID       string // sent as X-Request-ID
+	Upstream string // the provider's request id, when it sent one
+	Status   int    // 0 when no response came
+	Err      error  // why no response came
+}
+
+// Limiter paces calls: Wait returns once the next attempt may start, or the
+// error the call fails with instead, such as a spent budget.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+type noObserver struct{}
+
+func (noObserver) Request(RequestInfo)                        {}
+func (noObserver) Attempt(Call, time.Duration, *Usage, error) {}
+func (noObserver) Retry(Call, int, int, time.Duration, error) {}
+func (noObserver) Notice(string)                              {}
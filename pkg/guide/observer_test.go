@@ -0,0 +1,41 @@
+package guide
+
+import (
+	"sync"
+	"time"
+)
+
+// recorder is an Observer that keeps what it is told.
+type recorder struct {
+	mu       sync.Mutex
+	requests []RequestInfo
+	attempts []error
+	retries  []error
+	waits    []time.Duration
+	notices  []string
+}
+
+func (r *recorder) Request(info RequestInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, info)
+}
+
+func (r *recorder) Attempt(_ Call, _ time.Duration, _ *Usage, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts = append(r.attempts, err)
+}
+
+func (r *recorder) Retry(_ Call, _, _ int, wait time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retries = append(r.retries, err)
+	r.waits = append(r.waits, wait)
+}
+
+func (r *recorder) Notice(msg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notices = append(r.notices, msg)
+}
@@ -0,0 +1,125 @@
+package guide
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultSystemPrompt is the system prompt of a guide: how each concept is
+// explained.
+//
+//go:embed system_prompt.txt
+var DefaultSystemPrompt string
+
+// ListPrompt asks for the numbered list of n concepts of subject.
+func ListPrompt(n int, subject string) string {
+	return fmt.Sprintf("Generate a numbered list of exactly %d core questions or concepts regarding the subject: '%s'. ", n, subject)
+}
+
+// ListFormat is appended to the list request so the answer parses.
+const ListFormat = "Output ONLY the numbered list. Do not add introductions or conclusions. " +
+	"Ensure every line starts with a number followed by a dot."
+
+// ListSystemPrompt is the system prompt of the concept-list request.
+const ListSystemPrompt = "You are a helpful assistant that lists concepts concisely."
+
+// ChunkPrompt asks for the explanation of items, one concept per line.
+func ChunkPrompt(items string) string {
+	return fmt.Sprintf(
+		"Here is a list of concepts/questions:\n%s\n\n"+
+			"Provide a detailed, numbered explanation for EACH one based on the system prompt instructions. "+
+			"Maintain the original numbering exactly.",
+		items,
+	)
+}
+
+// ParseConceptList keeps the numbered or bulleted lines of a model's list.
+func ParseConceptList(resp string) []string {
+	var cleanList []string
+	scanner := bufio.NewScanner(strings.NewReader(resp))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && (isDigit(line[0]) || strings.HasPrefix(line, "-")) {
+			cleanList = append(cleanList, line)
+		}
+	}
+	return cleanList
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+var slugRe = regexp.MustCompile(`[^\p{L}\p{M}\p{N} _-]+`)
+
+// Slug is the anchor GitHub gives a heading with this text: lowercased,
+// with punctuation and emoji dropped and every space turned into a hyphen.
+// Letters and marks of every script are kept.
+func Slug(text string) string {
+	s := strings.ToLower(strings.TrimSpace(text))
+	return strings.ReplaceAll(slugRe.ReplaceAllString(s, ""), " ", "-")
+}
+
+// ConceptAnchor returns the Table of Contents anchor of a concept line
+// ("3. Foo Bar" -> "3-foo-bar"), the slug of its heading "## 3. Foo Bar".
+// It is empty for a line without a title.
+func ConceptAnchor(concept string) string {
+	if len(strings.SplitN(concept, " ", 2)) < 2 {
+		return ""
+	}
+	return Slug(concept)
+}
+
+// Slugger keeps the anchors of one document unique the way GitHub does:
+// the second heading with a slug gets "-1" appended, the third "-2".
+type Slugger map[string]int
+
+// Unique returns slug, suffixed if an earlier heading took it.
+func (s Slugger) Unique(slug string) string {
+	u := slug
+	for {
+		if _, taken := s[u]; !taken {
+			break
+		}
+		s[slug]++
+		u = slug + "-" + strconv.Itoa(s[slug])
+	}
+	s[u] = 0
+	return u
+}
+
+var conceptPrefixRe = regexp.MustCompile(`^\s*(?:\d+[.)]|[-*])\s*`)
+
+// Concept is one entry of a guide's concept list.
+type Concept struct {
+	Number int
+	Title  string
+}
+
+// String is the concept as the list and its heading number it: "3. Title".
+func (c Concept) String() string {
+	return strconv.Itoa(c.Number) + ". " + c.Title
+}
+
+// numberConcepts turns list lines into concepts numbered 1, 2, 3... in
+// order, whatever numbers or bullets the lines had.
+func numberConcepts(lines []string) []Concept {
+	out := make([]Concept, 0, len(lines))
+	for i, l := range lines {
+		out = append(out, Concept{Number: i + 1, Title: strings.TrimSpace(conceptPrefixRe.ReplaceAllString(l, ""))})
+	}
+	return out
+}
+
+// CleanContent strips the markdown fences models like to wrap answers in.
+func CleanContent(content string) string {
+	content = strings.TrimSpace(content)
+	content = strings.TrimPrefix(content, "```markdown")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+	return content
+}
@@ -0,0 +1,78 @@
+package guide
+
+import "testing"
+
+func TestSlug(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"punctuation", "3. What's `select` (and why)?", "3-whats-select-and-why"},
+		{"symbols between words", "C++ & C#: pointers!", "c--c-pointers"},
+		{"underscores and hyphens", "snake_case-and-dash", "snake_case-and-dash"},
+		{"inner spaces", "  Padded  Title  ", "padded--title"},
+		{"emoji", "1. Goroutines 🧵", "1-goroutines-"},
+		{"emoji around the title", "🚀 Launch 🚀", "-launch-"},
+		{"Cyrillic", "4. Горутины и каналы", "4-горутины-и-каналы"},
+		{"Greek, lowercased", "6. Ελληνικά Γράμματα", "6-ελληνικά-γράμματα"},
+		{"CJK", "5. 並行処理", "5-並行処理"},
+		{"Devanagari marks", "7. हिन्दी सिंक", "7-हिन्दी-सिंक"},
+		{"Arabic", "8. مرحبا بالعالم", "8-مرحبا-بالعالم"},
+		{"accents", "9. Café crème", "9-café-crème"},
+	}
+	for _, tt := range tests {
+		if got := Slug(tt.text); got != tt.want {
+			t.Errorf("%s: Slug(%q) = %q, want %q", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestConceptAnchor(t *testing.T) {
+	tests := []struct{ concept, want string }{
+		{"3. Foo Bar", "3-foo-bar"},
+		{"12. Ownership & Borrowing!", "12-ownership--borrowing"},
+		{"4. Горутины", "4-горутины"},
+		// Concepts with the same title differ by their numbers.
+		{"2. Channels", "2-channels"},
+		{"7. Channels", "7-channels"},
+		{"12", ""},
+	}
+	for _, tt := range tests {
+		if got := ConceptAnchor(tt.concept); got != tt.want {
+			t.Errorf("ConceptAnchor(%q) = %q, want %q", tt.concept, got, tt.want)
+		}
+	}
+}
+
+func TestSluggerUnique(t *testing.T) {
+	for _, seq := range [][][2]string{
+		// Repeated titles get -1, -2 in the order they appear.
+		{{"channels", "channels"}, {"channels", "channels-1"}, {"select", "select"}, {"channels", "channels-2"}},
+		// A heading that already looks suffixed is skipped over, and
+		// suffixed in turn when it repeats.
+		{{"a", "a"}, {"a-1", "a-1"}, {"a", "a-2"}, {"a-1", "a-1-1"}},
+	} {
+		s := Slugger{}
+		for i, step := range seq {
+			if got := s.Unique(step[0]); got != step[1] {
+				t.Errorf("%v, heading %d: Unique(%q) = %q, want %q", seq, i+1, step[0], got, step[1])
+			}
+		}
+	}
+}
+
+// TestCanonicalHeadingAnchors checks that the headings CanonicalHeadings
+// writes have the slugs the Table of Contents links to.
+func TestCanonicalHeadingAnchors(t *testing.T) {
+	items := []string{"4. Горутины и каналы", "5. What's `select`?", "6. Launch 🚀"}
+	content := "### 4) горутины и каналы\n\nA.\n\n# **Concept 5: select**\n\nB.\n\n## Question 6 — launch\n\nC."
+	got, _ := CanonicalHeadings(content, items)
+	headings := headingsOutsideFences(got)
+	if len(headings) != len(items) {
+		t.Fatalf("%d headings in:\n%s", len(headings), got)
+	}
+	for i, h := range headings {
+		if Slug(h.title) != ConceptAnchor(items[i]) {
+			t.Errorf("heading %q has the slug %q, the ToC links to %q", h.title, Slug(h.title), ConceptAnchor(items[i]))
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package guide
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseCompletionRefusal(t *testing.T) {
+	for _, tt := range []struct{ file, text string }{
+		{"testdata/refusal.json", "I can't help with that."},
+		{"testdata/refusal_part.json", "Not something I can explain."},
+	} {
+		body, err := os.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = parseCompletion(body, "m")
+		var refusal *RefusalError
+		if !errors.As(err, &refusal) || refusal.Text != tt.text {
+			t.Errorf("%s: err = %v, want a refusal %q", tt.file, err, tt.text)
+		}
+		if !errors.Is(err, ErrRefused) {
+			t.Errorf("%s: errors.Is(err, ErrRefused) is false", tt.file)
+		}
+	}
+}
+
+func TestParseCompletionToolCalls(t *testing.T) {
+	body, err := os.ReadFile("testdata/tool_calls.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, u, err := parseCompletion(body, "gpt-test")
+	if content != "" || err == nil {
+		t.Fatalf("got %q, %v; want an error", content, err)
+	}
+	for _, want := range []string{"gpt-test", "tool calls (web_search, lookup)", "no tools were offered"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	if u == nil || u.TotalTokens != 52 {
+		t.Errorf("usage = %+v, want the 52 tokens the call used", u)
+	}
+}
+
+// TestAnswerChunkRefusal checks that a refused chunk is asked once more
+// with the softened prompt, and that a second refusal is returned.
+func TestAnswerChunkRefusal(t *testing.T) {
+	refusal, err := os.ReadFile("testdata/refusal.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name     string
+		refusals int
+		wantErr  bool
+	}{
+		{"refused once", 1, false},
+		{"refused twice", 2, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var prompts []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req CompletionRequest
+				b, _ := io.ReadAll(r.Body)
+				json.Unmarshal(b, &req)
+				mu.Lock()
+				prompts = append(prompts, req.Messages[1].Content)
+				n := len(prompts)
+				mu.Unlock()
+				if n <= tt.refusals {
+					w.Write(refusal)
+					return
+				}
+				w.Write([]byte("{\"choices\":[{\"message\":{\"content\":\"```markdown\\n## 1. Foo\\n\\nText.\\n```\"}}],\"usage\":{\"total_tokens\":10}}"))
+			}))
+			defer srv.Close()
+
+			obs := &recorder{}
+			g, err := New(Config{BaseURL: srv.URL, Observer: obs})
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, u, err := g.AnswerChunk(context.Background(), Chunk{Concepts: []string{"1. Foo"}, Label: "Chunk 1"})
+			if len(prompts) != 2 || strings.Contains(prompts[0], SoftenedPromptSuffix) || !strings.HasSuffix(prompts[1], SoftenedPromptSuffix) {
+				t.Fatalf("prompts = %q, want the chunk prompt, then it softened", prompts)
+			}
+			if len(obs.retries) != 1 || !errors.Is(obs.retries[0], ErrRefused) {
+				t.Errorf("observed retries %v, want the refusal", obs.retries)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrRefused) {
+					t.Errorf("err = %v, want the refusal", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content != "\n## 1. Foo\n\nText.\n" {
+				t.Errorf("content = %q, want the answer without its fences", content)
+			}
+			if u.TotalTokens != 56 {
+				t.Errorf("tokens = %d, want both attempts' 56", u.TotalTokens)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package guide
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// upstreamIDHeaders are the response headers providers put their own request
+// id in, most specific first.
+var upstreamIDHeaders = []string{"X-Request-Id", "Request-Id", "X-Amzn-Requestid", "Cf-Ray"}
+
+// requestIDs name one HTTP request to the model: ours, sent as X-Request-ID,
+// and the provider's, when it sends one back.
+type requestIDs struct {
+	ID       string
+	Upstream string
+}
+
+func (g *Generator) newRequestIDs() requestIDs {
+	return requestIDs{ID: fmt.Sprintf("%s%04d", g.cfg.RequestIDPrefix, g.seq.Add(1))}
+}
+
+// readUpstream takes the provider's request id from resp. A gateway that
+// only echoes our X-Request-ID back doesn't count.
+func (r *requestIDs) readUpstream(resp *http.Response) {
+	for _, h := range upstreamIDHeaders {
+		if v := resp.Header.Get(h); v != "" && v != r.ID {
+			r.Upstream = v
+			return
+		}
+	}
+}
+
+func (r requestIDs) String() string {
+	if r.Upstream == "" {
+		return "request " + r.ID
+	}
+	return fmt.Sprintf("request %s, upstream id %s", r.ID, r.Upstream)
+}
+
+// wrap ties err to the request it came from.
+func (r requestIDs) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RequestError{ID: r.ID, Upstream: r.Upstream, Err: err}
+}
+
+// RequestError is a failed request to the model. Its text names the request
+// ids, to correlate with a provider's dashboard or support.
+type RequestError struct {
+	ID       string // sent as X-Request-ID
+	Upstream string // the provider's own id, when it sent one back
+	Err      error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%v (%s)", e.Err, requestIDs{e.ID, e.Upstream})
+}
+
+func (e *RequestError) Unwrap() error { return e.Err }
+
+// FailedRequest returns the request err came from.
+func FailedRequest(err error) (*RequestError, bool) {
+	var re *RequestError
+	if errors.As(err, &re) {
+		return re, true
+	}
+	return nil, false
+}
@@ -0,0 +1,77 @@
+package guide
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// retryableStatus are the responses worth another attempt: rate limits and
+// the transient failures of an overloaded or restarting backend.
+var retryableStatus = map[int]bool{
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// Retryable reports whether err is transient: a retryable response, a
+// connection reset or a timeout. Authentication errors and requests the
+// backend rejects, such as a prompt over the context length, are not.
+func Retryable(err error) bool {
+	var ae *APIError
+	if errors.As(err, &ae) {
+		return ae.Retryable
+	}
+	var ne net.Error
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		(errors.As(err, &ne) && ne.Timeout())
+}
+
+// parseRetryAfter reads a Retry-After header, in seconds or as an HTTP date.
+func parseRetryAfter(h string) time.Duration {
+	h = strings.TrimSpace(h)
+	if secs, err := strconv.Atoi(h); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// retryDelay is how long to wait before retry number attempt+1: the
+// server's Retry-After when it sent one, otherwise exponential backoff from
+// one second with jitter, so parallel workers don't retry in lockstep. ok
+// is false when the server asks for longer than maxWait.
+func retryDelay(attempt int, err error, maxWait time.Duration) (time.Duration, bool) {
+	if d, ok := RetryAfter(err); ok {
+		return d, d <= maxWait
+	}
+	d := min(time.Second<<attempt, maxWait)
+	return d/2 + rand.N(d/2+1), true
+}
+
+// RetryReason describes a retryable error in a few words for a progress
+// line; the full error is reported if the retries run out.
+func RetryReason(err error) string {
+	var ae *APIError
+	var ne net.Error
+	switch {
+	case errors.As(err, &ae):
+		return "the provider answered " + ae.Status
+	case errors.As(err, &ne) && ne.Timeout():
+		return "the request timed out"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "the connection was refused"
+	}
+	return "the connection was reset"
+}
@@ -0,0 +1,185 @@
+package guide
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		h    string
+		want time.Duration
+	}{
+		{"7", 7 * time.Second},
+		{" 3 ", 3 * time.Second},
+		{"0", 0},
+		{"-5", 0},
+		{"soon", 0},
+		{"", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.h); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.h, got, tt.want)
+		}
+	}
+	// An HTTP date is a wait until then; the header has whole seconds.
+	date := time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 88*time.Second || got > 90*time.Second {
+		t.Errorf("parseRetryAfter(%q) = %s, want about 90s", date, got)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	asked := &APIError{StatusCode: 429, RetryAfter: 5 * time.Second}
+	if d, ok := retryDelay(0, asked, time.Minute); !ok || d != 5*time.Second {
+		t.Errorf("with Retry-After: %s, %v; want 5s", d, ok)
+	}
+	if d, ok := retryDelay(0, &APIError{StatusCode: 429, RetryAfter: 2 * time.Minute}, time.Minute); ok || d != 2*time.Minute {
+		t.Errorf("Retry-After over the maximum: %s, %v; want 2m and no retry", d, ok)
+	}
+	// Without one, the backoff doubles from a second, half of it jitter.
+	for _, tt := range []struct {
+		attempt  int
+		max      time.Duration
+		min, top time.Duration
+	}{
+		{0, time.Minute, 500 * time.Millisecond, time.Second},
+		{1, time.Minute, time.Second, 2 * time.Second},
+		{3, time.Minute, 4 * time.Second, 8 * time.Second},
+		{10, time.Minute, 30 * time.Second, time.Minute},
+		{3, 3 * time.Second, 1500 * time.Millisecond, 3 * time.Second},
+	} {
+		for range 20 {
+			d, ok := retryDelay(tt.attempt, errors.New("connection reset"), tt.max)
+			if !ok || d < tt.min || d > tt.top {
+				t.Fatalf("attempt %d, max %s: %s, %v; want %s-%s", tt.attempt, tt.max, d, ok, tt.min, tt.top)
+			}
+		}
+	}
+}
+
+// flakyServer answers the first len(fail) requests with those statuses, 0
+// dropping the connection, and the rest with a completion.
+func flakyServer(t *testing.T, retryAfter string, fail ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		if n <= len(fail) {
+			if fail[n-1] == 0 {
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(fail[n-1])
+			fmt.Fprintf(w, `{"error":{"message":"attempt %d failed"}}`, n)
+			return
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"done"}}],"usage":{"prompt_tokens":3,"completion_tokens":4,"total_tokens":7}}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+type countingLimiter struct{ n atomic.Int32 }
+
+func (l *countingLimiter) Wait(context.Context) error {
+	l.n.Add(1)
+	return nil
+}
+
+func TestCompleteRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		retries    int
+		retryAfter string
+		fail       []int
+		calls      int
+		ok         bool
+	}{
+		{"rate limit, then an answer", 3, "", []int{429}, 2, true},
+		{"each retryable status", 5, "", []int{500, 502, 503, 504}, 5, true},
+		{"connection reset", 3, "", []int{0}, 2, true},
+		{"retries run out", 2, "", []int{503, 503, 503}, 3, false},
+		{"no retries", 0, "", []int{503}, 1, false},
+		{"bad request fails at once", 3, "", []int{400}, 1, false},
+		{"auth error fails at once", 3, "", []int{401}, 1, false},
+		{"Retry-After over the maximum", 3, "3600", []int{429}, 1, false},
+	}
+	for _, tt := range tests {
+		srv, calls := flakyServer(t, tt.retryAfter, tt.fail...)
+		obs := &recorder{}
+		lim := &countingLimiter{}
+		g, err := New(Config{BaseURL: srv.URL, APIKey: "x", Retries: &tt.retries, RetryMaxWait: 10 * time.Millisecond, Observer: obs, Limiter: lim})
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, u, err := g.Complete(context.Background(), Call{System: "s", User: "u"})
+		if got := int(calls.Load()); got != tt.calls {
+			t.Errorf("%s: %d requests, want %d", tt.name, got, tt.calls)
+		}
+		if tt.ok != (err == nil) || tt.ok && content != "done" {
+			t.Errorf("%s: Complete = %q, %v", tt.name, content, err)
+		}
+		if tt.ok && u.TotalTokens != 7 {
+			t.Errorf("%s: usage %+v", tt.name, u)
+		}
+		if len(obs.retries) != tt.calls-1 || len(obs.attempts) != tt.calls || int(lim.n.Load()) != tt.calls {
+			t.Errorf("%s: %d retries, %d attempts and %d limiter waits for %d requests", tt.name, len(obs.retries), len(obs.attempts), lim.n.Load(), tt.calls)
+		}
+		for _, w := range obs.waits {
+			if w > 10*time.Millisecond {
+				t.Errorf("%s: waited %s, over --retry-max-wait", tt.name, w)
+			}
+		}
+	}
+}
+
+func TestCompleteRetryHonorsRetryAfter(t *testing.T) {
+	srv, calls := flakyServer(t, "1", 429)
+	obs := &recorder{}
+	retries := 1
+	g, err := New(Config{BaseURL: srv.URL, APIKey: "x", Retries: &retries, RetryMaxWait: time.Minute, Observer: obs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, _, err := g.Complete(context.Background(), Call{System: "s", User: "u"}); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took < time.Second || calls.Load() != 2 {
+		t.Errorf("%d requests in %s, want 2 a second apart", calls.Load(), took)
+	}
+	if len(obs.waits) != 1 || obs.waits[0] != time.Second {
+		t.Errorf("waits = %v, want the server's 1s", obs.waits)
+	}
+	if !errors.Is(obs.retries[0], ErrRateLimited) {
+		t.Errorf("retried for %v", obs.retries[0])
+	}
+}
+
+func TestCompleteRetryCancelled(t *testing.T) {
+	srv, calls := flakyServer(t, "30", 429, 429)
+	retries := 3
+	g, err := New(Config{BaseURL: srv.URL, APIKey: "x", Retries: &retries, RetryMaxWait: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err = g.Complete(ctx, Call{System: "s", User: "u"})
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 5*time.Second || calls.Load() != 1 {
+		t.Errorf("Complete = %v after %s and %d requests; want it to stop waiting when cancelled", err, time.Since(start), calls.Load())
+	}
+}
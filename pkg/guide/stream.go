@@ -0,0 +1,143 @@
+package guide
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// StreamIdleTimeout is how long a stream may go without sending anything,
+// keep-alive comments included, before it is given up. Unlike a buffered
+// request, a streamed answer has no overall time limit.
+const StreamIdleTimeout = 120 * time.Second
+
+// streamEvent is one data payload of a streamed chat completion. The last
+// one may carry only the usage; servers report errors mid-stream as an
+// error object.
+type streamEvent struct {
+	Choices []struct {
+		Delta struct {
+			Content MessageContent `json:"content"`
+			Refusal string         `json:"refusal"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// streamCompletion is chatCompletion with "stream": true. A stream that
+// breaks off once part of the answer was handed to c.Stream is not
+// retried, since that part can't be taken back.
+func (g *Generator) streamCompletion(parent context.Context, url string, c Call) (string, *Usage, error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	idle := time.AfterFunc(StreamIdleTimeout, cancel)
+	defer idle.Stop()
+
+	client := *g.cfg.HTTPClient
+	client.Timeout = 0
+	resp, ids, err := g.openJSON(ctx, &client, url, g.buildRequest(c))
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	var sb strings.Builder
+	content, u, err := readStream(resp.Body, c, &sb, func() { idle.Reset(StreamIdleTimeout) })
+	if err != nil && ctx.Err() != nil && parent.Err() == nil {
+		err = fmt.Errorf("the stream sent nothing for %s", StreamIdleTimeout)
+	}
+	if err != nil && sb.Len() > 0 {
+		var refusal *RefusalError
+		if !errors.As(err, &refusal) {
+			err = fmt.Errorf("the answer stream broke off: %v", err)
+		}
+	}
+	return content, u, ids.wrap(err)
+}
+
+// readStream reads the server-sent events of a streamed completion into sb,
+// handing each piece of text to c.Stream. Comment lines, which servers
+// send as keep-alives, and fields other than data are skipped; seen is
+// called for every line.
+func readStream(r io.Reader, c Call, sb *strings.Builder, seen func()) (string, *Usage, error) {
+	var u *Usage
+	var refusal strings.Builder
+	var data []string
+	finished := false
+
+	dispatch := func() error {
+		payload := strings.Join(data, "\n")
+		data = data[:0]
+		if payload == "" {
+			return nil
+		}
+		if payload == "[DONE]" {
+			finished = true
+			return nil
+		}
+		var ev streamEvent
+		if err := json.Unmarshal([]byte(payload), &ev); err != nil {
+			return fmt.Errorf("decoding stream event: %w", err)
+		}
+		if ev.Usage != nil {
+			u = ev.Usage
+		}
+		if ev.Error != nil {
+			return fmt.Errorf("API returned error: %s", ev.Error.Message)
+		}
+		if len(ev.Choices) > 0 {
+			ch := ev.Choices[0]
+			refusal.WriteString(ch.Delta.Refusal)
+			if ch.Delta.Content != "" {
+				sb.WriteString(string(ch.Delta.Content))
+				c.Stream(string(ch.Delta.Content))
+			}
+			if ch.FinishReason != "" {
+				finished = true
+			}
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		seen()
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		switch {
+		case line == "":
+			if err := dispatch(); err != nil {
+				return sb.String(), u, err
+			}
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return sb.String(), u, err
+	}
+	// The last event needs no blank line after it.
+	if err := dispatch(); err != nil {
+		return sb.String(), u, err
+	}
+
+	switch {
+	case refusal.Len() > 0:
+		return "", u, &RefusalError{Text: refusal.String()}
+	case !finished:
+		return sb.String(), u, io.ErrUnexpectedEOF
+	case strings.TrimSpace(sb.String()) == "":
+		return "", u, fmt.Errorf("model %s returned an empty message", c.Model)
+	}
+	return sb.String(), u, nil
+}
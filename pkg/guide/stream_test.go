@@ -0,0 +1,126 @@
+package guide
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		want   string
+		deltas int
+		tokens int // total tokens reported, 0 for none
+		err    string
+	}{
+		{
+			"text, usage and done",
+			"data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\"}]}\n\n" +
+				"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":2,\"completion_tokens\":3,\"total_tokens\":5}}\n\n" +
+				"data: [DONE]\n\n",
+			"Hello", 2, 5, "",
+		},
+		{
+			"keep-alives, other fields and CRLF",
+			": ping\r\n\r\nevent: message\r\nid: 1\r\ndata: {\"choices\":[{\"delta\":{\"content\":\"ok\"}}]}\r\n\r\n: ping\r\n\r\ndata: [DONE]\r\n\r\n",
+			"ok", 1, 0, "",
+		},
+		{
+			"an event over several data lines",
+			"data: {\"choices\":[{\"delta\":\ndata: {\"content\":\"joined\"}}]}\n\ndata: [DONE]",
+			"joined", 1, 0, "",
+		},
+		{
+			"content parts",
+			"data: {\"choices\":[{\"delta\":{\"content\":[{\"type\":\"text\",\"text\":\"part\"}]},\"finish_reason\":\"stop\"}]}\n",
+			"part", 1, 0, "",
+		},
+		{
+			"cut off before the end",
+			"data: {\"choices\":[{\"delta\":{\"content\":\"Half\"}}]}\n\n",
+			"Half", 1, 0, io.ErrUnexpectedEOF.Error(),
+		},
+		{
+			"an error mid-stream",
+			"data: {\"choices\":[{\"delta\":{\"content\":\"Some\"}}]}\n\ndata: {\"error\":{\"message\":\"overloaded\"}}\n\n",
+			"Some", 1, 0, "API returned error: overloaded",
+		},
+		{
+			"an event that isn't JSON",
+			"data: {\"choices\":\n\n",
+			"", 0, 0, "decoding stream event",
+		},
+		{
+			"nothing but whitespace",
+			"data: {\"choices\":[{\"delta\":{\"content\":\"  \\n\"},\"finish_reason\":\"stop\"}]}\n\n",
+			"", 1, 0, "model m returned an empty message",
+		},
+	}
+	for _, tt := range tests {
+		var deltas []string
+		var sb strings.Builder
+		seen := 0
+		c := Call{Model: "m", Stream: func(d string) { deltas = append(deltas, d) }}
+		got, u, err := readStream(strings.NewReader(tt.body), c, &sb, func() { seen++ })
+		if got != tt.want || len(deltas) != tt.deltas || strings.Join(deltas, "") != sb.String() {
+			t.Errorf("%s: got %q from deltas %q, want %q from %d", tt.name, got, deltas, tt.want, tt.deltas)
+		}
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+		}
+		tokens := 0
+		if u != nil {
+			tokens = u.TotalTokens
+		}
+		if tokens != tt.tokens {
+			t.Errorf("%s: %d tokens reported, want %d", tt.name, tokens, tt.tokens)
+		}
+		if seen == 0 {
+			t.Errorf("%s: seen was never called", tt.name)
+		}
+	}
+}
+
+func TestReadStreamRefusal(t *testing.T) {
+	body := "data: {\"choices\":[{\"delta\":{\"refusal\":\"I can't \"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"refusal\":\"help.\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n"
+	var sb strings.Builder
+	got, _, err := readStream(strings.NewReader(body), Call{Stream: func(string) {}}, &sb, func() {})
+	var refusal *RefusalError
+	if got != "" || !errors.As(err, &refusal) || refusal.Text != "I can't help." {
+		t.Errorf("readStream = %q, %v; want the refusal", got, err)
+	}
+}
+
+// TestStreamBrokenOff checks that a stream cut off after part of the answer
+// was handed on is reported as such and not retried.
+func TestStreamBrokenOff(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Half an\"}}]}\n\n")
+	}))
+	defer srv.Close()
+	retries := 3
+	g, err := New(Config{BaseURL: srv.URL, APIKey: "x", Retries: &retries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shown strings.Builder
+	content, _, err := g.Complete(context.Background(), Call{System: "s", User: "u", Stream: func(d string) { shown.WriteString(d) }})
+	if err == nil || !strings.Contains(err.Error(), "the answer stream broke off") || calls != 1 {
+		t.Errorf("Complete = %q, %v after %d requests; want the break reported after 1", content, err, calls)
+	}
+	if shown.String() != "Half an" {
+		t.Errorf("streamed %q", shown.String())
+	}
+}
@@ -0,0 +1,171 @@
+package guide
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxTokens caps the answer of a backend that needs a cap, such as
+// TGI's /generate, when Config.MaxTokens is zero.
+const DefaultMaxTokens = 4096
+
+// tgiBackend talks to Hugging Face Text Generation Inference endpoints. It
+// prefers TGI's OpenAI-compatible /v1/chat/completions route, which applies
+// the model's own chat template, and falls back to /generate with a
+// client-side template when the server doesn't offer it.
+type tgiBackend struct {
+	g        *Generator
+	root     string
+	template string
+
+	mu     sync.Mutex
+	noChat bool
+}
+
+func newTGIBackend(g *Generator, baseURL, template string) *tgiBackend {
+	root := strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1")
+	if template == "" {
+		template = "chatml"
+	}
+	return &tgiBackend{g: g, root: root, template: template}
+}
+
+func (p *tgiBackend) chatURL() string {
+	return p.root + "/v1/chat/completions"
+}
+
+func (p *tgiBackend) complete(ctx context.Context, c Call) (string, *Usage, error) {
+	p.mu.Lock()
+	noChat := p.noChat
+	p.mu.Unlock()
+
+	if !noChat {
+		content, u, err := p.g.chatCompletion(ctx, p.chatURL(), c)
+		var ae *APIError
+		if !errors.As(err, &ae) || (ae.StatusCode != http.StatusNotFound && ae.StatusCode != http.StatusMethodNotAllowed) {
+			return content, u, classifyTGIError(err)
+		}
+
+		p.mu.Lock()
+		if !p.noChat {
+			p.noChat = true
+			p.g.cfg.Observer.Notice(fmt.Sprintf("%s has no chat completions route, falling back to /generate with the %s template", p.root, p.template))
+		}
+		p.mu.Unlock()
+	}
+
+	return p.generate(ctx, c)
+}
+
+type tgiParameters struct {
+	Temperature    *float64 `json:"temperature,omitempty"`
+	MaxNewTokens   int      `json:"max_new_tokens"`
+	Seed           *int     `json:"seed,omitempty"`
+	ReturnFullText bool     `json:"return_full_text"`
+	Details        bool     `json:"details"`
+}
+
+type tgiRequest struct {
+	Inputs     string        `json:"inputs"`
+	Parameters tgiParameters `json:"parameters"`
+}
+
+type tgiResponse struct {
+	GeneratedText string `json:"generated_text"`
+	Details       *struct {
+		GeneratedTokens int `json:"generated_tokens"`
+	} `json:"details"`
+}
+
+// tgiErrorBody is the error payload shared by TGI and HF Inference Endpoints.
+type tgiErrorBody struct {
+	Error         string  `json:"error"`
+	ErrorType     string  `json:"error_type"`
+	EstimatedTime float64 `json:"estimated_time"`
+}
+
+func (p *tgiBackend) generate(ctx context.Context, c Call) (string, *Usage, error) {
+	params := tgiParameters{
+		MaxNewTokens: p.g.cfg.MaxTokens,
+		Details:      true,
+	}
+	if params.MaxNewTokens == 0 {
+		params.MaxNewTokens = DefaultMaxTokens
+	}
+	// TGI rejects temperature 0; omitting it means greedy decoding.
+	if c.Temperature != nil && *c.Temperature > 0 && !p.g.cfg.NoTemperature {
+		params.Temperature = c.Temperature
+	}
+	if !p.g.cfg.NoSeed {
+		params.Seed = c.Seed
+	}
+
+	req := tgiRequest{Inputs: applyChatTemplate(p.template, c.System, c.User), Parameters: params}
+	body, ids, err := p.g.postJSON(ctx, p.root+"/generate", req)
+	if err != nil {
+		return "", nil, classifyTGIError(err)
+	}
+
+	// TGI returns an object; the HF serverless API wraps it in an array.
+	var out tgiResponse
+	if err := json.Unmarshal(body, &out); err != nil {
+		var list []tgiResponse
+		if err2 := json.Unmarshal(body, &list); err2 != nil || len(list) == 0 {
+			return "", nil, ids.wrap(fmt.Errorf("unexpected TGI response: %w", err))
+		}
+		out = list[0]
+	}
+
+	var u *Usage
+	if out.Details != nil {
+		u = &Usage{CompletionTokens: out.Details.GeneratedTokens, TotalTokens: out.Details.GeneratedTokens}
+	}
+	return out.GeneratedText, u, nil
+}
+
+// classifyTGIError marks overload, model-loading and transient generation
+// failures as retryable. Validation errors (422) are left as they are.
+func classifyTGIError(err error) error {
+	var ae *APIError
+	if !errors.As(err, &ae) {
+		return err
+	}
+
+	var body tgiErrorBody
+	_ = json.Unmarshal([]byte(ae.Body), &body)
+
+	switch {
+	case ae.StatusCode == http.StatusTooManyRequests, body.ErrorType == "overloaded":
+		ae.Retryable = true
+	case ae.StatusCode == http.StatusServiceUnavailable:
+		// Scaled-to-zero endpoints answer 503 while the model loads.
+		ae.Retryable = true
+		if body.EstimatedTime > 0 && ae.RetryAfter == 0 {
+			ae.RetryAfter = time.Duration(body.EstimatedTime * float64(time.Second))
+		}
+	case ae.StatusCode == http.StatusFailedDependency, body.ErrorType == "generation", body.ErrorType == "incomplete_generation":
+		ae.Retryable = true
+	}
+	return err
+}
+
+func applyChatTemplate(template, sys, user string) string {
+	switch template {
+	case "llama3":
+		return "<|begin_of_text|><|start_header_id|>system<|end_header_id|>\n\n" + sys +
+			"<|eot_id|><|start_header_id|>user<|end_header_id|>\n\n" + user +
+			"<|eot_id|><|start_header_id|>assistant<|end_header_id|>\n\n"
+	case "mistral":
+		return "<s>[INST] " + sys + "\n\n" + user + " [/INST]"
+	case "plain":
+		return sys + "\n\n" + user + "\n\n"
+	default:
+		return "<|im_start|>system\n" + sys + "<|im_end|>\n<|im_start|>user\n" + user + "<|im_end|>\n<|im_start|>assistant\n"
+	}
+}
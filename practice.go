@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const practiceRetries = 2
+
+var practiceMarkerRe = regexp.MustCompile(`(?m)^[ \t]*=+[ \t]*(PROBLEM|SOLUTION)[ \t]+(\d+)\.(\d+)(?:[ \t]*\((\w+)\))?[ \t]*=*[ \t]*$`)
+
+type practiceProblem struct {
+	Grade    string
+	Problem  string
+	Solution string
+}
+
+type practiceEntry struct {
+	Number  int
+	Concept string
+	practiceProblem
+}
+
+// practiceBook collects --practice problems per chunk while workers run and
+// numbers them globally once the chunks are written in order.
+type practiceBook struct {
+	n       int
+	mode    string                // inline, end or separate
+	sets    [][][]practiceProblem // chunk -> item -> problems
+	entries []practiceEntry       // collected for end and separate
+}
+
+func newPracticeBook(chunks int) *practiceBook {
+	if cfg.Practice <= 0 {
+		return nil
+	}
+	return &practiceBook{n: cfg.Practice, mode: cfg.Solutions, sets: make([][][]practiceProblem, chunks)}
+}
+
+// generate fills in the problems for j. Concepts whose problems can't be
+// parsed or lack a solution are asked for again; after practiceRetries they
+// are left without problems and reported.
+func (b *practiceBook) generate(j chunk) {
+	numbers := chunkNumbers(j.items)
+	got := map[string][]practiceProblem{}
+	pending := j.items
+
+	for attempt := 0; attempt <= practiceRetries && len(pending) > 0; attempt++ {
+		parsed, err := requestPractice(pending, b.n, j.model)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating practice problems for chunk %d: %v\n", j.id+1, err)
+			continue
+		}
+		var missing []string
+		for _, item := range pending {
+			num := conceptNumber(item)
+			if ps := parsed[num]; len(ps) >= b.n {
+				got[num] = ps[:b.n]
+			} else {
+				missing = append(missing, item)
+			}
+		}
+		pending = missing
+	}
+	if len(pending) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: no valid practice problems for concept(s) %s\n", strings.Join(chunkNumbers(pending), ", "))
+	}
+
+	sets := make([][]practiceProblem, len(numbers))
+	for k, num := range numbers {
+		sets[k] = got[num]
+	}
+	b.sets[j.id] = sets
+}
+
+func requestPractice(items []string, n int, model string) (map[string][]practiceProblem, error) {
+	prompt := fmt.Sprintf(
+		"For EACH of the following concepts, write %d practice problems of graded difficulty (easy to hard) "+
+			"with fully worked, step-by-step solutions.\n\n%s\n\n"+
+			"Use exactly this layout, where <n> is the concept number and <k> counts the problems from 1:\n"+
+			"=== PROBLEM <n>.<k> (easy|medium|hard) ===\n<problem statement>\n=== SOLUTION <n>.<k> ===\n<worked solution>\n\n"+
+			"Do not add any other text.",
+		n, strings.Join(items, "\n"),
+	)
+	resp, err := callAIWith(callOptions{Model: model, Temperature: defaultTemperature, Purpose: "practice"}, prompt, cfg.SystemPrompt)
+	if err != nil {
+		return nil, err
+	}
+	return parsePractice(resp), nil
+}
+
+// parsePractice reads the marker layout requested by requestPractice. A
+// problem only counts when both its statement and its solution are present.
+func parsePractice(resp string) map[string][]practiceProblem {
+	type key struct{ concept, k string }
+	problems := map[key]*practiceProblem{}
+	var order []key
+
+	marks := practiceMarkerRe.FindAllStringSubmatchIndex(resp, -1)
+	for i, m := range marks {
+		end := len(resp)
+		if i+1 < len(marks) {
+			end = marks[i+1][0]
+		}
+		body := strings.TrimSpace(resp[m[1]:end])
+		k := key{resp[m[4]:m[5]], resp[m[6]:m[7]]}
+		p, ok := problems[k]
+		if !ok {
+			p = &practiceProblem{}
+			problems[k] = p
+			order = append(order, k)
+		}
+		if resp[m[2]:m[3]] == "PROBLEM" {
+			p.Problem = body
+			if m[8] >= 0 {
+				p.Grade = strings.ToLower(resp[m[8]:m[9]])
+			}
+		} else {
+			p.Solution = body
+		}
+	}
+
+	out := map[string][]practiceProblem{}
+	for _, k := range order {
+		if p := problems[k]; p.Problem != "" && p.Solution != "" {
+			out[k.concept] = append(out[k.concept], *p)
+		}
+	}
+	for num, ps := range out {
+		for i := range ps {
+			if ps[i].Grade == "" {
+				ps[i].Grade = gradeFor(i, len(ps))
+			}
+		}
+		out[num] = ps
+	}
+	return out
+}
+
+func gradeFor(i, n int) string {
+	switch {
+	case n == 1:
+		return "medium"
+	case i*3 < n:
+		return "easy"
+	case i*3 < 2*n:
+		return "medium"
+	default:
+		return "hard"
+	}
+}
+
+func (b *practiceBook) solutionsPath(guidePath string) string {
+	return strings.TrimSuffix(guidePath, ".md") + ".solutions.md"
+}
+
+// render numbers chunk j's problems and, in inline mode, appends them to
+// each concept's section. It returns the global problem numbers per item.
+func (b *practiceBook) render(j chunk, content string) (string, [][]int) {
+	sets := b.sets[j.id]
+	if sets == nil {
+		return content, nil
+	}
+	numbers := make([][]int, len(j.items))
+	blocks := map[string]string{}
+	for k, item := range j.items {
+		var sb strings.Builder
+		for _, p := range sets[k] {
+			e := practiceEntry{Number: len(b.entries) + 1, Concept: item, practiceProblem: p}
+			b.entries = append(b.entries, e)
+			numbers[k] = append(numbers[k], e.Number)
+			if b.mode == "inline" {
+				fmt.Fprintf(&sb, "**Problem %d** · %s\n\n%s\n\n**Solution %d**\n\n%s\n\n", e.Number, e.Grade, e.Problem, e.Number, e.Solution)
+			}
+		}
+		if sb.Len() > 0 {
+			blocks[conceptNumber(item)] = "### Practice problems\n\n" + strings.TrimSpace(sb.String())
+		}
+	}
+	if b.mode != "inline" {
+		return content, numbers
+	}
+	return appendToSections(content, j.items, blocks), numbers
+}
+
+// writeEnd writes the collected "Practice Problems" part, with solutions
+// after it or, in separate mode, in their own file. It returns the
+// solutions file when one was written.
+func (b *practiceBook) writeEnd(w io.Writer, guidePath string) (string, error) {
+	if b.mode == "inline" || len(b.entries) == 0 {
+		return "", nil
+	}
+	solutionLink := func(n int) string { return "#solution-" + strconv.Itoa(n) }
+	problemLink := func(n int) string { return "#problem-" + strconv.Itoa(n) }
+	var solutionsFile string
+	if b.mode == "separate" {
+		solutionsFile = b.solutionsPath(guidePath)
+		sf, gf := filepath.Base(solutionsFile), filepath.Base(guidePath)
+		solutionLink = func(n int) string { return sf + "#solution-" + strconv.Itoa(n) }
+		problemLink = func(n int) string { return gf + "#problem-" + strconv.Itoa(n) }
+	}
+
+	fmt.Fprintf(w, "## %s\n\n", outputLanguage().practiceProblems)
+	for _, e := range b.entries {
+		fmt.Fprintf(w, "### Problem %d\n\n*%s · Concept: [%s](#%s) · [Solution](%s)*\n\n%s\n\n",
+			e.Number, e.Grade, e.Concept, conceptAnchor(e.Concept), solutionLink(e.Number), e.Problem)
+	}
+
+	fmt.Fprint(w, "---\n\n")
+
+	var sol strings.Builder
+	if b.mode == "separate" {
+		fmt.Fprintf(&sol, "# %s: %s\n\n", outputLanguage().solutions, cfg.Subject)
+	} else {
+		fmt.Fprintf(&sol, "## %s\n\n", outputLanguage().solutions)
+	}
+	for _, e := range b.entries {
+		fmt.Fprintf(&sol, "### Solution %d\n\n*[Problem %d](%s)*\n\n%s\n\n", e.Number, e.Number, problemLink(e.Number), e.Solution)
+	}
+
+	if b.mode == "separate" {
+		return solutionsFile, os.WriteFile(solutionsFile, []byte(sol.String()), 0o644)
+	}
+	fmt.Fprint(w, sol.String()+"---\n\n")
+	return "", nil
+}
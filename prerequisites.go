@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	prerequisiteLineRe = regexp.MustCompile(`^\s*(\d+)[.):]\s*(.*)$`)
+	numberRe           = regexp.MustCompile(`\d+`)
+)
+
+// prerequisitesEnabled reports whether the prerequisite graph is needed:
+// --prerequisites, or --export conceptmap, which draws it.
+func prerequisitesEnabled() bool {
+	return cfg.Prerequisites || slices.Contains(cfg.Exports, "conceptmap")
+}
+
+// findPrerequisites asks the model which of the other concepts each concept
+// directly builds on. The returned slice is aligned with concepts and holds
+// concept numbers; numbers that aren't another concept's are dropped.
+func findPrerequisites(concepts []string, model string) ([][]int, error) {
+	prompt := fmt.Sprintf(
+		"For a learner of the subject '%s', say which of the following concepts each concept directly builds on, "+
+			"i.e. what must be understood before it can be learned. List only direct prerequisites, not their own prerequisites, "+
+			"and leave foundational concepts with an empty list.\n\n%s\n\n"+
+			"Respond ONLY with a JSON object mapping each concept number to the numbers of its prerequisites, e.g. {\"%s\": []}.",
+		cfg.Subject, strings.Join(concepts, "\n"), conceptNumber(concepts[0]),
+	)
+
+	resp, err := callAIWith(callOptions{Model: model, Temperature: 0, Purpose: "prerequisites"}, prompt,
+		"You are an experienced curriculum designer who maps how concepts depend on each other.")
+	if err != nil {
+		return nil, err
+	}
+
+	raw := parsePrerequisites(resp)
+	known := make(map[int]bool, len(concepts))
+	for _, c := range concepts {
+		if n, err := strconv.Atoi(conceptNumber(c)); err == nil {
+			known[n] = true
+		}
+	}
+	prereqs := make([][]int, len(concepts))
+	for i, c := range concepts {
+		n, _ := strconv.Atoi(conceptNumber(c))
+		for _, p := range raw[conceptNumber(c)] {
+			if known[p] && p != n && !slices.Contains(prereqs[i], p) {
+				prereqs[i] = append(prereqs[i], p)
+			}
+		}
+		slices.Sort(prereqs[i])
+	}
+	return prereqs, nil
+}
+
+// parsePrerequisites reads the JSON object the prompt asks for and falls
+// back to "<number>: <numbers>" lines for models that ignore the format.
+func parsePrerequisites(resp string) map[string][]int {
+	prereqs := map[string][]int{}
+	if start, end := strings.Index(resp, "{"), strings.LastIndex(resp, "}"); start >= 0 && end > start {
+		var raw map[string][]json.Number
+		if json.Unmarshal([]byte(resp[start:end+1]), &raw) == nil {
+			for num, ps := range raw {
+				num = strings.TrimRight(strings.TrimSpace(num), ".)")
+				prereqs[num] = []int{}
+				for _, p := range ps {
+					if n, err := strconv.Atoi(p.String()); err == nil {
+						prereqs[num] = append(prereqs[num], n)
+					}
+				}
+			}
+			return prereqs
+		}
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(resp))
+	for scanner.Scan() {
+		m := prerequisiteLineRe.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		if _, seen := prereqs[m[1]]; seen {
+			continue
+		}
+		prereqs[m[1]] = []int{}
+		for _, p := range numberRe.FindAllString(m[2], -1) {
+			n, _ := strconv.Atoi(p)
+			prereqs[m[1]] = append(prereqs[m[1]], n)
+		}
+	}
+	return prereqs
+}
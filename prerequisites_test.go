@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePrerequisites(t *testing.T) {
+	tests := []struct {
+		name, resp string
+		want       map[string][]int
+	}{
+		{"json", `{"1": [], "2": [1], "3": [1, 2]}`, map[string][]int{"1": {}, "2": {1}, "3": {1, 2}}},
+		{"fenced json with dotted keys", "```json\n{\"1.\": [], \"2.\": [1]}\n```", map[string][]int{"1": {}, "2": {1}}},
+		{"lines", "1: none\n2: 1\n3) 1, 2\n3: 4", map[string][]int{"1": {}, "2": {1}, "3": {1, 2}}},
+	}
+	for _, tt := range tests {
+		if got := parsePrerequisites(tt.resp); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parsePrerequisites = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFindPrerequisites(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.Subject = "Go"
+	var prompt string
+	useFakeModel(t, func(p string) string {
+		prompt = p
+		// 3 lists itself, an unknown concept and a duplicate; 2 is left out.
+		return `{"1": [], "3": [3, 9, 1, 1, 2]}`
+	})
+
+	concepts := []string{"1. Values", "2. Pointers", "3. Interfaces"}
+	got, err := findPrerequisites(concepts, "test-model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]int{nil, nil, {1, 2}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("findPrerequisites = %v, want %v", got, want)
+	}
+	if !strings.Contains(prompt, "2. Pointers") || !strings.Contains(prompt, "'Go'") {
+		t.Errorf("prompt doesn't list the concepts of the subject:\n%s", prompt)
+	}
+}
+
+func TestConceptMapPrerequisiteEdges(t *testing.T) {
+	md := "# Guide\n\n## 1. Values\n\nValues.\n\n## 2. Pointers\n\nSee [values](#1-values).\n\n## 3. Interfaces\n\nInterfaces.\n"
+	sc := &Sidecar{Sections: []SectionMeta{
+		{Chunk: 1, Items: []int{1, 2}, Prerequisites: [][]int{nil, {1}}},
+		// Out-of-range and self references from an edited sidecar are ignored.
+		{Chunk: 2, Items: []int{3}, Prerequisites: [][]int{{1, 2, 3, 7}}},
+	}}
+	m := buildConceptMap("guide.md", parseMarkdown(md), sc)
+	want := []conceptMapEdge{
+		{Source: 1, Target: 2, Kind: "prerequisite"},
+		{Source: 1, Target: 3, Kind: "prerequisite"},
+		{Source: 2, Target: 3, Kind: "prerequisite"},
+		{Source: 2, Target: 1, Kind: "link"},
+	}
+	if !reflect.DeepEqual(m.Edges, want) {
+		t.Errorf("edges = %+v, want %+v", m.Edges, want)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// FlagProfile is a named bundle of flags, selected with --profile. Flags
+// maps long flag names to values: strings, numbers, booleans, or arrays
+// for repeatable flags.
+type FlagProfile struct {
+	Description string         `json:"description,omitempty"`
+	Extends     string         `json:"extends,omitempty"`
+	Flags       map[string]any `json:"flags"`
+	source      string
+}
+
+// profilesDir holds one profile per <name>.json file, next to the config
+// file.
+func profilesDir() string {
+	path := configPath
+	if path == "" {
+		path = defaultConfigPath()
+	}
+	if path == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(path), "profiles.d")
+}
+
+// loadProfiles gathers the profiles of the config file and of profiles.d.
+// A name defined in both is an error rather than a silent override.
+func loadProfiles() (map[string]*FlagProfile, error) {
+	fc, err := loadFileConfig()
+	if err != nil {
+		return nil, err
+	}
+	profiles := map[string]*FlagProfile{}
+	for name, p := range fc.Profiles {
+		p.source = "config file"
+		profiles[name] = &p
+	}
+	dir := profilesDir()
+	if dir == "" {
+		return profiles, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		name := strings.TrimSuffix(filepath.Base(f), ".json")
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		p := &FlagProfile{source: f}
+		if err := json.Unmarshal(b, p); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", f, err)
+		}
+		if prev, ok := profiles[name]; ok {
+			return nil, fmt.Errorf("profile %q is defined both in the %s and in %s", name, prev.source, f)
+		}
+		profiles[name] = p
+	}
+	return profiles, nil
+}
+
+func profileNames(profiles map[string]*FlagProfile) []string {
+	names := make([]string, 0, len(profiles))
+	for n := range profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveProfile returns the flags of profile name with the one it extends
+// underneath. Only one level of inheritance is supported.
+func resolveProfile(profiles map[string]*FlagProfile, name string) (map[string]any, error) {
+	p, ok := profiles[name]
+	if !ok {
+		if len(profiles) == 0 {
+			return nil, fmt.Errorf("unknown profile %q (no profiles configured in %s or %s)", name, defaultConfigPath(), profilesDir())
+		}
+		return nil, fmt.Errorf("unknown profile %q (configured: %s)", name, strings.Join(profileNames(profiles), ", "))
+	}
+	flags := map[string]any{}
+	if p.Extends != "" {
+		base, ok := profiles[p.Extends]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("profile %q extends unknown profile %q", name, p.Extends)
+		case base.Extends != "":
+			return nil, fmt.Errorf("profile %q extends %q, which extends %q; only one level of inheritance is supported", name, p.Extends, base.Extends)
+		}
+		for k, v := range base.Flags {
+			flags[k] = v
+		}
+	}
+	for k, v := range p.Flags {
+		flags[k] = v
+	}
+	return flags, nil
+}
+
+// profileValues turns a profile value into the arguments of its flag, one
+// per repetition for arrays.
+func profileValues(v any) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, nil
+	case bool:
+		return []string{strconv.FormatBool(v)}, nil
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}, nil
+	case []any:
+		var out []string
+		for _, e := range v {
+			s, err := profileValues(e)
+			if err != nil || len(s) != 1 {
+				return nil, fmt.Errorf("arrays may only hold strings, numbers or booleans")
+			}
+			out = append(out, s...)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("expected a string, number, boolean or array")
+}
+
+// checkProfileFlags reports profile flags that cmd doesn't have or can't
+// take.
+func checkProfileFlags(cmd *cobra.Command, name string, flags map[string]any) error {
+	for _, k := range sortedKeys(flags) {
+		f := cmd.Flags().Lookup(k)
+		switch {
+		case k == "profile":
+			return fmt.Errorf("profile %q sets --profile; use extends instead", name)
+		case f == nil:
+			return fmt.Errorf("profile %q sets unknown flag --%s", name, k)
+		}
+		if _, err := profileValues(flags[k]); err != nil {
+			return fmt.Errorf("profile %q has an invalid value for --%s: %v", name, k, err)
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// applyProfile sets the flags of profile name that weren't given on the
+// command line, which always win.
+func applyProfile(cmd *cobra.Command, name string) error {
+	profiles, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+	flags, err := resolveProfile(profiles, name)
+	if err != nil {
+		return err
+	}
+	if err := checkProfileFlags(cmd, name, flags); err != nil {
+		return err
+	}
+	for _, k := range sortedKeys(flags) {
+		if cmd.Flags().Changed(k) {
+			continue
+		}
+		values, _ := profileValues(flags[k])
+		for _, v := range values {
+			if err := cmd.Flags().Set(k, v); err != nil {
+				return fmt.Errorf("profile %q: --%s: %v", name, k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// profileSettings renders resolved flags as "name=value" pairs.
+func profileSettings(flags map[string]any) string {
+	parts := make([]string, 0, len(flags))
+	for _, k := range sortedKeys(flags) {
+		values, _ := profileValues(flags[k])
+		parts = append(parts, k+"="+strings.Join(values, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+func newProfilesCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "profiles",
+		Short: "List flag profiles with their effective settings",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			profiles, err := loadProfiles()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading profiles: %v\n", err)
+				os.Exit(1)
+			}
+			if len(profiles) == 0 {
+				fmt.Println("No profiles configured.")
+				return
+			}
+
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tEXTENDS\tSETTINGS\tDESCRIPTION")
+			for _, n := range profileNames(profiles) {
+				p := profiles[n]
+				settings := "(error)"
+				flags, err := resolveProfile(profiles, n)
+				if err == nil {
+					err = checkProfileFlags(cmd.Root(), n, flags)
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				} else {
+					settings = profileSettings(flags)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", n, p.Extends, settings, p.Description)
+			}
+			tw.Flush()
+		},
+	}
+}
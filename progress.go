@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// statusOut is where status lines ("-> ...") go: stdout, unless the guide
+// itself is written there.
+func statusOut() io.Writer {
+	if cfg.Stdout {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// statusf prints a status line, except with --quiet.
+func statusf(format string, args ...any) {
+	if cfg.Quiet {
+		return
+	}
+	progress.clear()
+	fmt.Fprintf(statusOut(), format, args...)
+}
+
+// verbosef prints the per-chunk and per-request details of --verbose.
+func verbosef(format string, args ...any) {
+	if !cfg.Verbose {
+		return
+	}
+	progress.clear()
+	fmt.Fprintf(os.Stderr, format, args...)
+}
+
+// retryf reports a retried request, or a chunk asked again: as a count on
+// the progress line while there is one, else on its own line.
+func retryf(format string, args ...any) {
+	if progress != nil {
+		progress.retry()
+		return
+	}
+	if cfg.Quiet {
+		return
+	}
+	fmt.Fprintf(os.Stderr, format, args...)
+}
+
+// progressInterval is how often the progress line is refreshed on a
+// terminal, and plainProgressInterval how often a line is printed when
+// stderr is a log instead.
+const (
+	progressInterval      = time.Second
+	plainProgressInterval = 10 * time.Second
+)
+
+// progressLine reports the chunks done on stderr while they are answered:
+// one line kept up to date on a terminal, a line every few seconds in a log.
+type progressLine struct {
+	mu       sync.Mutex
+	total    int
+	restored int // answered by an earlier run, left out of the ETA
+	done     int
+	failed   int
+	retries  int
+	started  time.Time
+	tty      bool
+	drawn    bool
+	stop     chan struct{}
+	finished chan struct{}
+}
+
+// progress is the line of the chunks being answered, nil outside of that.
+var progress *progressLine
+
+func stderrIsTerminal() bool {
+	fi, err := os.Stderr.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// startProgress starts reporting total chunks, restored of them already
+// done. With --quiet or --verbose there is no progress line: nothing is
+// printed, or every chunk is. With --stream the answers themselves show the
+// progress.
+func startProgress(total, restored int) {
+	if cfg.Quiet || cfg.Verbose || cfg.Stream || total == 0 {
+		return
+	}
+	p := &progressLine{total: total, restored: restored, done: restored, started: time.Now(), tty: stderrIsTerminal(),
+		stop: make(chan struct{}), finished: make(chan struct{})}
+	progress = p
+	go p.run()
+}
+
+func (p *progressLine) run() {
+	defer close(p.finished)
+	interval := plainProgressInterval
+	if p.tty {
+		interval = progressInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.mu.Lock()
+			p.draw()
+			p.mu.Unlock()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// chunkDone counts a finished chunk and redraws the terminal line.
+func (p *progressLine) chunkDone(failed bool) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if failed {
+		p.failed++
+	}
+	if p.tty {
+		p.draw()
+	}
+}
+
+// retry counts a retried request.
+func (p *progressLine) retry() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.retries++
+}
+
+// clear erases the terminal line before other output is printed; the next
+// refresh draws it again.
+func (p *progressLine) clear() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.drawn {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		p.drawn = false
+	}
+}
+
+// finish stops the reporting. A log gets a last line with the totals, the
+// terminal line is erased so the summary starts on a clean line.
+func (p *progressLine) finish() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.finished
+	p.mu.Lock()
+	if p.tty {
+		if p.drawn {
+			fmt.Fprint(os.Stderr, "\r\033[K")
+		}
+	} else {
+		p.draw()
+	}
+	p.mu.Unlock()
+	progress = nil
+}
+
+// draw prints the line; p.mu is held. The cursor is left at the start of
+// the line, so a warning printed meanwhile overwrites it rather than
+// continuing it.
+func (p *progressLine) draw() {
+	elapsed := time.Since(p.started).Round(time.Second)
+	line := fmt.Sprintf("%d/%d chunks, %s elapsed", p.done, p.total, elapsed)
+	if answered := p.done - p.restored; answered > 0 && p.done < p.total {
+		eta := time.Duration(float64(time.Since(p.started)) / float64(answered) * float64(p.total-p.done))
+		line += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+	}
+	if p.failed > 0 {
+		line += fmt.Sprintf(", %d failed", p.failed)
+	}
+	if p.retries > 0 {
+		line += fmt.Sprintf(", %d retries", p.retries)
+	}
+	if p.tty {
+		fmt.Fprintf(os.Stderr, "\r\033[K   %s\r", line)
+		p.drawn = true
+		return
+	}
+	fmt.Fprintf(os.Stderr, "   Progress: %s\n", line)
+}
+
+func requestPurpose(purpose string) string {
+	if purpose == "" {
+		return "API"
+	}
+	return purpose
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+// version and commit are overridden at build time via
+// -ldflags "-X main.version=... -X main.commit=...".
+var (
+	version = "dev"
+	commit  = ""
+)
+
+type Provenance struct {
+	Version          string            `json:"version"`
+	Commit           string            `json:"commit,omitempty"`
+	Provider         string            `json:"provider"`
+	Model            string            `json:"model"`
+	Date             string            `json:"date"`
+	Concepts         int               `json:"concepts"`
+	Settings         map[string]string `json:"settings"`
+	SystemPromptHash string            `json:"system_prompt_sha256"`
+}
+
+func buildCommit() string {
+	if commit != "" {
+		return commit
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			return s.Value[:12]
+		}
+	}
+	return ""
+}
+
+// providerName derives a short label for the API endpoint from its host.
+func providerName(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Hostname() == "" {
+		return "unknown"
+	}
+	host := u.Hostname()
+	switch {
+	case host == "localhost" || host == "127.0.0.1" || host == "::1":
+		return "local"
+	case strings.HasSuffix(host, "openai.com"):
+		return "openai"
+	case strings.HasSuffix(host, "openrouter.ai"):
+		return "openrouter"
+	case strings.HasSuffix(host, "groq.com"):
+		return "groq"
+	}
+	return host
+}
+
+func promptHash(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+func newProvenance(startedAt time.Time, concepts int) Provenance {
+	p := Provenance{
+		Version:  version,
+		Commit:   buildCommit(),
+		Provider: cfg.Provider,
+		Model:    cfg.Model,
+		Date:     startedAt.Format(time.RFC3339),
+		Concepts: concepts,
+		Settings: map[string]string{
+			"chunk":       fmt.Sprint(cfg.ChunkSize),
+			"temperature": fmt.Sprint(defaultTemperature),
+		},
+		SystemPromptHash: promptHash(cfg.SystemPrompt),
+	}
+	if p.Provider == "" {
+		p.Provider = providerName(cfg.BaseURL)
+	}
+	if cfg.Profile != "" {
+		p.Settings["profile"] = cfg.Profile
+	}
+	if cfg.BestOf > 1 {
+		p.Settings["best_of"] = fmt.Sprint(cfg.BestOf)
+	}
+	if len(cfg.TagSet) > 0 {
+		p.Settings["tag_set"] = strings.Join(normalizeTags(cfg.TagSet), ",")
+	}
+	if len(cfg.OnlyTags) > 0 {
+		p.Settings["only_tags"] = strings.Join(normalizeTags(cfg.OnlyTags), ",")
+	}
+	if len(cfg.SkipTags) > 0 {
+		p.Settings["skip_tags"] = strings.Join(normalizeTags(cfg.SkipTags), ",")
+	}
+	if cfg.Order != "model" {
+		p.Settings["order"] = cfg.Order
+	}
+	if cfg.Order == "shuffle" {
+		p.Settings["seed"] = fmt.Sprint(cfg.Seed)
+	}
+	if cfg.TargetLength != "" {
+		p.Settings["target_length"] = cfg.TargetLength
+		p.Settings["words_per_page"] = fmt.Sprint(cfg.WordsPerPage)
+	}
+	if cfg.MaxDifficulty > 0 {
+		p.Settings["max_difficulty"] = fmt.Sprint(cfg.MaxDifficulty)
+	}
+	if prerequisitesEnabled() {
+		p.Settings["prerequisites"] = "true"
+	}
+	if cfg.BloomMaxRemember > 0 {
+		p.Settings["bloom_max_remember"] = fmt.Sprint(cfg.BloomMaxRemember)
+	}
+	if cfg.Practice > 0 {
+		p.Settings["practice"] = fmt.Sprint(cfg.Practice)
+		p.Settings["solutions"] = cfg.Solutions
+	}
+	if cfg.Misconceptions {
+		p.Settings["misconceptions"] = "true"
+	}
+	if cfg.Pitfalls {
+		p.Settings["pitfalls"] = "true"
+	}
+	if cfg.Timeline {
+		p.Settings["timeline"] = "true"
+	}
+	if cfg.Format != "markdown" {
+		p.Settings["format"] = cfg.Format
+	}
+	if cfg.ConsistentTerms {
+		p.Settings["consistent_terms"] = "true"
+	}
+	if cfg.Glossary {
+		p.Settings["glossary"] = "true"
+	}
+	if cfg.Clarify {
+		p.Settings["clarify"] = "true"
+	}
+	if cfg.Mode != "guide" {
+		p.Settings["mode"] = cfg.Mode
+	}
+	if cfg.Lang != "en" {
+		p.Settings["lang"] = cfg.Lang
+	}
+	if cfg.VerifyCode {
+		p.Settings["verify_code"] = "true"
+	}
+	if cfg.FixCode {
+		p.Settings["fix_code"] = "true"
+	}
+	if cfg.CheckLinks {
+		p.Settings["broken_links"] = cfg.BrokenLinks
+	}
+	if cfg.DedupContent == "rewrite" {
+		p.Settings["dedup_content"] = cfg.DedupContent
+		p.Settings["dedup_threshold"] = fmt.Sprint(cfg.DedupThreshold)
+	}
+	if cfg.ReadabilityFix {
+		p.Settings["readability_fix"] = "true"
+		if cfg.ReadabilityTarget > 0 {
+			p.Settings["readability_target"] = fmt.Sprint(cfg.ReadabilityTarget)
+		}
+	}
+	if cfg.AltExplanations {
+		p.Settings["alt_explanations"] = "true"
+		if cfg.AltModel != "" {
+			p.Settings["alt_model"] = cfg.AltModel
+		}
+	}
+	if cfg.AnalogyDomain != "" {
+		p.Settings["analogy_domain"] = cfg.AnalogyDomain
+	}
+	if cfg.NoAnswers {
+		p.Settings["no_answers"] = "true"
+	}
+	if cfg.Mnemonics {
+		p.Settings["mnemonics"] = "true"
+	}
+	if cfg.Tables {
+		p.Settings["tables"] = "true"
+	}
+	if cfg.SectionHook != "" {
+		p.Settings["section_hook"] = cfg.SectionHook
+	}
+	if cfg.CitationStyle == "footnote" {
+		p.Settings["citation_style"] = cfg.CitationStyle
+		p.Settings["footnote_placement"] = cfg.FootnotePlacement
+	}
+	if cfg.StudyTime {
+		p.Settings["reading_speed"] = fmt.Sprint(cfg.ReadingSpeed)
+		p.Settings["difficulty_multipliers"] = cfg.DifficultyMults
+		p.Settings["exercise_minutes"] = fmt.Sprint(cfg.ExerciseMinutes)
+	}
+	if cfg.StudyPlan {
+		start, _ := planStartDate()
+		p.Settings["study_plan"] = start.Format("2006-01-02")
+		p.Settings["session_minutes"] = fmt.Sprint(cfg.SessionMinutes)
+	}
+	if cfg.GroupBy != "" {
+		p.Settings["group_by"] = cfg.GroupBy
+	}
+	if cfg.Depth > 1 {
+		p.Settings["depth"] = fmt.Sprint(cfg.Depth)
+		p.Settings["sub_count"] = fmt.Sprint(cfg.SubCount)
+	}
+	if cfg.RouteByDiff {
+		p.Settings["cheap_model"] = cfg.CheapModel
+		p.Settings["route_threshold"] = fmt.Sprint(cfg.RouteThreshold)
+	}
+	return p
+}
+
+func (p Provenance) settingsString() string {
+	keys := make([]string, 0, len(p.Settings))
+	for k := range p.Settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+p.Settings[k])
+	}
+	return strings.Join(parts, " ")
+}
+
+func (p Provenance) versionString() string {
+	if p.Commit == "" {
+		return p.Version
+	}
+	return fmt.Sprintf("%s (%s)", p.Version, p.Commit)
+}
+
+func writeProvenanceFooter(w io.Writer, p Provenance, style string) {
+	switch style {
+	case "section":
+		fmt.Fprintf(w, "\n*Generated with aiguide %s · %s/%s · %s · %d concepts · %s · system prompt sha256:%s*\n",
+			p.versionString(), p.Provider, p.Model, p.Date, p.Concepts, p.settingsString(), p.SystemPromptHash)
+	default:
+		fmt.Fprintf(w, "\n<!-- aiguide provenance\n")
+		fmt.Fprintf(w, "version: %s\n", p.versionString())
+		fmt.Fprintf(w, "provider: %s\n", p.Provider)
+		fmt.Fprintf(w, "model: %s\n", p.Model)
+		fmt.Fprintf(w, "date: %s\n", p.Date)
+		fmt.Fprintf(w, "concepts: %d\n", p.Concepts)
+		fmt.Fprintf(w, "settings: %s\n", p.settingsString())
+		fmt.Fprintf(w, "system_prompt_sha256: %s\n", p.SystemPromptHash)
+		fmt.Fprintf(w, "-->\n")
+	}
+}
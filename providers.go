@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// ProviderProfile is a named OpenAI-compatible endpoint from the config file.
+type ProviderProfile struct {
+	Type       string            `json:"type,omitempty"`
+	BaseURL    string            `json:"base_url"`
+	APIKeyEnv  string            `json:"api_key_env,omitempty"`
+	APIKeyFile string            `json:"api_key_file,omitempty"`
+	Model      string            `json:"model,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Quirks     []string          `json:"quirks,omitempty"`
+	MaxTokens  int               `json:"max_tokens,omitempty"`
+	// ChatTemplate is used by the tgi type when the endpoint only offers
+	// /generate: chatml (default), llama3, mistral or plain.
+	ChatTemplate string `json:"chat_template,omitempty"`
+}
+
+// Quirks adjust the request builder for endpoints that deviate from OpenAI.
+const (
+	quirkRequiresMaxTokens = "requires_max_tokens"
+	quirkNoSeed            = "no_seed"
+	quirkNoTemperature     = "no_temperature"
+)
+
+var knownQuirks = map[string]bool{
+	quirkRequiresMaxTokens: true,
+	quirkNoSeed:            true,
+	quirkNoTemperature:     true,
+}
+
+func findProvider(name string) (ProviderProfile, error) {
+	fc, err := loadFileConfig()
+	if err != nil {
+		return ProviderProfile{}, err
+	}
+	p, ok := fc.Providers[name]
+	if !ok {
+		names := make([]string, 0, len(fc.Providers))
+		for n := range fc.Providers {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return ProviderProfile{}, fmt.Errorf("unknown provider %q (no providers configured in %s)", name, defaultConfigPath())
+		}
+		return ProviderProfile{}, fmt.Errorf("unknown provider %q (configured: %s)", name, strings.Join(names, ", "))
+	}
+	if p.BaseURL == "" {
+		return ProviderProfile{}, fmt.Errorf("provider %q has no base_url", name)
+	}
+	switch p.Type {
+	case "", "openai", "tgi":
+	default:
+		return ProviderProfile{}, fmt.Errorf("provider %q has unknown type %q (expected openai or tgi)", name, p.Type)
+	}
+	switch p.ChatTemplate {
+	case "", "chatml", "llama3", "mistral", "plain":
+	default:
+		return ProviderProfile{}, fmt.Errorf("provider %q has unknown chat_template %q", name, p.ChatTemplate)
+	}
+	for _, q := range p.Quirks {
+		if !knownQuirks[q] {
+			fmt.Fprintf(os.Stderr, "Warning: provider %q has unknown quirk %q\n", name, q)
+		}
+	}
+	return p, nil
+}
+
+// apiKey resolves the profile's key: key file first, then the named env var.
+// ok is false when the profile declares no key source at all, which is fine
+// for unauthenticated local servers.
+func (p ProviderProfile) apiKey() (key string, ok bool, err error) {
+	if p.APIKeyFile != "" {
+		b, err := os.ReadFile(expandHome(p.APIKeyFile))
+		if err != nil {
+			return "", true, fmt.Errorf("reading api_key_file: %w", err)
+		}
+		return strings.TrimSpace(string(b)), true, nil
+	}
+	if p.APIKeyEnv != "" {
+		return os.Getenv(p.APIKeyEnv), true, nil
+	}
+	return "", false, nil
+}
+
+func maskSecret(s string) string {
+	if s == "" {
+		return "(unset)"
+	}
+	if len(s) <= 8 {
+		return "****"
+	}
+	return s[:3] + "…" + s[len(s)-4:]
+}
+
+func newProvidersCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "providers",
+		Short: "List provider profiles from the config file",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			fc, err := loadFileConfig()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+				os.Exit(1)
+			}
+			if len(fc.Providers) == 0 {
+				fmt.Println("No providers configured.")
+				return
+			}
+
+			names := make([]string, 0, len(fc.Providers))
+			for n := range fc.Providers {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tTYPE\tBASE URL\tMODEL\tKEY\tHEADERS\tQUIRKS")
+			for _, n := range names {
+				p := fc.Providers[n]
+
+				key := "(none)"
+				if v, ok, err := p.apiKey(); err != nil {
+					key = "(error)"
+				} else if ok {
+					key = maskSecret(v)
+					if p.APIKeyEnv != "" && p.APIKeyFile == "" {
+						key = "$" + p.APIKeyEnv + "=" + key
+					}
+				}
+
+				headers := make([]string, 0, len(p.Headers))
+				for h, v := range p.Headers {
+					headers = append(headers, h+"="+maskSecret(v))
+				}
+				sort.Strings(headers)
+
+				typ := p.Type
+				if typ == "" {
+					typ = "openai"
+				}
+
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", n, typ, p.BaseURL, p.Model, key,
+					strings.Join(headers, ","), strings.Join(p.Quirks, ","))
+			}
+			tw.Flush()
+		},
+	}
+}
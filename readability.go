@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// readabilityTolerance is how many grade levels a section may sit from its
+// target before it counts as an outlier.
+const readabilityTolerance = 3.0
+
+var (
+	inlineCodeRe     = regexp.MustCompile("`[^`\n]*`")
+	mathBlockRe      = regexp.MustCompile(`(?s)\$\$.*?\$\$|\\\[.*?\\\]`)
+	inlineMathRe     = regexp.MustCompile(`\$[^$\n]+\$|\\\(.*?\\\)`)
+	mdLinkTextRe     = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	urlRe            = regexp.MustCompile(`https?://\S+`)
+	sentenceEndRe    = regexp.MustCompile(`[.!?]+(?:\s|$)`)
+	readableWordRe   = regexp.MustCompile(`[A-Za-z]+(?:'[A-Za-z]+)?`)
+	vowelGroupRe     = regexp.MustCompile(`[aeiouy]+`)
+	listMarkerLineRe = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+`)
+)
+
+// Readability holds the scores of one concept section.
+type Readability struct {
+	Grade       float64 `json:"grade"`        // Flesch-Kincaid grade level
+	ReadingEase float64 `json:"reading_ease"` // Flesch reading ease, 0-100
+	Target      float64 `json:"target,omitempty"`
+	Outlier     bool    `json:"outlier,omitempty"`
+	Fixed       bool    `json:"fixed,omitempty"`
+}
+
+// proseText strips what would distort the scores: code, formulas, tables,
+// headings, links' URLs and markup. List items count as sentences.
+func proseText(section string) string {
+	var lines []string
+	inFence := false
+	for _, line := range strings.Split(mathBlockRe.ReplaceAllString(section, " "), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence || trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "|") ||
+			strings.HasPrefix(trimmed, "<!--") || strings.HasPrefix(trimmed, "*Difficulty:*") ||
+			strings.HasPrefix(trimmed, "*Bloom:*") || strings.HasPrefix(trimmed, "*Tags:*") {
+			continue
+		}
+		if listMarkerLineRe.MatchString(trimmed) && !sentenceEndRe.MatchString(trimmed) {
+			trimmed += "."
+		}
+		lines = append(lines, trimmed)
+	}
+	text := strings.Join(lines, "\n")
+	text = inlineCodeRe.ReplaceAllString(text, " ")
+	text = inlineMathRe.ReplaceAllString(text, " ")
+	text = mdLinkTextRe.ReplaceAllString(text, "$1")
+	text = urlRe.ReplaceAllString(text, " ")
+	return strings.NewReplacer("**", "", "__", "", "*", "", "_", "", ">", "").Replace(text)
+}
+
+// scoreReadability computes the Flesch-Kincaid grade and Flesch reading ease
+// of a section's prose. ok is false when there's too little prose to judge.
+func scoreReadability(section string) (r Readability, ok bool) {
+	text := proseText(section)
+	words := readableWordRe.FindAllString(text, -1)
+	if len(words) < 30 {
+		return r, false
+	}
+	sentences := len(sentenceEndRe.FindAllStringIndex(text, -1))
+	if sentences == 0 {
+		sentences = 1
+	}
+	syllables := 0
+	for _, w := range words {
+		syllables += countSyllables(w)
+	}
+	wps := float64(len(words)) / float64(sentences)
+	spw := float64(syllables) / float64(len(words))
+	r.Grade = round1(math.Max(0, 0.39*wps+11.8*spw-15.59))
+	r.ReadingEase = round1(206.835 - 1.015*wps - 84.6*spw)
+	return r, true
+}
+
+// countSyllables estimates syllables from vowel groups, which is what
+// readability formulas were calibrated against in practice.
+func countSyllables(word string) int {
+	w := strings.ToLower(word)
+	n := len(vowelGroupRe.FindAllString(w, -1))
+	if strings.HasSuffix(w, "e") && !strings.HasSuffix(w, "le") && n > 1 {
+		n--
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+func round1(f float64) float64 {
+	return math.Round(f*10) / 10
+}
+
+// readabilityTarget is the grade a concept should read at: --readability-
+// target when set, else one derived from its difficulty score, else 0 (no
+// target; outliers are judged against the median).
+func readabilityTarget(j chunk, k int) float64 {
+	if cfg.ReadabilityTarget > 0 {
+		return cfg.ReadabilityTarget
+	}
+	if j.diff != nil {
+		return float64(6 + 2*j.diff[k]) // difficulty 1 -> grade 8 ... 5 -> grade 16
+	}
+	return 0
+}
+
+// scoreSections scores every concept section and flags outliers. With
+// --readability-fix the outliers are rewritten once at their target level.
+// Results are per chunk and aligned with each chunk's items.
+func scoreSections(chunks []chunk, results []string) [][]Readability {
+	scores := make([][]Readability, len(results))
+	have := make([][]bool, len(results))
+	texts := make([]map[string]string, len(results))
+	var grades []float64
+	for i, content := range results {
+		scores[i] = make([]Readability, len(chunks[i].items))
+		have[i] = make([]bool, len(chunks[i].items))
+		texts[i] = map[string]string{}
+		if content == "" {
+			continue
+		}
+		_, sections := splitSections(content, chunkNumbers(chunks[i].items))
+		for _, s := range sections {
+			texts[i][s.Number] = s.Text
+		}
+		for k, it := range chunks[i].items {
+			text, found := texts[i][conceptNumber(it)]
+			if !found {
+				continue
+			}
+			if r, ok := scoreReadability(text); ok {
+				r.Target = readabilityTarget(chunks[i], k)
+				scores[i][k], have[i][k] = r, true
+				grades = append(grades, r.Grade)
+			}
+		}
+	}
+	if len(grades) == 0 {
+		return nil
+	}
+	median := medianOf(grades)
+
+	for i := range scores {
+		for k, it := range chunks[i].items {
+			r := &scores[i][k]
+			if !have[i][k] {
+				continue
+			}
+			target := r.Target
+			if target == 0 {
+				target = median
+			}
+			if math.Abs(r.Grade-target) <= readabilityTolerance {
+				continue
+			}
+			r.Outlier = true
+			if !cfg.ReadabilityFix {
+				continue
+			}
+			num := conceptNumber(it)
+			text, err := adjustReadability(chunks[i], num, texts[i][num], r.Grade, target)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error adjusting readability of section %s: %v\n", num, err)
+				continue
+			}
+			results[i] = replaceSection(results[i], chunks[i].items, num, text)
+			if fixed, ok := scoreReadability(text); ok {
+				r.Grade, r.ReadingEase = fixed.Grade, fixed.ReadingEase
+				r.Outlier = math.Abs(r.Grade-target) > readabilityTolerance
+			}
+			r.Fixed = true
+		}
+	}
+	return scores
+}
+
+func adjustReadability(j chunk, num, section string, grade, target float64) (string, error) {
+	direction := "Simplify the language: shorter sentences, plainer words, and explain jargon on first use"
+	if grade < target {
+		direction = "Deepen the language: precise technical vocabulary and fuller, more nuanced explanations"
+	}
+	if !cfg.Stdout {
+		statusf("-> Adjusting section %s from grade %.1f towards %.0f...\n", num, grade, target)
+	}
+	prompt := fmt.Sprintf(
+		"This study-guide section reads at about US grade level %.1f; the audience needs about grade %.0f. %s. "+
+			"Keep the heading line exactly, and keep all facts, code blocks, formulas, tables and the overall structure.\n\n%s",
+		grade, target, direction, section,
+	)
+	resp, err := callAIWith(callOptions{Model: j.model, Temperature: defaultTemperature, Purpose: "readability"}, prompt, cfg.SystemPrompt)
+	if err != nil {
+		return "", err
+	}
+	resp = cleanChunkContent(resp)
+	heading, _, _ := strings.Cut(section, "\n")
+	if h, _, _ := strings.Cut(resp, "\n"); strings.TrimSpace(h) != heading {
+		resp = heading + "\n\n" + resp
+	}
+	return resp, nil
+}
+
+func medianOf(xs []float64) float64 {
+	s := append([]float64(nil), xs...)
+	sort.Float64s(s)
+	if len(s)%2 == 1 {
+		return s[len(s)/2]
+	}
+	return (s[len(s)/2-1] + s[len(s)/2]) / 2
+}
+
+// writeReadabilitySummary prints the grade distribution and the outliers.
+func writeReadabilitySummary(w io.Writer, sections []SectionMeta) {
+	buckets := []struct {
+		label string
+		max   float64
+	}{{"≤ 6", 6}, {"7-8", 8}, {"9-10", 10}, {"11-12", 12}, {"13-14", 14}, {"15+", math.Inf(1)}}
+	counts := make([]int, len(buckets))
+	total := 0
+	var outliers []string
+	for _, sec := range sections {
+		for k, r := range sec.Readability {
+			if r.Grade == 0 && r.ReadingEase == 0 {
+				continue
+			}
+			total++
+			for b := range buckets {
+				if math.Round(r.Grade) <= buckets[b].max {
+					counts[b]++
+					break
+				}
+			}
+			if r.Outlier || r.Fixed {
+				note := fmt.Sprintf("   %d: grade %.1f", sec.Items[k], r.Grade)
+				if r.Target > 0 {
+					note += fmt.Sprintf(", target %.0f", r.Target)
+				}
+				if r.Fixed {
+					note += " (adjusted)"
+				}
+				outliers = append(outliers, note)
+			}
+		}
+	}
+	if total == 0 {
+		return
+	}
+	fmt.Fprintln(w, "-> Readability (Flesch-Kincaid grade):")
+	for b, bucket := range buckets {
+		pct := float64(counts[b]) * 100 / float64(total)
+		fmt.Fprintf(w, "   %-6s %-20s %3d (%.0f%%)\n", bucket.label, strings.Repeat("█", int(pct/5+0.5)), counts[b], pct)
+	}
+	if len(outliers) > 0 {
+		fmt.Fprintf(w, "   Outliers (more than %.0f grades off):\n", readabilityTolerance)
+		for _, o := range outliers {
+			fmt.Fprintln(w, "  "+o)
+		}
+	}
+}
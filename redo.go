@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// redoSection is a concept of a finished guide regenerated from scratch.
+type redoSection struct {
+	number     int
+	title      string // the heading, "7. Goroutines"
+	model      string
+	start, end int
+	old, new   string
+	err        error
+}
+
+// applyGuideSettings restores the settings a guide was generated with, from
+// its sidecar, so regenerated sections match the rest of it. Flags given to
+// this command win.
+func applyGuideSettings(cmd *cobra.Command, sc *Sidecar) error {
+	cfg.Mode, cfg.Lang = "guide", guideLanguage(sc)
+	langRequested = cfg.Lang != "en"
+	if sc == nil {
+		return nil
+	}
+	s := sc.Provenance.Settings
+	if m := s["mode"]; m != "" {
+		cfg.Mode = m
+	}
+	if _, ok := modes[cfg.Mode]; !ok || cfg.Mode == "exercises" {
+		return fmt.Errorf("guides generated with --mode %s can't be redone", cfg.Mode)
+	}
+	cfg.Misconceptions = s["misconceptions"] == "true"
+	cfg.Tables = s["tables"] == "true"
+	cfg.AltExplanations = s["alt_explanations"] == "true" && s["alt_model"] == ""
+	cfg.NoAnswers = s["no_answers"] == "true"
+	cfg.AnalogyDomain = s["analogy_domain"]
+	if !cmd.Flags().Changed("model") && sc.Provenance.Model != "" {
+		cfg.Model = sc.Provenance.Model
+	}
+	return nil
+}
+
+// sectionModel is the model that wrote concept n, from the sidecar, so a
+// guide routed by difficulty keeps each concept on its model.
+func sectionModel(sc *Sidecar, n int) string {
+	if sc != nil {
+		for _, sec := range sc.Sections {
+			if slices.Contains(sec.Items, n) && sec.Model != "" {
+				return sec.Model
+			}
+		}
+	}
+	return ""
+}
+
+// regenerateSection answers one concept the way the chunk workers do.
+func regenerateSection(s *redoSection) (string, error) {
+	j := chunk{id: s.number, start: s.number - 1, items: []string{s.title}, model: s.model}
+	prompt := currentMode().chunkPrompt(s.title)
+	if cfg.Misconceptions {
+		prompt += misconceptionsInstruction
+	}
+	if cfg.Tables {
+		prompt += tablesInstruction(j.items)
+	}
+	if cfg.AltExplanations {
+		prompt += altInstruction
+	}
+	if cfg.AnalogyDomain != "" {
+		prompt += analogyInstruction(cfg.AnalogyDomain)
+	}
+	resp, err := callAIWith(callOptions{Model: s.model, Temperature: defaultTemperature, Purpose: "redo"}, prompt, cfg.SystemPrompt)
+	if err != nil {
+		return "", err
+	}
+	content, err := renumberSections(j, cleanChunkContent(resp))
+	if err != nil {
+		return "", err
+	}
+	if cfg.AnalogyDomain != "" {
+		content, _ = styleAnalogies(j, content)
+	}
+	if cfg.Mode == "socratic" {
+		content, _ = hideAnswers(j, content)
+	}
+	if _, _, ok := guideSection(content, s.number); !ok {
+		return "", fmt.Errorf("the model's answer has no heading for concept %d", s.number)
+	}
+	return content, nil
+}
+
+// redoGuide regenerates concepts numbers of the guide at path from scratch
+// and writes them back in place, keeping the original as path.bak.
+func redoGuide(cmd *cobra.Command, path string, numbers []int, showDiff, confirm bool) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	md := string(src)
+	sc, err := readSidecar(sidecarPath(path))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "Warning: ignoring the sidecar: %v\n", err)
+		}
+		sc = nil
+	}
+
+	title, concepts := guideConcepts(parseMarkdown(md))
+	headings := map[int]string{}
+	for _, c := range concepts {
+		if n, err := strconv.Atoi(conceptNumber(c.Title)); err == nil {
+			headings[n] = c.Title
+		}
+	}
+	var picked []*redoSection
+	for _, n := range numbers {
+		start, end, ok := guideSection(md, n)
+		if !ok || headings[n] == "" {
+			return fmt.Errorf("%s has no concept %d (it has %d concepts)", path, n, len(headings))
+		}
+		picked = append(picked, &redoSection{number: n, title: headings[n], start: start, end: end, old: strings.TrimSpace(md[start:end])})
+	}
+	if err := applyGuideSettings(cmd, sc); err != nil {
+		return err
+	}
+	cfg.Subject = title
+	cfg.SystemPrompt = currentMode().systemPrompt
+	if cfg.SystemPromptPath != "" {
+		if cfg.SystemPrompt, err = loadSystemPrompt(cfg.SystemPromptPath); err != nil {
+			return err
+		}
+	}
+	if cfg.SystemPrompt, err = withInstructions(cfg.SystemPrompt, cfg.Info); err != nil {
+		return err
+	}
+	if sc != nil && len(sc.Terminology) > 0 {
+		cfg.SystemPrompt += terminologyInstruction(sc.Terminology)
+	}
+	for _, s := range picked {
+		if s.model = cfg.Model; !cmd.Flags().Changed("model") {
+			if m := sectionModel(sc, s.number); m != "" {
+				s.model = m
+			}
+		}
+	}
+
+	fmt.Printf("-> Regenerating %d section(s) of %s\n", len(picked), path)
+	jobs := make(chan *redoSection)
+	var wg sync.WaitGroup
+	for i := 0; i < max(cfg.Threads, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range jobs {
+				fmt.Printf("   Regenerating %s...\n", s.title)
+				s.new, s.err = regenerateSection(s)
+			}
+		}()
+	}
+	for _, s := range picked {
+		jobs <- s
+	}
+	close(jobs)
+	wg.Wait()
+
+	var failed int
+	for _, s := range picked {
+		if s.err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "Error regenerating %s: %v\n", s.title, s.err)
+			continue
+		}
+		if showDiff {
+			fmt.Printf("\n--- %s (before)\n+++ %s (after)\n", s.title, s.title)
+			for _, line := range lineDiff(s.old, s.new) {
+				fmt.Println(line)
+			}
+		}
+	}
+	if failed == len(picked) {
+		return fmt.Errorf("no section could be regenerated; %s is unchanged", path)
+	}
+	if confirm {
+		fmt.Printf("\nReplace %d section(s) of %s? [y/N] ", len(picked)-failed, path)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Nothing changed.")
+			return nil
+		}
+	}
+
+	backup := path + ".bak"
+	if err := writeFileAtomic(backup, src, st.Mode().Perm()); err != nil {
+		return fmt.Errorf("keeping the original: %w", err)
+	}
+	now := time.Now()
+	// From the end, so the earlier sections' offsets stay valid.
+	slices.SortFunc(picked, func(a, b *redoSection) int { return b.start - a.start })
+	for _, s := range picked {
+		if s.err != nil {
+			continue
+		}
+		md = md[:s.start] + s.new + "\n\n" + md[s.end:]
+		emitEvent(progressEvent{Event: "section", Text: s.new})
+		if sc != nil {
+			markUpdated(sc, s.number, now)
+		}
+	}
+	if err := writeFileAtomic(path, []byte(md), st.Mode().Perm()); err != nil {
+		return err
+	}
+	if sc != nil {
+		if err := writeSidecar(sidecarPath(path), sc); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing sidecar: %v\n", err)
+		}
+	}
+	fmt.Printf("-> Regenerated %d of %d section(s) of %s; the original is kept as %s\n", len(picked)-failed, len(picked), path, backup)
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d section(s) could not be regenerated and were left as they were", ErrPartialFailure, failed, len(picked))
+	}
+	return nil
+}
+
+// lineDiff is a line diff of a and b, with - and + for removed and added
+// lines. Unchanged runs are cut down to three lines of context.
+func lineDiff(a, b string) []string {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+	// lcs[i][j] is the longest common subsequence of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var out, same []string
+	flush := func(last bool) {
+		const context = 3
+		switch {
+		case len(out) == 0 && len(same) > context:
+			same = same[len(same)-context:]
+		case last && len(same) > context:
+			same = same[:context]
+		case len(same) > 2*context:
+			same = append(append(same[:context:context], "  ..."), same[len(same)-context:]...)
+		}
+		out = append(out, same...)
+		same = nil
+	}
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			same = append(same, "  "+x[i])
+			i, j = i+1, j+1
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			flush(false)
+			out = append(out, "- "+x[i])
+			i++
+		default:
+			flush(false)
+			out = append(out, "+ "+y[j])
+			j++
+		}
+	}
+	flush(true)
+	return out
+}
+
+func newRedoCmd() *cobra.Command {
+	var showDiff, confirm bool
+	cmd := &cobra.Command{
+		Use:   "redo <guide.md> <n>...",
+		Short: "Regenerate concepts of a guide from scratch with the settings it was generated with",
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var numbers []int
+			for _, a := range args[1:] {
+				n, err := strconv.Atoi(a)
+				if err != nil || n < 1 {
+					fmt.Fprintf(os.Stderr, "Error: invalid concept number %q\n", a)
+					os.Exit(1)
+				}
+				if !slices.Contains(numbers, n) {
+					numbers = append(numbers, n)
+				}
+			}
+			if cfg.Threads < 1 {
+				fmt.Fprintln(os.Stderr, "Error: --threads must be at least 1.")
+				os.Exit(1)
+			}
+			if confirm && cfg.SystemPromptPath == "-" {
+				fmt.Fprintln(os.Stderr, "Error: --confirm reads the answer from stdin, so --system-prompt cannot be -.")
+				os.Exit(1)
+			}
+			if err := loadEnv(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			err := redoGuide(cmd, args[0], numbers, showDiff, confirm)
+			emitUsage()
+			usage.writeSummary(os.Stdout, cfg.Model)
+			if err != nil {
+				if !errors.Is(err, ErrPartialFailure) {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				}
+				os.Exit(reportError(err))
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&showDiff, "show-diff", false, "Print how each section changed")
+	cmd.Flags().BoolVar(&confirm, "confirm", false, "Ask before writing the regenerated sections")
+	cmd.Flags().StringVarP(&cfg.Provider, "provider", "p", "", "Named provider profile from the config file")
+	cmd.Flags().StringVarP(&cfg.Model, "model", "m", "", "Model to use instead of the one the guide was generated with")
+	cmd.Flags().StringVarP(&cfg.SystemPromptPath, "system-prompt", "s", "", "Custom system prompt: a file path, an http(s) URL or - for stdin")
+	cmd.Flags().StringArrayVarP(&cfg.Info, "info", "i", nil, "Additional instructions for this redo, or @file to read them from a file (repeatable)")
+	cmd.Flags().IntVarP(&cfg.Threads, "threads", "t", 1, "Number of sections regenerated concurrently")
+	cmd.Flags().BoolVar(&cfg.ProgressEvents, "progress-events", false, "Write machine-readable progress events to stdout")
+	cmd.Flags().MarkHidden("progress-events")
+	return cmd
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// lastUpdatedRe matches the "*Last updated: 2006-01-02*" line refresh ends a
+// section with, in any output language.
+var lastUpdatedRe = regexp.MustCompile(`\n+\*[^*\n]+: (\d{4}-\d{2}-\d{2})\*$`)
+
+// refreshSelection picks the sections to refresh. A section has to match
+// every criterion that is set.
+type refreshSelection struct {
+	olderThan time.Duration
+	sections  map[int]bool
+	matching  []string
+}
+
+// parseAge reads --older-than: a Go duration, or a number of days or weeks
+// like 180d or 6w.
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.Atoi(n)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("expected a number before %q", suffix)
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// parseSectionList reads --sections: numbers and ranges such as 12,30-35.
+func parseSectionList(s string) (map[int]bool, error) {
+	out := map[int]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(lo)
+		to := from
+		if err == nil && isRange {
+			to, err = strconv.Atoi(hi)
+		}
+		if err != nil || from < 1 || to < from {
+			return nil, fmt.Errorf("%q is not a concept number or range", part)
+		}
+		for n := from; n <= to; n++ {
+			out[n] = true
+		}
+	}
+	return out, nil
+}
+
+// staleSection is a section of the guide selected for refreshing.
+type staleSection struct {
+	number     int
+	title      string
+	start, end int
+	text       string // without its last-updated line
+	updated    time.Time
+	refreshed  string
+	err        error
+}
+
+// sectionUpdated is when concept n was last written: the section's own
+// last-updated line, else the sidecar, else the guide's file time.
+func sectionUpdated(text string, sc *Sidecar, n int, fallback time.Time) time.Time {
+	if m := lastUpdatedRe.FindStringSubmatch(text); m != nil {
+		if t, err := time.ParseInLocation(time.DateOnly, m[1], time.Local); err == nil {
+			return t
+		}
+	}
+	if sc == nil {
+		return fallback
+	}
+	for _, sec := range sc.Sections {
+		if k := slices.Index(sec.Items, n); k >= 0 && k < len(sec.Updated) {
+			if t, err := time.Parse(time.RFC3339, sec.Updated[k]); err == nil {
+				return t
+			}
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, sc.Provenance.Date); err == nil {
+		return t
+	}
+	return fallback
+}
+
+// selectStale finds the sections of md that sel picks, in guide order.
+func selectStale(md string, sc *Sidecar, sel refreshSelection, fallback time.Time) []*staleSection {
+	_, concepts := guideConcepts(parseMarkdown(md))
+	var picked []*staleSection
+	for _, c := range concepts {
+		n, err := strconv.Atoi(conceptNumber(c.Title))
+		if err != nil {
+			continue
+		}
+		start, end, ok := guideSection(md, n)
+		if !ok {
+			continue
+		}
+		text := strings.TrimSpace(md[start:end])
+		s := &staleSection{number: n, title: c.Title, start: start, end: end, updated: sectionUpdated(text, sc, n, fallback)}
+		s.text = lastUpdatedRe.ReplaceAllString(text, "")
+		if sel.sections != nil && !sel.sections[n] {
+			continue
+		}
+		if sel.olderThan > 0 && time.Since(s.updated) < sel.olderThan {
+			continue
+		}
+		if len(sel.matching) > 0 && !slices.ContainsFunc(sel.matching, func(k string) bool {
+			return strings.Contains(strings.ToLower(s.text), strings.ToLower(k))
+		}) {
+			continue
+		}
+		picked = append(picked, s)
+	}
+	return picked
+}
+
+// refreshSection asks the model to bring one section up to date.
+func refreshSection(title string, s *staleSection, webSearch bool) (string, error) {
+	grounding := ""
+	if webSearch {
+		grounding = "Search the web to check current versions, APIs and recommendations, and link the sources you relied on. "
+	}
+	prompt := fmt.Sprintf(
+		"Here is one section of a study guide about %s, last updated on %s:\n\n%s\n\n"+
+			"Today is %s. Refresh the section so it reflects the current state of the subject: correct what has become outdated, "+
+			"replace deprecated APIs, tools and practices with their current equivalents and keep everything that is still accurate. %s"+
+			"Keep its heading and numbering exactly as they are. Output ONLY the refreshed section in markdown.",
+		title, s.updated.Format(time.DateOnly), s.text, time.Now().Format(time.DateOnly), grounding)
+	resp, err := callAIWith(callOptions{Model: cfg.Model, Temperature: defaultTemperature, Purpose: "refresh", WebSearch: webSearch}, prompt, cfg.SystemPrompt)
+	if err != nil {
+		return "", err
+	}
+	refreshed := cleanChunkContent(resp)
+	if _, _, ok := guideSection(refreshed, s.number); !ok {
+		return "", fmt.Errorf("the model's answer lost the heading of concept %d", s.number)
+	}
+	return refreshed, nil
+}
+
+// refreshGuide rewrites the selected sections of a guide in place, with a
+// last-updated line each, and records the dates in its sidecar. Every other
+// byte of the guide is left as it was.
+func refreshGuide(path string, sel refreshSelection, webSearch, dryRun bool) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	md := string(src)
+	sc, err := readSidecar(sidecarPath(path))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "Warning: ignoring the sidecar: %v\n", err)
+		}
+		sc = nil
+	}
+	lang := languages[guideLanguage(sc)]
+
+	stale := selectStale(md, sc, sel, st.ModTime())
+	if len(stale) == 0 {
+		fmt.Println("-> No sections match; the guide is unchanged.")
+		return nil
+	}
+	fmt.Printf("-> Refreshing %d section(s) of %s\n", len(stale), path)
+	if dryRun {
+		for _, s := range stale {
+			fmt.Printf("   %s (last updated %s)\n", s.title, s.updated.Format(time.DateOnly))
+		}
+		return nil
+	}
+
+	title, _ := guideConcepts(parseMarkdown(md))
+	jobs := make(chan *staleSection)
+	var wg sync.WaitGroup
+	for i := 0; i < max(cfg.Threads, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range jobs {
+				fmt.Printf("   Refreshing %s...\n", s.title)
+				s.refreshed, s.err = refreshSection(title, s, webSearch)
+			}
+		}()
+	}
+	for _, s := range stale {
+		jobs <- s
+	}
+	close(jobs)
+	wg.Wait()
+
+	now := time.Now()
+	var failed int
+	for i := len(stale) - 1; i >= 0; i-- {
+		s := stale[i]
+		if s.err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "Error refreshing %s: %v\n", s.title, s.err)
+			continue
+		}
+		section := fmt.Sprintf("%s\n\n*%s: %s*\n\n", s.refreshed, lang.lastUpdated, now.Format(time.DateOnly))
+		md = md[:s.start] + section + md[s.end:]
+		emitEvent(progressEvent{Event: "section", Text: s.refreshed})
+		if sc != nil {
+			markUpdated(sc, s.number, now)
+		}
+	}
+	if failed < len(stale) {
+		if err := writeFileAtomic(path, []byte(md), st.Mode().Perm()); err != nil {
+			return err
+		}
+		if sc != nil {
+			if err := writeSidecar(sidecarPath(path), sc); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing sidecar: %v\n", err)
+			}
+		}
+	}
+	fmt.Printf("-> Refreshed %d of %d section(s) of %s\n", len(stale)-failed, len(stale), path)
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d section(s) could not be refreshed and were left as they were", ErrPartialFailure, failed, len(stale))
+	}
+	return nil
+}
+
+// markUpdated records in the sidecar when concept n was refreshed.
+func markUpdated(sc *Sidecar, n int, at time.Time) {
+	for i := range sc.Sections {
+		sec := &sc.Sections[i]
+		k := slices.Index(sec.Items, n)
+		if k < 0 {
+			continue
+		}
+		if len(sec.Updated) < len(sec.Items) {
+			sec.Updated = append(sec.Updated, make([]string, len(sec.Items)-len(sec.Updated))...)
+		}
+		sec.Updated[k] = at.Format(time.RFC3339)
+		return
+	}
+}
+
+// writeFileAtomic replaces path with data through a temporary file in the
+// same directory, so a crash never leaves a half-written guide.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func newRefreshCmd() *cobra.Command {
+	var olderThan, sections string
+	var matching []string
+	var webSearch, dryRun bool
+	cmd := &cobra.Command{
+		Use:   "refresh <guide.md>",
+		Short: "Regenerate stale or selected sections of a guide in place",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var sel refreshSelection
+			var err error
+			if olderThan != "" {
+				if sel.olderThan, err = parseAge(olderThan); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: invalid --older-than %q: %v\n", olderThan, err)
+					os.Exit(1)
+				}
+			}
+			if sections != "" {
+				if sel.sections, err = parseSectionList(sections); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: invalid --sections: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			sel.matching = matching
+			if olderThan == "" && sections == "" && len(matching) == 0 {
+				fmt.Fprintln(os.Stderr, "Error: refresh needs --older-than, --sections or --matching to pick the sections.")
+				os.Exit(1)
+			}
+			if cfg.Threads < 1 {
+				fmt.Fprintln(os.Stderr, "Error: --threads must be at least 1.")
+				os.Exit(1)
+			}
+			if err := loadEnv(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			cfg.SystemPrompt = modes["guide"].systemPrompt
+			err = refreshGuide(args[0], sel, webSearch, dryRun)
+			emitUsage()
+			if !dryRun {
+				usage.writeSummary(os.Stdout, cfg.Model)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrPartialFailure) {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				}
+				os.Exit(reportError(err))
+			}
+		},
+	}
+	cmd.Flags().StringVar(&olderThan, "older-than", "", "Refresh sections last written longer ago than this, e.g. 180d, 6w or 720h")
+	cmd.Flags().StringVar(&sections, "sections", "", "Refresh these concepts, e.g. 12,30-35")
+	cmd.Flags().StringSliceVar(&matching, "matching", nil, "Refresh sections mentioning any of these words, e.g. deprecated (case-insensitive)")
+	cmd.Flags().BoolVar(&webSearch, "web-search", false, "Ground the refreshed sections in a web search (needs a search-capable model)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the sections that would be refreshed and exit")
+	cmd.Flags().StringVarP(&cfg.Provider, "provider", "p", "", "Named provider profile from the config file")
+	cmd.Flags().StringVarP(&cfg.Model, "model", "m", "", "Model to use (overrides OPENAI_MODEL)")
+	cmd.Flags().IntVarP(&cfg.Threads, "threads", "t", 1, "Number of sections refreshed concurrently")
+	cmd.Flags().BoolVar(&cfg.ProgressEvents, "progress-events", false, "Write machine-readable progress events to stdout")
+	cmd.Flags().MarkHidden("progress-events")
+	return cmd
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/yuriiter/aiguide/pkg/guide"
+)
+
+// runID identifies this run: it prefixes every request id, is set on every
+// progress event and is the id of the run's history record.
+var runID = newHistoryID()
+
+// failedRequestIDs returns the ids of the request err came from.
+func failedRequestIDs(err error) (*guide.RequestError, bool) {
+	return guide.FailedRequest(err)
+}
+
+// writeFailureSummary lists the failed chunks with their concepts and the
+// request ids to quote in a support ticket to the provider. Concepts left
+// out after Ctrl-C or once the budget was spent are listed apart.
+func writeFailureSummary(w io.Writer, sections []SectionMeta) {
+	var failed []SectionMeta
+	var concepts, stopped []int
+	reason := "after Ctrl-C"
+	for _, sec := range sections {
+		switch {
+		case sec.Failed && (errors.Is(sec.err, ErrInterrupted) || errors.Is(sec.err, ErrBudgetExceeded)):
+			stopped = append(stopped, sec.Items...)
+			if errors.Is(sec.err, ErrBudgetExceeded) {
+				reason = "within the budget"
+			}
+		case sec.Failed:
+			failed = append(failed, sec)
+			concepts = append(concepts, sec.Items...)
+		}
+	}
+	if len(stopped) > 0 {
+		fmt.Fprintf(w, "-> Not generated %s: concepts %s\n", reason, joinInts(stopped))
+	}
+	if len(failed) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "-> Failed: %d of %d chunk(s) (run %s), concepts %s\n", len(failed), len(sections), runID, joinInts(concepts))
+	for _, sec := range failed {
+		ids, ok := failedRequestIDs(sec.err)
+		switch {
+		case !ok:
+			fmt.Fprintf(w, "   chunk %d (concepts %s)\n", sec.Chunk, joinInts(sec.Items))
+		case ids.Upstream == "":
+			fmt.Fprintf(w, "   chunk %d (concepts %s), request %s, no upstream id\n", sec.Chunk, joinInts(sec.Items), ids.ID)
+		default:
+			fmt.Fprintf(w, "   chunk %d (concepts %s), request %s, upstream id %s\n", sec.Chunk, joinInts(sec.Items), ids.ID, ids.Upstream)
+		}
+	}
+	fmt.Fprintf(w, "   Regenerate them with: aiguide redo <guide.md> %s\n", strings.Join(strings.Split(joinInts(concepts), ", "), " "))
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// schemaVersion is the version of the JSON documents aiguide writes. Bump
+// it for any backwards-incompatible change to their shape, update the
+// schema files' const, and teach the loaders to upgrade the old version.
+const schemaVersion = 1
+
+const schemaBaseURL = "https://raw.githubusercontent.com/yuriiter/aiguide/main/"
+
+var (
+	//go:embed sidecar.schema.json
+	sidecarSchema []byte
+	//go:embed conceptmap.schema.json
+	conceptmapSchema []byte
+	//go:embed guide.schema.json
+	guideSchema []byte
+)
+
+// schemas maps a document kind to its embedded JSON Schema.
+var schemas = map[string][]byte{
+	"sidecar":    sidecarSchema,
+	"conceptmap": conceptmapSchema,
+	"guide":      guideSchema,
+}
+
+func schemaURL(kind string) string {
+	return schemaBaseURL + kind + ".schema.json"
+}
+
+func schemaNames() string {
+	names := make([]string, 0, len(schemas))
+	for n := range schemas {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// documentKind tells which schema a document follows: from its $schema
+// stamp, else from the file name.
+func documentKind(path string, doc any) (string, error) {
+	if m, ok := doc.(map[string]any); ok {
+		if s, ok := m["$schema"].(string); ok {
+			for kind := range schemas {
+				if s == schemaURL(kind) {
+					return kind, nil
+				}
+			}
+			return "", fmt.Errorf("unknown $schema %q", s)
+		}
+	}
+	switch {
+	case strings.HasSuffix(path, ".meta.json"):
+		return "sidecar", nil
+	case strings.HasSuffix(path, ".conceptmap.json"):
+		return "conceptmap", nil
+	}
+	return "", fmt.Errorf("cannot tell which schema %s follows (no $schema field)", path)
+}
+
+// validateDocument checks a marshalled document against the embedded
+// schema of its kind and returns every violation found.
+func validateDocument(kind string, data []byte) ([]string, error) {
+	var schema map[string]any
+	if err := json.Unmarshal(schemas[kind], &schema); err != nil {
+		return nil, fmt.Errorf("embedded %s schema: %v", kind, err)
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	v := &schemaValidator{root: schema}
+	v.check("$", schema, doc)
+	return v.errs, nil
+}
+
+// schemaValidator implements the subset of JSON Schema 2020-12 the
+// embedded schemas use: type, const, enum, properties, required,
+// additionalProperties, items, minimum, maximum and local $refs.
+type schemaValidator struct {
+	root map[string]any
+	errs []string
+}
+
+func (v *schemaValidator) fail(at, format string, args ...any) {
+	v.errs = append(v.errs, at+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *schemaValidator) check(at string, schema map[string]any, doc any) {
+	if ref, ok := schema["$ref"].(string); ok {
+		target := v.resolve(ref)
+		if target == nil {
+			v.fail(at, "unresolvable $ref %q", ref)
+			return
+		}
+		schema = target
+	}
+	if t, ok := schema["type"]; ok && !typeMatches(t, doc) {
+		v.fail(at, "expected %s, got %s", typeList(t), jsonType(doc))
+		return
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, doc) {
+		v.fail(at, "expected %v, got %v", c, doc)
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			found = found || jsonEqual(e, doc)
+		}
+		if !found {
+			v.fail(at, "%v is not one of %v", doc, enum)
+		}
+	}
+	switch d := doc.(type) {
+	case float64:
+		if lo, ok := schema["minimum"].(float64); ok && d < lo {
+			v.fail(at, "%v is below the minimum %v", d, lo)
+		}
+		if hi, ok := schema["maximum"].(float64); ok && d > hi {
+			v.fail(at, "%v is above the maximum %v", d, hi)
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, e := range d {
+				v.check(fmt.Sprintf("%s[%d]", at, i), items, e)
+			}
+		}
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		if req, ok := schema["required"].([]any); ok {
+			for _, r := range req {
+				if _, ok := d[r.(string)]; !ok {
+					v.fail(at, "missing required field %q", r)
+				}
+			}
+		}
+		keys := make([]string, 0, len(d))
+		for k := range d {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if p, ok := props[k].(map[string]any); ok {
+				v.check(at+"."+k, p, d[k])
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					v.fail(at, "unexpected field %q", k)
+				}
+			case map[string]any:
+				v.check(at+"."+k, extra, d[k])
+			}
+		}
+	}
+}
+
+// resolve follows a "#/$defs/name" style pointer into the root schema.
+func (v *schemaValidator) resolve(ref string) map[string]any {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+	var node any = v.root
+	for _, part := range strings.Split(ref[2:], "/") {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil
+		}
+		node = m[part]
+	}
+	m, _ := node.(map[string]any)
+	return m
+}
+
+func jsonType(doc any) string {
+	switch d := doc.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if d == math.Trunc(d) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	}
+	return "object"
+}
+
+func typeMatches(t, doc any) bool {
+	got := jsonType(doc)
+	ok := func(want string) bool { return want == got || want == "number" && got == "integer" }
+	switch t := t.(type) {
+	case string:
+		return ok(t)
+	case []any:
+		for _, w := range t {
+			if s, _ := w.(string); ok(s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeList(t any) string {
+	if list, ok := t.([]any); ok {
+		parts := make([]string, len(list))
+		for i, s := range list {
+			parts[i] = fmt.Sprint(s)
+		}
+		return strings.Join(parts, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func jsonEqual(a, b any) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
+}
+
+func newSchemaCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema <" + strings.ReplaceAll(schemaNames(), ", ", "|") + ">",
+		Short: "Print the JSON Schema of a document aiguide writes",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			s, ok := schemas[args[0]]
+			if !ok {
+				fmt.Fprintf(os.Stderr, "Error: unknown schema %q (expected %s)\n", args[0], schemaNames())
+				os.Exit(1)
+			}
+			os.Stdout.Write(s)
+		},
+	}
+
+	validate := &cobra.Command{
+		Use:   "validate <file.json>...",
+		Short: "Check sidecars, concept map data or JSON guides against their schema",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			failed := false
+			for _, path := range args {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				var doc any
+				if err := json.Unmarshal(data, &doc); err != nil {
+					fmt.Fprintf(os.Stderr, "Error parsing %s: %v\n", path, err)
+					os.Exit(1)
+				}
+				kind, err := documentKind(path, doc)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				errs, err := validateDocument(kind, data)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				if len(errs) == 0 {
+					fmt.Printf("%s: valid %s\n", path, kind)
+					continue
+				}
+				failed = true
+				for _, e := range errs {
+					fmt.Printf("%s: %s\n", path, e)
+				}
+			}
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.AddCommand(validate)
+	return cmd
+}
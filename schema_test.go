@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSchemaFixtures validates the example documents in testdata/schema:
+// the invalid*.json ones against the violations in their .errors golden
+// file, the others against none. testdata/schema/v0 holds documents of
+// older versions, which don't match the current schemas.
+func TestSchemaFixtures(t *testing.T) {
+	paths, err := filepath.Glob("testdata/schema/*.json")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		kind, err := documentKind(path, doc)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		errs, err := validateDocument(kind, data)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if strings.HasPrefix(filepath.Base(path), "invalid") {
+			golden(t, strings.TrimSuffix(path, ".json")+".errors", strings.Join(errs, "\n")+"\n")
+		} else if len(errs) > 0 {
+			t.Errorf("%s does not match the %s schema:\n%s", path, kind, strings.Join(errs, "\n"))
+		}
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	for kind, data := range schemas {
+		var schema struct {
+			Properties struct {
+				Version struct {
+					Const int `json:"const"`
+				} `json:"schema_version"`
+			} `json:"properties"`
+		}
+		if err := json.Unmarshal(data, &schema); err != nil {
+			t.Fatalf("%s schema: %v", kind, err)
+		}
+		if schema.Properties.Version.Const != schemaVersion {
+			t.Errorf("%s schema is version %d, aiguide writes %d", kind, schema.Properties.Version.Const, schemaVersion)
+		}
+	}
+}
+
+// fill sets every exported field of v to a value the schemas accept, so a
+// field added to a document without its schema shows up as unexpected.
+func fill(v reflect.Value, name string) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.IsExported() {
+				fill(v.Field(i), strings.Split(f.Tag.Get("json"), ",")[0])
+			}
+		}
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(v.Elem(), name)
+	case reflect.Slice:
+		s := reflect.MakeSlice(v.Type(), 1, 1)
+		fill(s.Index(0), name)
+		v.Set(s)
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		k, e := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		fill(k, name)
+		fill(e, name)
+		m.SetMapIndex(k, e)
+		v.Set(m)
+	case reflect.String:
+		switch name {
+		case "status":
+			v.SetString("ok")
+		case "kind":
+			v.SetString("link")
+		default:
+			v.SetString("x")
+		}
+	case reflect.Int, reflect.Int64:
+		v.SetInt(2)
+	case reflect.Float64:
+		v.SetFloat(0.5)
+	case reflect.Bool:
+		v.SetBool(true)
+	}
+}
+
+func TestWrittenDocumentsMatchSchema(t *testing.T) {
+	var sc Sidecar
+	fill(reflect.ValueOf(&sc).Elem(), "")
+	path := filepath.Join(t.TempDir(), "guide.meta.json")
+	if err := writeSidecar(path, &sc); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs, err := validateDocument("sidecar", data); err != nil || len(errs) > 0 {
+		t.Errorf("the sidecar does not match its schema: %v\n%s", err, strings.Join(errs, "\n"))
+	}
+
+	var m conceptMap
+	fill(reflect.ValueOf(&m).Elem(), "")
+	m.Schema, m.SchemaVersion = schemaURL("conceptmap"), schemaVersion
+	data, err = json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs, err := validateDocument("conceptmap", data); err != nil || len(errs) > 0 {
+		t.Errorf("the concept map does not match its schema: %v\n%s", err, strings.Join(errs, "\n"))
+	}
+
+	var g jsonGuide
+	fill(reflect.ValueOf(&g).Elem(), "")
+	g.Schema, g.Version = schemaURL("guide"), schemaVersion
+	path = filepath.Join(t.TempDir(), "guide.json")
+	if err := g.write(path); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if errs, err := validateDocument("guide", data); err != nil || len(errs) > 0 {
+		t.Errorf("the JSON guide does not match its schema: %v\n%s", err, strings.Join(errs, "\n"))
+	}
+}
+
+func TestReadSidecarUpgradesV0(t *testing.T) {
+	sc, err := readSidecar("testdata/schema/v0/guide.meta.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Schema != schemaURL("sidecar") || sc.SchemaVersion != schemaVersion || len(sc.Sections) != 1 {
+		t.Errorf("readSidecar = %+v", sc)
+	}
+}
+
+func TestSidecarPath(t *testing.T) {
+	for in, want := range map[string]string{
+		"guide.md":            "guide.meta.json",
+		"out/guide.json":      "out/guide.meta.json",
+		"Go_Cards.tsv":        "Go_Cards.meta.json",
+		"guide.v2.md":         "guide.v2.meta.json",
+		"v1.5/Go_Concurrency": "v1.5/Go_Concurrency.meta.json",
+	} {
+		if got := sidecarPath(in); got != want {
+			t.Errorf("sidecarPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
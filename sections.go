@@ -0,0 +1,163 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/yuriiter/aiguide/pkg/guide"
+)
+
+var (
+	conceptHeadingRe = guide.ConceptHeadingRe
+	conceptMarkerRe  = regexp.MustCompile(`(?m)^[ \t]*=+[ \t]*CONCEPT[ \t]+(\d+)[ \t]*=*[ \t]*$`)
+)
+
+type conceptSection struct {
+	Number string
+	Text   string
+}
+
+// splitSections cuts a chunk response into per-concept sections at headings
+// carrying one of the expected concept numbers. Only the first heading for
+// each number counts, so numbered sub-headings inside an answer ("### 1.
+// Install") don't split it. Text before the first match is returned as the
+// preamble.
+func splitSections(content string, numbers []string) (string, []conceptSection) {
+	expected := make(map[string]bool, len(numbers))
+	for _, n := range numbers {
+		expected[n] = true
+	}
+
+	type cut struct {
+		pos    int
+		number string
+	}
+	var cuts []cut
+	for _, m := range conceptHeadingRe.FindAllStringSubmatchIndex(content, -1) {
+		n := content[m[2]:m[3]]
+		if !expected[n] {
+			continue
+		}
+		delete(expected, n)
+		cuts = append(cuts, cut{pos: m[0], number: n})
+	}
+
+	if len(cuts) == 0 {
+		return content, nil
+	}
+
+	sections := make([]conceptSection, len(cuts))
+	for i, c := range cuts {
+		end := len(content)
+		if i+1 < len(cuts) {
+			end = cuts[i+1].pos
+		}
+		sections[i] = conceptSection{Number: c.number, Text: strings.TrimSpace(content[c.pos:end])}
+	}
+	return strings.TrimSpace(content[:cuts[0].pos]), sections
+}
+
+func chunkNumbers(items []string) []string {
+	numbers := make([]string, len(items))
+	for i, c := range items {
+		numbers[i] = conceptNumber(c)
+	}
+	return numbers
+}
+
+// labelSections puts a label line right under each concept heading; labels
+// are aligned with items.
+func labelSections(content string, items []string, labels []string) string {
+	preamble, sections := splitSections(content, chunkNumbers(items))
+	if len(sections) == 0 {
+		return content
+	}
+	byNumber := make(map[string]string, len(items))
+	for k, it := range items {
+		byNumber[conceptNumber(it)] = labels[k]
+	}
+
+	var parts []string
+	if preamble != "" {
+		parts = append(parts, preamble)
+	}
+	for _, s := range sections {
+		label := byNumber[s.Number]
+		if label == "" {
+			parts = append(parts, s.Text)
+			continue
+		}
+		heading, rest, _ := strings.Cut(s.Text, "\n")
+		parts = append(parts, heading+"\n\n"+label+"\n"+rest)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// appendToSections adds a block to the end of each concept's section; blocks
+// are keyed by concept number. Without recognizable sections the blocks go
+// after the content, in item order.
+func appendToSections(content string, items []string, blocks map[string]string) string {
+	if len(blocks) == 0 {
+		return content
+	}
+	preamble, sections := splitSections(content, chunkNumbers(items))
+	if len(sections) == 0 {
+		for _, it := range items {
+			if blk := blocks[conceptNumber(it)]; blk != "" {
+				content += "\n\n" + blk
+			}
+		}
+		return content
+	}
+	var parts []string
+	if preamble != "" {
+		parts = append(parts, preamble)
+	}
+	for _, s := range sections {
+		text := s.Text
+		if blk := blocks[s.Number]; blk != "" {
+			text += "\n\n" + blk
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// replaceSections swaps the sections of content for texts, keyed by concept
+// number; other sections and the preamble stay as they are.
+func replaceSections(content string, items []string, texts map[string]string) string {
+	preamble, sections := splitSections(content, chunkNumbers(items))
+	if len(sections) == 0 {
+		return content
+	}
+	var parts []string
+	if preamble != "" {
+		parts = append(parts, preamble)
+	}
+	for _, s := range sections {
+		if text, ok := texts[s.Number]; ok {
+			parts = append(parts, text)
+		} else {
+			parts = append(parts, s.Text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// parseConceptBlocks splits a response laid out as "=== CONCEPT <n> ==="
+// markers, each followed by that concept's text, into text per number.
+func parseConceptBlocks(resp string) map[string]string {
+	out := map[string]string{}
+	marks := conceptMarkerRe.FindAllStringSubmatchIndex(resp, -1)
+	for i, m := range marks {
+		end := len(resp)
+		if i+1 < len(marks) {
+			end = marks[i+1][0]
+		}
+		num := resp[m[2]:m[3]]
+		if _, seen := out[num]; !seen {
+			out[num] = strings.TrimSpace(resp[m[1]:end])
+		}
+	}
+	return out
+}
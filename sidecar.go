@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Sidecar is the machine-readable companion written next to a generated
+// guide. Tools should be able to rely on it instead of parsing markdown.
+type Sidecar struct {
+	Schema         string          `json:"$schema"`
+	SchemaVersion  int             `json:"schema_version"`
+	Provenance     Provenance      `json:"provenance"`
+	Sections       []SectionMeta   `json:"sections,omitempty"`
+	Version        *VersionInfo    `json:"version,omitempty"`
+	Clarifications []Clarification `json:"clarifications,omitempty"`
+	Terminology    []Term          `json:"terminology,omitempty"`
+	Usage          *RunUsage       `json:"usage,omitempty"`
+}
+
+// SectionMeta describes one answered chunk. Items are the 1-based positions
+// of the concepts it covers.
+type SectionMeta struct {
+	Chunk            int             `json:"chunk"`
+	Items            []int           `json:"items"`
+	Model            string          `json:"model"`
+	Difficulty       []int           `json:"difficulty,omitempty"`
+	Tags             [][]string      `json:"tags,omitempty"`
+	Bloom            []string        `json:"bloom,omitempty"`
+	Prerequisites    [][]int         `json:"prerequisites,omitempty"`
+	Problems         [][]int         `json:"problems,omitempty"`
+	Misconceptions   [][]string      `json:"misconceptions,omitempty"`
+	AltExplanations  []bool          `json:"alt_explanations,omitempty"`
+	Analogies        []bool          `json:"analogies,omitempty"`
+	GuidingQuestions [][]string      `json:"guiding_questions,omitempty"`
+	Mnemonics        []string        `json:"mnemonics,omitempty"`
+	CodeChecks       []CodeCheck     `json:"code_checks,omitempty"`
+	Links            []LinkCheck     `json:"links,omitempty"`
+	Duplicates       []Duplicate     `json:"duplicates,omitempty"`
+	Readability      []Readability   `json:"readability,omitempty"`
+	Tables           *TableStats     `json:"tables,omitempty"`
+	StudyMinutes     []int           `json:"study_minutes,omitempty"`
+	TargetWords      []int           `json:"target_words,omitempty"`
+	Words            []int           `json:"words,omitempty"`
+	TermDeviations   []TermDeviation `json:"term_deviations,omitempty"`
+	Judge            []JudgeChoice   `json:"judge,omitempty"`
+	Missing          []int           `json:"missing,omitempty"` // concepts still unanswered, marked MISSING
+	Updated          []string        `json:"updated,omitempty"` // when aiguide refresh last rewrote a concept
+	Failed           bool            `json:"failed,omitempty"`
+
+	err error // why the chunk failed, for the exit code
+}
+
+// sidecarPath is the sidecar of an output file of any format: guide.md,
+// guide.json and guide.tsv all have guide.meta.json.
+func sidecarPath(outputPath string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".meta.json"
+}
+
+func writeSidecar(path string, sc *Sidecar) error {
+	sc.Schema, sc.SchemaVersion = schemaURL("sidecar"), schemaVersion
+	b, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// readSidecar loads the sidecar of an existing guide, upgrading sidecars
+// written by older versions of aiguide to the current schema.
+func readSidecar(path string) (*Sidecar, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var stamp struct {
+		Version int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(b, &stamp); err != nil {
+		return nil, err
+	}
+	if stamp.Version > schemaVersion {
+		return nil, fmt.Errorf("%s uses schema version %d; this aiguide only reads up to %d", path, stamp.Version, schemaVersion)
+	}
+	sc := &Sidecar{}
+	if err := json.Unmarshal(b, sc); err != nil {
+		return nil, err
+	}
+	switch stamp.Version {
+	case 0:
+		// Sidecars from before the schema was published carry no stamp
+		// but have the version 1 shape.
+	}
+	sc.Schema, sc.SchemaVersion = schemaURL("sidecar"), schemaVersion
+	return sc, nil
+}
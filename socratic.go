@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var answerMarkerRe = regexp.MustCompile(`(?m)^[ \t]*={3,}[ \t]*ANSWER[ \t]*={3,}[ \t]*$`)
+
+// Guiding questions a concept should get in --mode socratic.
+const (
+	minGuidingQuestions = 3
+	maxGuidingQuestions = 6
+)
+
+// hideAnswers moves each concept's model answer, everything after its
+// "=== ANSWER ===" line, into a collapsed details block at the end of the
+// section, or drops it with --no-answers. It returns the updated content and,
+// aligned with j.items, each concept's guiding questions.
+func hideAnswers(j chunk, content string) (string, [][]string) {
+	preamble, sections := splitSections(content, chunkNumbers(j.items))
+	if len(sections) == 0 {
+		return content, nil
+	}
+	byNumber := map[string]int{}
+	for k, it := range j.items {
+		byNumber[conceptNumber(it)] = k
+	}
+
+	questions := make([][]string, len(j.items))
+	var parts []string
+	if preamble != "" {
+		parts = append(parts, preamble)
+	}
+	for _, s := range sections {
+		text := s.Text
+		answer := ""
+		if loc := answerMarkerRe.FindStringIndex(text); loc != nil {
+			answer = strings.TrimSpace(text[loc[1]:])
+			text = strings.TrimSpace(text[:loc[0]])
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: concept %s has no separate model answer; it was left as written.\n", s.Number)
+		}
+
+		qs := guidingQuestions(text)
+		if n := len(qs); n < minGuidingQuestions || n > maxGuidingQuestions {
+			fmt.Fprintf(os.Stderr, "Warning: concept %s has %d guiding questions (expected %d-%d).\n", s.Number, n, minGuidingQuestions, maxGuidingQuestions)
+		}
+		if k, ok := byNumber[s.Number]; ok {
+			questions[k] = qs
+		}
+
+		if answer != "" && !cfg.NoAnswers {
+			text += fmt.Sprintf("\n\n<details>\n<summary>%s</summary>\n\n%s\n\n</details>", outputLanguage().answer, answer)
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, "\n\n"), questions
+}
+
+// guidingQuestions are the top-level numbered items of a section.
+func guidingQuestions(section string) []string {
+	var qs []string
+	for _, line := range strings.Split(section, "\n") {
+		if m := mdNumberedRe.FindStringSubmatch(line); m != nil && indentDepth(m[1]) == 0 {
+			qs = append(qs, strings.TrimSpace(m[2]))
+		}
+	}
+	return qs
+}
+
+// detailsTag recognizes the HTML lines of a details block, as hideAnswers
+// writes them: it returns "open", "summary" with the summary text, or
+// "close", and "" for any other HTML.
+func detailsTag(text string) (tag, summary string) {
+	t := strings.TrimSpace(text)
+	switch {
+	case strings.HasPrefix(t, "<details") && strings.HasSuffix(t, ">"):
+		return "open", ""
+	case strings.HasPrefix(t, "<summary>") && strings.HasSuffix(t, "</summary>"):
+		return "summary", strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(t, "<summary>"), "</summary>"))
+	case t == "</details>":
+		return "close", ""
+	}
+	return "", ""
+}
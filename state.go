@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+const runStateVersion = 1
+
+// runState is the checkpoint of a run in progress: the final concept plan
+// and every chunk answered so far. It is rewritten as each chunk finishes,
+// so --resume can pick up after a crash or Ctrl-C, and removed once the
+// guide is complete.
+type runState struct {
+	Version        int             `json:"version"`
+	Subject        string          `json:"subject"`
+	Output         string          `json:"output,omitempty"`
+	Model          string          `json:"model"`
+	ChunkSize      int             `json:"chunk_size"`
+	Depth          int             `json:"depth,omitempty"`
+	SubCount       int             `json:"sub_count,omitempty"`
+	PromptHash     string          `json:"system_prompt_sha256"`
+	Concepts       []string        `json:"concepts"`
+	Periods        []string        `json:"periods,omitempty"`
+	Tags           [][]string      `json:"tags,omitempty"`
+	Difficulty     []int           `json:"difficulty,omitempty"`
+	Bloom          []string        `json:"bloom,omitempty"`
+	Groups         []conceptGroup  `json:"groups,omitempty"`
+	Clarifications []Clarification `json:"clarifications,omitempty"`
+	Terminology    []Term          `json:"terminology,omitempty"`
+	Chunks         []savedChunk    `json:"chunks"`
+
+	path   string
+	mu     sync.Mutex
+	warned bool
+}
+
+// savedChunk is one answered chunk, found again by its first concept and
+// its concepts, so a different --chunk size only loses the chunks that no
+// longer line up.
+type savedChunk struct {
+	Start   int         `json:"start"`
+	Items   []string    `json:"items"`
+	Content string      `json:"content"`
+	Section SectionMeta `json:"section"`
+}
+
+// statePath is where the checkpoint of the guide at filename is kept: next
+// to it, or in the working directory with --stdout.
+func statePath(filename string) string {
+	return filepath.Join(filepath.Dir(filename), ".aiguide_state_"+subjectSlugRe.ReplaceAllString(cfg.Subject, "_")+".json")
+}
+
+func newRunState(path, filename string, plan *conceptPlan, groups []conceptGroup) *runState {
+	st := &runState{
+		Version:        runStateVersion,
+		Subject:        cfg.Subject,
+		Output:         filename,
+		Model:          cfg.Model,
+		ChunkSize:      cfg.ChunkSize,
+		Depth:          cfg.Depth,
+		PromptHash:     promptHash(cfg.SystemPrompt),
+		Concepts:       plan.concepts,
+		Periods:        plan.periods,
+		Tags:           plan.tags,
+		Difficulty:     plan.difficulty,
+		Bloom:          plan.bloom,
+		Groups:         groups,
+		Clarifications: clarifications,
+		Terminology:    terminology,
+		path:           path,
+	}
+	if cfg.Depth > 1 {
+		st.SubCount = cfg.SubCount
+	}
+	return st
+}
+
+func loadRunState(path string) (*runState, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	st := &runState{path: path}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if st.Version != runStateVersion {
+		return nil, fmt.Errorf("%s has state version %d, this aiguide reads version %d", path, st.Version, runStateVersion)
+	}
+	if len(st.Concepts) == 0 {
+		return nil, fmt.Errorf("%s has no concepts", path)
+	}
+	return st, nil
+}
+
+func (st *runState) answered() int {
+	return len(st.Chunks)
+}
+
+// plan is the concept plan the state was saved with.
+func (st *runState) plan() *conceptPlan {
+	return &conceptPlan{concepts: st.Concepts, tags: st.Tags, difficulty: st.Difficulty, bloom: st.Bloom, periods: st.Periods}
+}
+
+// checkSettings warns about settings that differ from the saved run's, since
+// the resumed chunks would no longer match the saved ones.
+func (st *runState) checkSettings() {
+	if cfg.Model != st.Model {
+		fmt.Fprintf(os.Stderr, "Warning: resuming with --model %s, the saved chunks were generated with %s.\n", cfg.Model, st.Model)
+	}
+	if cfg.ChunkSize != st.ChunkSize {
+		fmt.Fprintf(os.Stderr, "Warning: resuming with --chunk %d, the saved run used %d; saved chunks that no longer line up are generated again.\n", cfg.ChunkSize, st.ChunkSize)
+	}
+	if promptHash(cfg.SystemPrompt) != st.PromptHash {
+		fmt.Fprintln(os.Stderr, "Warning: the system prompt differs from the saved run's (another --system-prompt, --info, --lang or mode?).")
+	}
+}
+
+// completed returns the saved answer of c, if any.
+func (st *runState) completed(c chunk) (savedChunk, bool) {
+	for _, s := range st.Chunks {
+		if s.Start == c.start && slices.Equal(s.Items, c.items) {
+			return s, true
+		}
+	}
+	return savedChunk{}, false
+}
+
+// record saves the answer of c and rewrites the state file. A state file
+// that can't be written is reported once and doesn't stop the run.
+func (st *runState) record(c chunk, content string, sec SectionMeta) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.Chunks = append(st.Chunks, savedChunk{Start: c.start, Items: c.items, Content: content, Section: sec})
+	if err := st.save(); err != nil && !st.warned {
+		fmt.Fprintf(os.Stderr, "Warning: cannot save progress to %s: %v\n", st.path, err)
+		st.warned = true
+	}
+}
+
+// writeResumeHint tells how to retry the failed chunks of a run, whose
+// state file is kept for that.
+func writeResumeHint(w io.Writer, st *runState, sections []SectionMeta) {
+	if partialFailure(sections) != nil {
+		fmt.Fprintf(w, "   Resume the run with: aiguide --resume %s\n", st.path)
+	}
+}
+
+func (st *runState) save() error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(st.path, b, 0o644)
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// placeholderRe matches what aiguide writes in place of a chunk or exercise
+// it couldn't generate.
+var placeholderRe = regexp.MustCompile(`(?i)^(?:error generating section\b|section \d+-\d+ not generated\b|exercise not generated\b)`)
+
+// guideStats are the figures of one finished guide.
+type guideStats struct {
+	Path           string             `json:"path"`
+	Title          string             `json:"title"`
+	Sections       int                `json:"sections"`
+	Words          int                `json:"words"`
+	SectionWords   []sectionWordCount `json:"section_words"`
+	ReadingMinutes int                `json:"reading_minutes"`
+	CodeBlocks     int                `json:"code_blocks"`
+	Tables         int                `json:"tables"`
+	Placeholders   int                `json:"placeholders"`
+	Missing        []int              `json:"missing_sections,omitempty"`
+	TOC            tocHealth          `json:"toc"`
+	Model          string             `json:"model,omitempty"`
+	Usage          *RunUsage          `json:"usage,omitempty"`
+}
+
+type sectionWordCount struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	Words  int    `json:"words"`
+}
+
+// tocHealth checks the Table of Contents against the headings: links that
+// lead nowhere and concept sections it doesn't list.
+type tocHealth struct {
+	Present  bool     `json:"present"`
+	Entries  int      `json:"entries"`
+	Broken   []string `json:"broken,omitempty"`
+	Unlisted []int    `json:"unlisted,omitempty"`
+}
+
+func (t tocHealth) String() string {
+	switch {
+	case !t.Present:
+		return "none"
+	case len(t.Broken) == 0 && len(t.Unlisted) == 0:
+		return "ok"
+	}
+	return fmt.Sprintf("%d broken, %d unlisted", len(t.Broken), len(t.Unlisted))
+}
+
+// analyzeGuide reads the guide at path and, when there is one, its sidecar.
+func analyzeGuide(path string, wpm int) (guideStats, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return guideStats{}, err
+	}
+	st := guideStats{Path: path}
+	anchors := map[string]bool{}
+	var tocLinks []string
+	var cur *sectionWordCount
+	inTOC := false
+	numbers := map[int]bool{}
+
+	for _, b := range parseMarkdown(string(src)) {
+		if b.Kind == "heading" {
+			anchors[mdAnchor(b.Text)] = true
+			anchors[conceptAnchor(plainInline(b.Text))] = true
+			if placeholderRe.MatchString(plainInline(b.Text)) {
+				st.Placeholders++
+			}
+		}
+		if b.Kind == "quote" && placeholderRe.MatchString(b.Text) {
+			st.Placeholders++
+		}
+		switch {
+		case b.Kind == "heading" && b.Level == 1 && st.Title == "":
+			st.Title = plainInline(b.Text)
+			continue
+		case b.Kind == "heading" && b.Level <= 2:
+			cur, inTOC = nil, isTOCHeading(b.Text)
+			title := plainInline(b.Text)
+			if b.Level == 2 && conceptTitleRe.MatchString(title) {
+				n, _ := strconv.Atoi(conceptNumber(title))
+				numbers[n] = true
+				st.SectionWords = append(st.SectionWords, sectionWordCount{Number: n, Title: title})
+				cur = &st.SectionWords[len(st.SectionWords)-1]
+			}
+			continue
+		case b.Kind == "rule":
+			cur, inTOC = nil, false
+			continue
+		case b.Kind == "code":
+			st.CodeBlocks++
+		case b.Kind == "table":
+			st.Tables++
+		}
+		if inTOC {
+			st.TOC.Present = true
+			for _, sp := range parseInline(b.Text) {
+				if a, ok := strings.CutPrefix(sp.Link, "#"); ok {
+					tocLinks = append(tocLinks, a)
+				}
+			}
+		}
+		if cur != nil && b.Kind != "html" {
+			text := b.Text
+			for _, row := range b.Rows {
+				text += " " + strings.Join(row, " ")
+			}
+			cur.Words += len(strings.Fields(text))
+		}
+	}
+
+	listed := map[string]bool{}
+	for _, a := range tocLinks {
+		listed[a] = true
+		if !anchors[a] {
+			st.TOC.Broken = append(st.TOC.Broken, a)
+		}
+	}
+	st.TOC.Entries = len(tocLinks)
+	highest := 0
+	for _, s := range st.SectionWords {
+		st.Words += s.Words
+		highest = max(highest, s.Number)
+		if st.TOC.Present && !listed[mdAnchor(s.Title)] && !listed[conceptAnchor(s.Title)] {
+			st.TOC.Unlisted = append(st.TOC.Unlisted, s.Number)
+		}
+	}
+	st.Sections = len(st.SectionWords)
+	// Numbers skipped by the headings, or only in the Table of Contents.
+	for _, a := range tocLinks {
+		if n, err := strconv.Atoi(strings.SplitN(a, "-", 2)[0]); err == nil {
+			highest = max(highest, n)
+		}
+	}
+	for n := 1; n <= highest; n++ {
+		if !numbers[n] {
+			st.Missing = append(st.Missing, n)
+		}
+	}
+	if st.Words > 0 {
+		st.ReadingMinutes = roundStudyMinutes(float64(st.Words) / float64(wpm))
+	}
+
+	sc, err := readSidecar(sidecarPath(path))
+	switch {
+	case err == nil:
+		st.Model, st.Usage = sc.Provenance.Model, sc.Usage
+	case !errors.Is(err, os.ErrNotExist):
+		fmt.Fprintf(os.Stderr, "Warning: ignoring the sidecar of %s: %v\n", path, err)
+	}
+	return st, nil
+}
+
+// statsTargets expands the arguments of aiguide stats: files as given,
+// directories to the guides under them.
+func statsTargets(args []string) ([]string, error) {
+	var paths []string
+	for _, a := range args {
+		info, err := os.Stat(a)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, a)
+			continue
+		}
+		err = filepath.WalkDir(a, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(p, ".md") {
+				paths = append(paths, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+func formatUsage(u *RunUsage) (tokens, cost string) {
+	if u == nil {
+		return "-", "-"
+	}
+	return strconv.Itoa(u.TotalTokens), formatCost(u.CostUSD)
+}
+
+func writeGuideStats(st guideStats) {
+	fmt.Printf("%s: %s\n", st.Path, st.Title)
+	fmt.Printf("   Sections: %d, %d words, %s to read\n", st.Sections, st.Words, formatStudyTime(st.ReadingMinutes))
+	fmt.Printf("   Code blocks: %d, tables: %d\n", st.CodeBlocks, st.Tables)
+	fmt.Printf("   Error placeholders: %d\n", st.Placeholders)
+	if len(st.Missing) > 0 {
+		fmt.Printf("   Missing sections: %s\n", joinInts(st.Missing))
+	}
+	fmt.Printf("   Table of Contents: %s", st.TOC)
+	if st.TOC.Present {
+		fmt.Printf(" (%d entries)", st.TOC.Entries)
+	}
+	fmt.Println()
+	for _, a := range st.TOC.Broken {
+		fmt.Printf("      broken link #%s\n", a)
+	}
+	if len(st.TOC.Unlisted) > 0 {
+		fmt.Printf("      not listed: %s\n", joinInts(st.TOC.Unlisted))
+	}
+	if st.Usage != nil {
+		tokens, cost := formatUsage(st.Usage)
+		fmt.Printf("   Generation: %s, %d calls, %s tokens, %s\n", st.Model, st.Usage.Calls, tokens, cost)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "   WORDS\tSECTION")
+	for _, s := range st.SectionWords {
+		fmt.Fprintf(tw, "   %d\t%s\n", s.Words, s.Title)
+	}
+	tw.Flush()
+}
+
+func joinInts(ns []int) string {
+	parts := make([]string, len(ns))
+	for i, n := range ns {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func newStatsCmd() *cobra.Command {
+	var asJSON bool
+	var wpm int
+	cmd := &cobra.Command{
+		Use:   "stats <guide.md|dir>...",
+		Short: "Report sections, words, reading time and problems of finished guides",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if wpm <= 0 {
+				fmt.Fprintln(os.Stderr, "Error: --reading-speed must be a positive number of words per minute.")
+				os.Exit(1)
+			}
+			paths, err := statsTargets(args)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			sort.Strings(paths)
+			var all []guideStats
+			for _, p := range paths {
+				st, err := analyzeGuide(p, wpm)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				// A directory holds more than guides: READMEs, solutions.
+				if st.Sections == 0 && len(paths) > 1 {
+					continue
+				}
+				all = append(all, st)
+			}
+			if len(all) == 0 {
+				fmt.Println("No guides found.")
+				return
+			}
+
+			switch {
+			case asJSON:
+				b, _ := json.MarshalIndent(all, "", "  ")
+				fmt.Println(string(b))
+			case len(all) == 1:
+				writeGuideStats(all[0])
+			default:
+				tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(tw, "GUIDE\tSECTIONS\tWORDS\tREADING\tCODE\tTABLES\tERRORS\tMISSING\tTOC\tTOKENS\tCOST")
+				for _, st := range all {
+					tokens, cost := formatUsage(st.Usage)
+					fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n", st.Path, st.Sections, st.Words,
+						strings.TrimPrefix(formatStudyTime(st.ReadingMinutes), "≈ "), st.CodeBlocks, st.Tables, st.Placeholders, len(st.Missing), st.TOC, tokens, cost)
+				}
+				tw.Flush()
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the figures as JSON, one object per guide")
+	cmd.Flags().IntVar(&wpm, "reading-speed", 200, "Reading speed in words per minute for the reading time")
+	return cmd
+}
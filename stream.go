@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/yuriiter/aiguide/pkg/guide"
+)
+
+// streamConflicts lists the flags that rewrite answers after they arrive or
+// that answer chunks out of order, so a streamed answer would differ from
+// the guide.
+func streamConflicts() []string {
+	var flags []string
+	add := func(set bool, flag string) {
+		if set {
+			flags = append(flags, flag)
+		}
+	}
+	add(cfg.Format != "markdown", "--format "+cfg.Format)
+	add(cfg.Mode == "exercises" || cfg.Mode == "socratic", "--mode "+cfg.Mode)
+	add(cfg.BestOf > 1, "--best-of")
+	add(cfg.Depth > 1, "--depth")
+	add(cfg.TargetLength != "", "--target-length")
+	add(cfg.DedupContent == "rewrite", "--dedup-content rewrite")
+	add(cfg.ReadabilityFix, "--readability-fix")
+	add(cfg.StudyTime, "--study-time")
+	add(cfg.CheckLinks && cfg.BrokenLinks != "keep", "--check-links --broken-links "+cfg.BrokenLinks)
+	add(cfg.VersionOf != "", "--version-of")
+	add(cfg.VerifyCode, "--verify-code")
+	add(cfg.Tables, "--tables")
+	add(cfg.Misconceptions, "--misconceptions")
+	add(cfg.AltExplanations, "--alt-explanations")
+	add(cfg.AnalogyDomain != "", "--analogy-domain")
+	add(cfg.Mnemonics, "--mnemonics")
+	add(tagsEnabled(), "--tags")
+	add(cfg.ShowDifficulty, "--show-difficulty")
+	add(cfg.ShowBloom, "--show-bloom")
+	add(cfg.CitationStyle == "footnote", "--citation-style footnote")
+	add(cfg.Practice > 0, "--practice")
+	add(cfg.SectionHook != "", "--section-hook")
+	return flags
+}
+
+// liveChunk writes a chunk's answer to the guide as it streams in. The text
+// is trimmed of the fences the model wraps it in and its concept headings
+// are rewritten as cleanChunkContent, renumberSections and
+// guide.CanonicalHeadings do, so what is shown is the start of what the
+// chunk's full answer becomes; unnumbered headings, and the headings
+// CanonicalHeadings inserts, can only be placed once the whole answer is
+// in, so they are shown as they came.
+// Lines that may be a heading or a fence are held until they end, and
+// trailing whitespace and backticks until more text follows.
+type liveChunk struct {
+	w     io.Writer
+	j     chunk
+	items map[string]string // concepts whose heading hasn't been seen yet
+	// level is that of the first numbered heading; drift is set when its
+	// number isn't one of the chunk's, and headings of that level are then
+	// taken for the concepts in order, as models number from 1.
+	level int
+	drift bool
+
+	line      strings.Builder // the held line
+	holding   bool
+	lineStart bool
+	tail      strings.Builder
+	started   bool
+	shown     strings.Builder
+}
+
+func newLiveChunk(w io.Writer, j chunk) *liveChunk {
+	items := make(map[string]string, len(j.items))
+	for _, it := range j.items {
+		items[conceptNumber(it)] = it
+	}
+	return &liveChunk{w: w, j: j, items: items, lineStart: true}
+}
+
+// delta takes the next piece of the answer.
+func (l *liveChunk) delta(s string) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if l.holding {
+			l.line.WriteByte(c)
+			if c == '\n' {
+				l.holding = false
+				l.emitLine(l.line.String())
+				l.line.Reset()
+			}
+			continue
+		}
+		if l.lineStart && (c == '#' || c == '`') {
+			l.holding = true
+			l.line.WriteByte(c)
+			continue
+		}
+		l.text(c)
+	}
+}
+
+// text shows c, or keeps it in the tail while it is whitespace or a
+// backtick.
+func (l *liveChunk) text(c byte) {
+	switch {
+	case !l.started && isSpaceByte(c):
+		// Leading whitespace is trimmed; what follows starts a line.
+		l.lineStart = true
+		return
+	case isSpaceByte(c) || c == '`':
+		l.tail.WriteByte(c)
+	default:
+		l.emit(l.tail.String() + string(c))
+		l.tail.Reset()
+	}
+	l.lineStart = c == '\n'
+}
+
+// emitLine handles a held line: the opening fence is dropped, a concept's
+// first heading rewritten, anything else shown as text.
+func (l *liveChunk) emitLine(line string) {
+	if !l.started {
+		rest := strings.TrimPrefix(strings.TrimPrefix(line, "```markdown"), "```")
+		if rest != line {
+			// What follows the fence is kept, as cleanChunkContent keeps
+			// it.
+			l.started = true
+			for i := 0; i < len(rest); i++ {
+				l.text(rest[i])
+			}
+			l.lineStart = true
+			return
+		}
+	}
+	if m := guide.ConceptHeadingRe.FindStringSubmatch(line); m != nil {
+		level := len(line) - len(strings.TrimLeft(line, "#"))
+		if l.level == 0 {
+			_, known := l.items[m[1]]
+			l.level, l.drift = level, !known
+		}
+		n := m[1]
+		if k, err := strconv.Atoi(n); err == nil && l.drift && level == l.level && k >= 1 && k <= len(l.j.items) {
+			n = conceptNumber(l.j.items[k-1])
+		}
+		if it, ok := l.items[n]; ok {
+			delete(l.items, n)
+			nl := ""
+			if strings.HasSuffix(line, "\n") {
+				nl = "\n"
+			}
+			l.emit(l.tail.String() + "## " + it)
+			l.tail.Reset()
+			l.tail.WriteString(nl)
+			l.lineStart = nl != ""
+			return
+		}
+	}
+	for i := 0; i < len(line); i++ {
+		l.text(line[i])
+	}
+}
+
+func (l *liveChunk) emit(s string) {
+	l.started = true
+	l.shown.WriteString(s)
+	fmt.Fprint(l.w, s)
+}
+
+// rest returns what is left to write of content, the chunk as finished,
+// after what was shown. A failed chunk's MISSING sections follow whatever
+// part of the answer was shown; a chunk corrected in the shown part, such as
+// a renumbered one, is reported, since that part can't be rewritten.
+func (l *liveChunk) rest(content string, failed bool) string {
+	shown := l.shown.String()
+	if rest, ok := strings.CutPrefix(content, shown); ok {
+		return rest
+	}
+	if failed {
+		return "\n\n" + content
+	}
+	fmt.Fprintf(os.Stderr, "Warning: chunk %d was corrected after it was streamed; the guide shows it as it arrived. Run with --stream=false to write corrected chunks.\n", l.j.id+1)
+	return ""
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// studyPlanLineRe matches one day of the Study Plan appendix:
+	// "- **Day 1, 2026-10-15** (≈ 55 min): [1. Foo](#1-foo) (≈ 20 min), ...".
+	studyPlanLineRe  = regexp.MustCompile(`^- \*\*(.+?)\*\* \((≈ [^)]+)\): (.+)$`)
+	studyPlanEntryRe = regexp.MustCompile(`\[([^\]]*)\]\(#([^)\s]+)\) \((≈ [^)]+)\)`)
+	studyTimeRe      = regexp.MustCompile(`^≈ (?:(\d+) h)? ?(?:(\d+) min)?$`)
+	// studyTimeLabelRe matches the estimate under a concept heading,
+	// studyTotalRe the total under the title.
+	studyTimeLabelRe = regexp.MustCompile(`^\*(≈ [^*]+)\*$`)
+	studyTotalRe     = regexp.MustCompile(`^\*([^*:]+): (≈ [^*]+)\*$`)
+)
+
+// parseStudyTime reads back what formatStudyTime wrote.
+func parseStudyTime(s string) (int, bool) {
+	m := studyTimeRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || m[1] == "" && m[2] == "" {
+		return 0, false
+	}
+	h, _ := strconv.Atoi(m[1])
+	min, _ := strconv.Atoi(m[2])
+	return h*60 + min, true
+}
+
+// writeStudyPlan writes the --study-plan appendix: the concepts packed into
+// sessions as --export ics schedules them, one line per day with its total.
+// Failed sections have no estimate and are left out.
+func writeStudyPlan(w io.Writer, concepts []string, sections []SectionMeta) {
+	minutes := make([]int, len(concepts))
+	for _, sec := range sections {
+		for k, item := range sec.Items {
+			if k < len(sec.StudyMinutes) && item >= 1 && item <= len(minutes) {
+				minutes[item-1] = sec.StudyMinutes[k]
+			}
+		}
+	}
+	var planned []*guideConcept
+	var each []int
+	for i, c := range concepts {
+		if minutes[i] == 0 {
+			continue
+		}
+		planned = append(planned, &guideConcept{Item: i + 1, Title: c, Anchor: conceptAnchor(c)})
+		each = append(each, minutes[i])
+	}
+	if len(planned) == 0 {
+		return
+	}
+	lang := outputLanguage()
+	start, _ := planStartDate()
+	var b strings.Builder
+	for d, s := range planSessions(planned, each, start) {
+		label := fmt.Sprintf(lang.day, d+1) + ", " + s.Start.Format("2006-01-02")
+		b.WriteString(studyPlanLine(label, s) + "\n")
+	}
+	fmt.Fprintf(w, "## %s\n\n%s\n---\n\n", lang.studyPlan, b.String())
+}
+
+func studyPlanLine(label string, s studySession) string {
+	entries := make([]string, len(s.Concepts))
+	total := 0
+	for k, c := range s.Concepts {
+		entries[k] = fmt.Sprintf("[%s](#%s) (%s)", c.Title, c.Anchor, formatStudyTime(s.Each[k]))
+		total += s.Each[k]
+	}
+	return fmt.Sprintf("- **%s** (%s): %s", label, formatStudyTime(total), strings.Join(entries, ", "))
+}
+
+// parseStudyPlanLine reads one day of the Study Plan appendix. Start is the
+// date in its label, at midnight local time.
+func parseStudyPlanLine(line string) (label string, s studySession, ok bool) {
+	m := studyPlanLineRe.FindStringSubmatch(strings.TrimRight(line, "\r"))
+	if m == nil {
+		return "", s, false
+	}
+	label = m[1]
+	if i := strings.LastIndex(label, ", "); i >= 0 {
+		if t, err := time.ParseInLocation("2006-01-02", label[i+2:], time.Local); err == nil {
+			s.Start = t
+		}
+	}
+	for _, e := range studyPlanEntryRe.FindAllStringSubmatch(m[3], -1) {
+		min, ok := parseStudyTime(e[3])
+		if !ok {
+			return "", s, false
+		}
+		s.Concepts = append(s.Concepts, &guideConcept{Title: e[1], Anchor: e[2]})
+		s.Each = append(s.Each, min)
+		s.Minutes += min
+	}
+	return label, s, len(s.Concepts) > 0
+}
+
+// stripStudyTime removes the estimate under the heading of a concept
+// section and returns it in minutes.
+func stripStudyTime(section string) (string, int, bool) {
+	lines := strings.Split(section, "\n")
+	for i := 1; i < len(lines); i++ {
+		l := strings.TrimSpace(lines[i])
+		if l == "" {
+			continue
+		}
+		if m := studyTimeLabelRe.FindStringSubmatch(l); m != nil {
+			if min, ok := parseStudyTime(m[1]); ok {
+				j := i + 1
+				if j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+					j++
+				}
+				return strings.Join(append(lines[:i:i], lines[j:]...), "\n"), min, true
+			}
+		}
+		if !labelLineRe.MatchString(l) {
+			break
+		}
+	}
+	return section, 0, false
+}
+
+// updateStudyTotals changes the study time of concept n from old to
+// minutes in the total under the title and in the Study Plan appendix, so a
+// section changed by expand or condense doesn't leave them stale.
+func updateStudyTotals(md string, n, old, minutes int) string {
+	want := strconv.Itoa(n)
+	lines := strings.Split(md, "\n")
+	inHeader := true
+	for i, l := range lines {
+		if inHeader {
+			if strings.HasPrefix(l, "## ") {
+				inHeader = false
+			} else if m := studyTotalRe.FindStringSubmatch(strings.TrimSpace(l)); m != nil {
+				if total, ok := parseStudyTime(m[2]); ok {
+					lines[i] = fmt.Sprintf("*%s: %s*", m[1], formatStudyTime(max(total-old+minutes, 1)))
+				}
+				inHeader = false
+			}
+			continue
+		}
+		label, s, ok := parseStudyPlanLine(l)
+		if !ok {
+			continue
+		}
+		for k, c := range s.Concepts {
+			if conceptNumber(c.Title) == want {
+				s.Each[k] = minutes
+				lines[i] = studyPlanLine(label, s)
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sidecarStudyModel is the --study-time formula a guide was generated
+// with, as its sidecar records it; the current flags fill in what's
+// missing.
+func sidecarStudyModel(sc *Sidecar) studyModel {
+	m := currentStudyModel()
+	if sc == nil {
+		return m
+	}
+	set := sc.Provenance.Settings
+	if wpm, err := strconv.Atoi(set["reading_speed"]); err == nil && wpm > 0 {
+		m.WPM = wpm
+	}
+	if mult, err := parseDifficultyMultipliers(set["difficulty_multipliers"]); err == nil {
+		m.DiffMult = mult
+	}
+	if ex, err := strconv.ParseFloat(set["exercise_minutes"], 64); err == nil && ex >= 0 {
+		m.ExerciseMin = ex
+	}
+	return m
+}
+
+// reestimate recomputes the study time of concept n of a guide from its
+// rewritten section, with the difficulty and practice problems its sidecar
+// records, and stores it in the sidecar.
+func reestimate(sc *Sidecar, n int, section string) int {
+	diff, exercises := 0, 0
+	var minutes *int
+	if sc != nil {
+		for s := range sc.Sections {
+			sec := &sc.Sections[s]
+			for k, item := range sec.Items {
+				if item != n {
+					continue
+				}
+				if k < len(sec.Difficulty) {
+					diff = sec.Difficulty[k]
+				}
+				if k < len(sec.Problems) {
+					exercises = len(sec.Problems[k])
+				}
+				if k < len(sec.StudyMinutes) {
+					minutes = &sec.StudyMinutes[k]
+				}
+			}
+		}
+		if sc.Provenance.Settings["mode"] == "exercises" {
+			exercises++
+		}
+	}
+	est := sidecarStudyModel(sc).estimate(section, diff, exercises)
+	if minutes != nil {
+		*minutes = est
+	}
+	return est
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteStudyPlan(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.PlanStart, cfg.SessionTime, cfg.SessionMinutes, cfg.WeekendsOff = "2026-10-16", "18:00", 60, true
+	concepts := []string{"1. Foo", "2. Bar", "3. Baz", "4. Qux", "5. Failed"}
+	sections := []SectionMeta{
+		{Items: []int{1, 2}, StudyMinutes: []int{30, 25}},
+		{Items: []int{3, 4}, StudyMinutes: []int{40, 60}},
+		{Items: []int{5}, Failed: true},
+	}
+	var b bytes.Buffer
+	writeStudyPlan(&b, concepts, sections)
+	// 2026-10-16 is a Friday; the weekend is skipped.
+	want := "## Study Plan\n\n" +
+		"- **Day 1, 2026-10-16** (≈ 55 min): [1. Foo](#1-foo) (≈ 30 min), [2. Bar](#2-bar) (≈ 25 min)\n" +
+		"- **Day 2, 2026-10-19** (≈ 40 min): [3. Baz](#3-baz) (≈ 40 min)\n" +
+		"- **Day 3, 2026-10-20** (≈ 1 h): [4. Qux](#4-qux) (≈ 1 h)\n" +
+		"\n---\n\n"
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	cfg.Lang = "ja"
+	b.Reset()
+	writeStudyPlan(&b, concepts[:1], sections[:1])
+	if got := b.String(); !strings.HasPrefix(got, "## 学習計画\n\n- **1日目, 2026-10-16** (≈ 30 min)") {
+		t.Errorf("ja plan: %q", got)
+	}
+}
+
+func TestParseStudyPlanLine(t *testing.T) {
+	line := "- **Day 2, 2026-10-19** (≈ 1 h 5 min): [3. Baz](#3-baz) (≈ 40 min), [4. A, B and (C)](#4-a-b-and-c) (≈ 25 min)"
+	label, s, ok := parseStudyPlanLine(line + "\r")
+	if !ok {
+		t.Fatalf("%q not parsed", line)
+	}
+	if label != "Day 2, 2026-10-19" || s.Start.Format("2006-01-02") != "2026-10-19" || s.Minutes != 65 || len(s.Concepts) != 2 {
+		t.Fatalf("got %q, %+v", label, s)
+	}
+	if c := s.Concepts[1]; c.Title != "4. A, B and (C)" || c.Anchor != "4-a-b-and-c" || s.Each[1] != 25 {
+		t.Errorf("second entry: %+v, %d min", c, s.Each[1])
+	}
+	if got := studyPlanLine(label, s); got != line {
+		t.Errorf("round trip:\n%s\nwant:\n%s", got, line)
+	}
+	for _, l := range []string{"", "- **Bold** text", "- **Day 1** (≈ 5 min): no links", "- **Day 1** (≈ 5 min): [1. Foo](#1-foo) (5 min)"} {
+		if _, _, ok := parseStudyPlanLine(l); ok {
+			t.Errorf("%q parsed as a plan line", l)
+		}
+	}
+}
+
+func TestStripStudyTime(t *testing.T) {
+	tests := []struct {
+		section string
+		want    string
+		min     int
+		ok      bool
+	}{
+		{"## 2. Bar\n\n*≈ 25 min*\n\nBody.", "## 2. Bar\n\nBody.", 25, true},
+		{"## 2. Bar\n\n*≈ 1 h 5 min*\n\n*Difficulty: 3/5*\n\nBody.", "## 2. Bar\n\n*Difficulty: 3/5*\n\nBody.", 65, true},
+		{"## 2. Bar\n\n*Tags: go*\n\n*≈ 5 min*\nBody.", "## 2. Bar\n\n*Tags: go*\n\nBody.", 5, true},
+		{"## 2. Bar\n\nBody.\n\n*≈ 5 min*", "## 2. Bar\n\nBody.\n\n*≈ 5 min*", 0, false},
+		{"## 2. Bar", "## 2. Bar", 0, false},
+	}
+	for _, tt := range tests {
+		got, min, ok := stripStudyTime(tt.section)
+		if got != tt.want || min != tt.min || ok != tt.ok {
+			t.Errorf("stripStudyTime(%q) = %q, %d, %v; want %q, %d, %v", tt.section, got, min, ok, tt.want, tt.min, tt.ok)
+		}
+	}
+}
+
+func TestUpdateStudyTotals(t *testing.T) {
+	md := "# Comprehensive Guide: GO\n\n*Estimated study time: ≈ 1 h 35 min*\n\n## Table of Contents\n\n- [1. Foo](#1-foo)\n\n---\n\n" +
+		"## 1. Foo\n\n*≈ 30 min*\n\nFoo.\n\n## 2. Bar\n\n*≈ 45 min*\n\nBar.\n\n---\n\n" +
+		"## Study Plan\n\n" +
+		"- **Day 1, 2026-10-16** (≈ 30 min): [1. Foo](#1-foo) (≈ 30 min)\n" +
+		"- **Day 2, 2026-10-17** (≈ 1 h 5 min): [2. Bar](#2-bar) (≈ 25 min), [3. Baz](#3-baz) (≈ 40 min)\n\n---\n\n"
+	got := updateStudyTotals(md, 2, 25, 45)
+	want := strings.NewReplacer(
+		"*Estimated study time: ≈ 1 h 35 min*", "*Estimated study time: ≈ 1 h 55 min*",
+		"(≈ 1 h 5 min): [2. Bar](#2-bar) (≈ 25 min)", "(≈ 1 h 25 min): [2. Bar](#2-bar) (≈ 45 min)",
+	).Replace(md)
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	// The section labels are rewriteSection's; only the totals change.
+	if !strings.Contains(got, "## 2. Bar\n\n*≈ 45 min*") || !strings.Contains(got, "## 1. Foo\n\n*≈ 30 min*") {
+		t.Errorf("section labels changed:\n%s", got)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const defaultDifficultyMultipliers = "0.8,0.9,1,1.25,1.5"
+
+// studyModel is the --study-time formula: reading time of the section at
+// WPM words per minute, scaled by the concept's difficulty, plus a fixed
+// time per exercise.
+type studyModel struct {
+	WPM         int
+	DiffMult    [5]float64 // for difficulty 1-5
+	ExerciseMin float64
+}
+
+// currentStudyModel is the formula set by the flags. run validates
+// --difficulty-multipliers; the defaults stand in for a bad value elsewhere.
+func currentStudyModel() studyModel {
+	mult, err := parseDifficultyMultipliers(cfg.DifficultyMults)
+	if err != nil {
+		mult, _ = parseDifficultyMultipliers(defaultDifficultyMultipliers)
+	}
+	return studyModel{WPM: cfg.ReadingSpeed, DiffMult: mult, ExerciseMin: cfg.ExerciseMinutes}
+}
+
+func parseDifficultyMultipliers(s string) ([5]float64, error) {
+	var m [5]float64
+	parts := strings.Split(s, ",")
+	if len(parts) != len(m) {
+		return m, fmt.Errorf("expected 5 comma-separated numbers, one per difficulty")
+	}
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || f <= 0 {
+			return m, fmt.Errorf("%q is not a positive number", strings.TrimSpace(p))
+		}
+		m[i] = f
+	}
+	return m, nil
+}
+
+// estimate returns the study time of a section in minutes. difficulty is 0
+// when unknown.
+func (m studyModel) estimate(text string, difficulty, exercises int) int {
+	min := float64(len(strings.Fields(text))) / float64(m.WPM)
+	if difficulty >= 1 && difficulty <= len(m.DiffMult) {
+		min *= m.DiffMult[difficulty-1]
+	}
+	min += float64(exercises) * m.ExerciseMin
+	return roundStudyMinutes(min)
+}
+
+// roundStudyMinutes keeps estimates from looking more precise than they are:
+// whole minutes up to 10, then multiples of 5.
+func roundStudyMinutes(min float64) int {
+	if min <= 10 {
+		return int(math.Max(1, math.Ceil(min)))
+	}
+	return int(math.Round(min/5)) * 5
+}
+
+func formatStudyTime(min int) string {
+	if min < 60 {
+		return fmt.Sprintf("≈ %d min", min)
+	}
+	if min%60 == 0 {
+		return fmt.Sprintf("≈ %d h", min/60)
+	}
+	return fmt.Sprintf("≈ %d h %d min", min/60, min%60)
+}
+
+// studyTimes estimates each concept section of chunk j, whose final content
+// is given, and shows the estimate under its heading. problems are the
+// practice problems per item, as returned by practiceBook.render.
+func studyTimes(j chunk, content string, problems [][]int) (string, []int) {
+	_, sections := splitSections(content, chunkNumbers(j.items))
+	texts := map[string]string{}
+	for _, s := range sections {
+		texts[s.Number] = s.Text
+	}
+	if len(texts) == 0 {
+		return content, nil
+	}
+	m := currentStudyModel()
+	minutes := make([]int, len(j.items))
+	labels := make([]string, len(j.items))
+	for k, it := range j.items {
+		text, ok := texts[conceptNumber(it)]
+		if !ok {
+			continue
+		}
+		diff := 0
+		if j.diff != nil {
+			diff = j.diff[k]
+		}
+		exercises := 0
+		if problems != nil {
+			exercises = len(problems[k])
+		}
+		if cfg.Mode == "exercises" {
+			exercises++
+		}
+		minutes[k] = m.estimate(text, diff, exercises)
+		labels[k] = "*" + formatStudyTime(minutes[k]) + "*"
+	}
+	return labelSections(content, j.items, labels), minutes
+}
+
+// totalStudyTime sums the estimates of all sections.
+func totalStudyTime(sections []SectionMeta) int {
+	total := 0
+	for _, sec := range sections {
+		for _, m := range sec.StudyMinutes {
+			total += m
+		}
+	}
+	return total
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStudyModelEstimate(t *testing.T) {
+	m := studyModel{WPM: 200, DiffMult: [5]float64{0.8, 0.9, 1, 1.25, 1.5}, ExerciseMin: 5}
+	words := func(n int) string { return strings.Repeat("word ", n) }
+	tests := []struct {
+		name       string
+		text       string
+		difficulty int
+		exercises  int
+		want       int
+	}{
+		{"reading only", words(1000), 0, 0, 5},
+		{"hardest", words(1000), 5, 0, 8},                  // 7.5 min
+		{"easiest", words(1000), 1, 0, 4},                  // 4 min
+		{"with exercises", words(1000), 3, 2, 15},          // 5 + 2×5
+		{"over ten rounds to five", words(3000), 4, 0, 20}, // 18.75 min
+		{"twelve rounds down", words(2400), 0, 0, 10},
+		{"unknown difficulty", words(1000), 7, 0, 5},
+		{"empty section", "", 0, 0, 1},
+		{"short section", words(30), 2, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := m.estimate(tt.text, tt.difficulty, tt.exercises); got != tt.want {
+			t.Errorf("%s: estimate = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRoundStudyMinutes(t *testing.T) {
+	tests := []struct {
+		min  float64
+		want int
+	}{
+		{0, 1}, {0.2, 1}, {1, 1}, {9.1, 10}, {10, 10},
+		{10.1, 10}, {12.4, 10}, {12.5, 15}, {62, 60}, {63, 65},
+	}
+	for _, tt := range tests {
+		if got := roundStudyMinutes(tt.min); got != tt.want {
+			t.Errorf("roundStudyMinutes(%v) = %d, want %d", tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestFormatStudyTime(t *testing.T) {
+	tests := []struct {
+		min  int
+		want string
+	}{
+		{1, "≈ 1 min"}, {59, "≈ 59 min"}, {60, "≈ 1 h"}, {65, "≈ 1 h 5 min"}, {180, "≈ 3 h"}, {125, "≈ 2 h 5 min"},
+	}
+	for _, tt := range tests {
+		got := formatStudyTime(tt.min)
+		if got != tt.want {
+			t.Errorf("formatStudyTime(%d) = %q, want %q", tt.min, got, tt.want)
+		}
+		if back, ok := parseStudyTime(got); !ok || back != tt.min {
+			t.Errorf("parseStudyTime(%q) = %d, %v; want %d", got, back, ok, tt.min)
+		}
+	}
+	for _, s := range []string{"", "≈ ", "15 min", "≈ x min", "≈ 1 day"} {
+		if min, ok := parseStudyTime(s); ok {
+			t.Errorf("parseStudyTime(%q) = %d, want not ok", s, min)
+		}
+	}
+}
+
+func TestParseDifficultyMultipliers(t *testing.T) {
+	got, err := parseDifficultyMultipliers(" 1, 2,3 ,4,5.5")
+	if err != nil || got != [5]float64{1, 2, 3, 4, 5.5} {
+		t.Errorf("got %v, %v", got, err)
+	}
+	if _, err := parseDifficultyMultipliers(defaultDifficultyMultipliers); err != nil {
+		t.Errorf("the default is invalid: %v", err)
+	}
+	for _, s := range []string{"", "1,2,3,4", "1,2,3,4,5,6", "1,2,3,4,0", "1,2,-3,4,5", "1,2,a,4,5"} {
+		if _, err := parseDifficultyMultipliers(s); err == nil {
+			t.Errorf("%q: want an error", s)
+		}
+	}
+}
+
+func TestStudyTimes(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.ReadingSpeed, cfg.DifficultyMults, cfg.ExerciseMinutes = 200, defaultDifficultyMultipliers, 5
+	j := chunk{items: []string{"1. Foo", "2. Bar"}, diff: []int{1, 5}}
+	// 1000 words each, headings included.
+	content := "## 1. Foo\n\n" + strings.Repeat("foo ", 997) + "\n\n## 2. Bar\n\n" + strings.Repeat("bar ", 997)
+	got, minutes := studyTimes(j, content, [][]int{nil, {1, 2}})
+	if want := []int{4, 20}; len(minutes) != 2 || minutes[0] != want[0] || minutes[1] != want[1] {
+		t.Errorf("minutes = %v, want %v", minutes, want)
+	}
+	for _, want := range []string{"## 1. Foo\n\n*≈ 4 min*\n\nfoo", "## 2. Bar\n\n*≈ 20 min*\n\nbar"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("labelled content lacks %q", want)
+		}
+	}
+	if total := totalStudyTime([]SectionMeta{{StudyMinutes: minutes}, {StudyMinutes: []int{6}}}); total != 30 {
+		t.Errorf("total = %d, want 30", total)
+	}
+}
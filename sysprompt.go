@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxSystemPromptSize caps a system prompt read from stdin or a URL.
+const maxSystemPromptSize = 256 << 10
+
+// promptCacheTTL is how long a fetched prompt is used without asking the
+// server again; after that it is revalidated with its ETag.
+const promptCacheTTL = time.Hour
+
+// cachedPrompt is a fetched system prompt, kept in the "prompts" cache.
+type cachedPrompt struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	Body         string    `json:"body"`
+}
+
+// loadSystemPrompt reads --system-prompt: a file path, an http(s) URL, or
+// "-" for stdin.
+func loadSystemPrompt(src string) (string, error) {
+	switch {
+	case src == "-":
+		b, err := io.ReadAll(io.LimitReader(os.Stdin, maxSystemPromptSize+1))
+		if err != nil {
+			return "", fmt.Errorf("reading the system prompt from stdin: %w", err)
+		}
+		return checkPromptText(b, "stdin")
+	case strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://"):
+		return fetchSystemPrompt(src)
+	}
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return "", fmt.Errorf("reading system prompt file: %w", err)
+	}
+	return string(b), nil
+}
+
+func checkPromptText(b []byte, from string) (string, error) {
+	if len(b) > maxSystemPromptSize {
+		return "", fmt.Errorf("the system prompt from %s is over %d KB", from, maxSystemPromptSize>>10)
+	}
+	if !utf8.Valid(b) {
+		return "", fmt.Errorf("the system prompt from %s is not UTF-8 text", from)
+	}
+	if strings.TrimSpace(string(b)) == "" {
+		return "", fmt.Errorf("the system prompt from %s is empty", from)
+	}
+	return string(b), nil
+}
+
+// fetchSystemPrompt downloads a prompt through the proxy and CA settings of
+// the environment (HTTPS_PROXY, SSL_CERT_FILE and friends). A cached copy is
+// used as is within promptCacheTTL, then revalidated; when the server can't
+// be reached, a stale copy is used with a warning.
+func fetchSystemPrompt(url string) (string, error) {
+	var cached *cachedPrompt
+	if b, ok := cacheGet("prompts", url); ok {
+		var c cachedPrompt
+		if json.Unmarshal(b, &c) == nil && c.URL == url {
+			cached = &c
+		}
+	}
+	if cached != nil && time.Since(cached.Fetched) < promptCacheTTL {
+		return cached.Body, nil
+	}
+
+	body, err := requestSystemPrompt(url, cached)
+	if err != nil {
+		if cached == nil {
+			return "", err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v; using the copy fetched %s.\n", err, cached.Fetched.Local().Format("2006-01-02 15:04"))
+		return cached.Body, nil
+	}
+	return body, nil
+}
+
+func requestSystemPrompt(url string, cached *cachedPrompt) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid system prompt URL: %w", err)
+	}
+	req.Header.Set("Accept", "text/plain, text/markdown;q=0.9, */*;q=0.1")
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching the system prompt: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		cached.Fetched = time.Now().UTC()
+		storePrompt(*cached)
+		return cached.Body, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching the system prompt: %s returned %s", url, resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		switch {
+		case err != nil:
+			return "", fmt.Errorf("fetching the system prompt: invalid Content-Type %q", ct)
+		case mt == "text/html" || mt == "application/xhtml+xml":
+			return "", fmt.Errorf("%s is an HTML page, not a prompt; link to the raw text instead", url)
+		case !strings.HasPrefix(mt, "text/") && mt != "application/octet-stream":
+			return "", fmt.Errorf("%s is %s, not a text prompt", url, mt)
+		}
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxSystemPromptSize+1))
+	if err != nil {
+		return "", fmt.Errorf("fetching the system prompt: %w", err)
+	}
+	text, err := checkPromptText(b, url)
+	if err != nil {
+		return "", err
+	}
+	storePrompt(cachedPrompt{URL: url, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified"), Fetched: time.Now().UTC(), Body: text})
+	return text, nil
+}
+
+func storePrompt(c cachedPrompt) {
+	b, err := json.Marshal(c)
+	if err == nil {
+		err = cachePut("prompts", c.URL, b)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not cache the system prompt: %v\n", err)
+	}
+}
+
+// additionalInstructions is the block --info appends to the system prompt:
+// each value is its own paragraph, in the order given, and a value starting
+// with @ is read from that file.
+func additionalInstructions(values []string) (string, error) {
+	if len(values) == 0 {
+		return "", nil
+	}
+	var paras []string
+	for i, v := range values {
+		if path, ok := strings.CutPrefix(v, "@"); ok {
+			b, err := os.ReadFile(expandHome(path))
+			if err != nil {
+				return "", fmt.Errorf("reading --info file: %w", err)
+			}
+			v = string(b)
+		}
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return "", fmt.Errorf("--info value %d (%q) is empty", i+1, values[i])
+		}
+		paras = append(paras, v)
+	}
+	return "\n\nADDITIONAL USER INSTRUCTIONS:\n" + strings.Join(paras, "\n\n"), nil
+}
+
+// withInstructions completes a run's system prompt: the base prompt, then
+// the --info block, then the language instruction, so the user's
+// instructions can't push the language out of the model's last word.
+func withInstructions(base string, info []string) (string, error) {
+	extra, err := additionalInstructions(info)
+	if err != nil {
+		return "", err
+	}
+	return base + extra + languageInstruction(), nil
+}
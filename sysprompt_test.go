@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAdditionalInstructions(t *testing.T) {
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("\nFrom the file.\n\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := additionalInstructions([]string{"First.", "@" + notes, "  Last.  "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each value is a paragraph of its own, in the order given.
+	if want := "\n\nADDITIONAL USER INSTRUCTIONS:\nFirst.\n\nFrom the file.\n\nLast."; got != want {
+		t.Errorf("additionalInstructions = %q, want %q", got, want)
+	}
+	if got, err := additionalInstructions(nil); got != "" || err != nil {
+		t.Errorf("no --info gave %q, %v", got, err)
+	}
+
+	empty := filepath.Join(dir, "empty.txt")
+	if err := os.WriteFile(empty, []byte(" \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		values []string
+		err    string
+	}{
+		{[]string{"ok", "   "}, `--info value 2 ("   ") is empty`},
+		{[]string{"@" + empty}, "--info value 1"},
+		{[]string{"@" + filepath.Join(dir, "missing.txt")}, "reading --info file"},
+	} {
+		if _, err := additionalInstructions(tt.values); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: error %v, want %q", tt.values, err, tt.err)
+		}
+	}
+}
+
+// TestWithInstructionsOrder checks where --info goes in the system prompt:
+// after the base prompt and before the language instruction.
+func TestWithInstructionsOrder(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	defer func(r bool) { langRequested = r }(langRequested)
+	cfg.Lang, langRequested = "de", true
+
+	notes := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(notes, []byte("NOTES"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := withInstructions("BASE", []string{"ONE", "@" + notes, "TWO"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := -1
+	for _, part := range []string{"BASE", "ADDITIONAL USER INSTRUCTIONS:", "ONE", "NOTES", "TWO", "LANGUAGE:\nWrite everything in German"} {
+		i := strings.Index(got, part)
+		if i <= last {
+			t.Fatalf("%q is out of order in:\n%s", part, got)
+		}
+		last = i
+	}
+
+	langRequested = false
+	if got, _ := withInstructions("BASE", nil); got != "BASE" {
+		t.Errorf("withInstructions without --info or --lang = %q", got)
+	}
+}
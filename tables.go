@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	contrastRe     = regexp.MustCompile(`(?i)\b(?:vs\.?|versus|differences?\s+between|compar(?:e|ed|es|ing|ison)|contrast(?:ing)?)\b`)
+	tableSepCellRe = regexp.MustCompile(`^\s*:?-{1,}:?\s*$`)
+)
+
+// TableStats counts what --tables did to a chunk.
+type TableStats struct {
+	Repaired int `json:"repaired,omitempty"`
+	Flagged  int `json:"flagged,omitempty"`
+	Added    int `json:"added,omitempty"`
+}
+
+// contrastItems returns the items of j that compare things ("X vs Y",
+// "differences between A and B").
+func contrastItems(items []string) []string {
+	var out []string
+	for _, it := range items {
+		if contrastRe.MatchString(conceptPrefixRe.ReplaceAllString(it, "")) {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+func tablesInstruction(items []string) string {
+	contrast := contrastItems(items)
+	if len(contrast) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n\nConcept(s) %s compare or contrast things: include a markdown comparison table in each of them, "+
+		"with one column per thing compared and one row per aspect.", strings.Join(chunkNumbers(contrast), ", "))
+}
+
+// ensureTables repairs the tables in content and asks again for the
+// comparison tables the model left out.
+func ensureTables(j chunk, content string) (string, *TableStats) {
+	stats := &TableStats{}
+	content = fixTables(content, stats)
+
+	contrast := contrastItems(j.items)
+	if len(contrast) == 0 {
+		return content, statsOrNil(stats)
+	}
+	_, sections := splitSections(content, chunkNumbers(j.items))
+	texts := map[string]string{}
+	for _, s := range sections {
+		texts[s.Number] = s.Text
+	}
+	var missing []string
+	for _, it := range contrast {
+		if text, ok := texts[conceptNumber(it)]; ok && !hasTable(text) {
+			missing = append(missing, it)
+		}
+	}
+	if len(missing) == 0 {
+		return content, statsOrNil(stats)
+	}
+
+	retryf("   Chunk %d has no comparison table for concept(s) %s, asking again...\n", j.id+1, strings.Join(chunkNumbers(missing), ", "))
+	prompt := fmt.Sprintf(
+		"For EACH of the following concepts, write ONLY a markdown comparison table, with one column per thing compared "+
+			"and one row per aspect.\n\n%s\n\nStart each concept with a line \"=== CONCEPT <number> ===\" followed by its table. "+
+			"Do not add any other text.",
+		strings.Join(missing, "\n"),
+	)
+	resp, err := callAIWith(callOptions{Model: j.model, Temperature: defaultTemperature, Purpose: "tables"}, prompt, cfg.SystemPrompt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error asking for comparison tables in chunk %d: %v\n", j.id+1, err)
+		return content, statsOrNil(stats)
+	}
+	blocks := map[string]string{}
+	for num, body := range parseConceptBlocks(resp) {
+		if table := fixTables(cleanChunkContent(body), stats); hasTable(table) {
+			blocks[num] = table
+			stats.Added++
+		}
+	}
+	return appendToSections(content, j.items, blocks), statsOrNil(stats)
+}
+
+func statsOrNil(s *TableStats) *TableStats {
+	if *s == (TableStats{}) {
+		return nil
+	}
+	return s
+}
+
+// hasTable reports whether text holds a well-formed table: a header row
+// followed by a separator row.
+func hasTable(text string) bool {
+	lines := strings.Split(text, "\n")
+	for i := 0; i+1 < len(lines); i++ {
+		if strings.Contains(lines[i], "|") && isSeparatorRow(lines[i+1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSeparatorRow(line string) bool {
+	cells := splitRow(line)
+	if len(cells) == 0 {
+		return false
+	}
+	for _, c := range cells {
+		if !tableSepCellRe.MatchString(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitRow returns the cells of a table row, with or without outer pipes.
+// Pipes inside inline code and escaped pipes don't split cells.
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cur strings.Builder
+	inCode := false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '`':
+			inCode = !inCode
+			cur.WriteByte(c)
+		case c == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cur.WriteString(`\|`)
+			i++
+		case c == '|' && !inCode:
+			cells = append(cells, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	return append(cells, strings.TrimSpace(cur.String()))
+}
+
+// fixTables finds table-like blocks outside code fences and rewrites them as
+// well-formed tables: outer pipes, a separator row after the header, and
+// every row padded to the header's width. Rows wider than the header can't
+// be repaired without guessing, so the table is flagged with a comment.
+func fixTables(content string, stats *TableStats) string {
+	lines := strings.Split(content, "\n")
+	var out []string
+	inFence := false
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+		if inFence || !strings.Contains(trimmed, "|") {
+			out = append(out, lines[i])
+			continue
+		}
+
+		end := i
+		for end < len(lines) && strings.Contains(lines[end], "|") && strings.TrimSpace(lines[end]) != "" &&
+			!strings.HasPrefix(strings.TrimSpace(lines[end]), "```") {
+			end++
+		}
+		block := lines[i:end]
+		looksLikeTable := len(block) >= 2
+		for _, line := range block {
+			if len(splitRow(line)) < 2 {
+				looksLikeTable = false
+			}
+		}
+		if !looksLikeTable {
+			out = append(out, block...)
+			i = end - 1
+			continue
+		}
+
+		fixed, repaired, flagged := fixTable(block)
+		if repaired {
+			stats.Repaired++
+		}
+		if len(out) > 0 && strings.TrimSpace(out[len(out)-1]) != "" {
+			out = append(out, "") // many renderers need a blank line before a table
+		}
+		if flagged {
+			stats.Flagged++
+			out = append(out, "<!-- aiguide: this table has rows with more cells than its header -->")
+		}
+		out = append(out, fixed...)
+		i = end - 1
+	}
+	return strings.Join(out, "\n")
+}
+
+func fixTable(block []string) (fixed []string, repaired, flagged bool) {
+	header := splitRow(block[0])
+	width := len(header)
+	rows := block[1:]
+	if isSeparatorRow(block[1]) {
+		if len(splitRow(block[1])) != width {
+			repaired = true
+		}
+		rows = block[2:]
+	} else {
+		repaired = true
+	}
+
+	format := func(cells []string) string {
+		return "| " + strings.Join(cells, " | ") + " |"
+	}
+	sep := make([]string, width)
+	for k := range sep {
+		sep[k] = "---"
+	}
+	if isSeparatorRow(block[1]) && len(splitRow(block[1])) == width {
+		sep = splitRow(block[1]) // keep the model's alignment markers
+	}
+
+	fixed = append(fixed, format(header), format(sep))
+	for _, r := range rows {
+		cells := splitRow(r)
+		switch {
+		case len(cells) < width:
+			cells = append(cells, make([]string, width-len(cells))...)
+			repaired = true
+		case len(cells) > width:
+			flagged = true
+		}
+		fixed = append(fixed, format(cells))
+	}
+	if !repaired {
+		return block, false, flagged // well-formed already; keep the model's spacing
+	}
+	return fixed, repaired, flagged
+}
+
+// writeTablesSummary reports the tables --tables repaired, flagged or added.
+func writeTablesSummary(w io.Writer, sections []SectionMeta) {
+	var total TableStats
+	for _, sec := range sections {
+		if sec.Tables != nil {
+			total.Repaired += sec.Tables.Repaired
+			total.Flagged += sec.Tables.Flagged
+			total.Added += sec.Tables.Added
+		}
+	}
+	if total == (TableStats{}) {
+		return
+	}
+	fmt.Fprintf(w, "-> Tables: %d repaired, %d flagged as malformed, %d comparison tables added\n", total.Repaired, total.Flagged, total.Added)
+}
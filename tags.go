@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxTagsPerConcept = 3
+	untaggedTag       = "untagged"
+)
+
+var (
+	tagLineRe       = regexp.MustCompile(`^\s*(\d+)[.):]\s*(.+)$`)
+	tagSpaceRe      = regexp.MustCompile(`[\s_]+`)
+	conceptPrefixRe = regexp.MustCompile(`^\s*(?:\d+[.)]|[-*])\s*`)
+)
+
+// tagsEnabled reports whether any flag needs concept tags.
+func tagsEnabled() bool {
+	return cfg.Tags || len(cfg.TagSet) > 0 || len(cfg.OnlyTags) > 0 || len(cfg.SkipTags) > 0 || cfg.GroupBy == "tag"
+}
+
+// normalizeTag lowercases a tag and joins its words with hyphens, so "Memory
+// Model", "memory_model" and "#memory-model" are the same tag.
+func normalizeTag(t string) string {
+	t = strings.Trim(strings.TrimSpace(t), "#`*\"'.")
+	t = tagSpaceRe.ReplaceAllString(strings.ToLower(t), "-")
+	return strings.Trim(t, "-")
+}
+
+func normalizeTags(tags []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = normalizeTag(t)
+		if t != "" && !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// assignTags asks the model for 1-3 tags per concept, restricted to tagSet
+// when one is given. The result is aligned with concepts; a concept left
+// without a valid tag gets untaggedTag.
+func assignTags(concepts []string, model string, tagSet []string) ([][]string, error) {
+	vocabulary := "Reuse the same tags across concepts wherever they fit, so the set stays small."
+	if len(tagSet) > 0 {
+		vocabulary = "Use ONLY tags from this set: " + strings.Join(tagSet, ", ") + "."
+	}
+	prompt := fmt.Sprintf(
+		"Assign 1 to %d short topical tags to each of the following concepts of the subject '%s'. %s\n\n%s\n\n"+
+			"Output ONLY one line per concept in the form \"<number>: <tag>, <tag>\", using the numbers above.",
+		maxTagsPerConcept, cfg.Subject, vocabulary, strings.Join(concepts, "\n"),
+	)
+
+	resp, err := callAIWith(callOptions{Model: model, Temperature: 0, Purpose: "tags"}, prompt,
+		"You are an experienced curriculum designer who categorizes concepts tersely.")
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := map[string]bool{}
+	for _, t := range tagSet {
+		allowed[t] = true
+	}
+
+	byNumber := make(map[string]int, len(concepts))
+	for i, c := range concepts {
+		byNumber[conceptNumber(c)] = i
+	}
+
+	tags := make([][]string, len(concepts))
+	scanner := bufio.NewScanner(strings.NewReader(resp))
+	for scanner.Scan() {
+		m := tagLineRe.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		idx, ok := byNumber[m[1]]
+		if !ok || tags[idx] != nil {
+			continue
+		}
+		var valid []string
+		for _, t := range normalizeTags(strings.Split(m[2], ",")) {
+			if len(allowed) > 0 && !allowed[t] {
+				continue
+			}
+			valid = append(valid, t)
+		}
+		if len(valid) > maxTagsPerConcept {
+			valid = valid[:maxTagsPerConcept]
+		}
+		tags[idx] = valid
+	}
+
+	for i := range tags {
+		if len(tags[i]) == 0 {
+			tags[i] = []string{untaggedTag}
+		}
+	}
+	return tags, nil
+}
+
+// filterByTags returns the indexes of the concepts kept by --only-tags and
+// --skip-tags.
+func filterByTags(tags [][]string) []int {
+	only := setOf(normalizeTags(cfg.OnlyTags))
+	skip := setOf(normalizeTags(cfg.SkipTags))
+
+	var keep []int
+	for i, ts := range tags {
+		if len(only) > 0 && !hasAny(ts, only) {
+			continue
+		}
+		if hasAny(ts, skip) {
+			continue
+		}
+		keep = append(keep, i)
+	}
+	return keep
+}
+
+func setOf(items []string) map[string]bool {
+	s := make(map[string]bool, len(items))
+	for _, it := range items {
+		s[it] = true
+	}
+	return s
+}
+
+func hasAny(tags []string, set map[string]bool) bool {
+	for _, t := range tags {
+		if set[t] {
+			return true
+		}
+	}
+	return false
+}
+
+// conceptGroup is one part of a grouped guide: Count concepts starting at
+// position Start.
+type conceptGroup struct {
+	Name  string
+	Start int
+	Count int
+}
+
+// groupByTag orders concepts by their first tag. Groups appear in the order
+// their tag is first used and keep the original order inside, so the
+// model's progression survives within each part.
+func groupByTag(tags [][]string) ([]int, []conceptGroup) {
+	var names []string
+	members := map[string][]int{}
+	for i, ts := range tags {
+		primary := ts[0]
+		if _, ok := members[primary]; !ok {
+			names = append(names, primary)
+		}
+		members[primary] = append(members[primary], i)
+	}
+
+	var order []int
+	groups := make([]conceptGroup, len(names))
+	for g, name := range names {
+		groups[g] = conceptGroup{Name: name, Start: len(order), Count: len(members[name])}
+		order = append(order, members[name]...)
+	}
+	return order, groups
+}
+
+// renumberConcepts rewrites concept lines as "1. ...", "2. ..." so headings,
+// anchors and the sidecar agree after filtering or reordering.
+func renumberConcepts(concepts []string) []string {
+	out := make([]string, len(concepts))
+	for i, c := range concepts {
+		out[i] = fmt.Sprintf("%d. %s", i+1, conceptPrefixRe.ReplaceAllString(c, ""))
+	}
+	return out
+}
+
+func groupTitle(i int, g conceptGroup) string {
+	if cfg.Depth > 1 {
+		return fmt.Sprintf("Chapter %d: %s", i+1, g.Name)
+	}
+	return fmt.Sprintf("Part %d: %s", i+1, g.Name)
+}
+
+func tagLabel(tags []string) string {
+	labels := make([]string, len(tags))
+	for i, t := range tags {
+		labels[i] = "`" + t + "`"
+	}
+	return "*Tags:* " + strings.Join(labels, " · ")
+}
+
+// pick returns the elements of s at idx, in that order. A nil s stays nil so
+// optional per-concept data can be reordered alongside the concepts.
+func pick[T any](s []T, idx []int) []T {
+	if s == nil {
+		return nil
+	}
+	out := make([]T, len(idx))
+	for i, k := range idx {
+		out[i] = s[k]
+	}
+	return out
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Term is one entry of the --consistent-terms sheet: the preferred term, a
+// short definition and the variants sections shouldn't use for it.
+type Term struct {
+	Term       string   `json:"term"`
+	Definition string   `json:"definition"`
+	Avoid      []string `json:"avoid,omitempty"`
+}
+
+// TermDeviation is a variant a section used in place of a preferred term.
+type TermDeviation struct {
+	Item  int    `json:"item"`
+	Term  string `json:"term"`
+	Used  string `json:"used"`
+	Count int    `json:"count"`
+}
+
+// terminology is the sheet of this run, shared by every chunk.
+var terminology []Term
+
+// terminologySheet asks for the core terms of the subject once the concept
+// list exists, so every chunk can be told the same vocabulary.
+func terminologySheet(concepts []string, model string) ([]Term, error) {
+	prompt := fmt.Sprintf(
+		"A study guide about '%s' covers these concepts:\n\n%s\n\n"+
+			"List the 20 to 40 core terms of this subject that several sections will need. For each, give the one preferred term, "+
+			"a one-sentence definition, and the synonyms or variant phrasings a writer might use for the same thing instead, "+
+			"so the guide can stick to the preferred one.\n\n"+
+			"Respond ONLY with a JSON array, e.g. [{\"term\": \"goroutine leak\", \"definition\": \"...\", \"avoid\": [\"leaked goroutine\", \"dangling goroutine\"]}].",
+		cfg.Subject, strings.Join(concepts, "\n")) + languageInstruction()
+
+	resp, err := callAIWith(callOptions{Model: model, Temperature: 0, Purpose: "terms"}, prompt,
+		"You are an editor who keeps the vocabulary of a textbook consistent.")
+	if err != nil {
+		return nil, err
+	}
+	start, end := strings.Index(resp, "["), strings.LastIndex(resp, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("the terminology sheet is not JSON")
+	}
+	var out []Term
+	if err := json.Unmarshal([]byte(resp[start:end+1]), &out); err != nil {
+		return nil, fmt.Errorf("parsing the terminology sheet: %w", err)
+	}
+	var terms []Term
+	for _, t := range out {
+		if t.Term = strings.TrimSpace(t.Term); t.Term == "" {
+			continue
+		}
+		t.Definition = strings.TrimSpace(t.Definition)
+		var avoid []string
+		for _, a := range t.Avoid {
+			if a = strings.TrimSpace(a); a != "" && !strings.EqualFold(a, t.Term) {
+				avoid = append(avoid, a)
+			}
+		}
+		t.Avoid = avoid
+		terms = append(terms, t)
+	}
+	return terms, nil
+}
+
+// terminologyInstruction is the sheet as the system prompt gives it.
+func terminologyInstruction(terms []Term) string {
+	var b strings.Builder
+	b.WriteString("\n\nTERMINOLOGY: Other sections of this guide are written separately. Use exactly these preferred terms, " +
+		"as defined here, and don't switch to the variants in parentheses:\n")
+	for _, t := range terms {
+		fmt.Fprintf(&b, "- %s: %s", t.Term, t.Definition)
+		if len(t.Avoid) > 0 {
+			fmt.Fprintf(&b, " (not: %s)", strings.Join(t.Avoid, ", "))
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+var fencedCodeRe = regexp.MustCompile("(?s)```.*?```")
+
+// termPattern matches phrase as whole words, case-insensitively.
+func termPattern(phrase string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(phrase) + `\b`)
+}
+
+// checkTerminology finds the variants each concept of j used instead of a
+// preferred term. Code is left out, and so are variants inside the
+// preferred term itself, such as "leak" in "goroutine leak".
+func checkTerminology(j chunk, content string) []TermDeviation {
+	_, sections := splitSections(content, chunkNumbers(j.items))
+	var out []TermDeviation
+	for _, s := range sections {
+		item, _ := strconv.Atoi(s.Number)
+		text := inlineCodeRe.ReplaceAllString(fencedCodeRe.ReplaceAllString(s.Text, ""), "")
+		for _, t := range terminology {
+			plain := termPattern(t.Term).ReplaceAllString(text, "")
+			for _, a := range t.Avoid {
+				if n := len(termPattern(a).FindAllStringIndex(plain, -1)); n > 0 {
+					out = append(out, TermDeviation{Item: item, Term: t.Term, Used: a, Count: n})
+				}
+			}
+		}
+	}
+	return out
+}
+
+// writeGlossary renders the terminology sheet as the guide's glossary.
+func writeGlossary(w io.Writer, terms []Term) {
+	if len(terms) == 0 {
+		return
+	}
+	sorted := append([]Term(nil), terms...)
+	sort.Slice(sorted, func(a, b int) bool { return strings.ToLower(sorted[a].Term) < strings.ToLower(sorted[b].Term) })
+	var b strings.Builder
+	for _, t := range sorted {
+		fmt.Fprintf(&b, "- **%s**: %s\n", t.Term, t.Definition)
+	}
+	fmt.Fprintf(w, "## %s\n\n%s\n---\n\n", outputLanguage().glossary, b.String())
+}
+
+func writeTermsSummary(w io.Writer, sections []SectionMeta) {
+	if terminology == nil {
+		return
+	}
+	var devs []TermDeviation
+	for _, sec := range sections {
+		devs = append(devs, sec.TermDeviations...)
+	}
+	if len(devs) == 0 {
+		fmt.Fprintf(w, "-> Terminology: all sections use the %d preferred terms\n", len(terminology))
+		return
+	}
+	fmt.Fprintf(w, "-> Terminology: %d section(s) use variants of the preferred terms\n", countItems(devs))
+	for _, d := range devs {
+		fmt.Fprintf(w, "   concept %d: %q for %q (%dx)\n", d.Item, d.Used, d.Term, d.Count)
+	}
+}
+
+func countItems(devs []TermDeviation) int {
+	seen := map[int]bool{}
+	for _, d := range devs {
+		seen[d.Item] = true
+	}
+	return len(seen)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// generateTimelineList asks for the concept list with a date or period per
+// concept. Periods are aligned with the concepts, empty when the model
+// couldn't date one.
+func generateTimelineList() (concepts, periods []string, err error) {
+	prompt := currentMode().listPrompt(cfg.TotalCount, cfg.Subject) + clarificationContext() +
+		"For each concept, give the date or period it belongs to: a year (1976), a range (1939-1945) or an approximate date (c. 1850). " +
+		"Leave the period empty for a concept that can't be dated rather than guessing. " +
+		"Respond ONLY with a JSON array, e.g. [{\"concept\": \"...\", \"period\": \"1976\"}]." +
+		languageInstruction()
+
+	resp, err := callAI(prompt, "You are a helpful assistant that lists concepts concisely.")
+	if err != nil {
+		return nil, nil, err
+	}
+	start, end := strings.Index(resp, "["), strings.LastIndex(resp, "]")
+	if start < 0 || end < start {
+		return nil, nil, fmt.Errorf("the dated concept list is not JSON")
+	}
+	var out []struct {
+		Concept string `json:"concept"`
+		Period  string `json:"period"`
+	}
+	if err := json.Unmarshal([]byte(resp[start:end+1]), &out); err != nil {
+		return nil, nil, fmt.Errorf("parsing the dated concept list: %w", err)
+	}
+	for _, c := range out {
+		if title := strings.TrimSpace(conceptPrefixRe.ReplaceAllString(c.Concept, "")); title != "" {
+			concepts = append(concepts, fmt.Sprintf("%d. %s", len(concepts)+1, title))
+			periods = append(periods, strings.TrimSpace(c.Period))
+		}
+	}
+	return concepts, periods, nil
+}
+
+var (
+	centuryRe = regexp.MustCompile(`(?i)\b(early|mid|late)?[\s-]*(\d{1,2})(?:st|nd|rd|th)[\s-]+century\b(?:\s*(bce?|ce|ad)\b)?`)
+	yearRe    = regexp.MustCompile(`(?i)(?:\b(ad|ce)\s*)?\b(\d{1,4})s?\b(?:\s*(bce?|ad|ce)\b)?`)
+	bcRe      = regexp.MustCompile(`(?i)\bbce?\b`)
+)
+
+// parsePeriod returns the year a period starts, as a sort key: BC years are
+// negative. It reads years (1976, 1850s), ranges (1939-1945, 300-200 BC),
+// approximate dates (c. 1850, circa 1850) and centuries (late 19th century).
+func parsePeriod(s string) (int, bool) {
+	if m := centuryRe.FindStringSubmatch(s); m != nil {
+		c, _ := strconv.Atoi(m[2])
+		year := (c - 1) * 100
+		if strings.HasPrefix(strings.ToLower(m[3]), "b") {
+			year = -c * 100
+		}
+		switch strings.ToLower(m[1]) {
+		case "mid":
+			year += 40
+		case "late":
+			year += 70
+		}
+		return year, true
+	}
+	for _, m := range yearRe.FindAllStringSubmatch(s, -1) {
+		era := strings.ToLower(m[1] + m[3])
+		// One- and two-digit numbers are only years with an era, as in
+		// "AD 79"; otherwise they are the end of a range like 1850-70.
+		if len(m[2]) < 3 && era == "" {
+			continue
+		}
+		year, _ := strconv.Atoi(m[2])
+		if strings.HasPrefix(era, "b") || (era == "" && bcRe.MatchString(s)) {
+			year = -year
+		}
+		return year, true
+	}
+	return 0, false
+}
+
+func formatYear(y int) string {
+	if y < 0 {
+		return fmt.Sprintf("%d BC", -y)
+	}
+	return strconv.Itoa(y)
+}
+
+// orderChronologically sorts the concepts by the year their period starts,
+// keeping the model's order for ties. Concepts that can't be dated go last;
+// dated is how many come before them.
+func orderChronologically(periods []string) (order []int, dated int) {
+	years := make([]int, len(periods))
+	for i, p := range periods {
+		if y, ok := parsePeriod(p); ok {
+			years[i] = y
+			dated++
+		} else {
+			years[i] = math.MaxInt
+		}
+		order = append(order, i)
+	}
+	sort.SliceStable(order, func(a, b int) bool { return years[order[a]] < years[order[b]] })
+	return order, dated
+}
+
+// timelineGroups puts the undated concepts, which orderChronologically moved
+// to the end, in a part of their own, so they don't read as the latest.
+func timelineGroups(periods []string, dated int) []conceptGroup {
+	if dated == 0 || dated == len(periods) {
+		return nil
+	}
+	first, _ := parsePeriod(periods[0])
+	last, _ := parsePeriod(periods[dated-1])
+	name := formatYear(first)
+	if last != first {
+		name += " – " + formatYear(last)
+	}
+	return []conceptGroup{
+		{Name: name, Start: 0, Count: dated},
+		{Name: outputLanguage().undated, Start: dated, Count: len(periods) - dated},
+	}
+}
+
+// withPeriods adds each concept's period to its line, so the headings show
+// it. Lines that already name it are left alone.
+func withPeriods(concepts, periods []string) []string {
+	out := make([]string, len(concepts))
+	for i, c := range concepts {
+		out[i] = c
+		if p := periods[i]; p != "" && !strings.Contains(c, p) {
+			out[i] = fmt.Sprintf("%s (%s)", c, p)
+		}
+	}
+	return out
+}
+
+// timelineOverview is the table of periods written after the Table of
+// Contents, linking each row to its section.
+func timelineOverview(concepts, periods []string) string {
+	lang := outputLanguage()
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s\n\n| | |\n| --- | --- |\n", lang.timeline)
+	for i, c := range concepts {
+		p := periods[i]
+		if _, ok := parsePeriod(p); !ok {
+			p = "*" + lang.undated + "*"
+		}
+		title := strings.TrimSuffix(c, " ("+periods[i]+")")
+		fmt.Fprintf(&b, "| %s | [%s](#%s) |\n", strings.ReplaceAll(p, "|", `\|`), strings.ReplaceAll(title, "|", `\|`), conceptAnchor(c))
+	}
+	return b.String() + "\n"
+}
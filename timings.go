@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// timingRecord is one run's aggregates in timings.json, which the pre-run
+// estimate is based on. Setup is everything before the first chunk: the
+// concept list and any classification passes.
+type timingRecord struct {
+	Time           time.Time `json:"time"`
+	Model          string    `json:"model"`
+	Mode           string    `json:"mode"`
+	ChunkSize      int       `json:"chunk_size"`
+	Threads        int       `json:"threads"`
+	Chunks         int       `json:"chunks"`
+	SetupSeconds   float64   `json:"setup_seconds"`
+	ChunkSeconds   float64   `json:"avg_chunk_seconds"`
+	TokensPerChunk int       `json:"tokens_per_chunk"`
+}
+
+// The store keeps the last timingsPerKey runs of each model, mode and chunk
+// size, none older than timingsMaxAge.
+const (
+	timingsPerKey = 20
+	timingsMaxAge = 90 * 24 * time.Hour
+)
+
+// chunkTimings adds up the latency of the chunks answered in this run.
+var chunkTimings struct {
+	mu    sync.Mutex
+	n     int
+	total time.Duration
+}
+
+func addChunkTiming(d time.Duration) {
+	chunkTimings.mu.Lock()
+	chunkTimings.n++
+	chunkTimings.total += d
+	chunkTimings.mu.Unlock()
+}
+
+func timingsPath() string {
+	return filepath.Join(dataDir(), "timings.json")
+}
+
+func (r timingRecord) key() string {
+	return fmt.Sprintf("%s|%s|%d", r.Model, r.Mode, r.ChunkSize)
+}
+
+func loadTimings(path string) ([]timingRecord, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []timingRecord
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return records, nil
+}
+
+// pruneTimings drops records past timingsMaxAge and all but the newest
+// timingsPerKey of each key. records are oldest first.
+func pruneTimings(records []timingRecord, now time.Time) []timingRecord {
+	seen := map[string]int{}
+	var keep []timingRecord
+	for i := len(records) - 1; i >= 0; i-- {
+		r := records[i]
+		if now.Sub(r.Time) > timingsMaxAge || seen[r.key()] >= timingsPerKey {
+			continue
+		}
+		seen[r.key()]++
+		keep = append(keep, r)
+	}
+	for i, j := 0, len(keep)-1; i < j; i, j = i+1, j-1 {
+		keep[i], keep[j] = keep[j], keep[i]
+	}
+	return keep
+}
+
+// recordTimings adds this run's chunk timings to the store. Runs that
+// answered no chunk, or ran with --no-history, aren't recorded. A failure
+// is only a warning.
+func recordTimings(setup time.Duration, tokens int) {
+	chunkTimings.mu.Lock()
+	n, total := chunkTimings.n, chunkTimings.total
+	chunkTimings.mu.Unlock()
+	if n == 0 || runHistory.path == "" {
+		return
+	}
+	r := timingRecord{
+		Time:           time.Now().UTC().Truncate(time.Second),
+		Model:          cfg.Model,
+		Mode:           cfg.Mode,
+		ChunkSize:      cfg.ChunkSize,
+		Threads:        cfg.Threads,
+		Chunks:         n,
+		SetupSeconds:   setup.Round(time.Millisecond).Seconds(),
+		ChunkSeconds:   (total / time.Duration(n)).Round(time.Millisecond).Seconds(),
+		TokensPerChunk: tokens / n,
+	}
+	path := timingsPath()
+	err := func() error {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return err
+		}
+		unlock, err := lockFile(path + ".lock")
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		records, err := loadTimings(path)
+		if err != nil {
+			// A corrupt store only loses old estimates.
+			records = nil
+		}
+		b, err := json.MarshalIndent(pruneTimings(append(records, r), time.Now()), "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(path, append(b, '\n'), 0o600)
+	}()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not record chunk timings in %s: %v\n", path, err)
+	}
+}
+
+// durationEstimate is how long a run of chunks chunks should take, from the
+// earlier runs with the same model, mode and chunk size.
+type durationEstimate struct {
+	Duration       time.Duration
+	TokensPerChunk int
+	Runs           int
+}
+
+func estimateDuration(chunks int) (durationEstimate, bool) {
+	records, err := loadTimings(timingsPath())
+	if err != nil {
+		return durationEstimate{}, false
+	}
+	want := timingRecord{Model: cfg.Model, Mode: cfg.Mode, ChunkSize: cfg.ChunkSize}.key()
+	var runs, answered, tokens int
+	var setup, chunkSeconds float64
+	for _, r := range pruneTimings(records, time.Now()) {
+		if r.key() != want || r.Chunks == 0 {
+			continue
+		}
+		runs++
+		setup += r.SetupSeconds
+		answered += r.Chunks
+		chunkSeconds += r.ChunkSeconds * float64(r.Chunks)
+		tokens += r.TokensPerChunk * r.Chunks
+	}
+	if runs == 0 {
+		return durationEstimate{}, false
+	}
+	// Chunks run in waves of --threads.
+	waves := (chunks + max(cfg.Threads, 1) - 1) / max(cfg.Threads, 1)
+	secs := setup/float64(runs) + float64(waves)*chunkSeconds/float64(answered)
+	return durationEstimate{
+		Duration:       time.Duration(secs * float64(time.Second)).Round(time.Second),
+		TokensPerChunk: tokens / answered,
+		Runs:           runs,
+	}, true
+}
+
+// printEstimate prints how long the planned run should take, or that there
+// is nothing to base an estimate on yet.
+func printEstimate() {
+	size := max(cfg.ChunkSize, 1)
+	chunks := (plannedConcepts() + size - 1) / size
+	like := fmt.Sprintf("%s at chunk size %d", cfg.Model, cfg.ChunkSize)
+	if cfg.Mode != "guide" {
+		like += " in " + cfg.Mode + " mode"
+	}
+	e, ok := estimateDuration(chunks)
+	if !ok {
+		statusf("-> No duration estimate yet: no earlier runs of %s\n", like)
+		return
+	}
+	statusf("-> Estimated duration: about %s, done around %s (from %d earlier run(s) of %s, ~%d tokens per chunk)\n",
+		e.Duration, time.Now().Add(e.Duration).Format("15:04"), e.Runs, like, e.TokensPerChunk)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yuriiter/aiguide/pkg/guide"
+)
+
+type Usage = guide.Usage
+
+// modelPrice is the list price in USD per 1M tokens.
+type modelPrice struct {
+	In, Out float64
+}
+
+// knownPrices is matched by longest prefix against the model name.
+var knownPrices = map[string]modelPrice{
+	"gpt-4o":        {2.50, 10.00},
+	"gpt-4o-mini":   {0.15, 0.60},
+	"gpt-4.1":       {2.00, 8.00},
+	"gpt-4.1-mini":  {0.40, 1.60},
+	"gpt-4.1-nano":  {0.10, 0.40},
+	"gpt-4-turbo":   {10.00, 30.00},
+	"gpt-3.5-turbo": {0.50, 1.50},
+	"o3-mini":       {1.10, 4.40},
+	"o4-mini":       {1.10, 4.40},
+}
+
+// priceFor is the price of model: --price-in/--price-out for --model when
+// given, otherwise its known list price.
+func priceFor(model string) (modelPrice, bool) {
+	if model == cfg.Model && (cfg.PriceIn > 0 || cfg.PriceOut > 0) {
+		return modelPrice{cfg.PriceIn, cfg.PriceOut}, true
+	}
+	best := ""
+	for prefix := range knownPrices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return modelPrice{}, false
+	}
+	return knownPrices[best], true
+}
+
+func (p modelPrice) cost(u Usage) float64 {
+	return (float64(u.PromptTokens)*p.In + float64(u.CompletionTokens)*p.Out) / 1e6
+}
+
+type modelUsage struct {
+	Calls int
+	Usage
+}
+
+// usageTracker accumulates token usage per model across concurrent workers.
+type usageTracker struct {
+	mu          sync.Mutex
+	byModel     map[string]*modelUsage
+	byPurpose   map[string]int
+	purposeCost map[string]float64 // only for purposes whose every call was priced
+}
+
+var usage = &usageTracker{byModel: map[string]*modelUsage{}, byPurpose: map[string]int{}, purposeCost: map[string]float64{}}
+
+// checkBudget stops new calls once the estimated cost reaches --max-cost or
+// the tokens used reach --max-total-tokens.
+func checkBudget() error {
+	if cfg.MaxCost <= 0 && cfg.MaxTotalTokens <= 0 {
+		return nil
+	}
+	sum, cost, priced := usage.totals()
+	if cfg.MaxCost > 0 && priced && cost >= cfg.MaxCost {
+		return fmt.Errorf("%w: ≈ $%.4f spent, the --max-cost limit is $%g", ErrBudgetExceeded, cost, cfg.MaxCost)
+	}
+	if cfg.MaxTotalTokens > 0 && sum.TotalTokens >= cfg.MaxTotalTokens {
+		return fmt.Errorf("%w: %d tokens used, the --max-total-tokens limit is %d", ErrBudgetExceeded, sum.TotalTokens, cfg.MaxTotalTokens)
+	}
+	return nil
+}
+
+var budgetNotice sync.Once
+
+// budgetSpent reports whether the budget is spent, saying so once: the
+// chunks already started finish, no new ones are.
+func budgetSpent() bool {
+	err := checkBudget()
+	if err == nil {
+		return false
+	}
+	budgetNotice.Do(func() {
+		fmt.Fprintf(os.Stderr, "Stopping: %v. The chunks already started finish, no new ones are started.\n", err)
+	})
+	return true
+}
+
+// modelsPriced reports whether every model the run may use has a known
+// price.
+func modelsPriced() bool {
+	for _, m := range []string{cfg.Model, cfg.CheapModel, cfg.AltModel} {
+		if _, ok := priceFor(m); m != "" && !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// auxPurposes are the extra passes listed separately in the summary.
+var auxPurposes = []string{"subtopics", "bloom", "tags", "difficulty", "prerequisites", "practice", "misconceptions", "alt-explanations", "mnemonics", "fix-code", "missing", "dedup", "readability", "tables", "changelog"}
+
+func (t *usageTracker) add(model, purpose string, u Usage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if purpose != "" {
+		_, seen := t.byPurpose[purpose]
+		t.byPurpose[purpose] += u.TotalTokens
+		if p, ok := priceFor(model); ok {
+			if c, priced := t.purposeCost[purpose]; priced || !seen {
+				t.purposeCost[purpose] = c + p.cost(u)
+			}
+		} else {
+			delete(t.purposeCost, purpose)
+		}
+	}
+	m, ok := t.byModel[model]
+	if !ok {
+		m = &modelUsage{}
+		t.byModel[model] = m
+	}
+	m.Calls++
+	m.PromptTokens += u.PromptTokens
+	m.CompletionTokens += u.CompletionTokens
+	m.TotalTokens += u.TotalTokens
+}
+
+// purposeTokens returns the total tokens spent on calls tagged with purpose.
+func (t *usageTracker) purposeTokens(purpose string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.byPurpose[purpose]
+}
+
+// RunUsage is what a run spent, as the sidecar records it. CostUSD is nil
+// when a model used has no known price.
+type RunUsage struct {
+	Calls int `json:"calls"`
+	Usage
+	CostUSD *float64 `json:"cost_usd,omitempty"`
+}
+
+func (t *usageTracker) runUsage() *RunUsage {
+	sum, cost, priced := t.totals()
+	u := &RunUsage{Calls: sum.Calls, Usage: sum.Usage}
+	if priced {
+		u.CostUSD = &cost
+	}
+	return u
+}
+
+// totals returns the summed usage and, when every model used has a known
+// price, the estimated cost.
+func (t *usageTracker) totals() (sum modelUsage, cost float64, priced bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.totalsLocked()
+}
+
+func (t *usageTracker) totalsLocked() (sum modelUsage, cost float64, priced bool) {
+	priced = true
+	for m, u := range t.byModel {
+		sum.Calls += u.Calls
+		sum.PromptTokens += u.PromptTokens
+		sum.CompletionTokens += u.CompletionTokens
+		sum.TotalTokens += u.TotalTokens
+		if p, ok := priceFor(m); ok {
+			cost += p.cost(u.Usage)
+		} else {
+			priced = false
+		}
+	}
+	return sum, cost, priced
+}
+
+// writeSummary prints calls, tokens and estimated cost per model. When more
+// than one model was used it also compares against running everything on
+// baseline, which is how routing savings are reported.
+func (t *usageTracker) writeSummary(w io.Writer, baseline string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	models := make([]string, 0, len(t.byModel))
+	for m := range t.byModel {
+		models = append(models, m)
+	}
+	sort.Strings(models)
+
+	if len(models) > 1 {
+		for _, m := range models {
+			u := t.byModel[m]
+			line := fmt.Sprintf("   %s: %d calls, %d tokens in / %d out", m, u.Calls, u.PromptTokens, u.CompletionTokens)
+			if p, ok := priceFor(m); ok {
+				line += fmt.Sprintf(" (≈ $%.4f)", p.cost(u.Usage))
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+
+	for _, p := range auxPurposes {
+		tokens, ok := t.byPurpose[p]
+		if !ok {
+			continue
+		}
+		line := fmt.Sprintf("   %s pass: %d tokens", p, tokens)
+		if c, ok := t.purposeCost[p]; ok {
+			line += fmt.Sprintf(" (≈ $%.4f)", c)
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	sum, cost, priced := t.totalsLocked()
+	fmt.Fprintf(w, "-> Usage: %d calls, %d tokens in / %d out\n", sum.Calls, sum.PromptTokens, sum.CompletionTokens)
+	if !priced {
+		return
+	}
+	fmt.Fprintf(w, "-> Estimated cost: $%.4f\n", cost)
+
+	if len(models) > 1 {
+		if p, ok := priceFor(baseline); ok {
+			single := p.cost(sum.Usage)
+			fmt.Fprintf(w, "-> Single-model (%s) estimate: $%.4f, saved $%.4f\n", baseline, single, single-cost)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// VersionInfo links a guide regenerated with --version-of to the version it
+// replaced, which is kept next to it. Following Previous from sidecar to
+// sidecar reconstructs the chain of revisions; PreviousSHA256 tells whether
+// a kept version was edited since.
+type VersionInfo struct {
+	Number         int      `json:"number"`
+	Previous       string   `json:"previous"`
+	PreviousSHA256 string   `json:"previous_sha256"`
+	Added          []string `json:"added,omitempty"`
+	Removed        []string `json:"removed,omitempty"`
+	Revised        []string `json:"revised,omitempty"`
+}
+
+// previousVersion is the guide a --version-of run regenerates.
+type previousVersion struct {
+	path     string
+	md       string
+	sha256   string
+	number   int // 1 for a guide that isn't a revision itself
+	concepts []*guideConcept
+}
+
+func loadPreviousVersion(path string) (*previousVersion, error) {
+	if !strings.HasSuffix(path, ".md") {
+		return nil, fmt.Errorf("%s is not a markdown guide", path)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &previousVersion{path: path, md: string(b), sha256: promptHash(string(b)), number: 1}
+	_, p.concepts = guideConcepts(parseMarkdown(p.md))
+	if len(p.concepts) == 0 {
+		return nil, fmt.Errorf("%s has no numbered concept sections", path)
+	}
+	if sc, err := readSidecar(sidecarPath(path)); err == nil && sc.Version != nil {
+		p.number = sc.Version.Number
+	}
+	if _, err := os.Stat(p.archivePath()); err == nil {
+		return nil, fmt.Errorf("%s already exists; move it before revising %s", p.archivePath(), path)
+	}
+	return p, nil
+}
+
+// archivePath is where the previous version is kept: guide.v<N>.md.
+func (p *previousVersion) archivePath() string {
+	return fmt.Sprintf("%s.v%d.md", strings.TrimSuffix(p.path, ".md"), p.number)
+}
+
+// archive moves the previous version and its sidecar out of the way of the
+// new one, and returns the paths they were moved to.
+func (p *previousVersion) archive() ([]string, error) {
+	dst := p.archivePath()
+	if err := os.Rename(p.path, dst); err != nil {
+		return nil, err
+	}
+	moved := []string{dst}
+	if err := os.Rename(sidecarPath(p.path), sidecarPath(dst)); err == nil {
+		moved = append(moved, sidecarPath(dst))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return moved, err
+	}
+	return moved, nil
+}
+
+// maxConceptChanges bounds how many concepts a revision may add, and how
+// many it may remove.
+func maxConceptChanges(n int) int {
+	return max(2, n/5)
+}
+
+// conceptKey matches a concept across versions, whatever its number.
+func conceptKey(title string) string {
+	return strings.ToLower(strings.TrimSpace(conceptPrefixRe.ReplaceAllString(title, "")))
+}
+
+// reviseConceptList asks the model to revise the previous version's concept
+// list, keeping the changes within maxConceptChanges.
+func reviseConceptList(p *previousVersion) ([]string, error) {
+	old := make([]string, len(p.concepts))
+	for i, c := range p.concepts {
+		old[i] = c.Title
+	}
+	limit := maxConceptChanges(len(old))
+	prompt := fmt.Sprintf(
+		"Here is the concept list of an existing study guide about '%s':\n\n%s\n\n"+
+			"Revise it for a new version of the guide. Keep the concepts that still belong, in their order and with their titles unchanged. "+
+			"Where it makes the guide better, add at most %d new concepts and remove at most %d; aim for about %d concepts in total. "+
+			"Output ONLY the numbered list. Do not add introductions or conclusions. "+
+			"Ensure every line starts with a number followed by a dot.",
+		cfg.Subject, strings.Join(old, "\n"), limit, limit, cfg.TotalCount) + languageInstruction()
+
+	resp, err := callAI(prompt, "You are a helpful assistant that lists concepts concisely.")
+	if err != nil {
+		return nil, err
+	}
+	revised := boundConceptChanges(old, parseConceptList(resp), limit)
+	return renumberConcepts(revised), nil
+}
+
+// boundConceptChanges keeps the first limit concepts revised adds, and puts
+// back the old concepts it removed beyond the first limit, each after the
+// old concept it followed.
+func boundConceptChanges(old, revised []string, limit int) []string {
+	oldKeys := map[string]bool{}
+	for _, c := range old {
+		oldKeys[conceptKey(c)] = true
+	}
+	var out []string
+	var added, dropped int
+	for _, c := range revised {
+		if !oldKeys[conceptKey(c)] {
+			if added++; added > limit {
+				dropped++
+				continue
+			}
+		}
+		out = append(out, c)
+	}
+
+	kept := func(c string) int {
+		return slices.IndexFunc(out, func(o string) bool { return conceptKey(o) == conceptKey(c) })
+	}
+	var removed, restored int
+	for i, c := range old {
+		if kept(c) >= 0 {
+			continue
+		}
+		if removed++; removed <= limit {
+			continue
+		}
+		at := 0
+		for j := i - 1; j >= 0; j-- {
+			if k := kept(old[j]); k >= 0 {
+				at = k + 1
+				break
+			}
+		}
+		out = slices.Insert(out, at, c)
+		restored++
+	}
+	if dropped > 0 || restored > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: the revision changed more than %d concepts each way; dropped %d added and kept %d removed concept(s).\n", limit, dropped, restored)
+	}
+	return out
+}
+
+// changelog is what changed between the previous version and the new one.
+type changelog struct {
+	from     *previousVersion
+	added    []*guideConcept
+	removed  []*guideConcept
+	revised  []*guideConcept
+	comments map[*guideConcept]string // what changed in a revised concept
+}
+
+// diffVersions compares the concepts of the previous version with the new
+// body. Added and removed concepts are found by title; the model judges which
+// of the others were substantially revised.
+func diffVersions(p *previousVersion, body string) *changelog {
+	_, current := guideConcepts(parseMarkdown(body))
+	cl := &changelog{from: p, comments: map[*guideConcept]string{}}
+	before := map[string]*guideConcept{}
+	for _, c := range p.concepts {
+		before[conceptKey(c.Title)] = c
+	}
+	now := map[string]bool{}
+	var pairs [][2]*guideConcept
+	for _, c := range current {
+		now[conceptKey(c.Title)] = true
+		if old, ok := before[conceptKey(c.Title)]; ok {
+			pairs = append(pairs, [2]*guideConcept{old, c})
+		} else {
+			cl.added = append(cl.added, c)
+		}
+	}
+	for _, c := range p.concepts {
+		if !now[conceptKey(c.Title)] {
+			cl.removed = append(cl.removed, c)
+		}
+	}
+	if len(pairs) == 0 {
+		return cl
+	}
+
+	statusf("-> Comparing %d concepts with version %d...\n", len(pairs), p.number)
+	comments, err := judgeRevisions(pairs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not tell which concepts were revised, the changelog only lists added and removed ones: %v\n", err)
+		return cl
+	}
+	for i, pair := range pairs {
+		if comment, ok := comments[i+1]; ok {
+			cl.revised = append(cl.revised, pair[1])
+			cl.comments[pair[1]] = comment
+		}
+	}
+	return cl
+}
+
+var revisionLineRe = regexp.MustCompile(`^\s*\[?(\d+)\]?[.:)]?\s+(.+)$`)
+
+// maxRevisionSummary caps the text sent per concept version.
+const maxRevisionSummary = 600
+
+// judgeRevisions asks which pairs teach substantially different things now,
+// and returns a one-sentence summary per changed pair, by 1-based position.
+func judgeRevisions(pairs [][2]*guideConcept) (map[int]string, error) {
+	var b strings.Builder
+	for i, pair := range pairs {
+		fmt.Fprintf(&b, "[%d] %s\nOLD: %s\nNEW: %s\n\n", i+1, conceptPrefixRe.ReplaceAllString(pair[1].Title, ""),
+			truncateRunes(pair[0].Summary, maxRevisionSummary), truncateRunes(pair[1].Summary, maxRevisionSummary))
+	}
+	prompt := fmt.Sprintf(
+		"Here are the concepts two versions of a study guide about '%s' share, with what each version teaches about them:\n\n%s"+
+			"List the concepts whose new version teaches something substantially different: new or dropped material, changed advice, corrected mistakes. "+
+			"Ignore rewording, reordering and different examples of the same point. "+
+			"Output ONLY one line per such concept in the form \"[<number>] <one sentence on what changed>\", using the numbers above, "+
+			"or NONE when no concept changed substantially.",
+		cfg.Subject, b.String()) + languageInstruction()
+	resp, err := callAIWith(callOptions{Model: auxModel(), Temperature: 0, Purpose: "changelog"}, prompt,
+		"You compare versions of study guides and report only substantive changes.")
+	if err != nil {
+		return nil, err
+	}
+	comments := map[int]string{}
+	for _, line := range strings.Split(resp, "\n") {
+		m := revisionLineRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if n, err := strconv.Atoi(m[1]); err == nil && n >= 1 && n <= len(pairs) {
+			comments[n] = strings.TrimSpace(m[2])
+		}
+	}
+	return comments, nil
+}
+
+// info is the sidecar's record of this version.
+func (cl *changelog) info() *VersionInfo {
+	v := &VersionInfo{Number: cl.from.number + 1, Previous: filepath.Base(cl.from.archivePath()), PreviousSHA256: cl.from.sha256}
+	for _, c := range cl.added {
+		v.Added = append(v.Added, conceptPrefixRe.ReplaceAllString(c.Title, ""))
+	}
+	for _, c := range cl.removed {
+		v.Removed = append(v.Removed, conceptPrefixRe.ReplaceAllString(c.Title, ""))
+	}
+	for _, c := range cl.revised {
+		v.Revised = append(v.Revised, conceptPrefixRe.ReplaceAllString(c.Title, ""))
+	}
+	return v
+}
+
+// write appends the Changelog section. Added and revised concepts link to
+// their sections; removed ones link to the kept previous version.
+func (cl *changelog) write(w io.Writer) {
+	lang := outputLanguage()
+	prev := filepath.Base(cl.from.archivePath())
+	fmt.Fprintf(w, "\n---\n\n## %s\n\n*v%d → v%d · [%s](%s)*\n\n", lang.changelog, cl.from.number, cl.from.number+1, prev, prev)
+	if len(cl.added) > 0 {
+		fmt.Fprintf(w, "### %s\n\n", lang.added)
+		for _, c := range cl.added {
+			fmt.Fprintf(w, "- [%s](#%s)\n", c.Title, c.Anchor)
+		}
+		fmt.Fprintln(w)
+	}
+	if len(cl.removed) > 0 {
+		fmt.Fprintf(w, "### %s\n\n", lang.removed)
+		for _, c := range cl.removed {
+			fmt.Fprintf(w, "- [%s](%s#%s)\n", conceptPrefixRe.ReplaceAllString(c.Title, ""), prev, c.Anchor)
+		}
+		fmt.Fprintln(w)
+	}
+	if len(cl.revised) > 0 {
+		fmt.Fprintf(w, "### %s\n\n", lang.revised)
+		for _, c := range cl.revised {
+			fmt.Fprintf(w, "- [%s](#%s): %s\n", c.Title, c.Anchor, cl.comments[c])
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type webhookPayload struct {
+	Subject       string   `json:"subject"`
+	Status        string   `json:"status"`
+	Stage         string   `json:"stage,omitempty"`
+	Outputs       []string `json:"outputs"`
+	Succeeded     int      `json:"succeeded_sections"`
+	Failed        int      `json:"failed_sections"`
+	DurationSec   float64  `json:"duration_seconds"`
+	Model         string   `json:"model"`
+	Calls         int      `json:"calls"`
+	PromptTokens  int      `json:"prompt_tokens"`
+	OutputTokens  int      `json:"completion_tokens"`
+	EstimatedCost *float64 `json:"estimated_cost_usd,omitempty"`
+}
+
+const webhookAttempts = 3
+
+// sendWebhook POSTs the run outcome to --webhook, retrying a couple of times
+// before giving up. The body is signed with HMAC-SHA256 when a secret is set.
+func sendWebhook(o runOutcome) error {
+	if cfg.Webhook == "" {
+		return nil
+	}
+
+	sum, cost, priced := usage.totals()
+	p := webhookPayload{
+		Subject:      cfg.Subject,
+		Status:       o.Status,
+		Stage:        o.Stage,
+		Outputs:      o.Outputs,
+		Succeeded:    o.Succeeded,
+		Failed:       o.Failed,
+		DurationSec:  o.Duration.Round(time.Millisecond).Seconds(),
+		Model:        cfg.Model,
+		Calls:        sum.Calls,
+		PromptTokens: sum.PromptTokens,
+		OutputTokens: sum.CompletionTokens,
+	}
+	if p.Outputs == nil {
+		p.Outputs = []string{}
+	}
+	if priced {
+		p.EstimatedCost = &cost
+	}
+
+	var body []byte
+	var err error
+	if cfg.WebhookFormat == "slack" {
+		body, err = json.Marshal(map[string]string{"text": slackText(p)})
+	} else {
+		body, err = json.Marshal(p)
+	}
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	for attempt := 1; ; attempt++ {
+		err = postWebhook(client, body)
+		if err == nil {
+			return nil
+		}
+		if attempt == webhookAttempts {
+			return fmt.Errorf("webhook delivery failed after %d attempts: %w", attempt, err)
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+func postWebhook(client *http.Client, body []byte) error {
+	req, err := http.NewRequest("POST", cfg.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "aiguide/"+version)
+	if cfg.WebhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(cfg.WebhookSecret))
+		mac.Write(body)
+		req.Header.Set("X-Aiguide-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func slackText(p webhookPayload) string {
+	var b strings.Builder
+	switch p.Status {
+	case statusFailed:
+		fmt.Fprintf(&b, ":x: *aiguide* failed for _%s_: %s", p.Subject, p.Stage)
+	case statusPartial:
+		fmt.Fprintf(&b, ":warning: *aiguide* finished _%s_ with %d failed sections", p.Subject, p.Failed)
+	default:
+		fmt.Fprintf(&b, ":white_check_mark: *aiguide* finished _%s_", p.Subject)
+	}
+	fmt.Fprintf(&b, "\n%d sections in %.0fs with %s", p.Succeeded+p.Failed, p.DurationSec, p.Model)
+	if p.EstimatedCost != nil {
+		fmt.Fprintf(&b, " (≈ $%.4f)", *p.EstimatedCost)
+	}
+	for _, out := range p.Outputs {
+		fmt.Fprintf(&b, "\n`%s`", out)
+	}
+	return b.String()
+}
+
+func validateWebhookFlags() {
+	if cfg.Webhook == "" {
+		cfg.Webhook = os.Getenv("AIGUIDE_WEBHOOK")
+	}
+	if cfg.WebhookFormat != "json" && cfg.WebhookFormat != "slack" {
+		fmt.Fprintf(os.Stderr, "Error: invalid --webhook-format %q (expected json or slack)\n", cfg.WebhookFormat)
+		os.Exit(1)
+	}
+}